@@ -60,7 +60,7 @@ func (p *PostgresDB) prepareStatements() error {
 
 	// Get active sale statement
 	p.getActiveSaleStmt, err = p.db.Prepare(`
-		SELECT id, start_time, end_time, items_available, items_sold, active, created_at, updated_at 
+		SELECT id, start_time, end_time, items_available, items_sold, max_per_user, active, created_at, updated_at 
 		FROM sales 
 		WHERE active = true 
 		ORDER BY start_time DESC 
@@ -129,18 +129,28 @@ func (p *PostgresDB) Stats() sql.DBStats {
 // Sale operations
 func (p *PostgresDB) CreateSale(ctx context.Context, sale *models.Sale) error {
 	query := `
-		INSERT INTO sales (start_time, end_time, items_available, items_sold, active, created_at) 
-		VALUES ($1, $2, $3, $4, $5, NOW()) 
+		INSERT INTO sales (start_time, end_time, items_available, items_sold, max_per_user, active, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, NOW()) 
 		RETURNING id, created_at`
 
-	err := p.db.QueryRowContext(ctx, query,
-		sale.StartTime, sale.EndTime, sale.ItemsAvailable, sale.ItemsSold, sale.Active).
+	tx, err := p.beginFenced(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query,
+		sale.StartTime, sale.EndTime, sale.ItemsAvailable, sale.ItemsSold, sale.MaxPerUser, sale.Active).
 		Scan(&sale.ID, &sale.CreatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create sale: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sale: %w", err)
+	}
+
 	return nil
 }
 
@@ -149,7 +159,7 @@ func (p *PostgresDB) GetActiveSale(ctx context.Context) (*models.Sale, error) {
 
 	err := p.getActiveSaleStmt.QueryRowContext(ctx).Scan(
 		&sale.ID, &sale.StartTime, &sale.EndTime, &sale.ItemsAvailable,
-		&sale.ItemsSold, &sale.Active, &sale.CreatedAt, &sale.UpdatedAt)
+		&sale.ItemsSold, &sale.MaxPerUser, &sale.Active, &sale.CreatedAt, &sale.UpdatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -163,14 +173,14 @@ func (p *PostgresDB) GetActiveSale(ctx context.Context) (*models.Sale, error) {
 
 func (p *PostgresDB) GetSaleByID(ctx context.Context, id int) (*models.Sale, error) {
 	query := `
-		SELECT id, start_time, end_time, items_available, items_sold, active, created_at, updated_at 
+		SELECT id, start_time, end_time, items_available, items_sold, max_per_user, active, created_at, updated_at 
 		FROM sales 
 		WHERE id = $1`
 
 	sale := &models.Sale{}
 	err := p.db.QueryRowContext(ctx, query, id).Scan(
 		&sale.ID, &sale.StartTime, &sale.EndTime, &sale.ItemsAvailable,
-		&sale.ItemsSold, &sale.Active, &sale.CreatedAt, &sale.UpdatedAt)
+		&sale.ItemsSold, &sale.MaxPerUser, &sale.Active, &sale.CreatedAt, &sale.UpdatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -182,6 +192,37 @@ func (p *PostgresDB) GetSaleByID(ctx context.Context, id int) (*models.Sale, err
 	return sale, nil
 }
 
+func (p *PostgresDB) ListSales(ctx context.Context, limit int) ([]models.Sale, error) {
+	query := `
+		SELECT id, start_time, end_time, items_available, items_sold, max_per_user, active, created_at, updated_at 
+		FROM sales 
+		ORDER BY start_time DESC 
+		LIMIT $1`
+
+	rows, err := p.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sales: %w", err)
+	}
+	defer rows.Close()
+
+	var sales []models.Sale
+	for rows.Next() {
+		var sale models.Sale
+		if err := rows.Scan(
+			&sale.ID, &sale.StartTime, &sale.EndTime, &sale.ItemsAvailable,
+			&sale.ItemsSold, &sale.MaxPerUser, &sale.Active, &sale.CreatedAt, &sale.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sale: %w", err)
+		}
+		sales = append(sales, sale)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sales: %w", err)
+	}
+
+	return sales, nil
+}
+
 func (p *PostgresDB) UpdateSaleItemsSold(ctx context.Context, saleID int, itemsSold int) error {
 	query := `UPDATE sales SET items_sold = $1 WHERE id = $2`
 
@@ -202,10 +243,66 @@ func (p *PostgresDB) UpdateSaleItemsSold(ctx context.Context, saleID int, itemsS
 	return nil
 }
 
+func (p *PostgresDB) UpdateSaleEndTime(ctx context.Context, saleID int, endTime time.Time) error {
+	query := `UPDATE sales SET end_time = $1 WHERE id = $2`
+
+	result, err := p.db.ExecContext(ctx, query, endTime, saleID)
+	if err != nil {
+		return fmt.Errorf("failed to update sale end time: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("sale with ID %d not found", saleID)
+	}
+
+	return nil
+}
+
+func (p *PostgresDB) ActivateSale(ctx context.Context, saleID int) error {
+	query := `UPDATE sales SET active = true WHERE id = $1`
+
+	tx, err := p.beginFenced(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, saleID)
+	if err != nil {
+		return fmt.Errorf("failed to activate sale: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("sale with ID %d not found", saleID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sale: %w", err)
+	}
+
+	return nil
+}
+
 func (p *PostgresDB) DeactivateSale(ctx context.Context, saleID int) error {
 	query := `UPDATE sales SET active = false WHERE id = $1`
 
-	result, err := p.db.ExecContext(ctx, query, saleID)
+	tx, err := p.beginFenced(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, saleID)
 	if err != nil {
 		return fmt.Errorf("failed to deactivate sale: %w", err)
 	}
@@ -219,9 +316,305 @@ func (p *PostgresDB) DeactivateSale(ctx context.Context, saleID int) error {
 		return fmt.Errorf("sale with ID %d not found", saleID)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sale: %w", err)
+	}
+
+	return nil
+}
+
+// Item catalog operations
+func (p *PostgresDB) GetItemByID(ctx context.Context, itemID string) (*models.Item, error) {
+	query := `
+		SELECT id, name, description, price_minor, price_currency, created_at, retired_at 
+		FROM items 
+		WHERE id = $1`
+
+	item := &models.Item{}
+	err := p.db.QueryRowContext(ctx, query, itemID).Scan(
+		&item.ID, &item.Name, &item.Description, &item.Price.Amount, &item.Price.Currency, &item.CreatedAt, &item.RetiredAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Item not in catalog
+		}
+		return nil, fmt.Errorf("failed to get item by ID: %w", err)
+	}
+
+	return item, nil
+}
+
+func (p *PostgresDB) ListItems(ctx context.Context, includeRetired bool) ([]models.Item, error) {
+	query := `
+		SELECT id, name, description, price_minor, price_currency, created_at, retired_at 
+		FROM items 
+		WHERE $1 OR retired_at IS NULL 
+		ORDER BY id`
+
+	rows, err := p.db.QueryContext(ctx, query, includeRetired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.Item
+	for rows.Next() {
+		var item models.Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price.Amount, &item.Price.Currency, &item.CreatedAt, &item.RetiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate items: %w", err)
+	}
+
+	return items, nil
+}
+
+// CreateItems adds items to the catalog in one transaction. Items whose ID is already
+// in the catalog are left unchanged, so every instance agrees on the first version stored.
+func (p *PostgresDB) CreateItems(ctx context.Context, items []models.Item) (int, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO items (id, name, description, price_minor, price_currency, created_at) 
+		VALUES ($1, $2, $3, $4, $5, NOW()) 
+		ON CONFLICT (id) DO NOTHING`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare item insert: %w", err)
+	}
+	defer stmt.Close()
+
+	created := 0
+	for i := range items {
+		result, err := stmt.ExecContext(ctx, items[i].ID, items[i].Name, items[i].Description, items[i].Price.Amount, items[i].Price.Currency)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create item %s: %w", items[i].ID, err)
+		}
+		if rows, err := result.RowsAffected(); err == nil {
+			created += int(rows)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit items: %w", err)
+	}
+
+	return created, nil
+}
+
+func (p *PostgresDB) UpdateItem(ctx context.Context, item *models.Item) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE items 
+		SET name = $2, description = $3, price_minor = $4, price_currency = $5 
+		WHERE id = $1 
+		AND ((price_minor = $4 AND price_currency = $5) OR ` + itemPriceUnlocked + `)`
+
+	result, err := tx.ExecContext(ctx, query, item.ID, item.Name, item.Description, item.Price.Amount, item.Price.Currency)
+	if err != nil {
+		return false, fmt.Errorf("failed to update item: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		found, err := itemExists(ctx, tx, item.ID)
+		if err != nil || !found {
+			return false, err
+		}
+		return true, fmt.Errorf("%w: %s", interfaces.ErrItemPriceLocked, item.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit item update: %w", err)
+	}
+
+	return true, nil
+}
+
+// itemPriceUnlocked matches catalog items that cannot be bought in an active sale. An
+// active sale with no per-item allocations sells every item.
+const itemPriceUnlocked = `NOT EXISTS (
+			SELECT 1 FROM sales s 
+			WHERE s.active = true 
+			AND (EXISTS (SELECT 1 FROM sale_items si WHERE si.sale_id = s.id AND si.item_id = items.id) 
+				OR NOT EXISTS (SELECT 1 FROM sale_items si WHERE si.sale_id = s.id)))`
+
+// itemExists reports whether the item is in the catalog
+func itemExists(ctx context.Context, tx *sql.Tx, itemID string) (bool, error) {
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM items WHERE id = $1)`, itemID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check item %s: %w", itemID, err)
+	}
+	return exists, nil
+}
+
+// UpdateItemPrices sets the price of several items in one transaction; if any item is
+// missing from the catalog or its price is locked by the active sale, no price is changed
+func (p *PostgresDB) UpdateItemPrices(ctx context.Context, prices []models.ItemPrice) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		UPDATE items SET price_minor = $2, price_currency = $3 
+		WHERE id = $1 
+		AND ((price_minor = $2 AND price_currency = $3) OR `+itemPriceUnlocked+`)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare item price update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, price := range prices {
+		result, err := stmt.ExecContext(ctx, price.ItemID, price.Price.Amount, price.Price.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to update price of item %s: %w", price.ItemID, err)
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			found, err := itemExists(ctx, tx, price.ItemID)
+			if err != nil {
+				return err
+			}
+			if found {
+				return fmt.Errorf("%w: %s", interfaces.ErrItemPriceLocked, price.ItemID)
+			}
+			return fmt.Errorf("item %s not found", price.ItemID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit item prices: %w", err)
+	}
+
+	return nil
+}
+
+// RetireItem marks an item as retired; retiring a retired item keeps its first retirement time
+func (p *PostgresDB) RetireItem(ctx context.Context, itemID string) (bool, error) {
+	query := `
+		UPDATE items 
+		SET retired_at = COALESCE(retired_at, NOW()) 
+		WHERE id = $1`
+
+	result, err := p.db.ExecContext(ctx, query, itemID)
+	if err != nil {
+		return false, fmt.Errorf("failed to retire item: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Sale item operations
+func (p *PostgresDB) CreateSaleItems(ctx context.Context, saleID int, items []models.SaleItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := p.beginFenced(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO sale_items (sale_id, item_id, stock, sold, created_at) 
+		VALUES ($1, $2, $3, 0, NOW()) 
+		RETURNING created_at`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare sale item insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i := range items {
+		items[i].SaleID = saleID
+		if err := stmt.QueryRowContext(ctx, saleID, items[i].ItemID, items[i].Stock).Scan(&items[i].CreatedAt); err != nil {
+			return fmt.Errorf("failed to create sale item %s: %w", items[i].ItemID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sale items: %w", err)
+	}
+
 	return nil
 }
 
+func (p *PostgresDB) GetSaleItems(ctx context.Context, saleID int) ([]models.SaleItem, error) {
+	query := `
+		SELECT sale_id, item_id, stock, sold, created_at, updated_at 
+		FROM sale_items 
+		WHERE sale_id = $1 
+		ORDER BY item_id`
+
+	rows, err := p.db.QueryContext(ctx, query, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sale items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.SaleItem
+	for rows.Next() {
+		var item models.SaleItem
+		if err := rows.Scan(&item.SaleID, &item.ItemID, &item.Stock, &item.Sold, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sale item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sale items: %w", err)
+	}
+
+	return items, nil
+}
+
+// UpdateSaleItemStock changes the stock allocated to an item in a sale.
+// Stock below the units already sold is rejected by the sale_items constraints.
+func (p *PostgresDB) UpdateSaleItemStock(ctx context.Context, saleID int, itemID string, stock int) (bool, error) {
+	query := `
+		UPDATE sale_items 
+		SET stock = $3 
+		WHERE sale_id = $1 AND item_id = $2`
+
+	result, err := p.db.ExecContext(ctx, query, saleID, itemID, stock)
+	if err != nil {
+		return false, fmt.Errorf("failed to update sale item stock: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
 // Checkout operations
 func (p *PostgresDB) CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error {
 	err := p.createCheckoutAttemptStmt.QueryRowContext(ctx,
@@ -270,6 +663,44 @@ func (p *PostgresDB) UpdateCheckoutAttemptPurchased(ctx context.Context, code st
 	return nil
 }
 
+// ExpireCheckoutAttempts marks up to limit pending checkout attempts that expired by now
+// as expired and returns their codes. Rows locked by another sweeper are skipped, so
+// concurrent sweepers never expire the same attempt twice.
+func (p *PostgresDB) ExpireCheckoutAttempts(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	query := `
+		UPDATE checkout_attempts 
+		SET status = 'expired', updated_at = NOW() 
+		WHERE id IN (
+			SELECT id FROM checkout_attempts 
+			WHERE status = 'pending' AND purchased = false AND expires_at <= $1 
+			ORDER BY expires_at 
+			LIMIT $2 
+			FOR UPDATE SKIP LOCKED
+		) 
+		RETURNING code`
+
+	rows, err := p.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire checkout attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("failed to scan expired checkout code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire checkout attempts: %w", err)
+	}
+
+	return codes, nil
+}
+
 // Transaction support
 func (p *PostgresDB) BeginTx(ctx context.Context) (interfaces.TxInterface, error) {
 	tx, err := p.db.BeginTx(ctx, nil)
@@ -297,13 +728,13 @@ func (p *PostgresDB) GetCheckoutByCode(ctx context.Context, code string) (*model
 // CreatePurchase creates a new purchase record
 func (p *PostgresDB) CreatePurchase(ctx context.Context, purchase *models.Purchase) error {
 	query := `
-		INSERT INTO purchases (sale_id, user_id, item_id, code, checkout_id, price, status, purchased_at, created_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW()) 
+		INSERT INTO purchases (sale_id, user_id, item_id, code, checkout_id, price_minor, price_currency, status, purchased_at, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW()) 
 		RETURNING id, created_at`
 
 	err := p.db.QueryRowContext(ctx, query,
 		purchase.SaleID, purchase.UserID, purchase.ItemID, purchase.Code,
-		purchase.CheckoutID, purchase.Price, purchase.Status, purchase.PurchasedAt).
+		purchase.CheckoutID, purchase.Price.Amount, purchase.Price.Currency, purchase.Status, purchase.PurchasedAt).
 		Scan(&purchase.ID, &purchase.CreatedAt)
 
 	if err != nil {
@@ -328,43 +759,691 @@ func (p *PostgresDB) UpdateCheckout(ctx context.Context, checkout *models.Checko
 	return nil
 }
 
-// PostgresTx implements TxInterface
-type PostgresTx struct {
-	tx *sql.Tx
-}
+// GetPurchaseCounts counts a sale's completed purchases in total, per item and per user
+func (p *PostgresDB) GetPurchaseCounts(ctx context.Context, saleID int) (*interfaces.PurchaseCounts, error) {
+	query := `
+		SELECT item_id, user_id, COUNT(*) FILTER (WHERE status = 'completed')
+		FROM purchases
+		WHERE sale_id = $1
+		GROUP BY item_id, user_id`
 
-func (t *PostgresTx) Commit() error {
-	return t.tx.Commit()
+	rows, err := p.db.QueryContext(ctx, query, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count purchases: %w", err)
+	}
+	defer rows.Close()
+
+	counts := &interfaces.PurchaseCounts{
+		ByItem: make(map[string]int),
+		ByUser: make(map[string]int),
+	}
+	for rows.Next() {
+		var itemID, userID string
+		var count int
+		if err := rows.Scan(&itemID, &userID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan purchase count: %w", err)
+		}
+		counts.Total += count
+		counts.ByItem[itemID] += count
+		counts.ByUser[userID] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count purchases: %w", err)
+	}
+
+	return counts, nil
 }
 
-func (t *PostgresTx) Rollback() error {
-	return t.tx.Rollback()
+// PersistEvents applies a batch of write-behind events in one transaction, in order.
+// Inserts are keyed by checkout code, so redelivered events are no-ops: a purchase only
+// marks its checkout used and counts towards the sale the first time it is inserted.
+func (p *PostgresDB) PersistEvents(ctx context.Context, events []interfaces.PersistenceEvent) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	for _, event := range events {
+		switch {
+		case event.Type == interfaces.PersistCheckout && event.Checkout != nil:
+			err = persistCheckoutEvent(ctx, tx, event.Checkout)
+		case event.Type == interfaces.PersistPurchase && event.Purchase != nil:
+			err = persistPurchaseEvent(ctx, tx, event.Purchase)
+		default:
+			err = fmt.Errorf("unknown persistence event type %q", event.Type)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to persist event %s: %w", event.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit persistence batch: %w", err)
+	}
+
+	return nil
 }
 
-func (t *PostgresTx) CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error {
+// persistCheckoutEvent inserts a checkout attempt unless its code is already recorded.
+// A checkout whose purchase was persisted first, as a redelivered checkout can be, is
+// inserted as used and linked to the purchase, so the expiry sweeper leaves it alone.
+func persistCheckoutEvent(ctx context.Context, tx *sql.Tx, checkout *models.CheckoutAttempt) error {
 	query := `
-		INSERT INTO checkout_attempts (sale_id, user_id, item_id, code, status, expires_at, created_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, NOW()) 
-		RETURNING id, created_at`
+		INSERT INTO checkout_attempts (sale_id, user_id, item_id, code, status, purchased, expires_at, created_at) 
+		VALUES ($1, $2, $3, $4,
+			CASE WHEN EXISTS (SELECT 1 FROM purchases WHERE code = $4) THEN 'used' ELSE $5 END,
+			EXISTS (SELECT 1 FROM purchases WHERE code = $4), $6, $7) 
+		ON CONFLICT (code) DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, query,
+		checkout.SaleID, checkout.UserID, checkout.ItemID, checkout.Code, checkout.Status, checkout.ExpiresAt, checkout.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert checkout attempt: %w", err)
+	}
 
-	err := t.tx.QueryRowContext(ctx, query,
-		attempt.SaleID, attempt.UserID, attempt.ItemID, attempt.Code, attempt.Status, attempt.ExpiresAt).
-		Scan(&attempt.ID, &attempt.CreatedAt)
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 
+	if inserted == 0 {
+		return nil // Already persisted
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE purchases SET checkout_id = c.id 
+		FROM checkout_attempts c 
+		WHERE c.code = $1 AND purchases.code = $1 AND purchases.checkout_id IS NULL`, checkout.Code)
 	if err != nil {
-		return fmt.Errorf("failed to create checkout attempt in transaction: %w", err)
+		return fmt.Errorf("failed to link purchase to checkout: %w", err)
 	}
 
 	return nil
 }
 
-func (t *PostgresTx) GetCheckoutAttemptByCode(ctx context.Context, code string) (*models.CheckoutAttempt, error) {
+// persistPurchaseEvent inserts a purchase unless its code is already recorded, and on
+// first insert marks the checkout used and adds the purchase to the sale counters
+func persistPurchaseEvent(ctx context.Context, tx *sql.Tx, purchase *models.Purchase) error {
 	query := `
-		SELECT id, sale_id, user_id, item_id, code, status, expires_at, purchased, created_at, updated_at 
-		FROM checkout_attempts 
-		WHERE code = $1 FOR UPDATE`
+		INSERT INTO purchases (sale_id, user_id, item_id, code, checkout_id, price_minor, price_currency, status, purchased_at, created_at) 
+		VALUES ($1, $2, $3, $4, (SELECT id FROM checkout_attempts WHERE code = $4), $5, $6, $7, $8, NOW()) 
+		ON CONFLICT (code) DO NOTHING`
 
-	attempt := &models.CheckoutAttempt{}
+	result, err := tx.ExecContext(ctx, query,
+		purchase.SaleID, purchase.UserID, purchase.ItemID, purchase.Code, purchase.Price.Amount, purchase.Price.Currency, purchase.Status, purchase.PurchasedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert purchase: %w", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if inserted == 0 {
+		return nil // Already persisted
+	}
+
+	updates := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE checkout_attempts SET status = 'used', purchased = true, updated_at = NOW() WHERE code = $1`, []interface{}{purchase.Code}},
+		{`UPDATE sales SET items_sold = items_sold + 1 WHERE id = $1`, []interface{}{purchase.SaleID}},
+		{`UPDATE sale_items SET sold = sold + 1 WHERE sale_id = $1 AND item_id = $2`, []interface{}{purchase.SaleID, purchase.ItemID}},
+	}
+	for _, update := range updates {
+		if _, err := tx.ExecContext(ctx, update.query, update.args...); err != nil {
+			return fmt.Errorf("failed to apply purchase: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AttemptPurchase enforces the same limits as the Redis purchase script, for use while
+// Redis is unavailable. The sale row is locked for the whole check, so attempts on a sale
+// run one at a time. A successful attempt adds the purchase to the sale counters and marks
+// the checkout code used; the caller still records the purchase row.
+func (p *PostgresDB) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) (*interfaces.PurchaseResult, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	result := &interfaces.PurchaseResult{ItemID: itemID}
+
+	// 1. Lock the sale
+	var active, fallback bool
+	var itemsSold, itemsAvailable, maxPerUser int
+	err = tx.QueryRowContext(ctx, `
+		SELECT active, purchase_fallback, items_sold, items_available, max_per_user
+		FROM sales
+		WHERE id = $1 FOR UPDATE`, saleID).
+		Scan(&active, &fallback, &itemsSold, &itemsAvailable, &maxPerUser)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to lock sale %d: %w", saleID, err)
+	}
+	if err == sql.ErrNoRows || !active {
+		result.Status = interfaces.PurchaseSaleNotActive
+		return result, nil
+	}
+	if !fallback {
+		// The sale moved back to Redis while this attempt waited for the lock
+		result.Status = interfaces.PurchaseSaleRebuilding
+		return result, nil
+	}
+	result.TotalSold = itemsSold
+
+	// 2. Count the user's purchases; a code is marked used as soon as its purchase is claimed,
+	// and stops counting once the purchase is refunded or cancelled
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM checkout_attempts c
+		WHERE c.sale_id = $1 AND c.user_id = $2 AND c.status = 'used'
+		  AND NOT EXISTS (
+			SELECT 1 FROM purchases p WHERE p.code = c.code AND p.status <> 'completed'
+		  )`, saleID, userID).
+		Scan(&result.UserPurchases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count user purchases: %w", err)
+	}
+
+	// 3. Reject replayed or racing checkout codes
+	var codeStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status
+		FROM checkout_attempts
+		WHERE code = $1 AND sale_id = $2 FOR UPDATE`, code, saleID).
+		Scan(&codeStatus)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("checkout code %s not found for sale %d", code, saleID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock checkout code: %w", err)
+	}
+	if codeStatus != "pending" {
+		result.Status = interfaces.PurchaseCodeAlreadyUsed
+		return result, nil
+	}
+
+	// 4. Check per-item stock when the sale has item allocations
+	var stock, sold int
+	err = tx.QueryRowContext(ctx, `
+		SELECT stock, sold
+		FROM sale_items
+		WHERE sale_id = $1 AND item_id = $2 FOR UPDATE`, saleID, itemID).
+		Scan(&stock, &sold)
+	itemRestricted := err == nil
+	if err == sql.ErrNoRows {
+		var hasItems bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM sale_items WHERE sale_id = $1)`, saleID).Scan(&hasItems); err != nil {
+			return nil, fmt.Errorf("failed to get sale items: %w", err)
+		}
+		if hasItems {
+			result.Status = interfaces.PurchaseItemNotInSale
+			return result, nil
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock sale item: %w", err)
+	}
+	if itemRestricted && sold >= stock {
+		result.Status = interfaces.PurchaseItemSoldOut
+		return result, nil
+	}
+
+	// 5. Check global inventory limit
+	if itemsSold >= itemsAvailable {
+		result.Status = interfaces.PurchaseSaleSoldOut
+		return result, nil
+	}
+
+	// 6. Check user purchase limit
+	if result.UserPurchases >= maxPerUser {
+		result.Status = interfaces.PurchaseUserLimitExceeded
+		return result, nil
+	}
+
+	// 7. Claim the unit and consume the code
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sales SET items_sold = items_sold + 1 WHERE id = $1`, saleID); err != nil {
+		return nil, fmt.Errorf("failed to increment sale items sold: %w", err)
+	}
+
+	if itemRestricted {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE sale_items SET sold = sold + 1 WHERE sale_id = $1 AND item_id = $2`, saleID, itemID); err != nil {
+			return nil, fmt.Errorf("failed to increment sale item sold: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE checkout_attempts SET status = 'used', updated_at = NOW() WHERE code = $1`, code); err != nil {
+		return nil, fmt.Errorf("failed to consume checkout code: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	result.Status = interfaces.PurchaseSuccess
+	result.TotalSold = itemsSold + 1
+	result.UserPurchases++
+	result.DatabaseCounted = true
+	return result, nil
+}
+
+// RevertPurchase undoes a successful AttemptPurchase whose purchase was never recorded.
+// It does nothing if the code is not held by an unrecorded claim, so it is safe to repeat.
+func (p *PostgresDB) RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE checkout_attempts
+		SET status = 'pending', updated_at = NOW()
+		WHERE code = $1 AND sale_id = $2 AND status = 'used' AND purchased = false`, code, saleID)
+	if err != nil {
+		return fmt.Errorf("failed to release checkout code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil // Nothing claimed
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sales SET items_sold = items_sold - 1 WHERE id = $1 AND items_sold > 0`, saleID); err != nil {
+		return fmt.Errorf("failed to decrement sale items sold: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sale_items SET sold = sold - 1 WHERE sale_id = $1 AND item_id = $2 AND sold > 0`, saleID, itemID); err != nil {
+		return fmt.Errorf("failed to decrement sale item sold: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetPurchaseFallback reports whether the sale's purchase limits are enforced in Postgres
+func (p *PostgresDB) GetPurchaseFallback(ctx context.Context, saleID int) (bool, error) {
+	var fallback bool
+	err := p.db.QueryRowContext(ctx, `SELECT purchase_fallback FROM sales WHERE id = $1`, saleID).Scan(&fallback)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get purchase fallback of sale %d: %w", saleID, err)
+	}
+
+	return fallback, nil
+}
+
+// BeginPurchaseFallback moves the sale's purchase limits to Postgres for every replica.
+// The update waits for purchases counted in Redis that are still being recorded, which
+// hold the sale row through EnsureRedisLimits; any recorded later are refused.
+func (p *PostgresDB) BeginPurchaseFallback(ctx context.Context, saleID int) (bool, error) {
+	result, err := p.db.ExecContext(ctx,
+		`UPDATE sales SET purchase_fallback = true WHERE id = $1 AND NOT purchase_fallback`, saleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to move sale %d purchases to Postgres: %w", saleID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// EndPurchaseFallback moves the sale's purchase limits back to Redis. The sale is locked
+// while restore writes the counters to Redis, so no Postgres purchase is missed.
+func (p *PostgresDB) EndPurchaseFallback(ctx context.Context, saleID int, restore func(*interfaces.SaleCounters) error) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	// 1. Lock the sale against Postgres purchases
+	counters := &interfaces.SaleCounters{
+		ItemStock:  make(map[string]int),
+		UserCounts: make(map[string]int),
+	}
+	var fallback bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT purchase_fallback, items_sold, items_available, max_per_user
+		FROM sales
+		WHERE id = $1 FOR UPDATE`, saleID).
+		Scan(&fallback, &counters.Sold, &counters.ItemsAvailable, &counters.MaxPerUser)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock sale %d: %w", saleID, err)
+	}
+	if !fallback {
+		return false, nil
+	}
+
+	// 2. Read the counters exactly as AttemptPurchase enforces them
+	rows, err := tx.QueryContext(ctx, `SELECT item_id, stock - sold FROM sale_items WHERE sale_id = $1`, saleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get sale item stock: %w", err)
+	}
+	for rows.Next() {
+		var itemID string
+		var remaining int
+		if err := rows.Scan(&itemID, &remaining); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan sale item stock: %w", err)
+		}
+		counters.ItemStock[itemID] = remaining
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to get sale item stock: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT c.user_id, COUNT(*) FILTER (WHERE p.code IS NULL)
+		FROM checkout_attempts c
+		LEFT JOIN purchases p ON p.code = c.code AND p.status <> 'completed'
+		WHERE c.sale_id = $1 AND c.status = 'used'
+		GROUP BY c.user_id`, saleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to count user purchases: %w", err)
+	}
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan user purchase count: %w", err)
+		}
+		counters.UserCounts[userID] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to count user purchases: %w", err)
+	}
+
+	// 3. Write the counters to Redis, then hand the sale back to it
+	if err := restore(counters); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE sales SET purchase_fallback = false WHERE id = $1`, saleID); err != nil {
+		return false, fmt.Errorf("failed to move sale %d purchases to Redis: %w", saleID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// CreateSaleWindow schedules a sale window. It returns false without error
+// if a window with the same start and end already exists.
+func (p *PostgresDB) CreateSaleWindow(ctx context.Context, window *models.SaleWindow) (bool, error) {
+	query := `
+		INSERT INTO sale_windows (start_time, end_time, items_available, max_per_user, status, source) 
+		VALUES ($1, $2, $3, $4, $5, $6) 
+		ON CONFLICT (start_time, end_time) DO NOTHING 
+		RETURNING id, created_at, updated_at`
+
+	var itemsAvailable, maxPerUser interface{}
+	if window.ItemsAvailable > 0 {
+		itemsAvailable = window.ItemsAvailable
+	}
+	if window.MaxPerUser > 0 {
+		maxPerUser = window.MaxPerUser
+	}
+
+	if window.Status == "" {
+		window.Status = models.SaleWindowPending
+	}
+
+	tx, err := p.beginFenced(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query,
+		window.StartTime, window.EndTime, itemsAvailable, maxPerUser, window.Status, window.Source).
+		Scan(&window.ID, &window.CreatedAt, &window.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create sale window: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit sale window: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetSaleWindowsByStatus returns the windows in a status, earliest start first
+func (p *PostgresDB) GetSaleWindowsByStatus(ctx context.Context, status string) ([]models.SaleWindow, error) {
+	query := `
+		SELECT id, start_time, end_time, COALESCE(items_available, 0), COALESCE(max_per_user, 0), 
+		       COALESCE(sale_id, 0), status, source, created_at, updated_at 
+		FROM sale_windows 
+		WHERE status = $1 
+		ORDER BY start_time, id`
+
+	rows, err := p.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sale windows: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []models.SaleWindow
+	for rows.Next() {
+		var window models.SaleWindow
+		if err := rows.Scan(
+			&window.ID, &window.StartTime, &window.EndTime, &window.ItemsAvailable, &window.MaxPerUser,
+			&window.SaleID, &window.Status, &window.Source, &window.CreatedAt, &window.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sale window: %w", err)
+		}
+		windows = append(windows, window)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sale windows: %w", err)
+	}
+
+	return windows, nil
+}
+
+// UpdateSaleWindowStatus moves a window to a new status. A saleID of 0 keeps the current sale.
+func (p *PostgresDB) UpdateSaleWindowStatus(ctx context.Context, windowID int, status string, saleID int) error {
+	query := `UPDATE sale_windows SET status = $1, sale_id = COALESCE(NULLIF($2, 0), sale_id) WHERE id = $3`
+
+	tx, err := p.beginFenced(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, status, saleID, windowID)
+	if err != nil {
+		return fmt.Errorf("failed to update sale window: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("sale window with ID %d not found", windowID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sale window: %w", err)
+	}
+
+	return nil
+}
+
+// CancelSaleWindow cancels a window that has not started yet.
+// It returns false if the window does not exist or is no longer pending.
+func (p *PostgresDB) CancelSaleWindow(ctx context.Context, windowID int) (bool, error) {
+	query := `UPDATE sale_windows SET status = 'cancelled' WHERE id = $1 AND status = 'pending'`
+
+	result, err := p.db.ExecContext(ctx, query, windowID)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel sale window: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// AdvanceFencingToken records token as the latest fencing token for name.
+// It returns false if a newer token has already been recorded, meaning the caller's
+// leadership lease was lost and it must stop acting as leader.
+func (p *PostgresDB) AdvanceFencingToken(ctx context.Context, name string, token int64) (bool, error) {
+	query := `
+		INSERT INTO leader_fences (name, token) 
+		VALUES ($1, $2) 
+		ON CONFLICT (name) DO UPDATE SET token = EXCLUDED.token, updated_at = NOW() 
+		WHERE leader_fences.token <= EXCLUDED.token 
+		RETURNING token`
+
+	var current int64
+	err := p.db.QueryRowContext(ctx, query, name, token).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to advance fencing token: %w", err)
+	}
+
+	return true, nil
+}
+
+// beginFenced begins a transaction for a write that must only apply while the fence of ctx,
+// if it has one, is current. The fence row stays share-locked until the transaction ends,
+// so a newer leader cannot advance the token between the check and the commit.
+func (p *PostgresDB) beginFenced(ctx context.Context) (*sql.Tx, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	fence, ok := interfaces.FenceFromContext(ctx)
+	if !ok {
+		return tx, nil
+	}
+
+	var current int64
+	err = tx.QueryRowContext(ctx, `SELECT token FROM leader_fences WHERE name = $1 FOR SHARE`, fence.Name).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to check %s fencing token: %w", fence.Name, err)
+	}
+
+	if err == sql.ErrNoRows || current != fence.Token {
+		tx.Rollback()
+		return nil, fmt.Errorf("%s fencing token %d is no longer current (latest %d): %w",
+			fence.Name, fence.Token, current, interfaces.ErrLeadershipLost)
+	}
+
+	return tx, nil
+}
+
+// CreateAuditEntry records an admin action
+func (p *PostgresDB) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO admin_audit_log (actor, action, sale_id, success, details, created_at) 
+		VALUES ($1, $2, $3, $4, $5, NOW()) 
+		RETURNING id, created_at`
+
+	var saleID, details interface{}
+	if entry.SaleID > 0 {
+		saleID = entry.SaleID
+	}
+	if entry.Details != "" {
+		details = entry.Details
+	}
+
+	err := p.db.QueryRowContext(ctx, query,
+		entry.Actor, entry.Action, saleID, entry.Success, details).
+		Scan(&entry.ID, &entry.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// PostgresTx implements TxInterface
+type PostgresTx struct {
+	tx *sql.Tx
+}
+
+func (t *PostgresTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *PostgresTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func (t *PostgresTx) CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error {
+	query := `
+		INSERT INTO checkout_attempts (sale_id, user_id, item_id, code, status, expires_at, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, NOW()) 
+		RETURNING id, created_at`
+
+	err := t.tx.QueryRowContext(ctx, query,
+		attempt.SaleID, attempt.UserID, attempt.ItemID, attempt.Code, attempt.Status, attempt.ExpiresAt).
+		Scan(&attempt.ID, &attempt.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create checkout attempt in transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (t *PostgresTx) GetCheckoutAttemptByCode(ctx context.Context, code string) (*models.CheckoutAttempt, error) {
+	query := `
+		SELECT id, sale_id, user_id, item_id, code, status, expires_at, purchased, created_at, updated_at 
+		FROM checkout_attempts 
+		WHERE code = $1 FOR UPDATE`
+
+	attempt := &models.CheckoutAttempt{}
 	err := t.tx.QueryRowContext(ctx, query, code).Scan(
 		&attempt.ID, &attempt.SaleID, &attempt.UserID, &attempt.ItemID,
 		&attempt.Code, &attempt.Status, &attempt.ExpiresAt, &attempt.Purchased, &attempt.CreatedAt, &attempt.UpdatedAt)
@@ -402,3 +1481,139 @@ func (t *PostgresTx) UpdateCheckoutAttemptPurchased(ctx context.Context, code st
 	return nil
 }
 
+func (t *PostgresTx) CreatePurchase(ctx context.Context, purchase *models.Purchase) error {
+	query := `
+		INSERT INTO purchases (sale_id, user_id, item_id, code, checkout_id, price_minor, price_currency, status, purchased_at, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW()) 
+		RETURNING id, created_at`
+
+	err := t.tx.QueryRowContext(ctx, query,
+		purchase.SaleID, purchase.UserID, purchase.ItemID, purchase.Code,
+		purchase.CheckoutID, purchase.Price.Amount, purchase.Price.Currency, purchase.Status, purchase.PurchasedAt).
+		Scan(&purchase.ID, &purchase.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create purchase in transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (t *PostgresTx) UpdateCheckout(ctx context.Context, checkout *models.CheckoutAttempt) error {
+	query := `
+		UPDATE checkout_attempts 
+		SET status = $2, purchased = $3, updated_at = NOW()
+		WHERE id = $1`
+
+	result, err := t.tx.ExecContext(ctx, query, checkout.ID, checkout.Status, checkout.Purchased)
+	if err != nil {
+		return fmt.Errorf("failed to update checkout in transaction: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("checkout with ID %d not found", checkout.ID)
+	}
+
+	return nil
+}
+
+func (t *PostgresTx) IncrementSaleItemsSold(ctx context.Context, saleID int, delta int) error {
+	query := `UPDATE sales SET items_sold = items_sold + $1 WHERE id = $2`
+
+	result, err := t.tx.ExecContext(ctx, query, delta, saleID)
+	if err != nil {
+		return fmt.Errorf("failed to increment sale items sold in transaction: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("sale with ID %d not found", saleID)
+	}
+
+	return nil
+}
+
+// EnsureRedisLimits locks the sale row, so BeginPurchaseFallback waits for this transaction,
+// and returns interfaces.ErrPurchaseFallback if the sale already moved to Postgres. The lock
+// is the one the sale counter updates take anyway, so recording is not serialized further.
+func (t *PostgresTx) EnsureRedisLimits(ctx context.Context, saleID int) error {
+	var fallback bool
+	err := t.tx.QueryRowContext(ctx, `SELECT purchase_fallback FROM sales WHERE id = $1 FOR NO KEY UPDATE`, saleID).Scan(&fallback)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("sale with ID %d not found", saleID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock sale %d: %w", saleID, err)
+	}
+
+	if fallback {
+		return fmt.Errorf("sale %d: %w", saleID, interfaces.ErrPurchaseFallback)
+	}
+
+	return nil
+}
+
+// GetPurchaseByCode returns the purchase made with a checkout code and locks it
+// until the transaction ends; nil if there is none
+func (t *PostgresTx) GetPurchaseByCode(ctx context.Context, code string) (*models.Purchase, error) {
+	query := `
+		SELECT id, sale_id, user_id, item_id, code, COALESCE(checkout_id, 0), price_minor, price_currency, status, purchased_at, created_at
+		FROM purchases
+		WHERE code = $1 FOR UPDATE`
+
+	purchase := &models.Purchase{}
+	err := t.tx.QueryRowContext(ctx, query, code).Scan(
+		&purchase.ID, &purchase.SaleID, &purchase.UserID, &purchase.ItemID, &purchase.Code,
+		&purchase.CheckoutID, &purchase.Price.Amount, &purchase.Price.Currency, &purchase.Status, &purchase.PurchasedAt, &purchase.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Purchase not found
+		}
+		return nil, fmt.Errorf("failed to get purchase in transaction: %w", err)
+	}
+
+	purchase.PurchaseAt = purchase.PurchasedAt
+	return purchase, nil
+}
+
+func (t *PostgresTx) UpdatePurchaseStatus(ctx context.Context, purchaseID int, status string) error {
+	query := `UPDATE purchases SET status = $2 WHERE id = $1`
+
+	result, err := t.tx.ExecContext(ctx, query, purchaseID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update purchase status in transaction: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("purchase with ID %d not found", purchaseID)
+	}
+
+	return nil
+}
+
+// IncrementSaleItemSold updates the per-item sold counter. Sales without
+// per-item allocations have no sale_items rows, so no rows affected is not an error.
+func (t *PostgresTx) IncrementSaleItemSold(ctx context.Context, saleID int, itemID string, delta int) error {
+	query := `UPDATE sale_items SET sold = sold + $1 WHERE sale_id = $2 AND item_id = $3`
+
+	if _, err := t.tx.ExecContext(ctx, query, delta, saleID, itemID); err != nil {
+		return fmt.Errorf("failed to increment sale item sold in transaction: %w", err)
+	}
+
+	return nil
+}
@@ -2,8 +2,11 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -17,28 +20,153 @@ type RedisClient struct {
 
 	// Lua scripts for atomic operations
 	atomicPurchaseScript *redis.Script
-	validateCodeScript   *redis.Script
+	revertPurchaseScript *redis.Script
 	setupSaleScript      *redis.Script
+	beginRebuildScript   *redis.Script
+	rebuildSaleScript    *redis.Script
+	refreshTTLScript     *redis.Script
+	reserveScript        *redis.Script
+	releaseScript        *redis.Script
+	cleanupExpiredScript *redis.Script
+	acquireLeaderScript  *redis.Script
+	releaseLeaderScript  *redis.Script
+	rateLimitScript      *redis.Script
+	claimIdemScript      *redis.Script
 }
 
-// Lua script for atomic purchase with inventory and user limit checks
+// ScriptPurchaseStatuses lists every outcome atomicPurchaseLua and reserveCheckoutLua
+// return. A script that gains an outcome must list it here, and the outcome must be an
+// interfaces.PurchaseStatus the handlers map to a response.
+var ScriptPurchaseStatuses = []interfaces.PurchaseStatus{
+	interfaces.PurchaseSuccess,
+	interfaces.PurchaseSaleNotActive,
+	interfaces.PurchaseSaleRebuilding,
+	interfaces.PurchaseCodeAlreadyUsed,
+	interfaces.PurchaseItemNotInSale,
+	interfaces.PurchaseItemSoldOut,
+	interfaces.PurchaseSaleSoldOut,
+	interfaces.PurchaseUserLimitExceeded,
+}
+
+// Lua script for atomic purchase with inventory and user limit checks.
+// Empty limits in ARGV[3]/ARGV[4] are read from the sale's Redis keys written by setupSaleLua.
+// When a checkout code is passed in ARGV[5] it is consumed in the same step,
+// so a code can only ever back a single successful purchase.
+// When the sale has per-item stock (sale:{id}:items), the item in ARGV[6] is
+// decremented alongside the global counter.
+// Purchases are refused with sale_rebuilding while the sale's counters are rebuilt
+// from Postgres, or when the sold counter is missing although the sale is set up.
+// A code with a live reservation (reservation:{code}) converts it into a sale without
+// further checks; other purchases may only take units that are not reserved.
+// A write-behind event in ARGV[7] is appended to the stream in ARGV[8] with the sale,
+// so a purchase is never counted without being queued for Postgres.
 const atomicPurchaseLua = `
 	local sale_key = "sale:" .. ARGV[1] .. ":sold"
 	local user_key = "user:" .. ARGV[2] .. ":sale:" .. ARGV[1] .. ":count"
+	local items_key = "sale:" .. ARGV[1] .. ":items"
 	local max_items = tonumber(ARGV[3])
 	local max_user_items = tonumber(ARGV[4])
+	local code = ARGV[5]
+	local item_id = ARGV[6]
+	local event = ARGV[7]
+	
+	-- Counters live at least as long as the sale's limits, which RefreshSaleTTL extends with the sale
+	local ttl = math.max(86400, redis.call('TTL', "sale:" .. ARGV[1] .. ":available"))
+	
+	local function queue_event()
+		if event and event ~= "" then
+			redis.call('XADD', ARGV[8], '*', 'event', event)
+		end
+	end
 	
 	-- Get current values
 	local sold = tonumber(redis.call('GET', sale_key) or 0)
 	local user_count = tonumber(redis.call('GET', user_key) or 0)
 	
+	-- Counters being rebuilt would undercount sales
+	if redis.call('EXISTS', "sale:" .. ARGV[1] .. ":rebuilding") == 1 then
+		return {0, "sale_rebuilding", sold, user_count}
+	end
+	
+	-- Fall back to the limits stored for this sale
+	if not max_items then
+		max_items = tonumber(redis.call('GET', "sale:" .. ARGV[1] .. ":available"))
+	end
+	if not max_user_items then
+		max_user_items = tonumber(redis.call('GET', "sale:" .. ARGV[1] .. ":max_per_user"))
+	end
+	if not max_items or not max_user_items then
+		return {0, "sale_not_active", sold, user_count}
+	end
+	
+	-- Counters lost while the limits survived would undercount sales
+	if redis.call('EXISTS', "sale:" .. ARGV[1] .. ":available") == 1 and redis.call('EXISTS', sale_key) == 0 then
+		return {0, "sale_rebuilding", sold, user_count}
+	end
+	
+	-- Reject replayed or racing checkout codes
+	local code_key = nil
+	if code and code ~= "" then
+		code_key = "checkout:" .. code
+		if redis.call('HGET', code_key, 'used') == "true" then
+			return {0, "code_already_used", sold, user_count}
+		end
+	end
+	
+	local reserved_key = "sale:" .. ARGV[1] .. ":reserved"
+	local user_reserved_key = "user:" .. ARGV[2] .. ":sale:" .. ARGV[1] .. ":reserved"
+	
+	-- Convert a reservation; its unit was already taken from the sale and item stock
+	local reservation_key = nil
+	if code_key then
+		reservation_key = "reservation:" .. code
+	end
+	if reservation_key and redis.call('HGET', reservation_key, 'sale_id') == ARGV[1] then
+		redis.call('DEL', reservation_key)
+		redis.call('ZREM', "sale:" .. ARGV[1] .. ":reservations", code)
+		if tonumber(redis.call('GET', reserved_key) or 0) > 0 then
+			redis.call('DECR', reserved_key)
+		end
+		if tonumber(redis.call('GET', user_reserved_key) or 0) > 0 then
+			redis.call('DECR', user_reserved_key)
+		end
+		
+		local new_sold = redis.call('INCR', sale_key)
+		local new_user_count = redis.call('INCR', user_key)
+		redis.call('EXPIRE', sale_key, ttl)
+		redis.call('EXPIRE', user_key, ttl)
+		
+		redis.call('HSET', code_key, 'used', 'true')
+		if redis.call('TTL', code_key) < 3600 then
+			redis.call('EXPIRE', code_key, 3600)
+		end
+		
+		queue_event()
+		return {1, "success", new_sold, new_user_count}
+	end
+	
+	local reserved = tonumber(redis.call('GET', reserved_key) or 0)
+	local user_reserved = tonumber(redis.call('GET', user_reserved_key) or 0)
+	
+	-- Check per-item stock when the sale has item allocations
+	local item_restricted = item_id and item_id ~= "" and redis.call('EXISTS', items_key) == 1
+	if item_restricted then
+		local stock = redis.call('HGET', items_key, item_id)
+		if not stock then
+			return {0, "item_not_in_sale", sold, user_count}
+		end
+		if tonumber(stock) <= 0 then
+			return {0, "item_sold_out", sold, user_count}
+		end
+	end
+	
 	-- Check global inventory limit
-	if sold >= max_items then
+	if sold + reserved >= max_items then
 		return {0, "sale_sold_out", sold, user_count}
 	end
 	
 	-- Check user purchase limit
-	if user_count >= max_user_items then
+	if user_count + user_reserved >= max_user_items then
 		return {0, "user_limit_exceeded", sold, user_count}
 	end
 	
@@ -46,58 +174,107 @@ const atomicPurchaseLua = `
 	local new_sold = redis.call('INCR', sale_key)
 	local new_user_count = redis.call('INCR', user_key)
 	
-	-- Set expiration for both keys (24 hours)
-	redis.call('EXPIRE', sale_key, 86400)
-	redis.call('EXPIRE', user_key, 86400)
+	if item_restricted then
+		redis.call('HINCRBY', items_key, item_id, -1)
+	end
+	
+	-- Set expiration for both keys (at least 24 hours)
+	redis.call('EXPIRE', sale_key, ttl)
+	redis.call('EXPIRE', user_key, ttl)
+	
+	-- Consume the checkout code (the hash may be missing if caching failed at checkout);
+	-- consumed codes are kept for an hour so replays are rejected from Redis
+	if code_key then
+		redis.call('HSET', code_key, 'used', 'true')
+		if redis.call('TTL', code_key) < 3600 then
+			redis.call('EXPIRE', code_key, 3600)
+		end
+	end
 	
+	queue_event()
 	return {1, "success", new_sold, new_user_count}
 `
 
-// Lua script for validating and consuming checkout codes
-const validateCodeLua = `
-	local code_key = "checkout:" .. ARGV[1]
-	local exists = redis.call('EXISTS', code_key)
+// Lua script for compensating a purchase whose database write failed.
+// Decrements both counters (never below zero), returns the item to stock
+// and releases the checkout code.
+const revertPurchaseLua = `
+	local sale_key = "sale:" .. ARGV[1] .. ":sold"
+	local user_key = "user:" .. ARGV[2] .. ":sale:" .. ARGV[1] .. ":count"
+	local items_key = "sale:" .. ARGV[1] .. ":items"
+	local code = ARGV[3]
+	local item_id = ARGV[4]
 	
-	if exists == 0 then
-		return {0, "code_not_found", "", "", ""}
+	if tonumber(redis.call('GET', sale_key) or 0) > 0 then
+		redis.call('DECR', sale_key)
 	end
 	
-	-- Get checkout data
-	local data = redis.call('HMGET', code_key, 'sale_id', 'user_id', 'item_id', 'used')
-	local sale_id = data[1]
-	local user_id = data[2]  
-	local item_id = data[3]
-	local used = data[4]
+	if tonumber(redis.call('GET', user_key) or 0) > 0 then
+		redis.call('DECR', user_key)
+	end
 	
-	if used == "true" then
-		return {0, "code_already_used", sale_id, user_id, item_id}
+	if item_id and item_id ~= "" and redis.call('HEXISTS', items_key, item_id) == 1 then
+		redis.call('HINCRBY', items_key, item_id, 1)
 	end
 	
-	-- Mark as used
-	redis.call('HSET', code_key, 'used', 'true')
+	-- Allow the checkout code to be retried
+	if code and code ~= "" and redis.call('EXISTS', "checkout:" .. code) == 1 then
+		redis.call('HSET', "checkout:" .. code, 'used', 'false')
+	end
 	
-	return {1, "success", sale_id, user_id, item_id}
+	return "OK"
+`
+
+// Lua script for removing the cached hashes of expired checkout codes.
+// Codes already consumed by a purchase are kept, so a purchase whose database write
+// is still in flight cannot be replayed. Returns the number of hashes removed.
+// ARGV: codes
+const cleanupExpiredLua = `
+	local removed = 0
+	for _, code in ipairs(ARGV) do
+		local code_key = "checkout:" .. code
+		if redis.call('EXISTS', code_key) == 1 and redis.call('HGET', code_key, 'used') ~= "true" then
+			redis.call('DEL', code_key)
+			removed = removed + 1
+		end
+	end
+	return removed
 `
 
-// Lua script for setting up sale counters
+// Lua script for setting up sale counters and limits.
+// ARGV[4..] holds optional item_id/stock pairs for per-item inventory.
 const setupSaleLua = `
 	local sale_id = ARGV[1]
 	local items_available = tonumber(ARGV[2])
+	local max_per_user = tonumber(ARGV[3])
+	local items_key = "sale:" .. sale_id .. ":items"
 	
-	-- Set up sale counters
+	-- Set up per-item stock (no hash means the sale is unrestricted)
+	redis.call('DEL', items_key)
+	for i = 4, #ARGV, 2 do
+		redis.call('HSET', items_key, ARGV[i], ARGV[i + 1])
+	end
+	if #ARGV >= 4 then
+		redis.call('EXPIRE', items_key, 86400)
+	end
+	
+	-- Set up sale counters and limits
 	redis.call('SET', "sale:" .. sale_id .. ":sold", 0)
 	redis.call('SET', "sale:" .. sale_id .. ":available", items_available)
+	redis.call('SET', "sale:" .. sale_id .. ":max_per_user", max_per_user)
 	redis.call('SET', "active_sale_id", sale_id)
 	
 	-- Set expiration (24 hours)
 	redis.call('EXPIRE', "sale:" .. sale_id .. ":sold", 86400)
 	redis.call('EXPIRE', "sale:" .. sale_id .. ":available", 86400)
+	redis.call('EXPIRE', "sale:" .. sale_id .. ":max_per_user", 86400)
 	redis.call('EXPIRE', "active_sale_id", 86400)
 	
 	-- Cache sale info
 	redis.call('HMSET', "sale:" .. sale_id .. ":cache", 
 		"id", sale_id,
 		"available", items_available,
+		"max_per_user", max_per_user,
 		"sold", 0,
 		"active", "true")
 	redis.call('EXPIRE', "sale:" .. sale_id .. ":cache", 3600)
@@ -105,8 +282,305 @@ const setupSaleLua = `
 	return "OK"
 `
 
+// Lua script for reserving one unit of a sale at checkout.
+// The unit counts against the sale, item and user limits until it is purchased or released.
+// A write-behind event for the checkout is appended to the stream with the reservation.
+// ARGV: sale_id, user_id, item_id, code, expires_at_ms, event, stream. Returns a purchase status.
+const reserveCheckoutLua = `
+	local sale_id = ARGV[1]
+	local item_id = ARGV[3]
+	local code = ARGV[4]
+	local prefix = "sale:" .. sale_id
+	local user_prefix = "user:" .. ARGV[2] .. ":sale:" .. sale_id
+	local ttl = math.max(86400, redis.call('TTL', prefix .. ":available"))
+	
+	if redis.call('EXISTS', prefix .. ":rebuilding") == 1 then
+		return "sale_rebuilding"
+	end
+	local max_items = tonumber(redis.call('GET', prefix .. ":available"))
+	local max_user_items = tonumber(redis.call('GET', prefix .. ":max_per_user"))
+	if not max_items or not max_user_items then
+		return "sale_not_active"
+	end
+	if redis.call('EXISTS', prefix .. ":sold") == 0 then
+		return "sale_rebuilding"
+	end
+	
+	local sold = tonumber(redis.call('GET', prefix .. ":sold"))
+	local reserved = tonumber(redis.call('GET', prefix .. ":reserved") or 0)
+	local user_count = tonumber(redis.call('GET', user_prefix .. ":count") or 0)
+	local user_reserved = tonumber(redis.call('GET', user_prefix .. ":reserved") or 0)
+	
+	-- Check per-item stock when the sale has item allocations
+	local items_key = prefix .. ":items"
+	local item_restricted = redis.call('EXISTS', items_key) == 1
+	if item_restricted then
+		local stock = redis.call('HGET', items_key, item_id)
+		if not stock then
+			return "item_not_in_sale"
+		end
+		if tonumber(stock) <= 0 then
+			return "item_sold_out"
+		end
+	end
+	
+	if sold + reserved >= max_items then
+		return "sale_sold_out"
+	end
+	if user_count + user_reserved >= max_user_items then
+		return "user_limit_exceeded"
+	end
+	
+	-- Hold the unit
+	redis.call('INCR', prefix .. ":reserved")
+	redis.call('EXPIRE', prefix .. ":reserved", ttl)
+	redis.call('INCR', user_prefix .. ":reserved")
+	redis.call('EXPIRE', user_prefix .. ":reserved", ttl)
+	if item_restricted then
+		redis.call('HINCRBY', items_key, item_id, -1)
+	end
+	
+	redis.call('HSET', "reservation:" .. code, 'sale_id', sale_id, 'user_id', ARGV[2], 'item_id', item_id)
+	redis.call('EXPIRE', "reservation:" .. code, ttl)
+	redis.call('ZADD', prefix .. ":reservations", ARGV[5], code)
+	redis.call('EXPIRE', prefix .. ":reservations", ttl)
+	
+	if ARGV[6] and ARGV[6] ~= "" then
+		redis.call('XADD', ARGV[7], '*', 'event', ARGV[6])
+	end
+	
+	return "success"
+`
+
+// Lua script for releasing reservations back to available stock: the reservation
+// for the code in ARGV[4], or else up to ARGV[3] reservations that expired by ARGV[2] (ms).
+// Each reservation is removed from the sorted set as it is released, so concurrent
+// sweepers never release one twice. Returns the number released.
+// ARGV: sale_id, now_ms, limit, code
+const releaseReservationsLua = `
+	local prefix = "sale:" .. ARGV[1]
+	local reservations_key = prefix .. ":reservations"
+	local items_key = prefix .. ":items"
+	
+	local codes = {}
+	if ARGV[4] ~= "" then
+		if redis.call('ZSCORE', reservations_key, ARGV[4]) then
+			codes = {ARGV[4]}
+		end
+	else
+		codes = redis.call('ZRANGEBYSCORE', reservations_key, '-inf', ARGV[2], 'LIMIT', 0, tonumber(ARGV[3]))
+	end
+	
+	for _, code in ipairs(codes) do
+		local reservation_key = "reservation:" .. code
+		local user_id = redis.call('HGET', reservation_key, 'user_id')
+		local item_id = redis.call('HGET', reservation_key, 'item_id')
+		
+		if tonumber(redis.call('GET', prefix .. ":reserved") or 0) > 0 then
+			redis.call('DECR', prefix .. ":reserved")
+		end
+		if user_id then
+			local user_reserved_key = "user:" .. user_id .. ":sale:" .. ARGV[1] .. ":reserved"
+			if tonumber(redis.call('GET', user_reserved_key) or 0) > 0 then
+				redis.call('DECR', user_reserved_key)
+			end
+		end
+		if item_id and redis.call('HEXISTS', items_key, item_id) == 1 then
+			redis.call('HINCRBY', items_key, item_id, 1)
+		end
+		
+		redis.call('DEL', reservation_key)
+		redis.call('ZREM', reservations_key, code)
+	end
+	
+	return #codes
+`
+
+// Lua script for keeping a sale's keys for at least ARGV[1] seconds.
+// ARGV: ttl_seconds, sale_id, then key names. Missing keys and keys that already live
+// longer are left alone; active_sale_id is included while it names the sale.
+const refreshSaleTTLLua = `
+	local ttl = tonumber(ARGV[1])
+	local function keep(key)
+		local current = redis.call('TTL', key)
+		if current >= 0 and current < ttl then
+			redis.call('EXPIRE', key, ttl)
+		end
+	end
+	
+	for i = 3, #ARGV do
+		keep(ARGV[i])
+	end
+	if redis.call('GET', "active_sale_id") == ARGV[2] then
+		keep("active_sale_id")
+	end
+	
+	return #ARGV - 2
+`
+
+// Lua script for starting or renewing a counter rebuild, unless another owner holds the marker.
+// ARGV: sale_id, owner, ttl_ms
+const beginRebuildLua = `
+	local marker_key = "sale:" .. ARGV[1] .. ":rebuilding"
+	local owner = redis.call('GET', marker_key)
+	if owner and owner ~= ARGV[2] then
+		return 0
+	end
+	redis.call('SET', marker_key, ARGV[2], 'PX', ARGV[3])
+	return 1
+`
+
+// Lua script for rebuilding a sale's counters from Postgres, only if the caller
+// still holds the rebuild marker. The marker is removed, which unblocks purchases.
+// ARGV: sale_id, owner, items_available, max_per_user, sold, item_count,
+// then item_count item_id/stock pairs, then user_id/count pairs.
+const rebuildSaleLua = `
+	local sale_id = ARGV[1]
+	local marker_key = "sale:" .. sale_id .. ":rebuilding"
+	if redis.call('GET', marker_key) ~= ARGV[2] then
+		return 0
+	end
+	
+	local items_key = "sale:" .. sale_id .. ":items"
+	local item_count = tonumber(ARGV[6])
+	local users_from = 7 + item_count * 2
+	
+	-- Remaining stock per item (no hash means the sale is unrestricted)
+	redis.call('DEL', items_key)
+	for i = 7, users_from - 1, 2 do
+		redis.call('HSET', items_key, ARGV[i], ARGV[i + 1])
+	end
+	if item_count > 0 then
+		redis.call('EXPIRE', items_key, 86400)
+	end
+	
+	-- Sale counters and limits
+	redis.call('SET', "sale:" .. sale_id .. ":sold", ARGV[5], 'EX', 86400)
+	redis.call('SET', "sale:" .. sale_id .. ":available", ARGV[3], 'EX', 86400)
+	redis.call('SET', "sale:" .. sale_id .. ":max_per_user", ARGV[4], 'EX', 86400)
+	redis.call('SET', "active_sale_id", sale_id, 'EX', 86400)
+	
+	-- Per-user purchase counts
+	for i = users_from, #ARGV, 2 do
+		redis.call('SET', "user:" .. ARGV[i] .. ":sale:" .. sale_id .. ":count", ARGV[i + 1], 'EX', 86400)
+	end
+	
+	-- Drop reservations; the stock above no longer holds units for them
+	local reservations_key = "sale:" .. sale_id .. ":reservations"
+	for _, code in ipairs(redis.call('ZRANGE', reservations_key, 0, -1)) do
+		local user_id = redis.call('HGET', "reservation:" .. code, 'user_id')
+		if user_id then
+			redis.call('DEL', "user:" .. user_id .. ":sale:" .. sale_id .. ":reserved")
+		end
+		redis.call('DEL', "reservation:" .. code)
+	end
+	redis.call('DEL', reservations_key, "sale:" .. sale_id .. ":reserved")
+	
+	redis.call('DEL', marker_key)
+	return 1
+`
+
+// Lua script to acquire or renew a leadership lease.
+// ARGV: name, instance_id, ttl_ms. A new holder gets the next fencing token from
+// leader:{name}:fence; the current holder renews its lease and keeps its token.
+// Returns the holder's fencing token, or 0 if another instance holds the lease.
+const acquireLeaderLua = `
+	local lease_key = "leader:" .. ARGV[1]
+	local fence_key = "leader:" .. ARGV[1] .. ":fence"
+	local instance_id = ARGV[2]
+	local ttl_ms = tonumber(ARGV[3])
+	
+	local owner = redis.call('HGET', lease_key, 'owner')
+	if not owner then
+		local token = redis.call('INCR', fence_key)
+		redis.call('HSET', lease_key, 'owner', instance_id, 'token', token)
+		redis.call('PEXPIRE', lease_key, ttl_ms)
+		return token
+	end
+	
+	if owner == instance_id then
+		redis.call('PEXPIRE', lease_key, ttl_ms)
+		return tonumber(redis.call('HGET', lease_key, 'token'))
+	end
+	
+	return 0
+`
+
+// Lua script to release a leadership lease, only if it is still held by the caller.
+// ARGV: name, instance_id
+const releaseLeaderLua = `
+	local lease_key = "leader:" .. ARGV[1]
+	if redis.call('HGET', lease_key, 'owner') == ARGV[2] then
+		redis.call('DEL', lease_key)
+		return 1
+	end
+	return 0
+`
+
+// Lua script for a token bucket rate limit. The bucket holds up to ARGV[2] tokens and
+// gains one every ARGV[3] ms; ARGV[4] is the caller's time in Unix ms. Returns whether a
+// token was taken and, if not, how many ms until one is available.
+const rateLimitLua = `
+	local key = "ratelimit:" .. ARGV[1]
+	local capacity = tonumber(ARGV[2])
+	local refill_ms = tonumber(ARGV[3])
+	local now = tonumber(ARGV[4])
+	
+	local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+	local tokens = tonumber(bucket[1]) or capacity
+	local ts = tonumber(bucket[2]) or now
+	if now > ts then
+		tokens = math.min(capacity, tokens + (now - ts) / refill_ms)
+	else
+		now = ts
+	end
+	
+	local allowed = 0
+	local retry_ms = 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	else
+		retry_ms = math.ceil((1 - tokens) * refill_ms)
+	end
+	
+	redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(capacity * refill_ms))
+	return {allowed, retry_ms}
+`
+
+// Lua script for claiming an Idempotency-Key: returns the stored record if the key is
+// taken, otherwise stores ARGV[2] for ARGV[3] ms and returns false
+const claimIdempotencyLua = `
+	local key = "idempotency:" .. ARGV[1]
+	local existing = redis.call('GET', key)
+	if existing then
+		return existing
+	end
+	
+	redis.call('SET', key, ARGV[2], 'PX', ARGV[3])
+	return false
+`
+
 // NewRedisClient creates a new Redis client connection
 func NewRedisClient(addr, password string, db int) (*RedisClient, error) {
+	redisClient := OpenRedisClient(addr, password, db)
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := redisClient.Ping(ctx); err != nil {
+		redisClient.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return redisClient, nil
+}
+
+// OpenRedisClient creates a Redis client without checking the connection.
+// Commands fail while Redis is unreachable and succeed again once it is back.
+func OpenRedisClient(addr, password string, db int) *RedisClient {
 	client := redis.NewClient(&redis.Options{
 		Addr:         addr,
 		Password:     password,
@@ -122,22 +596,22 @@ func NewRedisClient(addr, password string, db int) (*RedisClient, error) {
 		PoolTimeout:  4 * time.Second,  // Pool get timeout
 	})
 
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
-	}
-
-	redisClient := &RedisClient{
+	return &RedisClient{
 		client: client,
 		atomicPurchaseScript: redis.NewScript(atomicPurchaseLua),
-		validateCodeScript:   redis.NewScript(validateCodeLua),
+		revertPurchaseScript: redis.NewScript(revertPurchaseLua),
 		setupSaleScript:      redis.NewScript(setupSaleLua),
+		beginRebuildScript:   redis.NewScript(beginRebuildLua),
+		rebuildSaleScript:    redis.NewScript(rebuildSaleLua),
+		refreshTTLScript:     redis.NewScript(refreshSaleTTLLua),
+		reserveScript:        redis.NewScript(reserveCheckoutLua),
+		releaseScript:        redis.NewScript(releaseReservationsLua),
+		cleanupExpiredScript: redis.NewScript(cleanupExpiredLua),
+		acquireLeaderScript:  redis.NewScript(acquireLeaderLua),
+		releaseLeaderScript:  redis.NewScript(releaseLeaderLua),
+		rateLimitScript:      redis.NewScript(rateLimitLua),
+		claimIdemScript:      redis.NewScript(claimIdempotencyLua),
 	}
-
-	return redisClient, nil
 }
 
 // Connection management
@@ -150,9 +624,16 @@ func (r *RedisClient) Ping(ctx context.Context) error {
 }
 
 // Atomic sale operations
-func (r *RedisClient) AtomicPurchase(ctx context.Context, saleID int, userID string, maxItems, maxUserItems int) (bool, string, int, int, error) {
+func (r *RedisClient) AtomicPurchase(ctx context.Context, saleID int, userID string, maxItems, maxUserItems int) (bool, interfaces.PurchaseStatus, int, int, error) {
+	return r.atomicPurchase(ctx, saleID, userID, "", "", maxItems, maxUserItems, "")
+}
+
+// atomicPurchase runs the purchase script, optionally consuming a checkout code,
+// decrementing the item's stock and queueing an encoded write-behind event.
+// Zero limits make the script use the limits stored for the sale by SetupSale.
+func (r *RedisClient) atomicPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, maxItems, maxUserItems int, event string) (bool, interfaces.PurchaseStatus, int, int, error) {
 	result, err := r.atomicPurchaseScript.Run(ctx, r.client, 
-		[]string{}, saleID, userID, maxItems, maxUserItems).Result()
+		[]string{}, saleID, userID, limitArg(maxItems), limitArg(maxUserItems), code, itemID, event, persistenceStream).Result()
 	
 	if err != nil {
 		return false, "", 0, 0, fmt.Errorf("atomic purchase script failed: %w", err)
@@ -160,11 +641,23 @@ func (r *RedisClient) AtomicPurchase(ctx context.Context, saleID int, userID str
 
 	res := result.([]interface{})
 	success := res[0].(int64) == 1
-	message := res[1].(string)
+	status := interfaces.PurchaseStatus(res[1].(string))
 	sold := int(res[2].(int64))
 	userCount := int(res[3].(int64))
 
-	return success, message, sold, userCount, nil
+	if !status.Valid() {
+		return false, status, sold, userCount, fmt.Errorf("atomic purchase script returned unknown status %q", status)
+	}
+
+	return success, status, sold, userCount, nil
+}
+
+// limitArg converts a limit into a script argument ("" means use the stored limit)
+func limitArg(limit int) interface{} {
+	if limit <= 0 {
+		return ""
+	}
+	return limit
 }
 
 func (r *RedisClient) GetSoldItems(ctx context.Context, saleID int) (int, error) {
@@ -205,10 +698,28 @@ func (r *RedisClient) GetUserPurchaseCount(ctx context.Context, userID string, s
 	return count, nil
 }
 
+// RevertPurchase undoes the counter increments of a successful AttemptPurchase
+// and releases its checkout code. Used when the database write fails afterwards.
+func (r *RedisClient) RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error {
+	_, err := r.revertPurchaseScript.Run(ctx, r.client, 
+		[]string{}, saleID, userID, code, itemID).Result()
+	
+	if err != nil {
+		return fmt.Errorf("revert purchase script failed: %w", err)
+	}
+
+	return nil
+}
+
 // Sale management
-func (r *RedisClient) SetupSale(ctx context.Context, saleID int, itemsAvailable int) error {
+func (r *RedisClient) SetupSale(ctx context.Context, saleID int, itemsAvailable int, maxPerUser int, itemStock map[string]int) error {
+	args := []interface{}{saleID, itemsAvailable, maxPerUser}
+	for itemID, stock := range itemStock {
+		args = append(args, itemID, stock)
+	}
+
 	_, err := r.setupSaleScript.Run(ctx, r.client, 
-		[]string{}, saleID, itemsAvailable).Result()
+		[]string{}, args...).Result()
 	
 	if err != nil {
 		return fmt.Errorf("setup sale script failed: %w", err)
@@ -217,6 +728,106 @@ func (r *RedisClient) SetupSale(ctx context.Context, saleID int, itemsAvailable
 	return nil
 }
 
+// RefreshSaleTTL keeps the sale's counters, limits, item stock, reservations and per-user
+// counts for at least ttl, so they outlive a sale whose end time moved later. Per-user
+// keys are found with SCAN, so this does not block Redis on large sales.
+func (r *RedisClient) RefreshSaleTTL(ctx context.Context, saleID int, ttl time.Duration) error {
+	prefix := fmt.Sprintf("sale:%d", saleID)
+	keys := []string{
+		prefix + ":sold", prefix + ":available", prefix + ":max_per_user", prefix + ":items",
+		prefix + ":reserved", prefix + ":reservations", prefix + ":info", prefix + ":cache",
+	}
+	if err := r.refreshTTL(ctx, saleID, ttl, keys); err != nil {
+		return err
+	}
+
+	const batchSize = 1000
+	batch := make([]string, 0, batchSize)
+	iter := r.client.Scan(ctx, 0, fmt.Sprintf("user:*:sale:%d:*", saleID), batchSize).Iterator()
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == batchSize {
+			if err := r.refreshTTL(ctx, saleID, ttl, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan user keys of sale %d: %w", saleID, err)
+	}
+
+	return r.refreshTTL(ctx, saleID, ttl, batch)
+}
+
+// refreshTTL runs the refresh script on one batch of the sale's keys
+func (r *RedisClient) refreshTTL(ctx context.Context, saleID int, ttl time.Duration, keys []string) error {
+	args := make([]interface{}, 0, len(keys)+2)
+	args = append(args, int64(ttl/time.Second), saleID)
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	if err := r.refreshTTLScript.Run(ctx, r.client, []string{}, args...).Err(); err != nil {
+		return fmt.Errorf("refresh sale TTL script failed: %w", err)
+	}
+
+	return nil
+}
+
+// Leader election
+
+// AcquireLeadership acquires or renews the named leadership lease for instanceID.
+// It returns the lease's fencing token, or 0 if another instance holds the lease.
+func (r *RedisClient) AcquireLeadership(ctx context.Context, name string, instanceID string, ttl time.Duration) (int64, error) {
+	result, err := r.acquireLeaderScript.Run(ctx, r.client,
+		[]string{}, name, instanceID, ttl.Milliseconds()).Int64()
+
+	if err != nil {
+		return 0, fmt.Errorf("acquire leader script failed: %w", err)
+	}
+
+	return result, nil
+}
+
+// ReleaseLeadership gives up the named leadership lease if instanceID still holds it
+func (r *RedisClient) ReleaseLeadership(ctx context.Context, name string, instanceID string) error {
+	if err := r.releaseLeaderScript.Run(ctx, r.client, []string{}, name, instanceID).Err(); err != nil {
+		return fmt.Errorf("release leader script failed: %w", err)
+	}
+
+	return nil
+}
+
+// GetSaleItemStock returns the remaining stock of an item in a sale.
+// Sales without per-item allocations accept every item and are reported as not Restricted.
+func (r *RedisClient) GetSaleItemStock(ctx context.Context, saleID int, itemID string) (*interfaces.SaleItemStock, error) {
+	key := fmt.Sprintf("sale:%d:items", saleID)
+
+	pipe := r.client.Pipeline()
+	existsCmd := pipe.Exists(ctx, key)
+	stockCmd := pipe.HGet(ctx, key, itemID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get sale item stock: %w", err)
+	}
+
+	if existsCmd.Val() == 0 {
+		return &interfaces.SaleItemStock{InSale: true}, nil // Unrestricted sale
+	}
+
+	if stockCmd.Err() == redis.Nil {
+		return &interfaces.SaleItemStock{Restricted: true}, nil // Item is not part of this sale
+	}
+
+	stock, err := strconv.Atoi(stockCmd.Val())
+	if err != nil {
+		return nil, fmt.Errorf("invalid sale item stock: %w", err)
+	}
+
+	return &interfaces.SaleItemStock{InSale: true, Restricted: true, Remaining: stock}, nil
+}
+
 func (r *RedisClient) GetActiveSaleID(ctx context.Context) (int, error) {
 	result, err := r.client.Get(ctx, "active_sale_id").Result()
 	
@@ -244,30 +855,416 @@ func (r *RedisClient) SetActiveSaleID(ctx context.Context, saleID int) error {
 	return nil
 }
 
+// GetSaleCounters returns the sale's sold counter. present is false when the sale's
+// limits or sold counter are missing, e.g. after a Redis restart or key expiry.
+func (r *RedisClient) GetSaleCounters(ctx context.Context, saleID int) (int, bool, error) {
+	pipe := r.client.Pipeline()
+	available := pipe.Exists(ctx, fmt.Sprintf("sale:%d:available", saleID))
+	sold := pipe.Get(ctx, fmt.Sprintf("sale:%d:sold", saleID))
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, false, fmt.Errorf("failed to get sale counters: %w", err)
+	}
+
+	if available.Val() == 0 || sold.Err() == redis.Nil {
+		return 0, false, nil
+	}
+
+	count, err := strconv.Atoi(sold.Val())
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid sold items value: %w", err)
+	}
+
+	return count, true, nil
+}
+
+// BeginCounterRebuild blocks purchases for the sale until RebuildSaleCounters runs or ttl
+// passes. It returns false if another owner is already rebuilding the sale; the owner
+// itself renews the marker for another ttl.
+func (r *RedisClient) BeginCounterRebuild(ctx context.Context, saleID int, owner string, ttl time.Duration) (bool, error) {
+	result, err := r.beginRebuildScript.Run(ctx, r.client, []string{}, saleID, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, fmt.Errorf("begin rebuild script failed: %w", err)
+	}
+
+	return result == 1, nil
+}
+
+// RebuildSaleCounters replaces the sale's counters and unblocks purchases.
+// It returns false without writing anything if owner no longer holds the rebuild marker.
+func (r *RedisClient) RebuildSaleCounters(ctx context.Context, saleID int, owner string, counters *interfaces.SaleCounters) (bool, error) {
+	args := []interface{}{saleID, owner, counters.ItemsAvailable, counters.MaxPerUser, counters.Sold, len(counters.ItemStock)}
+	for itemID, stock := range counters.ItemStock {
+		args = append(args, itemID, stock)
+	}
+	for userID, count := range counters.UserCounts {
+		args = append(args, userID, count)
+	}
+
+	result, err := r.rebuildSaleScript.Run(ctx, r.client, []string{}, args...).Int64()
+	if err != nil {
+		return false, fmt.Errorf("rebuild sale script failed: %w", err)
+	}
+
+	return result == 1, nil
+}
+
+// ReserveCheckout holds one unit of the sale for the checkout code until expiresAt.
+// The unit counts against the sale, item and user limits until the code is used for a
+// purchase or the reservation is released. Returns PurchaseSuccess when the unit is held;
+// only then is event, if not nil, appended to the write-behind stream in the same step.
+func (r *RedisClient) ReserveCheckout(ctx context.Context, saleID int, userID string, itemID string, code string, expiresAt time.Time, event *interfaces.PersistenceEvent) (interfaces.PurchaseStatus, error) {
+	data, err := encodePersistenceEvent(event)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := r.reserveScript.Run(ctx, r.client, []string{}, saleID, userID, itemID, code, expiresAt.UnixMilli(), data, persistenceStream).Text()
+	if err != nil {
+		return "", fmt.Errorf("reserve checkout script failed: %w", err)
+	}
+
+	return interfaces.PurchaseStatus(status), nil
+}
+
+// ReleaseReservation returns the unit held for the checkout code to available stock.
+// It returns false if the code holds no reservation, e.g. it was purchased or already released.
+func (r *RedisClient) ReleaseReservation(ctx context.Context, saleID int, code string) (bool, error) {
+	released, err := r.releaseScript.Run(ctx, r.client, []string{}, saleID, 0, 0, code).Int()
+	if err != nil {
+		return false, fmt.Errorf("release reservation script failed: %w", err)
+	}
+
+	return released > 0, nil
+}
+
+// ReleaseExpiredReservations returns up to limit reservations that expired by now
+// to available stock and returns how many were released
+func (r *RedisClient) ReleaseExpiredReservations(ctx context.Context, saleID int, now time.Time, limit int) (int, error) {
+	released, err := r.releaseScript.Run(ctx, r.client, []string{}, saleID, now.UnixMilli(), limit, "").Int()
+	if err != nil {
+		return 0, fmt.Errorf("release reservations script failed: %w", err)
+	}
+
+	return released, nil
+}
+
+// GetReservedItems returns the number of units currently held by reservations
+func (r *RedisClient) GetReservedItems(ctx context.Context, saleID int) (int, error) {
+	val, err := r.client.Get(ctx, fmt.Sprintf("sale:%d:reserved", saleID)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get reserved items: %w", err)
+	}
+
+	count, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reserved items value: %w", err)
+	}
+
+	return count, nil
+}
+
+// TakeRateLimitToken takes a token from the rate limit bucket named key, which holds up to
+// capacity tokens and regains one every refill. When the bucket is empty it returns false
+// and how long until the next token.
+func (r *RedisClient) TakeRateLimitToken(ctx context.Context, key string, capacity int, refill time.Duration, now time.Time) (bool, time.Duration, error) {
+	refillMs := float64(refill) / float64(time.Millisecond)
+	result, err := r.rateLimitScript.Run(ctx, r.client, []string{}, key, capacity, refillMs, now.UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit script failed: %w", err)
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// ClaimIdempotencyKey stores record under key for lockTTL unless the key is already taken.
+// It returns nil when the caller claimed the key, or the record already stored.
+func (r *RedisClient) ClaimIdempotencyKey(ctx context.Context, key string, record *interfaces.IdempotencyRecord, lockTTL time.Duration) (*interfaces.IdempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	existing, err := r.claimIdemScript.Run(ctx, r.client, []string{}, key, data, lockTTL.Milliseconds()).Text()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim idempotency key script failed: %w", err)
+	}
+
+	var stored interfaces.IdempotencyRecord
+	if err := json.Unmarshal([]byte(existing), &stored); err != nil {
+		return nil, fmt.Errorf("invalid idempotency record for %s: %w", key, err)
+	}
+
+	return &stored, nil
+}
+
+// CompleteIdempotencyKey stores the final record for key, to be replayed for ttl
+func (r *RedisClient) CompleteIdempotencyKey(ctx context.Context, key string, record *interfaces.IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	if err := r.client.Set(ctx, "idempotency:"+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store idempotency record: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes key so the request can be retried
+func (r *RedisClient) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if err := r.client.Del(ctx, "idempotency:"+key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// itemInvalidationChannel carries the IDs of changed catalog items to every replica
+const itemInvalidationChannel = "items:invalidate"
+
+// PublishItemInvalidation tells every subscribed replica to drop the given items from its cache
+func (r *RedisClient) PublishItemInvalidation(ctx context.Context, itemIDs []string) error {
+	data, err := json.Marshal(itemIDs)
+	if err != nil {
+		return fmt.Errorf("failed to encode item invalidation: %w", err)
+	}
+
+	if err := r.client.Publish(ctx, itemInvalidationChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish item invalidation: %w", err)
+	}
+
+	return nil
+}
+
+// ReceiveItemInvalidations subscribes to item invalidations and passes each one to handle
+func (r *RedisClient) ReceiveItemInvalidations(ctx context.Context, handle func(itemIDs []string)) error {
+	pubsub := r.client.Subscribe(ctx, itemInvalidationChannel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to item invalidations: %w", err)
+	}
+	handle(nil)
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("item invalidation subscription failed: %w", err)
+		}
+
+		var itemIDs []string
+		if err := json.Unmarshal([]byte(msg.Payload), &itemIDs); err != nil || len(itemIDs) == 0 {
+			log.Printf("Warning: invalid item invalidation %q, dropping all cached items", msg.Payload)
+			itemIDs = nil
+		}
+		handle(itemIDs)
+	}
+}
+
+// Write-behind persistence stream and the consumer group of Postgres writers
+const (
+	persistenceStream = "persist:events"
+	persistenceGroup  = "persisters"
+)
+
+// EnsurePersistenceGroup creates the write-behind stream and its consumer group if missing
+func (r *RedisClient) EnsurePersistenceGroup(ctx context.Context) error {
+	err := r.client.XGroupCreateMkStream(ctx, persistenceStream, persistenceGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create persistence group: %w", err)
+	}
+
+	return nil
+}
+
+// EnqueuePersistence appends an event to the write-behind stream. Once it returns,
+// the event is delivered to a writer at least once.
+func (r *RedisClient) EnqueuePersistence(ctx context.Context, event *interfaces.PersistenceEvent) error {
+	data, err := encodePersistenceEvent(event)
+	if err != nil {
+		return err
+	}
+
+	err = r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: persistenceStream,
+		Values: map[string]interface{}{"event": data},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue persistence event: %w", err)
+	}
+
+	return nil
+}
+
+// encodePersistenceEvent encodes an event for the stream; nil encodes to "", which the
+// purchase and reserve scripts take as nothing to queue
+func encodePersistenceEvent(event *interfaces.PersistenceEvent) (string, error) {
+	if event == nil {
+		return "", nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode persistence event: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// ReadPersistence returns up to count events not yet delivered to any writer,
+// without blocking. They stay pending for consumer until acknowledged.
+func (r *RedisClient) ReadPersistence(ctx context.Context, consumer string, count int) ([]interfaces.PersistenceEvent, error) {
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    persistenceGroup,
+		Consumer: consumer,
+		Streams:  []string{persistenceStream, ">"},
+		Count:    int64(count),
+		Block:    -1,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persistence events: %w", err)
+	}
+
+	var messages []redis.XMessage
+	for _, stream := range streams {
+		messages = append(messages, stream.Messages...)
+	}
+
+	return r.decodePersistenceEvents(ctx, messages), nil
+}
+
+// ClaimStalePersistence takes over up to count events that were delivered but not
+// acknowledged for at least minIdle, e.g. because their writer failed or died
+func (r *RedisClient) ClaimStalePersistence(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]interfaces.PersistenceEvent, error) {
+	messages, _, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   persistenceStream,
+		Group:    persistenceGroup,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    int64(count),
+		Consumer: consumer,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to claim persistence events: %w", err)
+	}
+
+	return r.decodePersistenceEvents(ctx, messages), nil
+}
+
+// AckPersistence marks events as persisted and removes them from the stream
+func (r *RedisClient) AckPersistence(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.XAck(ctx, persistenceStream, persistenceGroup, ids...)
+	pipe.XDel(ctx, persistenceStream, ids...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge persistence events: %w", err)
+	}
+
+	return nil
+}
+
+// PendingPersistence returns how many events of the sale are still in the write-behind
+// stream, i.e. not yet acknowledged as persisted
+func (r *RedisClient) PendingPersistence(ctx context.Context, saleID int) (int, error) {
+	const batchSize = 1000
+	pending := 0
+	start := "-"
+	for {
+		messages, err := r.client.XRangeN(ctx, persistenceStream, start, "+", batchSize).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read persistence stream: %w", err)
+		}
+
+		for _, message := range messages {
+			var event interfaces.PersistenceEvent
+			data, _ := message.Values["event"].(string)
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue // Dropped by the writer that reads it
+			}
+			if (event.Checkout != nil && event.Checkout.SaleID == saleID) || (event.Purchase != nil && event.Purchase.SaleID == saleID) {
+				pending++
+			}
+		}
+
+		if len(messages) < batchSize {
+			return pending, nil
+		}
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+// decodePersistenceEvents decodes stream entries. Entries that cannot be decoded
+// can never be persisted, so they are logged and acknowledged instead of retried forever.
+func (r *RedisClient) decodePersistenceEvents(ctx context.Context, messages []redis.XMessage) []interfaces.PersistenceEvent {
+	events := make([]interfaces.PersistenceEvent, 0, len(messages))
+	var malformed []string
+
+	for _, message := range messages {
+		var event interfaces.PersistenceEvent
+		data, _ := message.Values["event"].(string)
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("Warning: dropping malformed persistence event %s: %v", message.ID, err)
+			malformed = append(malformed, message.ID)
+			continue
+		}
+		event.ID = message.ID
+		events = append(events, event)
+	}
+
+	if err := r.AckPersistence(ctx, malformed); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	return events
+}
+
 // Checkout code management
-func (r *RedisClient) CacheCheckoutCode(ctx context.Context, code string, saleID int, userID string, itemID string) error {
-	key := fmt.Sprintf("checkout:%s", code)
+
+// CacheCheckoutCode caches a checkout attempt for verification without a Postgres round trip.
+// The hash expires together with the checkout code, so Redis never accepts a code that
+// Postgres considers expired.
+func (r *RedisClient) CacheCheckoutCode(ctx context.Context, checkout *models.Checkout) error {
+	if !checkout.ExpiresAt.After(time.Now()) {
+		return nil // Already expired, nothing to verify
+	}
+
+	key := fmt.Sprintf("checkout:%s", checkout.Code)
 	
 	// Store checkout data as hash
 	data := map[string]interface{}{
-		"sale_id": saleID,
-		"user_id": userID,
-		"item_id": itemID,
-		"used":    "false",
-		"created": time.Now().Unix(),
+		"checkout_id": checkout.ID,
+		"sale_id":     checkout.SaleID,
+		"user_id":     checkout.UserID,
+		"item_id":     checkout.ItemID,
+		"used":        "false",
+		"expires_at":  checkout.ExpiresAt.UnixMilli(),
+		"created":     time.Now().Unix(),
 	}
 
-	err := r.client.HMSet(ctx, key, data).Err()
-	if err != nil {
+	// Write the hash and its expiry together so it never outlives the code
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, key, data)
+	pipe.PExpireAt(ctx, key, checkout.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("failed to cache checkout code: %w", err)
 	}
 
-	// Set expiration (1 hour)
-	err = r.client.Expire(ctx, key, time.Hour).Err()
-	if err != nil {
-		return fmt.Errorf("failed to set checkout code expiration: %w", err)
-	}
-
 	return nil
 }
 
@@ -325,6 +1322,26 @@ func (r *RedisClient) InvalidateCheckoutCode(ctx context.Context, code string) e
 	return nil
 }
 
+// RemoveExpiredCheckoutCodes deletes the cached hashes of expired checkout codes,
+// keeping codes already consumed by a purchase, and returns how many were removed
+func (r *RedisClient) RemoveExpiredCheckoutCodes(ctx context.Context, codes []string) (int, error) {
+	if len(codes) == 0 {
+		return 0, nil
+	}
+
+	args := make([]interface{}, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+
+	removed, err := r.cleanupExpiredScript.Run(ctx, r.client, []string{}, args...).Int()
+	if err != nil {
+		return 0, fmt.Errorf("cleanup expired script failed: %w", err)
+	}
+
+	return removed, nil
+}
+
 // Performance metrics
 func (r *RedisClient) GetConnectionStats() interface{} {
 	return r.client.PoolStats()
@@ -423,47 +1440,83 @@ func (r *RedisClient) HealthCheck(ctx context.Context) map[string]interface{} {
 }
 
 // SetCheckoutCode is an alias for CacheCheckoutCode for compatibility
-func (r *RedisClient) SetCheckoutCode(ctx context.Context, code string, saleID int, userID string, itemID string) error {
-	return r.CacheCheckoutCode(ctx, code, saleID, userID, itemID)
+func (r *RedisClient) SetCheckoutCode(ctx context.Context, checkout *models.Checkout) error {
+	return r.CacheCheckoutCode(ctx, checkout)
 }
 
-// GetCheckoutCode retrieves checkout data and returns as a Checkout model for compatibility
+// GetCheckoutCode returns the cached checkout attempt, with status "used" once a purchase
+// consumed the code. Codes cached without their ID and expiry are reported as not found,
+// so callers fall back to Postgres.
 func (r *RedisClient) GetCheckoutCode(ctx context.Context, code string) (*models.Checkout, error) {
-	saleID, userID, itemID, err := r.GetCheckoutData(ctx, code)
+	key := fmt.Sprintf("checkout:%s", code)
+
+	result, err := r.client.HMGet(ctx, key, "checkout_id", "sale_id", "user_id", "item_id", "used", "expires_at").Result()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get checkout data: %w", err)
 	}
-	
+
+	for _, field := range result {
+		if field == nil {
+			return nil, fmt.Errorf("checkout code not found")
+		}
+	}
+
+	checkoutID, err := strconv.Atoi(result[0].(string))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkout ID: %w", err)
+	}
+
+	saleID, err := strconv.Atoi(result[1].(string))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sale ID: %w", err)
+	}
+
+	expiresAt, err := strconv.ParseInt(result[5].(string), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expiry: %w", err)
+	}
+
+	status := "pending"
+	if result[4] == "true" {
+		status = "used"
+	}
+
 	// Create a checkout model from the cached data
 	checkout := &models.Checkout{
-		Code:   code,
-		SaleID: saleID,
-		UserID: userID,
-		ItemID: itemID,
-		Status: "pending", // Default status for cached codes
+		ID:        checkoutID,
+		Code:      code,
+		SaleID:    saleID,
+		UserID:    result[2].(string),
+		ItemID:    result[3].(string),
+		Status:    status,
+		ExpiresAt: time.UnixMilli(expiresAt),
 	}
 	
 	return checkout, nil
 }
 
-// AttemptPurchase performs an atomic purchase operation and returns a PurchaseResult
-func (r *RedisClient) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string) (*interfaces.PurchaseResult, error) {
-	// Use the existing AtomicPurchase method with default limits
-	success, message, totalSold, userPurchases, err := r.AtomicPurchase(ctx, saleID, userID, 10000, 10)
+// AttemptPurchase performs an atomic purchase operation and returns a PurchaseResult.
+// The checkout code is consumed, and event queued for write-behind, in the same script
+// as the counter increments.
+func (r *RedisClient) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, event *interfaces.PersistenceEvent) (*interfaces.PurchaseResult, error) {
+	data, err := encodePersistenceEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limits come from the sale's Redis keys, written by SetupSale
+	success, status, totalSold, userPurchases, err := r.atomicPurchase(ctx, saleID, userID, itemID, code, 0, 0, data)
 	if err != nil {
 		return nil, err
 	}
 	
 	// Convert to PurchaseResult format
 	result := &interfaces.PurchaseResult{
-		Status:        message,
+		Status:        status,
 		UserPurchases: userPurchases,
 		TotalSold:     totalSold,
 		ItemID:        itemID,
-	}
-	
-	if success {
-		result.Status = "success"
+		Queued:        success && event != nil,
 	}
 	
 	return result, nil
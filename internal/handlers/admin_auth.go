@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+)
+
+const defaultAdminActor = "admin"
+
+// AdminAuth authenticates operator requests to the admin handlers and records their
+// actions in the audit log
+type AdminAuth struct {
+	db        interfaces.DatabaseInterface
+	token     string            // Shared token; its requests are audited as defaultAdminActor
+	operators map[string]string // Operator name -> token; requests are audited under the name
+}
+
+type adminActorKey struct{}
+
+// NewAdminAuth creates the admin authenticator, auditing to db.
+// Requests must carry "Authorization: Bearer <token>" with the shared token or an operator
+// token; with an empty token and no operator tokens every request is rejected.
+func NewAdminAuth(db interfaces.DatabaseInterface, token string) *AdminAuth {
+	return &AdminAuth{
+		db:    db,
+		token: token,
+	}
+}
+
+// SetOperatorTokens adds a token per operator (operator name -> token), so audit entries
+// name the operator who made each request
+func (a *AdminAuth) SetOperatorTokens(tokens map[string]string) {
+	a.operators = tokens
+}
+
+// ParseOperatorTokens parses operator tokens from "alice=token1,bob=token2"
+func ParseOperatorTokens(spec string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid operator token entry, expected operator=token")
+		}
+
+		name, token := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if _, exists := tokens[name]; exists {
+			return nil, fmt.Errorf("operator %s has more than one token", name)
+		}
+		if seen[token] {
+			return nil, fmt.Errorf("operator %s shares a token with another operator", name)
+		}
+
+		tokens[name] = token
+		seen[token] = true
+	}
+
+	return tokens, nil
+}
+
+// authenticate checks the bearer token in constant time against the shared token and every
+// operator token. The returned request carries the actor the token belongs to.
+func (a *AdminAuth) authenticate(r *http.Request) (*http.Request, bool) {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return r, false
+	}
+	presented := []byte(header[len(prefix):])
+
+	actor := ""
+	if a.token != "" && subtle.ConstantTimeCompare(presented, []byte(a.token)) == 1 {
+		actor = defaultAdminActor
+	}
+	for name, token := range a.operators {
+		if token != "" && subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+			actor = name
+		}
+	}
+
+	if actor == "" {
+		return r, false
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), adminActorKey{}, actor)), true
+}
+
+// recordAudit writes an audit entry for an admin action. Failures are logged, not returned,
+// so an audit outage never masks the outcome of an action that already happened.
+// The actor is the operator the request's token belongs to; the X-Admin-User header is
+// self-reported by the caller and only recorded in the details, as claimed_user.
+func (a *AdminAuth) recordAudit(ctx context.Context, r *http.Request, action string, saleID int, success bool, request interface{}, actionErr error) {
+	actor, _ := r.Context().Value(adminActorKey{}).(string)
+	if actor == "" {
+		actor = defaultAdminActor
+	}
+
+	details := make(map[string]interface{})
+	if request != nil {
+		details["request"] = request
+	}
+	if actionErr != nil {
+		details["error"] = actionErr.Error()
+	}
+	if claimed := r.Header.Get("X-Admin-User"); claimed != "" {
+		details["claimed_user"] = claimed
+	}
+
+	entry := &models.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		SaleID:  saleID,
+		Success: success,
+	}
+
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("Warning: failed to encode audit details for %s: %v", action, err)
+		} else {
+			entry.Details = string(encoded)
+		}
+	}
+
+	if err := a.db.CreateAuditEntry(ctx, entry); err != nil {
+		log.Printf("Warning: failed to record audit entry %s for sale %d by %s: %v", action, saleID, actor, err)
+	}
+}
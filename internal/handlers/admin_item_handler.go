@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// Admin item audit actions
+const (
+	AuditActionCreateItem   = "create_item"
+	AuditActionUpdateItem   = "update_item"
+	AuditActionUpdatePrices = "update_item_prices"
+	AuditActionRetireItem   = "retire_item"
+)
+
+// AdminItemHandler handles /admin/items requests for operators
+type AdminItemHandler struct {
+	catalog interfaces.ItemCatalog // Item management is unavailable when nil
+	auth    *AdminAuth
+}
+
+// NewAdminItemHandler creates a new admin item handler whose requests are authenticated
+// and audited by auth. A nil catalog makes every request fail with 503.
+func NewAdminItemHandler(catalog interfaces.ItemCatalog, auth *AdminAuth) *AdminItemHandler {
+	return &AdminItemHandler{
+		catalog: catalog,
+		auth:    auth,
+	}
+}
+
+// AdminItemRequest represents the create and update item request structure.
+// The item ID comes from the path when updating. The price is either
+// {"amount": 1999, "currency": "USD"} or a decimal in models.DefaultCurrency.
+type AdminItemRequest struct {
+	ID          string       `json:"id,omitempty"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Price       models.Money `json:"price"`
+}
+
+// AdminItemPricesRequest represents the bulk price update request structure
+type AdminItemPricesRequest struct {
+	Prices []models.ItemPrice `json:"prices"`
+}
+
+// AdminItemResponse represents the admin item response structure
+type AdminItemResponse struct {
+	Success bool          `json:"success"`
+	Item    *models.Item  `json:"item,omitempty"`
+	Items   []models.Item `json:"items,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// HandleItems routes /admin/items requests:
+//
+//	GET   /admin/items               list catalog items (?include_retired=true for all)
+//	POST  /admin/items               create an item
+//	PATCH /admin/items               change the prices of several items at once
+//	GET   /admin/items/{id}          inspect an item
+//	PUT   /admin/items/{id}          update an item's name, description and price
+//	POST  /admin/items/{id}/retire   stop an item from being checked out
+func (ih *AdminItemHandler) HandleItems(w http.ResponseWriter, r *http.Request) {
+	// 1. Authenticate
+	r, ok := ih.auth.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		ih.sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if ih.catalog == nil {
+		ih.sendErrorResponse(w, http.StatusServiceUnavailable, "Item management requires PostgreSQL")
+		return
+	}
+
+	// 2. Route on the path below /admin/items
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/items"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			ih.listItems(w, r)
+		case http.MethodPost:
+			ih.createItem(w, r)
+		case http.MethodPatch:
+			ih.updateItemPrices(w, r)
+		default:
+			ih.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "retire") {
+		ih.sendErrorResponse(w, http.StatusNotFound, "Not found")
+		return
+	}
+	itemID := parts[0]
+
+	// 3. Dispatch the item action
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		ih.inspectItem(w, r, itemID)
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		ih.updateItem(w, r, itemID)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		ih.retireItem(w, r, itemID)
+	default:
+		ih.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// listItems handles GET /admin/items
+func (ih *AdminItemHandler) listItems(w http.ResponseWriter, r *http.Request) {
+	includeRetired := r.URL.Query().Get("include_retired") == "true"
+
+	items, err := ih.catalog.ListItems(r.Context(), includeRetired)
+	if err != nil {
+		log.Printf("Error listing catalog items: %v", err)
+		ih.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list items")
+		return
+	}
+
+	ih.sendResponse(w, http.StatusOK, &AdminItemResponse{Success: true, Items: items})
+}
+
+// inspectItem handles GET /admin/items/{id}
+func (ih *AdminItemHandler) inspectItem(w http.ResponseWriter, r *http.Request, itemID string) {
+	item, err := ih.catalog.LookupItem(r.Context(), itemID)
+	if err != nil {
+		ih.sendItemError(w, itemID, err)
+		return
+	}
+
+	ih.sendResponse(w, http.StatusOK, &AdminItemResponse{Success: true, Item: item})
+}
+
+// createItem handles POST /admin/items
+func (ih *AdminItemHandler) createItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req AdminItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ih.sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %v", err))
+		return
+	}
+
+	item := &models.Item{ID: req.ID, Name: req.Name, Description: req.Description, Price: req.Price}
+	if err := ih.catalog.CreateItem(ctx, item); err != nil {
+		ih.auth.recordAudit(ctx, r, AuditActionCreateItem, 0, false, req, err)
+		ih.sendItemError(w, req.ID, err)
+		return
+	}
+
+	ih.auth.recordAudit(ctx, r, AuditActionCreateItem, 0, true, req, nil)
+
+	// Respond with the item as stored, including its creation time
+	if stored, err := ih.catalog.LookupItem(ctx, item.ID); err == nil {
+		item = stored
+	}
+	ih.sendResponse(w, http.StatusCreated, &AdminItemResponse{Success: true, Item: item})
+}
+
+// updateItem handles PUT /admin/items/{id}
+func (ih *AdminItemHandler) updateItem(w http.ResponseWriter, r *http.Request, itemID string) {
+	ctx := r.Context()
+
+	var req AdminItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ih.sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %v", err))
+		return
+	}
+
+	if req.ID != "" && req.ID != itemID {
+		ih.sendErrorResponse(w, http.StatusBadRequest, "Item ID in body does not match the path")
+		return
+	}
+	req.ID = itemID
+
+	item := &models.Item{ID: itemID, Name: req.Name, Description: req.Description, Price: req.Price}
+	if err := ih.catalog.UpdateItem(ctx, item); err != nil {
+		ih.auth.recordAudit(ctx, r, AuditActionUpdateItem, 0, false, req, err)
+		ih.sendItemError(w, itemID, err)
+		return
+	}
+
+	ih.auth.recordAudit(ctx, r, AuditActionUpdateItem, 0, true, req, nil)
+	ih.sendResponse(w, http.StatusOK, &AdminItemResponse{Success: true, Item: item})
+}
+
+// updateItemPrices handles PATCH /admin/items
+func (ih *AdminItemHandler) updateItemPrices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req AdminItemPricesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ih.sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON format: %v", err))
+		return
+	}
+
+	if err := ih.catalog.UpdateItemPrices(ctx, req.Prices); err != nil {
+		ih.auth.recordAudit(ctx, r, AuditActionUpdatePrices, 0, false, req, err)
+		ih.sendItemError(w, "", err)
+		return
+	}
+
+	ih.auth.recordAudit(ctx, r, AuditActionUpdatePrices, 0, true, req, nil)
+
+	items := make([]models.Item, 0, len(req.Prices))
+	for _, price := range req.Prices {
+		item, err := ih.catalog.LookupItem(ctx, price.ItemID)
+		if err != nil {
+			log.Printf("Warning: failed to reload item %s after price update: %v", price.ItemID, err)
+			continue
+		}
+		items = append(items, *item)
+	}
+
+	ih.sendResponse(w, http.StatusOK, &AdminItemResponse{Success: true, Items: items})
+}
+
+// retireItem handles POST /admin/items/{id}/retire
+func (ih *AdminItemHandler) retireItem(w http.ResponseWriter, r *http.Request, itemID string) {
+	ctx := r.Context()
+	details := map[string]string{"item_id": itemID}
+
+	item, err := ih.catalog.RetireItem(ctx, itemID)
+	if err != nil {
+		ih.auth.recordAudit(ctx, r, AuditActionRetireItem, 0, false, details, err)
+		ih.sendItemError(w, itemID, err)
+		return
+	}
+
+	ih.auth.recordAudit(ctx, r, AuditActionRetireItem, 0, true, details, nil)
+	ih.sendResponse(w, http.StatusOK, &AdminItemResponse{Success: true, Item: item})
+}
+
+// sendItemError maps an item catalog error to its HTTP response
+func (ih *AdminItemHandler) sendItemError(w http.ResponseWriter, itemID string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidItem):
+		ih.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrItemNotInCatalog):
+		ih.sendErrorResponse(w, http.StatusNotFound, "Item not found")
+	case errors.Is(err, services.ErrItemExists):
+		ih.sendErrorResponse(w, http.StatusConflict, "Item already exists")
+	case errors.Is(err, services.ErrItemPriceLocked):
+		ih.sendErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrItemRetired):
+		ih.sendErrorResponse(w, http.StatusConflict, "Item is already retired")
+	default:
+		log.Printf("Error managing item %s: %v", itemID, err)
+		ih.sendErrorResponse(w, http.StatusInternalServerError, "Failed to manage item")
+	}
+}
+
+// sendResponse sends a JSON response
+func (ih *AdminItemHandler) sendResponse(w http.ResponseWriter, statusCode int, response *AdminItemResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendErrorResponse sends a standardized error response
+func (ih *AdminItemHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	ih.sendResponse(w, statusCode, &AdminItemResponse{
+		Success: false,
+		Error:   message,
+	})
+}
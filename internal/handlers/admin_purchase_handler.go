@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// Admin purchase audit actions
+const (
+	AuditActionRefundPurchase = "refund_purchase"
+	AuditActionCancelPurchase = "cancel_purchase"
+)
+
+// AdminPurchaseHandler handles /admin/purchases requests for operators
+type AdminPurchaseHandler struct {
+	refunder interfaces.PurchaseRefunder // Refunds are unavailable when nil
+	auth     *AdminAuth
+}
+
+// NewAdminPurchaseHandler creates a new admin purchase handler whose requests are
+// authenticated and audited by auth. A nil refunder makes every refund fail with 503.
+func NewAdminPurchaseHandler(refunder interfaces.PurchaseRefunder, auth *AdminAuth) *AdminPurchaseHandler {
+	return &AdminPurchaseHandler{
+		refunder: refunder,
+		auth:     auth,
+	}
+}
+
+// AdminReversePurchaseRequest represents the optional body of a refund or cancel request
+type AdminReversePurchaseRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// AdminPurchaseResponse represents the admin purchase response structure
+type AdminPurchaseResponse struct {
+	Success  bool             `json:"success"`
+	Purchase *models.Purchase `json:"purchase,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// HandlePurchases routes /admin/purchases requests:
+//
+//	POST /admin/purchases/{code}/refund refund a purchase, returning its item to the sale
+//	POST /admin/purchases/{code}/cancel cancel a purchase, returning its item to the sale
+func (ph *AdminPurchaseHandler) HandlePurchases(w http.ResponseWriter, r *http.Request) {
+	// 1. Authenticate
+	r, ok := ph.auth.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		ph.sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// 2. Route on the path below /admin/purchases
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/purchases"), "/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || (parts[1] != "refund" && parts[1] != "cancel") {
+		ph.sendErrorResponse(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		ph.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// 3. Reverse the purchase
+	ph.reversePurchase(w, r, parts[0], parts[1])
+}
+
+// reversePurchase handles POST /admin/purchases/{code}/refund and /admin/purchases/{code}/cancel
+func (ph *AdminPurchaseHandler) reversePurchase(w http.ResponseWriter, r *http.Request, code string, action string) {
+	ctx := r.Context()
+
+	if ph.refunder == nil {
+		ph.sendErrorResponse(w, http.StatusServiceUnavailable, "Refunds require PostgreSQL")
+		return
+	}
+
+	var req AdminReversePurchaseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			ph.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+	}
+
+	auditAction, reverse := AuditActionRefundPurchase, ph.refunder.RefundPurchase
+	if action == "cancel" {
+		auditAction, reverse = AuditActionCancelPurchase, ph.refunder.CancelPurchase
+	}
+	details := map[string]string{"code": code, "reason": req.Reason}
+
+	purchase, err := reverse(ctx, code)
+	switch {
+	case errors.Is(err, services.ErrPurchaseNotFound):
+		ph.auth.recordAudit(ctx, r, auditAction, 0, false, details, err)
+		ph.sendErrorResponse(w, http.StatusNotFound, "Purchase not found")
+	case errors.Is(err, services.ErrPurchaseNotCompleted):
+		ph.auth.recordAudit(ctx, r, auditAction, purchase.SaleID, false, details, err)
+		ph.sendErrorResponse(w, http.StatusConflict, fmt.Sprintf("Purchase is already %s", purchase.Status))
+	case err != nil:
+		log.Printf("Error reversing purchase %s: %v", code, err)
+		ph.auth.recordAudit(ctx, r, auditAction, 0, false, details, err)
+		ph.sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to %s purchase", action))
+	default:
+		ph.auth.recordAudit(ctx, r, auditAction, purchase.SaleID, true, details, nil)
+		ph.sendResponse(w, http.StatusOK, &AdminPurchaseResponse{Success: true, Purchase: purchase})
+	}
+}
+
+// sendResponse sends a JSON response
+func (ph *AdminPurchaseHandler) sendResponse(w http.ResponseWriter, statusCode int, response *AdminPurchaseResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendErrorResponse sends a standardized error response
+func (ph *AdminPurchaseHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	ph.sendResponse(w, statusCode, &AdminPurchaseResponse{
+		Success: false,
+		Error:   message,
+	})
+}
@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// Admin audit actions
+const (
+	AuditActionCreateSale     = "create_sale"
+	AuditActionActivateSale   = "activate_sale"
+	AuditActionDeactivateSale = "deactivate_sale"
+	AuditActionExtendSale     = "extend_sale"
+	AuditActionScheduleSale   = "schedule_sale"
+	AuditActionCancelSchedule = "cancel_scheduled_sale"
+)
+
+const (
+	defaultAdminListLimit = 50
+	maxAdminListLimit     = 500
+)
+
+// AdminSaleHandler handles /admin/sales and /admin/schedule requests for operators
+type AdminSaleHandler struct {
+	saleService interfaces.SaleService
+	scheduler   interfaces.SaleScheduler
+	db          interfaces.DatabaseInterface
+	redis       interfaces.RedisInterface
+	auth        *AdminAuth
+}
+
+// NewAdminSaleHandler creates a new admin sale handler whose requests are authenticated
+// and audited by auth
+func NewAdminSaleHandler(
+	saleService interfaces.SaleService,
+	scheduler interfaces.SaleScheduler,
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+	auth *AdminAuth,
+) *AdminSaleHandler {
+	return &AdminSaleHandler{
+		saleService: saleService,
+		scheduler:   scheduler,
+		db:          db,
+		redis:       redis,
+		auth:        auth,
+	}
+}
+
+// AdminCreateSaleRequest represents the create sale request structure
+type AdminCreateSaleRequest struct {
+	StartTime      time.Time         `json:"start_time"`
+	EndTime        time.Time         `json:"end_time"`
+	ItemsAvailable int               `json:"items_available"`
+	MaxPerUser     int               `json:"max_per_user"`
+	Items          []models.SaleItem `json:"items,omitempty"`
+	Activate       bool              `json:"activate"`
+}
+
+// AdminExtendSaleRequest represents the extend sale request structure.
+// Either EndTime or ExtendBy (a Go duration such as "30m") must be set.
+type AdminExtendSaleRequest struct {
+	EndTime  *time.Time `json:"end_time,omitempty"`
+	ExtendBy string     `json:"extend_by,omitempty"`
+}
+
+// AdminScheduleRequest represents the schedule sale window request structure.
+// Limits left at 0 use the server defaults when the window starts.
+type AdminScheduleRequest struct {
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	ItemsAvailable int       `json:"items_available,omitempty"`
+	MaxPerUser     int       `json:"max_per_user,omitempty"`
+}
+
+// AdminSaleLiveCounters holds the real-time Redis counters of a sale
+type AdminSaleLiveCounters struct {
+	ItemsSold    int            `json:"items_sold"`
+	ItemStock    map[string]int `json:"item_stock,omitempty"`
+	ActiveSaleID int            `json:"active_sale_id"`
+}
+
+// AdminSaleResponse represents the admin sale response structure
+type AdminSaleResponse struct {
+	Success bool                   `json:"success"`
+	Sale    *models.Sale           `json:"sale,omitempty"`
+	Sales   []models.Sale          `json:"sales,omitempty"`
+	Items   []models.SaleItem      `json:"items,omitempty"`
+	Live    *AdminSaleLiveCounters `json:"live,omitempty"`
+	Window  *models.SaleWindow     `json:"window,omitempty"`
+	Windows []models.SaleWindow    `json:"windows,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// HandleSales routes /admin/sales requests:
+//
+//	GET  /admin/sales                 list recent sales
+//	POST /admin/sales                 create a sale
+//	GET  /admin/sales/{id}            inspect a sale with live Redis counters
+//	POST /admin/sales/{id}/activate   activate a sale
+//	POST /admin/sales/{id}/deactivate deactivate a sale
+//	POST /admin/sales/{id}/extend     move the end time of a sale later
+func (ah *AdminSaleHandler) HandleSales(w http.ResponseWriter, r *http.Request) {
+	// 1. Authenticate
+	r, ok := ah.auth.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		ah.sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// 2. Route on the path below /admin/sales
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/sales"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			ah.listSales(w, r)
+		case http.MethodPost:
+			ah.createSale(w, r)
+		default:
+			ah.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	saleID, err := strconv.Atoi(parts[0])
+	if err != nil || saleID <= 0 || len(parts) > 2 {
+		ah.sendErrorResponse(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	// 3. Dispatch the sale action
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		ah.inspectSale(w, r, saleID)
+	case action == "activate" && r.Method == http.MethodPost:
+		ah.activateSale(w, r, saleID)
+	case action == "deactivate" && r.Method == http.MethodPost:
+		ah.deactivateSale(w, r, saleID)
+	case action == "extend" && r.Method == http.MethodPost:
+		ah.extendSale(w, r, saleID)
+	case action == "" || action == "activate" || action == "deactivate" || action == "extend":
+		ah.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		ah.sendErrorResponse(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// HandleSchedule routes /admin/schedule requests:
+//
+//	GET  /admin/schedule             list pending and active sale windows
+//	POST /admin/schedule             schedule a sale window
+//	POST /admin/schedule/{id}/cancel cancel a pending sale window
+func (ah *AdminSaleHandler) HandleSchedule(w http.ResponseWriter, r *http.Request) {
+	// 1. Authenticate
+	r, ok := ah.auth.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		ah.sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// 2. Route on the path below /admin/schedule
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/schedule"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			ah.listSchedule(w, r)
+		case http.MethodPost:
+			ah.scheduleWindow(w, r)
+		default:
+			ah.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	windowID, err := strconv.Atoi(parts[0])
+	if err != nil || windowID <= 0 || len(parts) != 2 || parts[1] != "cancel" {
+		ah.sendErrorResponse(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		ah.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// 3. Cancel the window
+	ah.cancelWindow(w, r, windowID)
+}
+
+// listSchedule handles GET /admin/schedule
+func (ah *AdminSaleHandler) listSchedule(w http.ResponseWriter, r *http.Request) {
+	var windows []models.SaleWindow
+	for _, status := range []string{models.SaleWindowActive, models.SaleWindowPending} {
+		found, err := ah.db.GetSaleWindowsByStatus(r.Context(), status)
+		if err != nil {
+			log.Printf("Error listing %s sale windows: %v", status, err)
+			ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list schedule")
+			return
+		}
+		windows = append(windows, found...)
+	}
+
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{Success: true, Windows: windows})
+}
+
+// scheduleWindow handles POST /admin/schedule
+func (ah *AdminSaleHandler) scheduleWindow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req AdminScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ah.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	if req.StartTime.IsZero() || req.EndTime.IsZero() {
+		err := fmt.Errorf("start_time and end_time are required")
+		ah.auth.recordAudit(ctx, r, AuditActionScheduleSale, 0, false, req, err)
+		ah.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window := &models.SaleWindow{
+		StartTime:      req.StartTime,
+		EndTime:        req.EndTime,
+		ItemsAvailable: req.ItemsAvailable,
+		MaxPerUser:     req.MaxPerUser,
+		Source:         models.SaleWindowSourceManual,
+	}
+
+	created, err := ah.scheduler.ScheduleWindow(ctx, window)
+	if err != nil {
+		ah.auth.recordAudit(ctx, r, AuditActionScheduleSale, 0, false, req, err)
+		ah.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !created {
+		ah.auth.recordAudit(ctx, r, AuditActionScheduleSale, 0, false, req, fmt.Errorf("window already scheduled"))
+		ah.sendErrorResponse(w, http.StatusConflict, "A sale window with these times is already scheduled")
+		return
+	}
+
+	ah.auth.recordAudit(ctx, r, AuditActionScheduleSale, 0, true, window, nil)
+	ah.sendResponse(w, http.StatusCreated, &AdminSaleResponse{Success: true, Window: window})
+}
+
+// cancelWindow handles POST /admin/schedule/{id}/cancel
+func (ah *AdminSaleHandler) cancelWindow(w http.ResponseWriter, r *http.Request, windowID int) {
+	ctx := r.Context()
+	details := map[string]int{"window_id": windowID}
+
+	cancelled, err := ah.db.CancelSaleWindow(ctx, windowID)
+	if err != nil {
+		log.Printf("Error cancelling sale window %d: %v", windowID, err)
+		ah.auth.recordAudit(ctx, r, AuditActionCancelSchedule, 0, false, details, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to cancel sale window")
+		return
+	}
+
+	if !cancelled {
+		ah.auth.recordAudit(ctx, r, AuditActionCancelSchedule, 0, false, details, fmt.Errorf("window not found or not pending"))
+		ah.sendErrorResponse(w, http.StatusConflict, "Sale window not found or already started")
+		return
+	}
+
+	ah.auth.recordAudit(ctx, r, AuditActionCancelSchedule, 0, true, details, nil)
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{Success: true})
+}
+
+// listSales handles GET /admin/sales?limit=N
+func (ah *AdminSaleHandler) listSales(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAdminListLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxAdminListLimit {
+			ah.sendErrorResponse(w, http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxAdminListLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	sales, err := ah.saleService.ListSales(r.Context(), limit)
+	if err != nil {
+		log.Printf("Error listing sales: %v", err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list sales")
+		return
+	}
+
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{Success: true, Sales: sales})
+}
+
+// createSale handles POST /admin/sales
+func (ah *AdminSaleHandler) createSale(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req AdminCreateSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ah.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	if err := ah.validateCreateSaleRequest(&req); err != nil {
+		ah.auth.recordAudit(ctx, r, AuditActionCreateSale, 0, false, req, err)
+		ah.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sale := &models.Sale{
+		StartTime:      req.StartTime,
+		EndTime:        req.EndTime,
+		ItemsAvailable: req.ItemsAvailable,
+		MaxPerUser:     req.MaxPerUser,
+		Active:         req.Activate,
+	}
+
+	sale, err := ah.saleService.CreateSale(ctx, sale, req.Items)
+	if err != nil {
+		log.Printf("Error creating sale: %v", err)
+		ah.auth.recordAudit(ctx, r, AuditActionCreateSale, 0, false, req, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create sale")
+		return
+	}
+
+	ah.auth.recordAudit(ctx, r, AuditActionCreateSale, sale.ID, true, req, nil)
+	ah.sendResponse(w, http.StatusCreated, &AdminSaleResponse{Success: true, Sale: sale, Items: req.Items})
+}
+
+// validateCreateSaleRequest validates the create sale request
+func (ah *AdminSaleHandler) validateCreateSaleRequest(req *AdminCreateSaleRequest) error {
+	if req.StartTime.IsZero() || req.EndTime.IsZero() {
+		return fmt.Errorf("start_time and end_time are required")
+	}
+
+	if !req.EndTime.After(req.StartTime) {
+		return fmt.Errorf("end_time must be after start_time")
+	}
+
+	if req.Activate && !req.EndTime.After(time.Now()) {
+		return fmt.Errorf("cannot activate a sale that has already ended")
+	}
+
+	if req.ItemsAvailable <= 0 {
+		return fmt.Errorf("items_available must be positive")
+	}
+
+	if req.MaxPerUser <= 0 {
+		return fmt.Errorf("max_per_user must be positive")
+	}
+
+	seen := make(map[string]bool, len(req.Items))
+	for _, item := range req.Items {
+		if item.ItemID == "" {
+			return fmt.Errorf("item_id is required for every sale item")
+		}
+
+		if item.Stock <= 0 {
+			return fmt.Errorf("stock for item %s must be positive", item.ItemID)
+		}
+
+		if seen[item.ItemID] {
+			return fmt.Errorf("duplicate sale item %s", item.ItemID)
+		}
+		seen[item.ItemID] = true
+	}
+
+	return nil
+}
+
+// inspectSale handles GET /admin/sales/{id}
+func (ah *AdminSaleHandler) inspectSale(w http.ResponseWriter, r *http.Request, saleID int) {
+	ctx := r.Context()
+
+	// GetSaleStatus already overlays the live Redis sold counter
+	sale, err := ah.saleService.GetSaleStatus(ctx, saleID)
+	if err != nil {
+		log.Printf("Error getting sale %d: %v", saleID, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to get sale")
+		return
+	}
+
+	if sale == nil {
+		ah.sendErrorResponse(w, http.StatusNotFound, "Sale not found")
+		return
+	}
+
+	items, err := ah.db.GetSaleItems(ctx, saleID)
+	if err != nil {
+		log.Printf("Warning: failed to get items for sale %d: %v", saleID, err)
+	}
+
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{
+		Success: true,
+		Sale:    sale,
+		Items:   items,
+		Live:    ah.liveCounters(ctx, saleID, items),
+	})
+}
+
+// liveCounters reads the Redis counters of a sale, returning nil if Redis is unavailable
+func (ah *AdminSaleHandler) liveCounters(ctx context.Context, saleID int, items []models.SaleItem) *AdminSaleLiveCounters {
+	sold, err := ah.redis.GetSoldItems(ctx, saleID)
+	if err != nil {
+		log.Printf("Warning: failed to get live counters for sale %d: %v", saleID, err)
+		return nil
+	}
+
+	live := &AdminSaleLiveCounters{ItemsSold: sold}
+
+	if activeSaleID, err := ah.redis.GetActiveSaleID(ctx); err != nil {
+		log.Printf("Warning: failed to get active sale ID from Redis: %v", err)
+	} else {
+		live.ActiveSaleID = activeSaleID
+	}
+
+	for _, item := range items {
+		stock, err := ah.redis.GetSaleItemStock(ctx, saleID, item.ItemID)
+		if err != nil {
+			log.Printf("Warning: failed to get stock for item %s in sale %d: %v", item.ItemID, saleID, err)
+			continue
+		}
+
+		// Unrestricted sales and sales that were never set up have no item stock in Redis
+		if !stock.InSale || !stock.Restricted {
+			continue
+		}
+
+		if live.ItemStock == nil {
+			live.ItemStock = make(map[string]int, len(items))
+		}
+		live.ItemStock[item.ItemID] = stock.Remaining
+	}
+
+	return live
+}
+
+// activateSale handles POST /admin/sales/{id}/activate
+func (ah *AdminSaleHandler) activateSale(w http.ResponseWriter, r *http.Request, saleID int) {
+	ctx := r.Context()
+
+	sale, ok := ah.loadSale(w, r, saleID)
+	if !ok {
+		return
+	}
+
+	if sale.Active {
+		ah.auth.recordAudit(ctx, r, AuditActionActivateSale, saleID, false, nil, fmt.Errorf("sale is already active"))
+		ah.sendErrorResponse(w, http.StatusConflict, "Sale is already active")
+		return
+	}
+
+	if !sale.EndTime.After(time.Now()) {
+		ah.auth.recordAudit(ctx, r, AuditActionActivateSale, saleID, false, nil, fmt.Errorf("sale has already ended"))
+		ah.sendErrorResponse(w, http.StatusConflict, "Sale has already ended")
+		return
+	}
+
+	if err := ah.saleService.ActivateSale(ctx, saleID); err != nil {
+		log.Printf("Error activating sale %d: %v", saleID, err)
+		ah.auth.recordAudit(ctx, r, AuditActionActivateSale, saleID, false, nil, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to activate sale")
+		return
+	}
+
+	ah.auth.recordAudit(ctx, r, AuditActionActivateSale, saleID, true, nil, nil)
+	sale.Active = true
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{Success: true, Sale: sale})
+}
+
+// deactivateSale handles POST /admin/sales/{id}/deactivate
+func (ah *AdminSaleHandler) deactivateSale(w http.ResponseWriter, r *http.Request, saleID int) {
+	ctx := r.Context()
+
+	sale, ok := ah.loadSale(w, r, saleID)
+	if !ok {
+		return
+	}
+
+	if err := ah.saleService.DeactivateSale(ctx, saleID); err != nil {
+		log.Printf("Error deactivating sale %d: %v", saleID, err)
+		ah.auth.recordAudit(ctx, r, AuditActionDeactivateSale, saleID, false, nil, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to deactivate sale")
+		return
+	}
+
+	ah.auth.recordAudit(ctx, r, AuditActionDeactivateSale, saleID, true, nil, nil)
+	sale.Active = false
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{Success: true, Sale: sale})
+}
+
+// extendSale handles POST /admin/sales/{id}/extend
+func (ah *AdminSaleHandler) extendSale(w http.ResponseWriter, r *http.Request, saleID int) {
+	ctx := r.Context()
+
+	var req AdminExtendSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ah.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	sale, ok := ah.loadSale(w, r, saleID)
+	if !ok {
+		return
+	}
+
+	endTime, err := ah.resolveExtendedEndTime(sale, &req)
+	if err != nil {
+		ah.auth.recordAudit(ctx, r, AuditActionExtendSale, saleID, false, req, err)
+		ah.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	extended, err := ah.saleService.ExtendSale(ctx, saleID, endTime)
+	if errors.Is(err, services.ErrSaleNotExtendable) || errors.Is(err, services.ErrSaleWindowOverlap) {
+		ah.auth.recordAudit(ctx, r, AuditActionExtendSale, saleID, false, req, err)
+		ah.sendErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error extending sale %d: %v", saleID, err)
+		ah.auth.recordAudit(ctx, r, AuditActionExtendSale, saleID, false, req, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to extend sale")
+		return
+	}
+
+	ah.auth.recordAudit(ctx, r, AuditActionExtendSale, saleID, true, map[string]interface{}{
+		"previous_end_time": sale.EndTime,
+		"end_time":          endTime,
+	}, nil)
+	ah.sendResponse(w, http.StatusOK, &AdminSaleResponse{Success: true, Sale: extended})
+}
+
+// resolveExtendedEndTime computes and validates the new end time of an extend request
+func (ah *AdminSaleHandler) resolveExtendedEndTime(sale *models.Sale, req *AdminExtendSaleRequest) (time.Time, error) {
+	var endTime time.Time
+	switch {
+	case req.EndTime != nil && req.ExtendBy != "":
+		return time.Time{}, fmt.Errorf("specify either end_time or extend_by, not both")
+	case req.EndTime != nil:
+		endTime = *req.EndTime
+	case req.ExtendBy != "":
+		extendBy, err := time.ParseDuration(req.ExtendBy)
+		if err != nil || extendBy <= 0 {
+			return time.Time{}, fmt.Errorf("extend_by must be a positive duration such as \"30m\"")
+		}
+		endTime = sale.EndTime.Add(extendBy)
+	default:
+		return time.Time{}, fmt.Errorf("end_time or extend_by is required")
+	}
+
+	if !endTime.After(sale.EndTime) {
+		return time.Time{}, fmt.Errorf("end_time must be after the current end time %s", sale.EndTime.Format(time.RFC3339))
+	}
+
+	return endTime, nil
+}
+
+// loadSale fetches a sale for an action, writing the error response if it cannot
+func (ah *AdminSaleHandler) loadSale(w http.ResponseWriter, r *http.Request, saleID int) (*models.Sale, bool) {
+	sale, err := ah.db.GetSaleByID(r.Context(), saleID)
+	if err != nil {
+		log.Printf("Error getting sale %d: %v", saleID, err)
+		ah.sendErrorResponse(w, http.StatusInternalServerError, "Failed to get sale")
+		return nil, false
+	}
+
+	if sale == nil {
+		ah.sendErrorResponse(w, http.StatusNotFound, "Sale not found")
+		return nil, false
+	}
+
+	return sale, true
+}
+
+// sendResponse sends a JSON response
+func (ah *AdminSaleHandler) sendResponse(w http.ResponseWriter, statusCode int, response *AdminSaleResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendErrorResponse sends a standardized error response
+func (ah *AdminSaleHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	ah.sendResponse(w, statusCode, &AdminSaleResponse{
+		Success: false,
+		Error:   message,
+	})
+}
@@ -3,38 +3,31 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
-
-	"github.com/google/uuid"
+	"flash-sale-backend/internal/services"
 )
 
 // CheckoutHandler handles checkout-related HTTP requests
 type CheckoutHandler struct {
-	saleService interfaces.SaleService
-	itemService interfaces.ItemService
-	db          interfaces.DatabaseInterface
-	redis       interfaces.RedisInterface
+	checkouts interfaces.CheckoutService
+	auth      interfaces.Authenticator // Identifies the caller; user_id is taken from the request when nil
 }
 
 // NewCheckoutHandler creates a new checkout handler
-func NewCheckoutHandler(
-	saleService interfaces.SaleService,
-	itemService interfaces.ItemService,
-	db interfaces.DatabaseInterface,
-	redis interfaces.RedisInterface,
-) *CheckoutHandler {
-	return &CheckoutHandler{
-		saleService: saleService,
-		itemService: itemService,
-		db:          db,
-		redis:       redis,
-	}
+func NewCheckoutHandler(checkouts interfaces.CheckoutService) *CheckoutHandler {
+	return &CheckoutHandler{checkouts: checkouts}
+}
+
+// SetAuthenticator requires every checkout to be authenticated. The user ID is then taken
+// from the caller's token, and a user_id in the request must match it.
+func (ch *CheckoutHandler) SetAuthenticator(auth interfaces.Authenticator) {
+	ch.auth = auth
 }
 
 // CheckoutRequest represents the checkout request structure
@@ -46,10 +39,12 @@ type CheckoutRequest struct {
 // CheckoutResponse represents the checkout response structure
 type CheckoutResponse struct {
 	Success     bool      `json:"success"`
+	ErrorCode   string    `json:"error_code,omitempty"` // Machine-readable failure reason, as for purchases
 	CheckoutCode string   `json:"checkout_code,omitempty"`
 	Message     string    `json:"message,omitempty"`
 	ExpiresAt   time.Time `json:"expires_at,omitempty"`
 	Item        *models.Item `json:"item,omitempty"`
+	Reserved    bool      `json:"reserved,omitempty"`
 	Error       string    `json:"error,omitempty"`
 }
 
@@ -57,13 +52,26 @@ type CheckoutResponse struct {
 func (ch *CheckoutHandler) HandleCheckout(w http.ResponseWriter, r *http.Request) {
 	// Only accept POST requests
 	if r.Method != http.MethodPost {
-		ch.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		ch.sendErrorResponse(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Set response headers
 	w.Header().Set("Content-Type", "application/json")
 
+	// Authenticate the caller when authentication is enabled
+	callerID := ""
+	if ch.auth != nil {
+		userID, err := ch.auth.Authenticate(r)
+		if err != nil {
+			log.Printf("Checkout authentication failed: %v", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			ch.sendErrorResponse(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Authentication required")
+			return
+		}
+		callerID = userID
+	}
+
 	// Parse request
 	var req CheckoutRequest
 	
@@ -71,7 +79,7 @@ func (ch *CheckoutHandler) HandleCheckout(w http.ResponseWriter, r *http.Request
 	if r.Header.Get("Content-Type") == "application/json" {
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&req); err != nil {
-			ch.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+			ch.sendErrorResponse(w, http.StatusBadRequest, ErrorCodeInvalidRequest, "Invalid JSON format")
 			return
 		}
 	} else {
@@ -80,9 +88,18 @@ func (ch *CheckoutHandler) HandleCheckout(w http.ResponseWriter, r *http.Request
 		req.ItemID = r.URL.Query().Get("item_id")
 	}
 
+	// The authenticated user checks out for themselves
+	if callerID != "" {
+		if req.UserID != "" && req.UserID != callerID {
+			ch.sendErrorResponse(w, http.StatusForbidden, ErrorCodeForbidden, "user_id does not match the authenticated user")
+			return
+		}
+		req.UserID = callerID
+	}
+
 	// Validate request
-	if err := ch.validateCheckoutRequest(&req); err != nil {
-		ch.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	if err := ch.checkouts.ValidateCheckoutRequest(req.UserID, req.ItemID); err != nil {
+		ch.sendErrorResponse(w, http.StatusBadRequest, ErrorCodeInvalidRequest, err.Error())
 		return
 	}
 
@@ -90,130 +107,125 @@ func (ch *CheckoutHandler) HandleCheckout(w http.ResponseWriter, r *http.Request
 	ctx := context.Background()
 	response, statusCode := ch.processCheckout(ctx, &req)
 	
+	if statusCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
 
-// validateCheckoutRequest validates the checkout request parameters
-func (ch *CheckoutHandler) validateCheckoutRequest(req *CheckoutRequest) error {
-	if req.UserID == "" {
-		return fmt.Errorf("user_id is required")
-	}
-
-	if req.ItemID == "" {
-		return fmt.Errorf("item_id is required")
-	}
-
-	// Validate user ID format (basic validation)
-	if len(req.UserID) < 1 || len(req.UserID) > 100 {
-		return fmt.Errorf("user_id must be between 1 and 100 characters")
-	}
-
-	// Validate item ID format using item service
-	if err := ch.itemService.ValidateItemID(req.ItemID); err != nil {
-		return fmt.Errorf("invalid item_id: %w", err)
-	}
-
-	return nil
-}
-
-// processCheckout handles the core checkout logic
+// processCheckout issues a checkout code and maps the outcome to a response and HTTP status code
 func (ch *CheckoutHandler) processCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResponse, int) {
-	// 1. Check if there's an active sale
-	activeSale, err := ch.saleService.GetCurrentActiveSale(ctx)
-	if err != nil {
-		log.Printf("Error getting active sale: %v", err)
+	issued, err := ch.checkouts.ProcessCheckout(ctx, req.UserID, req.ItemID)
+
+	var limitErr *services.LimitError
+	switch {
+	case err == nil:
+		message := "Checkout code generated successfully"
+		if issued.Reserved {
+			message = "Item reserved until the checkout code expires"
+		}
+
 		return &CheckoutResponse{
-			Success: false,
-			Error:   "Unable to process checkout at this time",
-		}, http.StatusInternalServerError
-	}
+			Success:      true,
+			CheckoutCode: issued.Checkout.Code,
+			Message:      message,
+			ExpiresAt:    issued.Checkout.ExpiresAt,
+			Item:         issued.Item,
+			Reserved:     issued.Reserved,
+		}, http.StatusOK
+
+	case errors.Is(err, services.ErrNoActiveSale):
+		return &CheckoutResponse{
+			Success:   false,
+			ErrorCode: string(interfaces.PurchaseSaleNotActive),
+			Message:   "No active sale at this time",
+		}, http.StatusBadRequest
 
-	if activeSale == nil {
+	case errors.Is(err, services.ErrSaleNotRunning):
 		return &CheckoutResponse{
-			Success: false,
-			Message: "No active sale at this time",
+			Success:   false,
+			ErrorCode: string(interfaces.PurchaseSaleNotActive),
+			Message:   "Sale is not currently active",
 		}, http.StatusBadRequest
-	}
 
-	// 2. Check if sale is still within time window
-	now := time.Now()
-	if now.Before(activeSale.StartTime) || now.After(activeSale.EndTime) {
+	case errors.Is(err, services.ErrUnknownItem):
 		return &CheckoutResponse{
-			Success: false,
-			Message: "Sale is not currently active",
+			Success:   false,
+			ErrorCode: ErrorCodeItemNotFound,
+			Error:     "Invalid item",
 		}, http.StatusBadRequest
-	}
 
-	// 3. Validate item exists
-	item, err := ch.itemService.GetItemByID(ctx, req.ItemID)
-	if err != nil {
-		log.Printf("Error getting item %s: %v", req.ItemID, err)
+	case errors.Is(err, services.ErrItemRetired):
 		return &CheckoutResponse{
-			Success: false,
-			Error:   "Invalid item",
+			Success:   false,
+			ErrorCode: ErrorCodeItemNotFound,
+			Message:   "Item is no longer available",
 		}, http.StatusBadRequest
-	}
 
-	// 4. Generate unique checkout code
-	checkoutCode := ch.generateCheckoutCode()
-
-	// 5. Create checkout record
-	checkout := &models.Checkout{
-		Code:      checkoutCode,
-		UserID:    req.UserID,
-		ItemID:    req.ItemID,
-		SaleID:    activeSale.ID,
-		Status:    "pending",
-		ExpiresAt: now.Add(10 * time.Minute), // 10-minute expiration
-		CreatedAt: now,
-	}
+	case errors.As(err, &limitErr):
+		return checkoutRejection(limitErr.Status)
 
-	// 6. Persist checkout attempt in database
-	if err := ch.db.CreateCheckout(ctx, checkout); err != nil {
-		log.Printf("Error creating checkout record: %v", err)
+	default:
+		log.Printf("Error processing checkout: %v", err)
 		return &CheckoutResponse{
-			Success: false,
-			Error:   "Unable to process checkout",
+			Success:   false,
+			ErrorCode: ErrorCodeInternal,
+			Error:     "Unable to process checkout",
 		}, http.StatusInternalServerError
 	}
+}
 
-	// 7. Cache checkout code in Redis for fast verification (TTL: 10 minutes)
-	if err := ch.redis.SetCheckoutCode(ctx, checkoutCode, activeSale.ID, req.UserID, req.ItemID); err != nil {
-		log.Printf("Warning: Failed to cache checkout code in Redis: %v", err)
-		// Continue anyway - database has the record
+// checkoutRejection maps a checkout the sale refused to a response and HTTP status code.
+// The error code is the reservation status, as in purchaseOutcomeResponse.
+func checkoutRejection(status interfaces.PurchaseStatus) (*CheckoutResponse, int) {
+	response := &CheckoutResponse{
+		Success:   false,
+		ErrorCode: string(status),
 	}
 
-	// 8. Return successful response
-	return &CheckoutResponse{
-		Success:      true,
-		CheckoutCode: checkoutCode,
-		Message:      "Checkout code generated successfully",
-		ExpiresAt:    checkout.ExpiresAt,
-		Item:         item,
-	}, http.StatusOK
-}
+	switch status {
+	case interfaces.PurchaseItemSoldOut:
+		response.Message = "Sorry, this item is sold out"
+		return response, http.StatusConflict
 
-// generateCheckoutCode creates a unique checkout code
-func (ch *CheckoutHandler) generateCheckoutCode() string {
-	// Generate UUID-based code for uniqueness
-	uuid := uuid.New()
-	
-	// Create a shorter, more user-friendly code
-	// Use first 8 characters of UUID + timestamp suffix for uniqueness
-	timestamp := time.Now().Unix() % 10000 // Last 4 digits of timestamp
-	
-	return fmt.Sprintf("CHK_%s_%d", uuid.String()[:8], timestamp)
+	case interfaces.PurchaseSaleSoldOut:
+		response.Message = "Sorry, the sale is sold out"
+		return response, http.StatusConflict
+
+	case interfaces.PurchaseUserLimitExceeded:
+		response.Message = "You have reached the purchase limit for this sale"
+		return response, http.StatusConflict
+
+	case interfaces.PurchaseItemNotInSale:
+		response.Message = "Item is not part of the current sale"
+		return response, http.StatusBadRequest
+
+	case interfaces.PurchaseSaleNotActive:
+		response.Message = "Sale is not currently active"
+		return response, http.StatusBadRequest
+
+	case interfaces.PurchaseSaleRebuilding:
+		response.Message = "Sale is being restored, please retry shortly"
+		return response, http.StatusServiceUnavailable
+
+	default:
+		log.Printf("Unknown reservation status: %q", status)
+		response.ErrorCode = ErrorCodeInternal
+		response.Error = "Unable to process checkout"
+		return response, http.StatusInternalServerError
+	}
 }
 
 // sendErrorResponse sends a standardized error response
-func (ch *CheckoutHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+func (ch *CheckoutHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, errorCode string, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	
 	response := CheckoutResponse{
-		Success: false,
-		Error:   message,
+		Success:   false,
+		ErrorCode: errorCode,
+		Error:     message,
 	}
 	
 	json.NewEncoder(w).Encode(response)
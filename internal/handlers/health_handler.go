@@ -7,19 +7,28 @@ import (
 )
 
 // HealthHandler handles health check requests
-type HealthHandler struct{}
+type HealthHandler struct {
+	itemCacheStats func() map[string]interface{} // Reported in the response when set
+}
 
 // NewHealthHandler creates a new health handler
 func NewHealthHandler() *HealthHandler {
 	return &HealthHandler{}
 }
 
+// SetItemCacheStats reports the item cache's hit and miss counts in health responses
+func (hh *HealthHandler) SetItemCacheStats(stats func() map[string]interface{}) {
+	hh.itemCacheStats = stats
+}
+
 // HealthResponse represents the health check response
 type HealthResponse struct {
 	Status    string    `json:"status"`
 	Timestamp time.Time `json:"timestamp"`
 	Service   string    `json:"service"`
 	Version   string    `json:"version"`
+
+	ItemCache map[string]interface{} `json:"item_cache,omitempty"`
 }
 
 // HandleHealth processes GET /health requests
@@ -41,6 +50,9 @@ func (hh *HealthHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 		Service:   "flash-sale-backend",
 		Version:   "1.0.0",
 	}
+	if hh.itemCacheStats != nil {
+		response.ItemCache = hh.itemCacheStats()
+	}
 
 	json.NewEncoder(w).Encode(response)
 } 
\ No newline at end of file
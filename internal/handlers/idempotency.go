@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// Idempotency-Key errors
+const (
+	ErrorCodeIdempotencyKeyReused     = "idempotency_key_reused"
+	ErrorCodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header clients set to make retries safe
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotencyReplayedHeader marks a response replayed for a repeated key
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	// MaxIdempotencyKeyLength bounds the keys clients may send
+	MaxIdempotencyKeyLength = 255
+
+	// DefaultIdempotencyWindow is how long responses are kept for replay
+	DefaultIdempotencyWindow = 24 * time.Hour
+
+	// idempotencyLockTTL is how long a key stays claimed by a request that never completes
+	idempotencyLockTTL = 30 * time.Second
+)
+
+// IdempotencyMiddleware replays the stored response for requests that repeat an
+// Idempotency-Key, so client retries do not create a second checkout or purchase
+type IdempotencyMiddleware struct {
+	redis      interfaces.RedisInterface
+	window     time.Duration
+	auth       interfaces.Authenticator // Scopes keys to the token's user; user_id in the request is used when nil
+	trustProxy bool                     // Take the client IP from X-Forwarded-For for requests without a user
+}
+
+// NewIdempotencyMiddleware creates a new idempotency middleware keeping responses for window
+func NewIdempotencyMiddleware(redis interfaces.RedisInterface, window time.Duration) *IdempotencyMiddleware {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return &IdempotencyMiddleware{redis: redis, window: window}
+}
+
+// SetAuthenticator scopes keys to the token's user instead of the request's user_id
+func (m *IdempotencyMiddleware) SetAuthenticator(auth interfaces.Authenticator) {
+	m.auth = auth
+}
+
+// SetTrustProxy takes the client IP of requests that name no user from the last
+// X-Forwarded-For entry, as for rate limiting
+func (m *IdempotencyMiddleware) SetTrustProxy(trust bool) {
+	m.trustProxy = trust
+}
+
+// Wrap makes next honor the Idempotency-Key header. Requests without the header pass
+// through; while Redis fails they pass through too, as if no key had been sent.
+func (m *IdempotencyMiddleware) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			if _, sent := r.Header[IdempotencyKeyHeader]; sent {
+				sendIdempotencyError(w, http.StatusBadRequest, ErrorCodeInvalidRequest, "Idempotency-Key must not be empty")
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		// 1. Validate the key
+		if len(key) > MaxIdempotencyKeyLength {
+			sendIdempotencyError(w, http.StatusBadRequest, ErrorCodeInvalidRequest,
+				fmt.Sprintf("Idempotency-Key must be at most %d characters", MaxIdempotencyKeyLength))
+			return
+		}
+
+		// 2. Scope the key to the route and client, so clients cannot replay each other's responses
+		ctx := r.Context()
+		scopedKey := fmt.Sprintf("%s:%s:%s", route, m.clientScope(r), key)
+		fingerprint := requestFingerprint(r)
+
+		// 3. Claim the key, or find the request that already did
+		existing, err := m.redis.ClaimIdempotencyKey(ctx, scopedKey, &interfaces.IdempotencyRecord{Fingerprint: fingerprint}, idempotencyLockTTL)
+		if err != nil {
+			log.Printf("Warning: Failed to claim idempotency key, processing without it: %v", err)
+			next(w, r)
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				sendIdempotencyError(w, http.StatusUnprocessableEntity, ErrorCodeIdempotencyKeyReused,
+					"Idempotency-Key was already used for a different request")
+			case !existing.Completed:
+				w.Header().Set("Retry-After", "1")
+				sendIdempotencyError(w, http.StatusConflict, ErrorCodeIdempotencyKeyInProgress,
+					"A request with this Idempotency-Key is still being processed")
+			default:
+				replayResponse(w, existing)
+			}
+			return
+		}
+
+		// 4. Process the request, capturing its response
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r)
+
+		// 5. Store the response for repeats. Server errors release the key so retries run again.
+		if recorder.statusCode >= http.StatusInternalServerError {
+			if err := m.redis.ReleaseIdempotencyKey(ctx, scopedKey); err != nil {
+				log.Printf("Warning: Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+
+		record := &interfaces.IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			StatusCode:  recorder.statusCode,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		}
+		if err := m.redis.CompleteIdempotencyKey(ctx, scopedKey, record, m.window); err != nil {
+			log.Printf("Warning: Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// clientScope identifies who a request's key belongs to: its user, or for requests that
+// name none (purchases without authentication) the checkout code it redeems, which only
+// its owner holds. Requests with neither are scoped to the client IP.
+func (m *IdempotencyMiddleware) clientScope(r *http.Request) string {
+	if userID := requestUserID(r, m.auth); userID != "" {
+		return "user:" + userID
+	}
+	if code := requestCheckoutCode(r); code != "" {
+		return "code:" + code
+	}
+	return "ip:" + clientIP(r, m.trustProxy)
+}
+
+// requestFingerprint identifies what a request asks for, to detect a key reused for another request
+func requestFingerprint(r *http.Request) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	hash.Write(peekBody(r))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayResponse writes a stored response again
+func replayResponse(w http.ResponseWriter, record *interfaces.IdempotencyRecord) {
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(IdempotencyReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// sendIdempotencyError rejects a request for its Idempotency-Key
+func sendIdempotencyError(w http.ResponseWriter, statusCode int, errorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error_code": errorCode,
+		"error":      message,
+	})
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,29 +11,24 @@ import (
 
 	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
 )
 
 // PurchaseHandler handles purchase-related HTTP requests
 type PurchaseHandler struct {
-	saleService interfaces.SaleService
-	itemService interfaces.ItemService
-	db          interfaces.DatabaseInterface
-	redis       interfaces.RedisInterface
+	purchases interfaces.PurchaseService
+	auth      interfaces.Authenticator // Identifies the caller; anyone holding a code may purchase when nil
 }
 
 // NewPurchaseHandler creates a new purchase handler
-func NewPurchaseHandler(
-	saleService interfaces.SaleService,
-	itemService interfaces.ItemService,
-	db interfaces.DatabaseInterface,
-	redis interfaces.RedisInterface,
-) *PurchaseHandler {
-	return &PurchaseHandler{
-		saleService: saleService,
-		itemService: itemService,
-		db:          db,
-		redis:       redis,
-	}
+func NewPurchaseHandler(purchases interfaces.PurchaseService) *PurchaseHandler {
+	return &PurchaseHandler{purchases: purchases}
+}
+
+// SetAuthenticator requires every purchase to be authenticated, and only lets the user
+// who created a checkout complete it
+func (ph *PurchaseHandler) SetAuthenticator(auth interfaces.Authenticator) {
+	ph.auth = auth
 }
 
 // PurchaseRequest represents the purchase request structure
@@ -40,13 +36,28 @@ type PurchaseRequest struct {
 	CheckoutCode string `json:"checkout_code"`
 }
 
+// Error codes for purchase and checkout failures that happen before the atomic purchase.
+// Rejections from the atomic purchase or reservation use the interfaces.PurchaseStatus value.
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "checkout_user_mismatch"
+	ErrorCodeInvalidCode      = "invalid_checkout_code"
+	ErrorCodeCheckoutExpired  = "checkout_expired"
+	ErrorCodeItemNotFound     = "item_not_found"
+	ErrorCodeInternal         = "internal_error"
+)
+
 // PurchaseResponse represents the purchase response structure
 type PurchaseResponse struct {
 	Success       bool           `json:"success"`
+	ErrorCode     string        `json:"error_code,omitempty"`    // Machine-readable failure reason
+	SoldOut       bool          `json:"sold_out,omitempty"`      // Set when the requested item has no stock left
 	PurchaseID    int           `json:"purchase_id,omitempty"`
 	Message       string        `json:"message,omitempty"`
 	Item          *models.Item  `json:"item,omitempty"`
-	TotalPrice    float64       `json:"total_price,omitempty"`
+	TotalPrice    *models.Money `json:"total_price,omitempty"`
 	PurchasedAt   time.Time     `json:"purchased_at,omitempty"`
 	UserPurchases int           `json:"user_purchases,omitempty"` // How many items user has purchased in this sale
 	Error         string        `json:"error,omitempty"`
@@ -56,13 +67,26 @@ type PurchaseResponse struct {
 func (ph *PurchaseHandler) HandlePurchase(w http.ResponseWriter, r *http.Request) {
 	// Only accept POST requests
 	if r.Method != http.MethodPost {
-		ph.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		ph.sendErrorResponse(w, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Set response headers
 	w.Header().Set("Content-Type", "application/json")
 
+	// Authenticate the caller when authentication is enabled
+	callerID := ""
+	if ph.auth != nil {
+		userID, err := ph.auth.Authenticate(r)
+		if err != nil {
+			log.Printf("Purchase authentication failed: %v", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			ph.sendErrorResponse(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Authentication required")
+			return
+		}
+		callerID = userID
+	}
+
 	// Parse request
 	var req PurchaseRequest
 	
@@ -70,7 +94,7 @@ func (ph *PurchaseHandler) HandlePurchase(w http.ResponseWriter, r *http.Request
 	if r.Header.Get("Content-Type") == "application/json" {
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&req); err != nil {
-			ph.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
+			ph.sendErrorResponse(w, http.StatusBadRequest, ErrorCodeInvalidRequest, "Invalid JSON format")
 			return
 		}
 	} else {
@@ -79,215 +103,151 @@ func (ph *PurchaseHandler) HandlePurchase(w http.ResponseWriter, r *http.Request
 	}
 
 	// Validate request
-	if err := ph.validatePurchaseRequest(&req); err != nil {
-		ph.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+	if err := ph.purchases.ValidatePurchaseRequest(req.CheckoutCode); err != nil {
+		ph.sendErrorResponse(w, http.StatusBadRequest, ErrorCodeInvalidRequest, err.Error())
 		return
 	}
 
 	// Process purchase
 	ctx := context.Background()
-	response, statusCode := ph.processPurchase(ctx, &req)
+	response, statusCode := ph.processPurchase(ctx, &req, callerID)
 	
+	if statusCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
 
-// validatePurchaseRequest validates the purchase request parameters
-func (ph *PurchaseHandler) validatePurchaseRequest(req *PurchaseRequest) error {
-	if req.CheckoutCode == "" {
-		return fmt.Errorf("checkout_code is required")
-	}
-
-	// Basic format validation for checkout code
-	if len(req.CheckoutCode) < 5 || len(req.CheckoutCode) > 50 {
-		return fmt.Errorf("invalid checkout_code format")
-	}
-
-	return nil
-}
+// processPurchase redeems a checkout code and maps the outcome to a response and HTTP status code.
+// callerID is the authenticated user, or "" when authentication is disabled.
+func (ph *PurchaseHandler) processPurchase(ctx context.Context, req *PurchaseRequest, callerID string) (*PurchaseResponse, int) {
+	completed, err := ph.purchases.ProcessPurchase(ctx, req.CheckoutCode, callerID)
 
-// processPurchase handles the core purchase logic with atomic operations
-func (ph *PurchaseHandler) processPurchase(ctx context.Context, req *PurchaseRequest) (*PurchaseResponse, int) {
-	// 1. Verify checkout code and get checkout details
-	checkout, err := ph.verifyCheckoutCode(ctx, req.CheckoutCode)
-	if err != nil {
-		log.Printf("Checkout code verification failed: %v", err)
+	var limitErr *services.LimitError
+	switch {
+	case err == nil:
+		purchase := completed.Purchase
+		return &PurchaseResponse{
+			Success:       true,
+			PurchaseID:    purchase.ID,
+			Message:       "Purchase completed successfully",
+			Item:          completed.Item,
+			TotalPrice:    &purchase.Price,
+			PurchasedAt:   purchase.PurchasedAt,
+			UserPurchases: completed.UserPurchases,
+		}, http.StatusOK
+
+	case errors.Is(err, services.ErrInvalidCheckoutCode):
 		return &PurchaseResponse{
-			Success: false,
-			Message: "Invalid or expired checkout code",
+			Success:   false,
+			ErrorCode: ErrorCodeInvalidCode,
+			Message:   "Invalid or expired checkout code",
 		}, http.StatusBadRequest
-	}
 
-	// 2. Check if checkout has already been used
-	if checkout.Status != "pending" {
+	case errors.Is(err, services.ErrCheckoutExpired):
 		return &PurchaseResponse{
-			Success: false,
-			Message: "Checkout code has already been used",
+			Success:   false,
+			ErrorCode: ErrorCodeCheckoutExpired,
+			Message:   "Checkout code has expired",
 		}, http.StatusBadRequest
-	}
 
-	// 3. Check if checkout has expired
-	if time.Now().After(checkout.ExpiresAt) {
+	case errors.Is(err, services.ErrCheckoutUserMismatch):
 		return &PurchaseResponse{
-			Success: false,
-			Message: "Checkout code has expired",
-		}, http.StatusBadRequest
-	}
+			Success:   false,
+			ErrorCode: ErrorCodeForbidden,
+			Message:   "Checkout code belongs to another user",
+		}, http.StatusForbidden
 
-	// 4. Get the associated sale and verify it's still active
-	sale, err := ph.saleService.GetCurrentActiveSale(ctx)
-	if err != nil || sale == nil || sale.ID != checkout.SaleID {
+	case errors.Is(err, services.ErrItemNotFound):
 		return &PurchaseResponse{
-			Success: false,
-			Message: "Sale is no longer active",
+			Success:   false,
+			ErrorCode: ErrorCodeItemNotFound,
+			Error:     "Item not found",
 		}, http.StatusBadRequest
-	}
 
-	// 5. Get item details
-	item, err := ph.itemService.GetItemByID(ctx, checkout.ItemID)
-	if err != nil {
-		log.Printf("Error getting item %s: %v", checkout.ItemID, err)
+	case errors.Is(err, services.ErrPurchaseNotRecorded):
 		return &PurchaseResponse{
-			Success: false,
-			Error: "Item not found",
-		}, http.StatusBadRequest
-	}
+			Success:   false,
+			ErrorCode: ErrorCodeInternal,
+			Error:     "Failed to record purchase",
+		}, http.StatusInternalServerError
 
-	// 6. Perform atomic purchase operation using Redis Lua script
-	purchaseResult, err := ph.redis.AttemptPurchase(ctx, sale.ID, checkout.UserID, checkout.ItemID)
-	if err != nil {
+	case errors.As(err, &limitErr):
+		return ph.purchaseOutcomeResponse(limitErr)
+
+	default:
 		log.Printf("Purchase attempt failed: %v", err)
 		return &PurchaseResponse{
-			Success: false,
-			Error: "Purchase failed",
+			Success:   false,
+			ErrorCode: ErrorCodeInternal,
+			Error:     "Purchase failed",
 		}, http.StatusInternalServerError
 	}
+}
 
-	// 7. Check purchase result
-	switch purchaseResult.Status {
-	case "success":
-		// Purchase successful, create purchase record in database
-		return ph.completePurchase(ctx, checkout, item, purchaseResult)
+// purchaseOutcomeResponse maps a rejected purchase outcome to its HTTP response.
+// The outcome string is returned as error_code:
+//
+//	sale_sold_out        409 Conflict
+//	item_sold_out        409 Conflict
+//	user_limit_exceeded  409 Conflict
+//	code_already_used    409 Conflict
+//	item_not_in_sale     400 Bad Request
+//	sale_not_active      400 Bad Request
+//	sale_rebuilding      503 Service Unavailable (retry shortly)
+//
+// Unknown outcomes are reported as internal_error with 500.
+func (ph *PurchaseHandler) purchaseOutcomeResponse(limitErr *services.LimitError) (*PurchaseResponse, int) {
+	response := &PurchaseResponse{
+		Success:   false,
+		ErrorCode: string(limitErr.Status),
+	}
+
+	switch limitErr.Status {
+	case interfaces.PurchaseSaleSoldOut, interfaces.PurchaseItemSoldOut:
+		response.SoldOut = true
+		response.Message = "Sorry, this item is sold out"
+		return response, http.StatusConflict
 		
-	case "sold_out":
-		return &PurchaseResponse{
-			Success: false,
-			Message: "Sorry, this item is sold out",
-		}, http.StatusConflict
+	case interfaces.PurchaseUserLimitExceeded:
+		response.Message = fmt.Sprintf("Purchase limit exceeded. You can only purchase %d items per sale", limitErr.MaxPerUser)
+		response.UserPurchases = limitErr.UserPurchases
+		return response, http.StatusConflict
 		
-	case "user_limit_exceeded":
-		return &PurchaseResponse{
-			Success: false,
-			Message: fmt.Sprintf("Purchase limit exceeded. You can only purchase %d items per sale", 10),
-			UserPurchases: purchaseResult.UserPurchases,
-		}, http.StatusConflict
+	case interfaces.PurchaseCodeAlreadyUsed:
+		response.Message = "Checkout code has already been used"
+		return response, http.StatusConflict
 		
-	case "sale_not_active":
-		return &PurchaseResponse{
-			Success: false,
-			Message: "Sale is not currently active",
-		}, http.StatusBadRequest
+	case interfaces.PurchaseItemNotInSale:
+		response.Message = "Item is not part of this sale"
+		return response, http.StatusBadRequest
+		
+	case interfaces.PurchaseSaleNotActive:
+		response.Message = "Sale is not currently active"
+		return response, http.StatusBadRequest
+		
+	case interfaces.PurchaseSaleRebuilding:
+		response.Message = "Sale is being restored, please retry shortly"
+		return response, http.StatusServiceUnavailable
 		
 	default:
-		return &PurchaseResponse{
-			Success: false,
-			Error: "Unknown purchase error",
-		}, http.StatusInternalServerError
-	}
-}
-
-// verifyCheckoutCode verifies and retrieves checkout details
-func (ph *PurchaseHandler) verifyCheckoutCode(ctx context.Context, code string) (*models.Checkout, error) {
-	// Use database lookup directly since Redis doesn't store ExpiresAt field
-	// This ensures we get the complete checkout record including expiration time
-	checkout, err := ph.db.GetCheckoutByCode(ctx, code)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get checkout from database: %w", err)
-	}
-
-	if checkout == nil {
-		return nil, fmt.Errorf("checkout code not found")
-	}
-
-	return checkout, nil
-}
-
-// completePurchase finalizes the purchase by creating database records
-func (ph *PurchaseHandler) completePurchase(ctx context.Context, checkout *models.Checkout, item *models.Item, purchaseResult *interfaces.PurchaseResult) (*PurchaseResponse, int) {
-	now := time.Now()
-
-	// Create purchase record
-	purchase := &models.Purchase{
-		UserID:      checkout.UserID,
-		ItemID:      checkout.ItemID,
-		SaleID:      checkout.SaleID,
-		CheckoutID:  checkout.ID,
-		Price:       item.Price,
-		Status:      "completed",
-		PurchasedAt: now,
+		log.Printf("Unknown purchase status: %q", limitErr.Status)
+		response.ErrorCode = ErrorCodeInternal
+		response.Error = "Unknown purchase error"
+		return response, http.StatusInternalServerError
 	}
-
-	// Begin database transaction to ensure consistency
-	tx, err := ph.db.BeginTransaction(ctx)
-	if err != nil {
-		log.Printf("Failed to begin transaction: %v", err)
-		return &PurchaseResponse{
-			Success: false,
-			Error: "Transaction failed",
-		}, http.StatusInternalServerError
-	}
-	defer tx.Rollback() // Will be no-op if transaction is committed
-
-	// Create purchase record
-	if err := ph.db.CreatePurchase(ctx, purchase); err != nil {
-		log.Printf("Failed to create purchase record: %v", err)
-		return &PurchaseResponse{
-			Success: false,
-			Error: "Failed to record purchase",
-		}, http.StatusInternalServerError
-	}
-
-	// Update checkout status to 'used'
-	checkout.Status = "used"
-	checkout.Purchased = true
-	checkout.UpdatedAt = now
-	if err := ph.db.UpdateCheckout(ctx, checkout); err != nil {
-		log.Printf("Failed to update checkout status: %v", err)
-		return &PurchaseResponse{
-			Success: false,
-			Error: "Failed to update checkout",
-		}, http.StatusInternalServerError
-	}
-
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		return &PurchaseResponse{
-			Success: false,
-			Error: "Transaction commit failed",
-		}, http.StatusInternalServerError
-	}
-
-	// Return successful response
-	return &PurchaseResponse{
-		Success:       true,
-		PurchaseID:    purchase.ID,
-		Message:       "Purchase completed successfully",
-		Item:          item,
-		TotalPrice:    item.Price,
-		PurchasedAt:   now,
-		UserPurchases: purchaseResult.UserPurchases,
-	}, http.StatusOK
 }
 
 // sendErrorResponse sends a standardized error response
-func (ph *PurchaseHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+func (ph *PurchaseHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, errorCode string, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	
 	response := PurchaseResponse{
-		Success: false,
-		Error:   message,
+		Success:   false,
+		ErrorCode: errorCode,
+		Error:     message,
 	}
 	
 	json.NewEncoder(w).Encode(response)
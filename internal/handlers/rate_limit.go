@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// ErrorCodeRateLimited is returned with 429 when a client exceeds a rate limit
+const ErrorCodeRateLimited = "rate_limited"
+
+// RateLimits are the request limits of one route. A zero rule is not enforced.
+type RateLimits struct {
+	PerIP   interfaces.RateLimitRule
+	PerUser interfaces.RateLimitRule
+}
+
+// RateLimitMiddleware throttles requests per route, client IP and user before they reach a handler
+type RateLimitMiddleware struct {
+	limiter    interfaces.RateLimiter
+	auth       interfaces.Authenticator // Identifies users by token; user_id in the request is used when nil
+	trustProxy bool                     // Take the client IP from X-Forwarded-For
+}
+
+// NewRateLimitMiddleware creates a new rate limit middleware
+func NewRateLimitMiddleware(limiter interfaces.RateLimiter) *RateLimitMiddleware {
+	return &RateLimitMiddleware{limiter: limiter}
+}
+
+// SetAuthenticator makes per-user limits apply to the token's user instead of the request's user_id
+func (m *RateLimitMiddleware) SetAuthenticator(auth interfaces.Authenticator) {
+	m.auth = auth
+}
+
+// SetTrustProxy takes the client IP from the last X-Forwarded-For entry, as appended by a
+// trusted reverse proxy. Only enable it behind such a proxy, as clients can set the header.
+func (m *RateLimitMiddleware) SetTrustProxy(trust bool) {
+	m.trustProxy = trust
+}
+
+// Limit wraps next with the route's limits. Requests over a limit get 429 with Retry-After.
+func (m *RateLimitMiddleware) Limit(route string, limits RateLimits, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		// 1. Limit the client IP
+		if limits.PerIP.Enabled() {
+			key := fmt.Sprintf("%s:ip:%s", route, clientIP(r, m.trustProxy))
+			if allowed, retryAfter := m.limiter.Allow(ctx, key, limits.PerIP); !allowed {
+				sendRateLimited(w, retryAfter)
+				return
+			}
+		}
+
+		// 2. Limit the user, when the request identifies one
+		if limits.PerUser.Enabled() {
+			if userID := requestUserID(r, m.auth); userID != "" {
+				key := fmt.Sprintf("%s:user:%s", route, userID)
+				if allowed, retryAfter := m.limiter.Allow(ctx, key, limits.PerUser); !allowed {
+					sendRateLimited(w, retryAfter)
+					return
+				}
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// sendRateLimited rejects a request over its rate limit
+func sendRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error_code": ErrorCodeRateLimited,
+		"error":      "Too many requests, please retry later",
+	})
+}
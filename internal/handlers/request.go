@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// maxPeekBytes bounds how much of a request body middleware reads before the handler
+const maxPeekBytes = 64 << 10
+
+// peekBody returns the start of the request body and puts it back for the handler
+func peekBody(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	peeked, _ := io.ReadAll(io.LimitReader(r.Body, maxPeekBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), r.Body), r.Body}
+
+	return peeked
+}
+
+// requestUserID returns the user a request is made by: the token's user when auth is set,
+// otherwise the user_id query parameter or JSON body field. Requests that do not identify
+// a user (e.g. invalid tokens, which the handler rejects) return "".
+func requestUserID(r *http.Request, auth interfaces.Authenticator) string {
+	if auth != nil {
+		userID, err := auth.Authenticate(r)
+		if err != nil {
+			return ""
+		}
+		return userID
+	}
+
+	return requestParam(r, "user_id", "user_id")
+}
+
+// requestCheckoutCode returns the checkout code a purchase request redeems, read the way
+// the purchase handler reads it, or "" for requests without one
+func requestCheckoutCode(r *http.Request) string {
+	if r.Header.Get("Content-Type") == "application/json" {
+		return requestParam(r, "", "checkout_code")
+	}
+	return r.URL.Query().Get("code")
+}
+
+// requestParam returns the query parameter named query, or else the JSON body field named
+// field. An empty name skips that source.
+func requestParam(r *http.Request, query, field string) string {
+	if query != "" {
+		if value := r.URL.Query().Get(query); value != "" {
+			return value
+		}
+	}
+
+	if field == "" || r.Header.Get("Content-Type") != "application/json" {
+		return ""
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(peekBody(r), &body); err != nil {
+		return ""
+	}
+	value, _ := body[field].(string)
+	return value
+}
+
+// clientIP returns the IP address the request came from. With trustProxy it is the last
+// X-Forwarded-For entry, as appended by a trusted reverse proxy.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			entries := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,10 @@
+package interfaces
+
+import "time"
+
+// Clock abstracts the current time and timers so that time-driven behavior
+// such as sale schedule transitions can be tested deterministically
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
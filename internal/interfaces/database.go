@@ -3,16 +3,131 @@ package interfaces
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"flash-sale-backend/internal/models"
 )
 
+// PurchaseStatus is the outcome of an atomic purchase attempt.
+// Values are the exact strings returned by the Redis purchase script.
+type PurchaseStatus string
+
+const (
+	PurchaseSuccess           PurchaseStatus = "success"
+	PurchaseSaleSoldOut       PurchaseStatus = "sale_sold_out"       // Sale-wide cap reached
+	PurchaseItemSoldOut       PurchaseStatus = "item_sold_out"       // Item's stock in this sale exhausted
+	PurchaseItemNotInSale     PurchaseStatus = "item_not_in_sale"    // Item has no allocation in this sale
+	PurchaseUserLimitExceeded PurchaseStatus = "user_limit_exceeded" // User reached the sale's max_per_user
+	PurchaseSaleNotActive     PurchaseStatus = "sale_not_active"     // Sale is not set up in Redis
+	PurchaseCodeAlreadyUsed   PurchaseStatus = "code_already_used"   // Checkout code was already consumed
+	PurchaseSaleRebuilding    PurchaseStatus = "sale_rebuilding"     // Sale counters are being rebuilt from Postgres
+)
+
+// PurchaseStatuses lists every purchase outcome
+var PurchaseStatuses = []PurchaseStatus{
+	PurchaseSuccess,
+	PurchaseSaleSoldOut,
+	PurchaseItemSoldOut,
+	PurchaseItemNotInSale,
+	PurchaseUserLimitExceeded,
+	PurchaseSaleNotActive,
+	PurchaseCodeAlreadyUsed,
+	PurchaseSaleRebuilding,
+}
+
+// Valid reports whether the status is a known purchase outcome
+func (s PurchaseStatus) Valid() bool {
+	for _, status := range PurchaseStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // PurchaseResult represents the result of a purchase operation
 type PurchaseResult struct {
-	Status        string `json:"status"`         // "success", "sold_out", "user_limit_exceeded", "sale_not_active"
-	UserPurchases int    `json:"user_purchases"` // How many items user has purchased in this sale
-	TotalSold     int    `json:"total_sold"`     // Total items sold in this sale
-	ItemID        string `json:"item_id"`        // The item that was purchased
+	Status        PurchaseStatus `json:"status"`
+	UserPurchases int            `json:"user_purchases"` // How many items user has purchased in this sale
+	TotalSold     int            `json:"total_sold"`     // Total items sold in this sale
+	ItemID        string         `json:"item_id"`        // The item that was purchased
+
+	// Set when the limiter already added the purchase to the sale counters in Postgres
+	DatabaseCounted bool `json:"-"`
+
+	// Set when the limiter queued the purchase's write-behind event along with counting it
+	Queued bool `json:"-"`
+}
+
+// ErrPurchaseFallback is returned when a purchase counted in Redis is recorded after its
+// sale's purchase limits moved to Postgres; Postgres did not count it, so it must not be recorded
+var ErrPurchaseFallback = errors.New("sale purchase limits moved to Postgres")
+
+// ErrItemPriceLocked is returned when a price change is refused because the item can be
+// bought in the active sale: it is allocated to the sale, or the sale has no per-item allocations
+var ErrItemPriceLocked = errors.New("item is on sale; its price cannot change until the sale ends")
+
+// PurchaseCounts are a sale's completed purchases as recorded in Postgres. ByUser also
+// lists users whose purchases were all reversed, with 0, so their Redis counts are reset.
+type PurchaseCounts struct {
+	Total  int
+	ByItem map[string]int
+	ByUser map[string]int
+}
+
+// SaleItemStock is an item's availability in a sale
+type SaleItemStock struct {
+	InSale     bool // False when the sale's allocations leave the item out
+	Restricted bool // False for sales without per-item allocations, which sell every item
+	Remaining  int  // Units left; only set when Restricted
+}
+
+// SaleCounters is the full Redis purchase state of a sale, used to rebuild it
+type SaleCounters struct {
+	ItemsAvailable int
+	MaxPerUser     int
+	Sold           int
+	ItemStock      map[string]int // Remaining stock per item; empty for unrestricted sales
+	UserCounts     map[string]int // Purchases per user
+}
+
+// PersistenceEventType identifies what a write-behind event records
+type PersistenceEventType string
+
+// Write-behind event types
+const (
+	PersistCheckout PersistenceEventType = "checkout"
+	PersistPurchase PersistenceEventType = "purchase"
+)
+
+// PersistenceEvent is a checkout attempt or purchase queued in Redis for Postgres.
+// Events may be delivered more than once, so applying one must be idempotent.
+type PersistenceEvent struct {
+	ID       string                  `json:"-"` // Stream entry ID, set when the event is read
+	Type     PersistenceEventType    `json:"type"`
+	Checkout *models.CheckoutAttempt `json:"checkout,omitempty"`
+	Purchase *models.Purchase        `json:"purchase,omitempty"`
+}
+
+// IdempotencyRecord is what is stored for an Idempotency-Key: the request's fingerprint,
+// and once the request has completed, the response to replay for repeats
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// PurchaseLimiter atomically enforces the sale-wide, per-item and per-user limits
+// for a purchase and consumes its checkout code. Redis is the primary implementation;
+// Postgres takes over while Redis is unavailable. A write-behind event, if not nil, is
+// queued in the same atomic step when the purchase succeeds; see PurchaseResult.Queued.
+type PurchaseLimiter interface {
+	AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, event *PersistenceEvent) (*PurchaseResult, error)
+	// RevertPurchase gives back a successful attempt whose purchase could not be recorded
+	RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error
 }
 
 // DatabaseInterface defines the contract for database operations
@@ -26,13 +141,30 @@ type DatabaseInterface interface {
 	CreateSale(ctx context.Context, sale *models.Sale) error
 	GetActiveSale(ctx context.Context) (*models.Sale, error)
 	GetSaleByID(ctx context.Context, id int) (*models.Sale, error)
+	ListSales(ctx context.Context, limit int) ([]models.Sale, error)
 	UpdateSaleItemsSold(ctx context.Context, saleID int, itemsSold int) error
+	UpdateSaleEndTime(ctx context.Context, saleID int, endTime time.Time) error
+	ActivateSale(ctx context.Context, saleID int) error
 	DeactivateSale(ctx context.Context, saleID int) error
 
+	// Item catalog operations
+	GetItemByID(ctx context.Context, itemID string) (*models.Item, error) // nil if the item is not in the catalog
+	ListItems(ctx context.Context, includeRetired bool) ([]models.Item, error)
+	CreateItems(ctx context.Context, items []models.Item) (int, error) // Skips existing IDs; returns how many were added
+	UpdateItem(ctx context.Context, item *models.Item) (bool, error)   // false if the item is not in the catalog; ErrItemPriceLocked if its price is locked
+	UpdateItemPrices(ctx context.Context, prices []models.ItemPrice) error // All or nothing; ErrItemPriceLocked if any price is locked
+	RetireItem(ctx context.Context, itemID string) (bool, error) // false if the item is not in the catalog
+
+	// Sale item operations
+	CreateSaleItems(ctx context.Context, saleID int, items []models.SaleItem) error
+	GetSaleItems(ctx context.Context, saleID int) ([]models.SaleItem, error)
+	UpdateSaleItemStock(ctx context.Context, saleID int, itemID string, stock int) (bool, error) // false if the item is not allocated to the sale
+
 	// Checkout operations
 	CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error
 	GetCheckoutAttemptByCode(ctx context.Context, code string) (*models.CheckoutAttempt, error)
 	UpdateCheckoutAttemptPurchased(ctx context.Context, code string) error
+	ExpireCheckoutAttempts(ctx context.Context, now time.Time, limit int) ([]string, error)
 
 	// Checkout operations (compatibility aliases)
 	CreateCheckout(ctx context.Context, attempt *models.CheckoutAttempt) error
@@ -41,6 +173,34 @@ type DatabaseInterface interface {
 	// Purchase operations
 	CreatePurchase(ctx context.Context, purchase *models.Purchase) error
 	UpdateCheckout(ctx context.Context, checkout *models.Checkout) error
+	GetPurchaseCounts(ctx context.Context, saleID int) (*PurchaseCounts, error)
+
+	// Write-behind persistence
+	PersistEvents(ctx context.Context, events []PersistenceEvent) error
+
+	// Purchase limits (used while Redis is unavailable)
+	AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) (*PurchaseResult, error)
+	RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error
+
+	// Purchase limit fallback, shared by every replica. BeginPurchaseFallback returns true if
+	// this call moved the sale to Postgres. EndPurchaseFallback locks the sale, passes restore
+	// the counters Postgres enforces so it can write them to Redis, and clears the flag only if
+	// restore succeeds; it returns false if the sale was not on Postgres.
+	GetPurchaseFallback(ctx context.Context, saleID int) (bool, error)
+	BeginPurchaseFallback(ctx context.Context, saleID int) (bool, error)
+	EndPurchaseFallback(ctx context.Context, saleID int, restore func(*SaleCounters) error) (bool, error)
+
+	// Sale schedule operations
+	CreateSaleWindow(ctx context.Context, window *models.SaleWindow) (bool, error)
+	GetSaleWindowsByStatus(ctx context.Context, status string) ([]models.SaleWindow, error)
+	UpdateSaleWindowStatus(ctx context.Context, windowID int, status string, saleID int) error
+	CancelSaleWindow(ctx context.Context, windowID int) (bool, error)
+
+	// Leader fencing
+	AdvanceFencingToken(ctx context.Context, name string, token int64) (bool, error)
+
+	// Audit operations
+	CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
 
 	// Transaction support
 	BeginTx(ctx context.Context) (TxInterface, error)
@@ -57,6 +217,19 @@ type TxInterface interface {
 	CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error
 	GetCheckoutAttemptByCode(ctx context.Context, code string) (*models.CheckoutAttempt, error)
 	UpdateCheckoutAttemptPurchased(ctx context.Context, code string) error
+
+	// Purchase operations within transaction context
+	CreatePurchase(ctx context.Context, purchase *models.Purchase) error
+	UpdateCheckout(ctx context.Context, checkout *models.Checkout) error
+	IncrementSaleItemsSold(ctx context.Context, saleID int, delta int) error
+	IncrementSaleItemSold(ctx context.Context, saleID int, itemID string, delta int) error
+	// EnsureRedisLimits returns ErrPurchaseFallback if the sale's limits are enforced in Postgres,
+	// and keeps them from moving there until the transaction ends
+	EnsureRedisLimits(ctx context.Context, saleID int) error
+
+	// Refunds within transaction context; GetPurchaseByCode locks the purchase
+	GetPurchaseByCode(ctx context.Context, code string) (*models.Purchase, error)
+	UpdatePurchaseStatus(ctx context.Context, purchaseID int, status string) error
 }
 
 // RedisInterface defines the contract for Redis operations
@@ -66,24 +239,67 @@ type RedisInterface interface {
 	Ping(ctx context.Context) error
 
 	// Atomic sale operations
-	AtomicPurchase(ctx context.Context, saleID int, userID string, maxItems, maxUserItems int) (bool, string, int, int, error)
+	AtomicPurchase(ctx context.Context, saleID int, userID string, maxItems, maxUserItems int) (bool, PurchaseStatus, int, int, error)
 	GetSoldItems(ctx context.Context, saleID int) (int, error)
 	GetUserPurchaseCount(ctx context.Context, userID string, saleID int) (int, error)
+	RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error
 
 	// Sale management
-	SetupSale(ctx context.Context, saleID int, itemsAvailable int) error
+	SetupSale(ctx context.Context, saleID int, itemsAvailable int, maxPerUser int, itemStock map[string]int) error
+	GetSaleItemStock(ctx context.Context, saleID int, itemID string) (*SaleItemStock, error)
 	GetActiveSaleID(ctx context.Context) (int, error)
 	SetActiveSaleID(ctx context.Context, saleID int) error
+	// RefreshSaleTTL keeps all of the sale's keys for at least ttl; keys never live shorter
+	RefreshSaleTTL(ctx context.Context, saleID int, ttl time.Duration) error
+
+	// Counter recovery
+	GetSaleCounters(ctx context.Context, saleID int) (sold int, present bool, err error)
+	BeginCounterRebuild(ctx context.Context, saleID int, owner string, ttl time.Duration) (bool, error)
+	RebuildSaleCounters(ctx context.Context, saleID int, owner string, counters *SaleCounters) (bool, error)
+
+	// Checkout reservations
+	ReserveCheckout(ctx context.Context, saleID int, userID string, itemID string, code string, expiresAt time.Time, event *PersistenceEvent) (PurchaseStatus, error)
+	ReleaseReservation(ctx context.Context, saleID int, code string) (bool, error)
+	ReleaseExpiredReservations(ctx context.Context, saleID int, now time.Time, limit int) (int, error)
+	GetReservedItems(ctx context.Context, saleID int) (int, error)
+
+	// Rate limiting
+	TakeRateLimitToken(ctx context.Context, key string, capacity int, refill time.Duration, now time.Time) (bool, time.Duration, error)
+
+	// Idempotency keys
+	ClaimIdempotencyKey(ctx context.Context, key string, record *IdempotencyRecord, lockTTL time.Duration) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+
+	// Item cache invalidation
+	PublishItemInvalidation(ctx context.Context, itemIDs []string) error
+	// ReceiveItemInvalidations calls handle with the IDs of changed items until ctx is done or
+	// the subscription fails. handle is first called with no IDs once subscribed, as changes
+	// published before then were missed.
+	ReceiveItemInvalidations(ctx context.Context, handle func(itemIDs []string)) error
+
+	// Write-behind persistence
+	EnsurePersistenceGroup(ctx context.Context) error
+	EnqueuePersistence(ctx context.Context, event *PersistenceEvent) error
+	ReadPersistence(ctx context.Context, consumer string, count int) ([]PersistenceEvent, error)
+	ClaimStalePersistence(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]PersistenceEvent, error)
+	AckPersistence(ctx context.Context, ids []string) error
+	PendingPersistence(ctx context.Context, saleID int) (int, error)
+
+	// Leader election
+	AcquireLeadership(ctx context.Context, name string, instanceID string, ttl time.Duration) (int64, error)
+	ReleaseLeadership(ctx context.Context, name string, instanceID string) error
 
 	// Checkout code management
-	CacheCheckoutCode(ctx context.Context, code string, saleID int, userID string, itemID string) error
+	CacheCheckoutCode(ctx context.Context, checkout *models.Checkout) error
 	GetCheckoutData(ctx context.Context, code string) (saleID int, userID string, itemID string, err error)
 	InvalidateCheckoutCode(ctx context.Context, code string) error
+	RemoveExpiredCheckoutCodes(ctx context.Context, codes []string) (int, error)
 
 	// Checkout code management (compatibility aliases)
-	SetCheckoutCode(ctx context.Context, code string, saleID int, userID string, itemID string) error
+	SetCheckoutCode(ctx context.Context, checkout *models.Checkout) error
 	GetCheckoutCode(ctx context.Context, code string) (*models.Checkout, error)
-	AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string) (*PurchaseResult, error)
+	AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, event *PersistenceEvent) (*PurchaseResult, error)
 
 	// Performance metrics
 	GetConnectionStats() interface{}
@@ -0,0 +1,31 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLeadershipLost is returned by a fenced write when a newer leader has recorded a
+// higher fencing token, meaning the caller's lease expired and it must step down
+var ErrLeadershipLost = errors.New("leadership lost to a newer leader")
+
+// Fence identifies the leadership a write is made under: the role's name and the
+// fencing token of the lease held when the write was issued
+type Fence struct {
+	Name  string
+	Token int64
+}
+
+type fenceKey struct{}
+
+// WithFence returns a context whose fenced database writes only apply while the
+// fence's token is still the latest one recorded for its role
+func WithFence(ctx context.Context, fence Fence) context.Context {
+	return context.WithValue(ctx, fenceKey{}, fence)
+}
+
+// FenceFromContext returns the fence writes under ctx are made under, if any
+func FenceFromContext(ctx context.Context) (Fence, bool) {
+	fence, ok := ctx.Value(fenceKey{}).(Fence)
+	return fence, ok
+}
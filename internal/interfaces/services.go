@@ -2,6 +2,8 @@ package interfaces
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"flash-sale-backend/internal/models"
 )
@@ -10,40 +12,100 @@ import (
 type SaleService interface {
 	// Sale lifecycle
 	CreateHourlySale(ctx context.Context) (*models.Sale, error)
+	CreateSale(ctx context.Context, sale *models.Sale, items []models.SaleItem) (*models.Sale, error)
+	CreateScheduledSale(ctx context.Context, window *models.SaleWindow) (*models.Sale, error)
 	GetCurrentActiveSale(ctx context.Context) (*models.Sale, error)
 	ActivateSale(ctx context.Context, saleID int) error
 	DeactivateSale(ctx context.Context, saleID int) error
+	ExtendSale(ctx context.Context, saleID int, endTime time.Time) (*models.Sale, error)
 
 	// Sale status
+	ListSales(ctx context.Context, limit int) ([]models.Sale, error)
 	GetSaleStatus(ctx context.Context, saleID int) (*models.Sale, error)
 	GetSaleItemsSold(ctx context.Context, saleID int) (int, error)
 }
 
+// SaleScheduler defines the interface for scheduling sale windows ahead of time
+type SaleScheduler interface {
+	ScheduleWindow(ctx context.Context, window *models.SaleWindow) (bool, error)
+}
+
+// IssuedCheckout is a checkout code issued to a user, with the item it is for
+type IssuedCheckout struct {
+	Checkout *models.CheckoutAttempt
+	Item     *models.Item
+	Reserved bool // A unit is held for the code until it expires
+}
+
 // CheckoutService defines the contract for checkout operations
 type CheckoutService interface {
 	// Checkout process
-	ProcessCheckout(ctx context.Context, userID, itemID string) (string, error)
+	ProcessCheckout(ctx context.Context, userID, itemID string) (*IssuedCheckout, error)
 	ValidateCheckoutRequest(userID, itemID string) error
 
 	// Checkout verification
 	GetCheckoutAttempt(ctx context.Context, code string) (*models.CheckoutAttempt, error)
 }
 
+// Authenticator identifies the user making a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (string, error)
+}
+
+// RateLimitRule allows Limit requests per Window, in bursts of up to Limit.
+// A zero rule is not enforced.
+type RateLimitRule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Enabled reports whether the rule limits anything
+func (r RateLimitRule) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+// RateLimiter throttles requests by key
+type RateLimiter interface {
+	// Allow reports whether a request under key may proceed and, if not, when to retry
+	Allow(ctx context.Context, key string, rule RateLimitRule) (bool, time.Duration)
+}
+
+// CheckoutCodeSigner issues and verifies self-validating checkout codes
+type CheckoutCodeSigner interface {
+	Sign(claims *models.CheckoutClaims) (string, error)
+	Verify(code string) (*models.CheckoutClaims, error)
+}
+
+// PurchaseRefunder reverses completed purchases, returning their items to the sale
+type PurchaseRefunder interface {
+	RefundPurchase(ctx context.Context, code string) (*models.Purchase, error)
+	CancelPurchase(ctx context.Context, code string) (*models.Purchase, error)
+}
+
+// CompletedPurchase is a recorded purchase, with the item bought
+type CompletedPurchase struct {
+	Purchase      *models.Purchase
+	Item          *models.Item
+	UserPurchases int // How many items the user has purchased in this sale
+}
+
 // PurchaseService defines the contract for purchase operations
 type PurchaseService interface {
-	// Purchase process
-	ProcessPurchase(ctx context.Context, code string) (bool, string, error)
+	// Purchase process; callerID is the authenticated user, or "" when anyone holding a code may purchase
+	ProcessPurchase(ctx context.Context, code string, callerID string) (*CompletedPurchase, error)
 	ValidatePurchaseRequest(code string) error
 
 	// Purchase verification
 	GetUserPurchaseCount(ctx context.Context, userID string, saleID int) (int, error)
 	CanUserPurchase(ctx context.Context, userID string, saleID int) (bool, error)
+
+	// Refunds
+	PurchaseRefunder
 }
 
 // ItemService defines the contract for item management
 type ItemService interface {
-	// Item generation
-	GenerateItems(ctx context.Context, count int) ([]models.Item, error)
+	// Item catalog
 	GetItemByID(ctx context.Context, itemID string) (*models.Item, error)
 	GetAvailableItems(ctx context.Context) ([]models.Item, error)
 
@@ -51,6 +113,16 @@ type ItemService interface {
 	ValidateItemID(itemID string) error
 }
 
+// ItemCatalog manages the items in the catalog. Changes are visible to every replica.
+type ItemCatalog interface {
+	ListItems(ctx context.Context, includeRetired bool) ([]models.Item, error)
+	LookupItem(ctx context.Context, itemID string) (*models.Item, error) // Reads the catalog, bypassing caches
+	CreateItem(ctx context.Context, item *models.Item) error
+	UpdateItem(ctx context.Context, item *models.Item) error
+	UpdateItemPrices(ctx context.Context, prices []models.ItemPrice) error
+	RetireItem(ctx context.Context, itemID string) (*models.Item, error)
+}
+
 // HealthService defines the contract for health monitoring
 type HealthService interface {
 	// Health checks
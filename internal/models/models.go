@@ -11,11 +11,62 @@ type Sale struct {
 	EndTime        time.Time `json:"end_time"`
 	ItemsAvailable int       `json:"items_available"`
 	ItemsSold      int       `json:"items_sold"`
+	MaxPerUser     int       `json:"max_per_user"`
 	Active         bool      `json:"active"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// SaleItem represents an item's stock allocation within a sale
+type SaleItem struct {
+	SaleID    int       `json:"sale_id"`
+	ItemID    string    `json:"item_id"`
+	Stock     int       `json:"stock"`
+	Sold      int       `json:"sold"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Sale window statuses
+const (
+	SaleWindowPending   = "pending"
+	SaleWindowActive    = "active"
+	SaleWindowCompleted = "completed"
+	SaleWindowMissed    = "missed"
+	SaleWindowCancelled = "cancelled"
+)
+
+// Sale window sources
+const (
+	SaleWindowSourceRule   = "rule"
+	SaleWindowSourceManual = "manual"
+)
+
+// SaleWindow is a scheduled sale. ItemsAvailable and MaxPerUser of 0 use the server defaults.
+type SaleWindow struct {
+	ID             int       `json:"id"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	ItemsAvailable int       `json:"items_available,omitempty"`
+	MaxPerUser     int       `json:"max_per_user,omitempty"`
+	SaleID         int       `json:"sale_id,omitempty"` // Set once the window's sale is created
+	Status         string    `json:"status"`
+	Source         string    `json:"source"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AuditEntry records an admin action on a sale
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	SaleID    int       `json:"sale_id,omitempty"` // 0 when the action failed before a sale existed
+	Success   bool      `json:"success"`
+	Details   string    `json:"details,omitempty"` // JSON-encoded request details or error
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // CheckoutAttempt represents a user's checkout attempt
 type CheckoutAttempt struct {
 	ID        int       `json:"id"`
@@ -30,13 +81,29 @@ type CheckoutAttempt struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CheckoutClaims are the checkout details signed into a checkout code
+type CheckoutClaims struct {
+	KeyID     string    `json:"key_id"` // Signing key the code was issued with
+	SaleID    int       `json:"sale_id"`
+	UserID    string    `json:"user_id"`
+	ItemID    string    `json:"item_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 // Item represents a purchasable item (generated at runtime)
 type Item struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Price       Money      `json:"price"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"` // Set once the item can no longer be checked out
+}
+
+// ItemPrice is a new price for a catalog item, as set by a bulk price update
+type ItemPrice struct {
+	ItemID string `json:"item_id"`
+	Price  Money  `json:"price"`
 }
 
 // CheckoutRequest represents the request payload for checkout
@@ -80,6 +147,13 @@ type HealthResponse struct {
 // Checkout represents a simplified checkout (alias for CheckoutAttempt for compatibility)
 type Checkout = CheckoutAttempt
 
+// Purchase statuses
+const (
+	PurchaseStatusCompleted = "completed"
+	PurchaseStatusRefunded  = "refunded"
+	PurchaseStatusCancelled = "cancelled"
+)
+
 // Purchase represents a completed purchase
 type Purchase struct {
 	ID          int       `json:"id"`
@@ -88,7 +162,7 @@ type Purchase struct {
 	ItemID      string    `json:"item_id"`
 	Code        string    `json:"code"`
 	CheckoutID  int       `json:"checkout_id"`
-	Price       float64   `json:"price"`
+	Price       Money     `json:"price"`
 	Status      string    `json:"status"`
 	PurchaseAt  time.Time `json:"purchased_at"`
 	PurchasedAt time.Time `json:"purchased_at"` // Alias for compatibility
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts given without one, and of every price
+// recorded before currencies were stored
+const DefaultCurrency = "USD"
+
+// currencyExponents maps the supported ISO 4217 currency codes to the number of
+// minor-unit digits each has
+var currencyExponents = map[string]int{
+	"AUD": 2, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2, "GBP": 2, "INR": 2, "USD": 2,
+	"JPY": 0, "KRW": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3,
+}
+
+// CurrencyExponent returns how many minor-unit digits a currency has, and whether
+// the currency is supported
+func CurrencyExponent(currency string) (int, bool) {
+	exponent, ok := currencyExponents[currency]
+	return exponent, ok
+}
+
+// Money is an amount in a currency's minor units, such as cents for USD, so prices
+// are exact. In JSON it is {"amount": 1999, "currency": "USD"}.
+type Money struct {
+	Amount   int64  `json:"amount"`   // Minor units
+	Currency string `json:"currency"` // ISO 4217 code
+}
+
+// NewMoney returns amount minor units of currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal amount in major units, such as "19.99", in currency.
+// Amounts with more significant decimals than the currency has are rejected rather
+// than rounded.
+func ParseMoney(amount, currency string) (Money, error) {
+	exponent, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	digits := strings.TrimPrefix(amount, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" || strings.Trim(whole+fraction, "0123456789") != "" || (strings.Contains(digits, ".") && fraction == "") {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", amount, exponent, currency)
+	}
+
+	minor, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is out of range", amount)
+	}
+
+	if strings.HasPrefix(amount, "-") {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// Validate checks that the currency is supported
+func (m Money) Validate() error {
+	if _, ok := CurrencyExponent(m.Currency); !ok {
+		return fmt.Errorf("unsupported currency %q", m.Currency)
+	}
+	return nil
+}
+
+// Decimal formats the amount in major units with the currency's decimals, such as "19.99"
+func (m Money) Decimal() string {
+	exponent, _ := CurrencyExponent(m.Currency)
+	if exponent == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	digits := fmt.Sprintf("%0*d", exponent+1, amount)
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// String formats the amount with its currency, such as "19.99 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// MulRatio returns the amount multiplied by num/den, rounded half to even to a whole
+// minor unit, so rounding many amounts does not bias their total up or down
+func (m Money) MulRatio(num, den int64) Money {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	divisor := big.NewInt(den)
+	quotient, remainder := new(big.Int).QuoRem(product, divisor, new(big.Int))
+
+	// Compare twice the remainder with the divisor to round the quotient
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	if cmp := twice.Cmp(new(big.Int).Abs(divisor)); cmp > 0 || (cmp == 0 && quotient.Bit(0) == 1) {
+		if product.Sign()*divisor.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: m.Currency}
+}
+
+// UnmarshalJSON accepts {"amount": 1999, "currency": "USD"}, or a decimal number in
+// major units such as 19.99, which is read exactly in DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	if len(data) > 0 && (data[0] == '-' || (data[0] >= '0' && data[0] <= '9')) {
+		parsed, err := ParseMoney(string(data), DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	type money Money // Without this method, to decode the object form
+	var decoded money
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*m = Money(decoded)
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// TokenLeeway is the clock skew tolerated when checking a token's exp and nbf claims
+const TokenLeeway = 30 * time.Second
+
+// Supported token signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// ErrUnauthenticated is returned for requests without a valid bearer token
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// tokenKey verifies signatures made with one key
+type tokenKey struct {
+	alg    string
+	secret []byte           // HS256
+	rsa    *rsa.PublicKey   // RS256
+	ecdsa  *ecdsa.PublicKey // ES256
+}
+
+// TokenAuthenticator authenticates requests by the JWT in their "Authorization: Bearer"
+// header. The user ID is the token's sub claim. Tokens must be signed by a configured key
+// with that key's algorithm, must not be expired, and must match the issuer and audience
+// when those are configured.
+type TokenAuthenticator struct {
+	keys     map[string]*tokenKey // By key ID; "" for a key used by tokens without a kid
+	issuer   string
+	audience string
+	clock    interfaces.Clock
+}
+
+// NewHMACAuthenticator creates an authenticator for HS256 tokens signed with a shared secret
+func NewHMACAuthenticator(secret []byte, issuer, audience string, clock interfaces.Clock) (*TokenAuthenticator, error) {
+	if len(secret) < MinSigningKeyBytes {
+		return nil, fmt.Errorf("token secret must be at least %d bytes", MinSigningKeyBytes)
+	}
+
+	return &TokenAuthenticator{
+		keys:     map[string]*tokenKey{"": {alg: AlgHS256, secret: secret}},
+		issuer:   issuer,
+		audience: audience,
+		clock:    clock,
+	}, nil
+}
+
+// NewJWKSAuthenticator creates an authenticator for RS256 and ES256 tokens signed by the
+// keys in a JWKS file. The file is read once; restart to pick up rotated keys.
+func NewJWKSAuthenticator(path, issuer, audience string, clock interfaces.Clock) (*TokenAuthenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenAuthenticator{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		clock:    clock,
+	}, nil
+}
+
+// jwk is a JSON Web Key; only the fields of RSA and P-256 EC public keys are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses the signing keys of a JWKS document, keyed by key ID
+func parseJWKS(data []byte) (map[string]*tokenKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*tokenKey)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		parsed, err := parseJWK(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", key.Kid, err)
+		}
+
+		if _, exists := keys[key.Kid]; exists {
+			return nil, fmt.Errorf("duplicate JWKS key id %q", key.Kid)
+		}
+		keys[key.Kid] = parsed
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no signing keys")
+	}
+
+	return keys, nil
+}
+
+// parseJWK converts a JSON Web Key into a verification key
+func parseJWK(key jwk) (*tokenKey, error) {
+	switch key.Kty {
+	case "RSA":
+		if key.Alg != "" && key.Alg != AlgRS256 {
+			return nil, fmt.Errorf("unsupported RSA algorithm %s", key.Alg)
+		}
+
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+
+		return &tokenKey{alg: AlgRS256, rsa: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+
+	case "EC":
+		if key.Crv != "P-256" || (key.Alg != "" && key.Alg != AlgES256) {
+			return nil, fmt.Errorf("unsupported EC curve %s", key.Crv)
+		}
+
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve P-256")
+		}
+
+		return &tokenKey{alg: AlgES256, ecdsa: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+// Authenticate returns the user ID of the request's bearer token
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return "", fmt.Errorf("%w: missing bearer token", ErrUnauthenticated)
+	}
+
+	return a.VerifyToken(strings.TrimSpace(header[len(prefix):]))
+}
+
+// VerifyToken verifies a JWT and returns its subject
+func (a *TokenAuthenticator) VerifyToken(token string) (string, error) {
+	// 1. Split the token and decode its header
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed token", ErrUnauthenticated)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("%w: malformed token header", ErrUnauthenticated)
+	}
+
+	// 2. Verify the signature with the named key, using only that key's algorithm
+	key, err := a.lookupKey(header.Kid)
+	if err != nil {
+		return "", err
+	}
+	if header.Alg != key.alg {
+		return "", fmt.Errorf("%w: unexpected algorithm %q", ErrUnauthenticated, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed signature", ErrUnauthenticated)
+	}
+	if !key.verify(parts[0]+"."+parts[1], signature) {
+		return "", fmt.Errorf("%w: invalid signature", ErrUnauthenticated)
+	}
+
+	// 3. Check the claims
+	var claims struct {
+		Sub string   `json:"sub"`
+		Iss string   `json:"iss"`
+		Aud audience `json:"aud"`
+		Exp *int64   `json:"exp"`
+		Nbf *int64   `json:"nbf"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("%w: malformed token claims", ErrUnauthenticated)
+	}
+
+	now := a.clock.Now()
+	if claims.Exp == nil || now.After(time.Unix(*claims.Exp, 0).Add(TokenLeeway)) {
+		return "", fmt.Errorf("%w: token expired", ErrUnauthenticated)
+	}
+	if claims.Nbf != nil && now.Add(TokenLeeway).Before(time.Unix(*claims.Nbf, 0)) {
+		return "", fmt.Errorf("%w: token not yet valid", ErrUnauthenticated)
+	}
+	if a.issuer != "" && claims.Iss != a.issuer {
+		return "", fmt.Errorf("%w: unexpected issuer %q", ErrUnauthenticated, claims.Iss)
+	}
+	if a.audience != "" && !claims.Aud.contains(a.audience) {
+		return "", fmt.Errorf("%w: token not issued for this audience", ErrUnauthenticated)
+	}
+	if claims.Sub == "" || len(claims.Sub) > 100 {
+		return "", fmt.Errorf("%w: token subject must be between 1 and 100 characters", ErrUnauthenticated)
+	}
+
+	return claims.Sub, nil
+}
+
+// lookupKey finds the key named by a token; tokens without a kid use the only key
+func (a *TokenAuthenticator) lookupKey(kid string) (*tokenKey, error) {
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrUnauthenticated, kid)
+}
+
+// verify checks a signature over the token's signing input
+func (k *tokenKey) verify(signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch k.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(signature, mac.Sum(nil))
+
+	case AlgRS256:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], signature) == nil
+
+	case AlgES256:
+		// JWS ECDSA signatures are the raw r and s, 32 bytes each
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k.ecdsa, digest[:], r, s)
+
+	default:
+		return false
+	}
+}
+
+// audience is a JWT aud claim, which may be a single string or a list
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, entry := range a {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url JSON token segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBigInt decodes a base64url big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
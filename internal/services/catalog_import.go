@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+)
+
+// ErrSaleAllocationLocked is returned when an import changes the allocations of a
+// sale that is active or has ended. The active sale's stock lives in Redis.
+var ErrSaleAllocationLocked = errors.New("sale is active or has ended; its allocations cannot change")
+
+// CatalogCSVHeader lists the catalog CSV columns. Prices are decimals in major units of
+// the currency, which defaults to models.DefaultCurrency. sale_id and stock are optional:
+// a row with both set also allocates that much stock of the item to the sale.
+var CatalogCSVHeader = []string{"id", "name", "description", "price", "currency", "sale_id", "stock"}
+
+// CatalogImport is the catalog items and per-sale allocations an import brings the
+// catalog in line with
+type CatalogImport struct {
+	Items       []models.Item     `json:"items"`
+	Allocations []models.SaleItem `json:"allocations"`
+}
+
+// CatalogChangeKind identifies what a catalog change does
+type CatalogChangeKind string
+
+// Catalog change kinds
+const (
+	CatalogCreateItem       CatalogChangeKind = "create_item"
+	CatalogUpdateItem       CatalogChangeKind = "update_item"
+	CatalogCreateAllocation CatalogChangeKind = "create_allocation"
+	CatalogUpdateAllocation CatalogChangeKind = "update_allocation"
+)
+
+// CatalogChange is one difference between an import and the current catalog
+type CatalogChange struct {
+	Kind       CatalogChangeKind
+	Item       *models.Item     // The imported item, for item changes
+	Current    *models.Item     // The item in the catalog, for CatalogUpdateItem
+	Allocation *models.SaleItem // The imported allocation, for allocation changes
+	Stock      int              // The stock currently allocated, for CatalogUpdateAllocation
+}
+
+// String describes the change as a line of a diff
+func (c CatalogChange) String() string {
+	switch c.Kind {
+	case CatalogCreateItem:
+		return fmt.Sprintf("+ item %s: name %q, description %q, price %s",
+			c.Item.ID, c.Item.Name, c.Item.Description, c.Item.Price)
+	case CatalogUpdateItem:
+		var fields []string
+		if c.Item.Name != c.Current.Name {
+			fields = append(fields, fmt.Sprintf("name %q -> %q", c.Current.Name, c.Item.Name))
+		}
+		if c.Item.Description != c.Current.Description {
+			fields = append(fields, fmt.Sprintf("description %q -> %q", c.Current.Description, c.Item.Description))
+		}
+		if c.Item.Price != c.Current.Price {
+			fields = append(fields, fmt.Sprintf("price %s -> %s", c.Current.Price, c.Item.Price))
+		}
+		return fmt.Sprintf("~ item %s: %s", c.Item.ID, strings.Join(fields, ", "))
+	case CatalogCreateAllocation:
+		return fmt.Sprintf("+ sale %d item %s: stock %d", c.Allocation.SaleID, c.Allocation.ItemID, c.Allocation.Stock)
+	case CatalogUpdateAllocation:
+		return fmt.Sprintf("~ sale %d item %s: stock %d -> %d", c.Allocation.SaleID, c.Allocation.ItemID, c.Stock, c.Allocation.Stock)
+	default:
+		return fmt.Sprintf("? %s", c.Kind)
+	}
+}
+
+// CatalogImporter brings the item catalog and sale allocations in line with an import.
+// Only differences are applied, so importing the same data twice changes nothing the
+// second time.
+type CatalogImporter struct {
+	db    interfaces.DatabaseInterface
+	items *ItemServiceImpl
+}
+
+// NewCatalogImporter creates an importer that changes items through itemService
+func NewCatalogImporter(db interfaces.DatabaseInterface, itemService *ItemServiceImpl) *CatalogImporter {
+	return &CatalogImporter{
+		db:    db,
+		items: itemService,
+	}
+}
+
+// Plan validates an import and returns the changes needed to apply it. Every problem
+// found is reported, not just the first.
+func (c *CatalogImporter) Plan(ctx context.Context, catalog *CatalogImport) ([]CatalogChange, error) {
+	var changes []CatalogChange
+	var problems []error
+
+	// 1. Diff the items against the catalog
+	imported := make(map[string]bool, len(catalog.Items))
+	for idx := range catalog.Items {
+		item := &catalog.Items[idx]
+		if imported[item.ID] {
+			problems = append(problems, fmt.Errorf("%w: duplicate item %s", ErrInvalidItem, item.ID))
+			continue
+		}
+		imported[item.ID] = true
+
+		change, err := c.planItem(ctx, item)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	// 2. Diff the allocations against each sale's current allocations
+	bySale := make(map[int][]models.SaleItem)
+	var saleIDs []int
+	for _, allocation := range catalog.Allocations {
+		if _, seen := bySale[allocation.SaleID]; !seen {
+			saleIDs = append(saleIDs, allocation.SaleID)
+		}
+		bySale[allocation.SaleID] = append(bySale[allocation.SaleID], allocation)
+	}
+
+	for _, saleID := range saleIDs {
+		saleChanges, err := c.planAllocations(ctx, saleID, bySale[saleID], imported)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		changes = append(changes, saleChanges...)
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	return changes, nil
+}
+
+// Apply makes the planned changes and returns how many were made. Changes are not
+// applied atomically; after a failure, planning and applying the import again picks
+// up where it stopped.
+func (c *CatalogImporter) Apply(ctx context.Context, changes []CatalogChange) (int, error) {
+	for idx, change := range changes {
+		var err error
+		switch change.Kind {
+		case CatalogCreateItem:
+			item := *change.Item
+			err = c.items.CreateItem(ctx, &item)
+		case CatalogUpdateItem:
+			item := *change.Item
+			err = c.items.UpdateItem(ctx, &item)
+		case CatalogCreateAllocation:
+			err = c.db.CreateSaleItems(ctx, change.Allocation.SaleID, []models.SaleItem{*change.Allocation})
+		case CatalogUpdateAllocation:
+			var found bool
+			found, err = c.db.UpdateSaleItemStock(ctx, change.Allocation.SaleID, change.Allocation.ItemID, change.Allocation.Stock)
+			if err == nil && !found {
+				err = fmt.Errorf("item %s is no longer allocated to sale %d", change.Allocation.ItemID, change.Allocation.SaleID)
+			}
+		default:
+			err = fmt.Errorf("unknown catalog change %s", change.Kind)
+		}
+
+		if err != nil {
+			return idx, fmt.Errorf("failed to apply %s: %w", change, err)
+		}
+	}
+
+	return len(changes), nil
+}
+
+// Export writes the catalog as CSV. With a sale ID, the stock allocated to each item
+// in that sale is included.
+func (c *CatalogImporter) Export(ctx context.Context, w io.Writer, saleID int, includeRetired bool) error {
+	items, err := c.items.ListItems(ctx, includeRetired)
+	if err != nil {
+		return err
+	}
+
+	var allocations []models.SaleItem
+	if saleID > 0 {
+		allocations, err = c.db.GetSaleItems(ctx, saleID)
+		if err != nil {
+			return fmt.Errorf("failed to get allocations of sale %d: %w", saleID, err)
+		}
+	}
+
+	return WriteCatalogCSV(w, items, allocations)
+}
+
+// planItem validates an imported item and diffs it against the catalog.
+// It returns nil if the item is unchanged.
+func (c *CatalogImporter) planItem(ctx context.Context, item *models.Item) (*CatalogChange, error) {
+	if err := c.items.ValidateItem(item); err != nil {
+		return nil, fmt.Errorf("item %s: %w", item.ID, err)
+	}
+
+	current, err := c.db.GetItemByID(ctx, item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item %s: %w", item.ID, err)
+	}
+
+	if current == nil {
+		return &CatalogChange{Kind: CatalogCreateItem, Item: item}, nil
+	}
+
+	if item.Name == current.Name && item.Description == current.Description && item.Price == current.Price {
+		return nil, nil
+	}
+
+	if item.Price != current.Price {
+		if err := c.items.checkPriceUnlocked(ctx, item.ID); err != nil {
+			return nil, fmt.Errorf("item %s: %w", item.ID, err)
+		}
+	}
+
+	return &CatalogChange{Kind: CatalogUpdateItem, Item: item, Current: current}, nil
+}
+
+// planAllocations validates the imported allocations of one sale and diffs them against
+// its current allocations. Allocations missing from the import are left unchanged.
+func (c *CatalogImporter) planAllocations(ctx context.Context, saleID int, allocations []models.SaleItem, imported map[string]bool) ([]CatalogChange, error) {
+	if err := validateSaleItems(allocations); err != nil {
+		return nil, fmt.Errorf("sale %d: %w", saleID, err)
+	}
+
+	sale, err := c.db.GetSaleByID(ctx, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sale %d: %w", saleID, err)
+	}
+
+	if sale == nil {
+		return nil, fmt.Errorf("sale %d not found", saleID)
+	}
+
+	if sale.Active || !sale.EndTime.After(time.Now()) {
+		return nil, fmt.Errorf("sale %d: %w", saleID, ErrSaleAllocationLocked)
+	}
+
+	current, err := c.db.GetSaleItems(ctx, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocations of sale %d: %w", saleID, err)
+	}
+
+	currentByItem := make(map[string]models.SaleItem, len(current))
+	for _, allocation := range current {
+		currentByItem[allocation.ItemID] = allocation
+	}
+
+	var changes []CatalogChange
+	for idx := range allocations {
+		allocation := &allocations[idx]
+		allocation.SaleID = saleID
+
+		if err := c.items.ValidateItemID(allocation.ItemID); err != nil {
+			return nil, fmt.Errorf("sale %d: %w: %v", saleID, ErrInvalidItem, err)
+		}
+
+		existing, allocated := currentByItem[allocation.ItemID]
+		if !allocated {
+			if !imported[allocation.ItemID] {
+				if _, err := c.items.LookupItem(ctx, allocation.ItemID); err != nil {
+					return nil, fmt.Errorf("sale %d: %w", saleID, err)
+				}
+			}
+			changes = append(changes, CatalogChange{Kind: CatalogCreateAllocation, Allocation: allocation})
+			continue
+		}
+
+		if allocation.Stock == existing.Stock {
+			continue
+		}
+
+		if allocation.Stock < existing.Sold {
+			return nil, fmt.Errorf("sale %d: stock for item %s cannot drop below the %d units sold", saleID, allocation.ItemID, existing.Sold)
+		}
+
+		changes = append(changes, CatalogChange{Kind: CatalogUpdateAllocation, Allocation: allocation, Stock: existing.Stock})
+	}
+
+	return changes, nil
+}
+
+// ParseCatalogJSON reads an import in the CatalogImport JSON format
+func ParseCatalogJSON(r io.Reader) (*CatalogImport, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var catalog CatalogImport
+	if err := decoder.Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("invalid catalog JSON: %w", err)
+	}
+
+	return &catalog, nil
+}
+
+// ParseCatalogCSV reads an import with the CatalogCSVHeader columns, in any order.
+// The id, name and price columns are required. An item allocated to several sales is
+// listed once per sale, with the same name, description and price each time.
+func ParseCatalogCSV(r io.Reader) (*CatalogImport, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	// 1. Map the header to column positions
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for idx, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isCatalogColumn(name) {
+			return nil, fmt.Errorf("unknown catalog CSV column %q", name)
+		}
+		if _, duplicate := columns[name]; duplicate {
+			return nil, fmt.Errorf("duplicate catalog CSV column %q", name)
+		}
+		columns[name] = idx
+	}
+
+	for _, required := range []string{"id", "name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("catalog CSV is missing the %q column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if idx, ok := columns[name]; ok {
+			return strings.TrimSpace(record[idx])
+		}
+		return ""
+	}
+
+	// 2. Read the rows, merging repeated items
+	catalog := &CatalogImport{}
+	itemRows := make(map[string]int)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog CSV: %w", err)
+		}
+
+		currency := field(record, "currency")
+		if currency == "" {
+			currency = models.DefaultCurrency
+		}
+
+		price, err := models.ParseMoney(field(record, "price"), strings.ToUpper(currency))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid price: %v", row, err)
+		}
+
+		item := models.Item{
+			ID:          field(record, "id"),
+			Name:        field(record, "name"),
+			Description: field(record, "description"),
+			Price:       price,
+		}
+
+		if first, seen := itemRows[item.ID]; !seen {
+			itemRows[item.ID] = len(catalog.Items)
+			catalog.Items = append(catalog.Items, item)
+		} else if catalog.Items[first] != item {
+			return nil, fmt.Errorf("row %d: item %s differs from its earlier row", row, item.ID)
+		}
+
+		saleID, stock := field(record, "sale_id"), field(record, "stock")
+		if saleID == "" && stock == "" {
+			continue
+		}
+
+		allocation := models.SaleItem{ItemID: item.ID}
+		if allocation.SaleID, err = strconv.Atoi(saleID); err != nil || allocation.SaleID <= 0 {
+			return nil, fmt.Errorf("row %d: invalid sale_id %q", row, saleID)
+		}
+		if allocation.Stock, err = strconv.Atoi(stock); err != nil {
+			return nil, fmt.Errorf("row %d: invalid stock %q", row, stock)
+		}
+		catalog.Allocations = append(catalog.Allocations, allocation)
+	}
+
+	return catalog, nil
+}
+
+// WriteCatalogCSV writes items in the catalog CSV format, one row per item. Items
+// with an allocation get its sale ID and stock; allocations of items not listed are
+// left out.
+func WriteCatalogCSV(w io.Writer, items []models.Item, allocations []models.SaleItem) error {
+	allocated := make(map[string]models.SaleItem, len(allocations))
+	for _, allocation := range allocations {
+		allocated[allocation.ItemID] = allocation
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(CatalogCSVHeader); err != nil {
+		return fmt.Errorf("failed to write catalog CSV: %w", err)
+	}
+
+	for _, item := range items {
+		record := []string{item.ID, item.Name, item.Description, item.Price.Decimal(), item.Price.Currency, "", ""}
+		if allocation, ok := allocated[item.ID]; ok {
+			record[5] = strconv.Itoa(allocation.SaleID)
+			record[6] = strconv.Itoa(allocation.Stock)
+		}
+
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write catalog CSV: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write catalog CSV: %w", err)
+	}
+
+	return nil
+}
+
+// isCatalogColumn reports whether name is one of the catalog CSV columns
+func isCatalogColumn(name string) bool {
+	for _, column := range CatalogCSVHeader {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"flash-sale-backend/internal/models"
+)
+
+// Checkout code format: CHK_<key id>.<payload>.<signature>, where the payload and the
+// signature are unpadded base64url. The payload holds a version byte, the sale ID, user ID,
+// item ID, expiry (Unix ms) and a random nonce; the signature is a truncated HMAC-SHA256 of
+// everything before it, keyed by the signing key named in the code.
+const (
+	CheckoutCodePrefix       = "CHK_"
+	MinSigningKeyBytes       = 32 // Shortest accepted signing secret
+	checkoutCodeVersion      = 1
+	checkoutCodeNonceBytes   = 8
+	checkoutCodeSigBytes     = 16
+	maxSigningKeyIDLength    = 32
+	checkoutCodeSeparator    = "."
+	checkoutCodePayloadLimit = 512 // Longest payload accepted before decoding
+)
+
+// ErrInvalidCheckoutCode is returned for codes that are malformed, signed with an
+// unknown key or fail signature verification
+var ErrInvalidCheckoutCode = errors.New("invalid checkout code")
+
+// SigningKey is a named checkout code signing secret
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// CheckoutCodeSigner signs checkout details into self-validating checkout codes.
+// New codes are signed with the first key; every key verifies, so a retired key can
+// keep verifying codes it issued until they expire.
+type CheckoutCodeSigner struct {
+	active SigningKey
+	keys   map[string][]byte
+}
+
+// NewCheckoutCodeSigner creates a signer from an ordered key list; the first key signs
+func NewCheckoutCodeSigner(keys []SigningKey) (*CheckoutCodeSigner, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one signing key is required")
+	}
+
+	signer := &CheckoutCodeSigner{
+		active: keys[0],
+		keys:   make(map[string][]byte, len(keys)),
+	}
+	for _, key := range keys {
+		if err := validateSigningKeyID(key.ID); err != nil {
+			return nil, err
+		}
+		if len(key.Secret) < MinSigningKeyBytes {
+			return nil, fmt.Errorf("signing key %s must be at least %d bytes", key.ID, MinSigningKeyBytes)
+		}
+		if _, exists := signer.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key id %s", key.ID)
+		}
+		signer.keys[key.ID] = key.Secret
+	}
+
+	return signer, nil
+}
+
+// ParseSigningKeys parses a key spec like "2025-10:<base64 secret>,2025-07:<base64 secret>"
+func ParseSigningKeys(spec string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid signing key entry, expected key_id:base64_secret")
+		}
+
+		keyID := strings.TrimSpace(parts[0])
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret for signing key %s: %w", keyID, err)
+		}
+
+		keys = append(keys, SigningKey{ID: keyID, Secret: secret})
+	}
+
+	return keys, nil
+}
+
+// validateSigningKeyID checks a key ID is safe to embed in a checkout code
+func validateSigningKeyID(keyID string) error {
+	if keyID == "" || len(keyID) > maxSigningKeyIDLength {
+		return fmt.Errorf("signing key id must be between 1 and %d characters", maxSigningKeyIDLength)
+	}
+
+	for _, r := range keyID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("signing key id %q may only contain letters, digits, '-' and '_'", keyID)
+		}
+	}
+
+	return nil
+}
+
+// Sign issues a checkout code for the claims with the active key
+func (s *CheckoutCodeSigner) Sign(claims *models.CheckoutClaims) (string, error) {
+	nonce := make([]byte, checkoutCodeNonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate checkout code nonce: %w", err)
+	}
+
+	payload := []byte{checkoutCodeVersion}
+	payload = binary.AppendUvarint(payload, uint64(claims.SaleID))
+	payload = appendString(payload, claims.UserID)
+	payload = appendString(payload, claims.ItemID)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(claims.ExpiresAt.UnixMilli()))
+	payload = append(payload, nonce...)
+
+	signed := CheckoutCodePrefix + s.active.ID + checkoutCodeSeparator + base64.RawURLEncoding.EncodeToString(payload)
+	signature := sign(s.active.Secret, signed)
+
+	return signed + checkoutCodeSeparator + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a checkout code's signature and returns the claims signed into it.
+// It does not check expiry; callers compare ExpiresAt with their own clock.
+func (s *CheckoutCodeSigner) Verify(code string) (*models.CheckoutClaims, error) {
+	// 1. Split the code and find its signing key
+	if !strings.HasPrefix(code, CheckoutCodePrefix) {
+		return nil, fmt.Errorf("%w: missing %s prefix", ErrInvalidCheckoutCode, CheckoutCodePrefix)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(code, CheckoutCodePrefix), checkoutCodeSeparator)
+	if len(parts) != 3 || len(parts[1]) > checkoutCodePayloadLimit {
+		return nil, fmt.Errorf("%w: malformed code", ErrInvalidCheckoutCode)
+	}
+
+	secret, ok := s.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidCheckoutCode, parts[0])
+	}
+
+	// 2. Verify the signature before trusting anything in the payload
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidCheckoutCode)
+	}
+
+	signed := code[:len(code)-len(parts[2])-len(checkoutCodeSeparator)]
+	if !hmac.Equal(signature, sign(secret, signed)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidCheckoutCode)
+	}
+
+	// 3. Decode the claims
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidCheckoutCode)
+	}
+
+	claims, err := decodeClaims(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCheckoutCode, err)
+	}
+	claims.KeyID = parts[0]
+
+	return claims, nil
+}
+
+// decodeClaims decodes a signed payload
+func decodeClaims(payload []byte) (*models.CheckoutClaims, error) {
+	if len(payload) == 0 || payload[0] != checkoutCodeVersion {
+		return nil, fmt.Errorf("unsupported code version")
+	}
+	rest := payload[1:]
+
+	saleID, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return nil, fmt.Errorf("malformed sale id")
+	}
+	rest = rest[n:]
+
+	userID, rest, err := readString(rest)
+	if err != nil {
+		return nil, fmt.Errorf("malformed user id")
+	}
+
+	itemID, rest, err := readString(rest)
+	if err != nil {
+		return nil, fmt.Errorf("malformed item id")
+	}
+
+	if len(rest) != 8+checkoutCodeNonceBytes {
+		return nil, fmt.Errorf("malformed expiry")
+	}
+	expiresAt := time.UnixMilli(int64(binary.BigEndian.Uint64(rest)))
+
+	return &models.CheckoutClaims{
+		SaleID:    int(saleID),
+		UserID:    userID,
+		ItemID:    itemID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// appendString appends a length-prefixed string
+func appendString(buf []byte, value string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// readString reads a length-prefixed string and returns the remaining bytes
+func readString(buf []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < length {
+		return "", nil, fmt.Errorf("truncated string")
+	}
+
+	end := n + int(length)
+	return string(buf[n:end]), buf[end:], nil
+}
+
+// sign returns the truncated HMAC-SHA256 of a message
+func sign(secret []byte, message string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)[:checkoutCodeSigBytes]
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// Checkout expiry sweeper defaults
+const (
+	DefaultCheckoutSweepInterval = 30 * time.Second
+	CheckoutExpiryBatchSize      = 500 // Attempts expired per database round trip
+)
+
+// CheckoutSweepResult reports what a sweep expired
+type CheckoutSweepResult struct {
+	Expired      int // Checkout attempts marked expired in Postgres
+	CodesRemoved int // Cached checkout codes deleted from Redis
+}
+
+// CheckoutExpirySweeper marks pending checkout attempts past their expires_at as
+// expired and removes their cached codes from Redis. Each batch claims its rows with
+// FOR UPDATE SKIP LOCKED, so replicas can sweep concurrently without overlapping.
+type CheckoutExpirySweeper struct {
+	db       interfaces.DatabaseInterface
+	redis    interfaces.RedisInterface
+	clock    interfaces.Clock
+	interval time.Duration
+	stopChan chan struct{}
+}
+
+// NewCheckoutExpirySweeper creates a new checkout expiry sweeper
+func NewCheckoutExpirySweeper(
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+	clock interfaces.Clock,
+	interval time.Duration,
+) *CheckoutExpirySweeper {
+	return &CheckoutExpirySweeper{
+		db:       db,
+		redis:    redis,
+		clock:    clock,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Sweep expires every checkout attempt that expired by now, in batches.
+// A failure to remove cached codes is only logged; they still expire with their Redis TTL.
+func (s *CheckoutExpirySweeper) Sweep(ctx context.Context) (*CheckoutSweepResult, error) {
+	result := &CheckoutSweepResult{}
+	now := s.clock.Now()
+
+	for {
+		// 1. Mark a batch of attempts expired in Postgres
+		codes, err := s.db.ExpireCheckoutAttempts(ctx, now, CheckoutExpiryBatchSize)
+		if err != nil {
+			return result, err
+		}
+		result.Expired += len(codes)
+
+		// 2. Drop their cached codes so Redis stops accepting them
+		if len(codes) > 0 {
+			removed, err := s.redis.RemoveExpiredCheckoutCodes(ctx, codes)
+			if err != nil {
+				log.Printf("Warning: failed to remove %d expired checkout codes from Redis: %v", len(codes), err)
+			}
+			result.CodesRemoved += removed
+		}
+
+		if len(codes) < CheckoutExpiryBatchSize {
+			break
+		}
+	}
+
+	if result.Expired > 0 {
+		log.Printf("Expired %d checkout attempts, removed %d cached codes", result.Expired, result.CodesRemoved)
+	}
+
+	return result, nil
+}
+
+// Start sweeps every interval until Stop is called or ctx is done
+func (s *CheckoutExpirySweeper) Start(ctx context.Context) {
+	for {
+		if _, err := s.Sweep(ctx); err != nil {
+			log.Printf("Warning: failed to expire checkout attempts: %v", err)
+		}
+
+		select {
+		case <-s.clock.After(s.interval):
+		case <-s.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the sweeper
+func (s *CheckoutExpirySweeper) Stop() {
+	close(s.stopChan)
+}
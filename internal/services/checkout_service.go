@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// DefaultCheckoutTTL is how long a checkout code stays valid unless configured otherwise
+const DefaultCheckoutTTL = 10 * time.Minute
+
+// MaxUserIDLength is the longest user ID accepted at checkout
+const MaxUserIDLength = 100
+
+// Checkout rejections
+var (
+	ErrNoActiveSale   = errors.New("no active sale")
+	ErrSaleNotRunning = errors.New("sale is not currently running")
+	ErrUnknownItem    = errors.New("unknown item")
+)
+
+// CheckoutServiceImpl implements interfaces.CheckoutService
+type CheckoutServiceImpl struct {
+	saleService interfaces.SaleService
+	itemService interfaces.ItemService
+	db          interfaces.DatabaseInterface
+	redis       interfaces.RedisInterface
+	codes       interfaces.CheckoutCodeSigner // Signs checkout codes; random unsigned codes when nil
+
+	checkoutTTL time.Duration // Lifetime of a checkout code, in Postgres and Redis alike
+	reserve     bool          // Hold a unit of stock for each checkout code until it expires
+	writeBehind bool          // Queue checkout attempts for Postgres instead of inserting them
+}
+
+// NewCheckoutService creates a new checkout service
+func NewCheckoutService(
+	saleService interfaces.SaleService,
+	itemService interfaces.ItemService,
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+) *CheckoutServiceImpl {
+	return &CheckoutServiceImpl{
+		saleService: saleService,
+		itemService: itemService,
+		db:          db,
+		redis:       redis,
+		checkoutTTL: DefaultCheckoutTTL,
+	}
+}
+
+// SetCheckoutTTL sets how long checkout codes stay valid
+func (s *CheckoutServiceImpl) SetCheckoutTTL(ttl time.Duration) {
+	s.checkoutTTL = ttl
+}
+
+// SetCodeSigner sets the signer used to issue checkout codes. Signed codes carry the
+// sale, user, item and expiry, so purchases can reject forged codes without a lookup.
+func (s *CheckoutServiceImpl) SetCodeSigner(signer interfaces.CheckoutCodeSigner) {
+	s.codes = signer
+}
+
+// SetReservations enables or disables reserving stock at checkout. With reservations,
+// a checkout code is only issued if a unit can be held for it until the code expires,
+// so every issued code can be redeemed; unredeemed units are released by the reservation sweeper.
+func (s *CheckoutServiceImpl) SetReservations(enabled bool) {
+	s.reserve = enabled
+}
+
+// SetWriteBehind enables or disables write-behind persistence. With write-behind, checkout
+// attempts are queued on the Redis persistence stream instead of inserted before returning,
+// and purchases verify the code from Redis.
+func (s *CheckoutServiceImpl) SetWriteBehind(enabled bool) {
+	s.writeBehind = enabled
+}
+
+// ValidateCheckoutRequest validates the checkout request parameters
+func (s *CheckoutServiceImpl) ValidateCheckoutRequest(userID, itemID string) error {
+	if userID == "" {
+		return fmt.Errorf("user_id is required")
+	}
+
+	if itemID == "" {
+		return fmt.Errorf("item_id is required")
+	}
+
+	// Validate user ID format (basic validation)
+	if len(userID) > MaxUserIDLength {
+		return fmt.Errorf("user_id must be between 1 and %d characters", MaxUserIDLength)
+	}
+
+	// Validate item ID format using item service
+	if err := s.itemService.ValidateItemID(itemID); err != nil {
+		return fmt.Errorf("invalid item_id: %w", err)
+	}
+
+	return nil
+}
+
+// ProcessCheckout issues a checkout code for userID to buy itemID in the active sale.
+// Sales that are not running and unknown or retired items are rejected with ErrNoActiveSale,
+// ErrSaleNotRunning, ErrUnknownItem and ErrItemRetired; items the sale cannot sell with a *LimitError.
+func (s *CheckoutServiceImpl) ProcessCheckout(ctx context.Context, userID, itemID string) (*interfaces.IssuedCheckout, error) {
+	// 1. Check if there's an active sale
+	activeSale, err := s.saleService.GetCurrentActiveSale(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active sale: %w", err)
+	}
+
+	if activeSale == nil {
+		return nil, ErrNoActiveSale
+	}
+
+	// 2. Check if sale is still within time window
+	now := time.Now()
+	if now.Before(activeSale.StartTime) || now.After(activeSale.EndTime) {
+		return nil, ErrSaleNotRunning
+	}
+
+	// 3. Validate item exists
+	item, err := s.itemService.GetItemByID(ctx, itemID)
+	if err != nil {
+		log.Printf("Error getting item %s: %v", itemID, err)
+		return nil, ErrUnknownItem
+	}
+
+	if item.RetiredAt != nil {
+		return nil, ErrItemRetired
+	}
+
+	// 4. Verify the item is allocated to this sale and still in stock
+	stock, err := s.getSaleItemStock(ctx, activeSale.ID, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check stock for item %s in sale %d: %w", itemID, activeSale.ID, err)
+	}
+
+	if !stock.InSale {
+		return nil, &LimitError{Status: interfaces.PurchaseItemNotInSale}
+	}
+
+	// Remaining stock can drop below zero when Postgres records an oversold item
+	if stock.Restricted && stock.Remaining <= 0 {
+		return nil, &LimitError{Status: interfaces.PurchaseItemSoldOut}
+	}
+
+	// 5. Generate unique checkout code (millisecond expiry, as signed into the code)
+	expiresAt := now.Add(s.checkoutTTL).Truncate(time.Millisecond)
+	checkoutCode, err := s.generateCheckoutCode(activeSale.ID, userID, itemID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate checkout code: %w", err)
+	}
+
+	// 6. Create checkout record
+	checkout := &models.Checkout{
+		Code:      checkoutCode,
+		UserID:    userID,
+		ItemID:    itemID,
+		SaleID:    activeSale.ID,
+		Status:    "pending",
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	// 7. Reserve a unit for the code when reservations are enabled. In write-behind mode the
+	// checkout is queued in the same step, so a held unit always has a checkout to expire it.
+	reserved, queued := false, false
+	if s.reserve {
+		var event *interfaces.PersistenceEvent
+		if s.writeBehind {
+			event = &interfaces.PersistenceEvent{Type: interfaces.PersistCheckout, Checkout: checkout}
+		}
+
+		status, err := s.redis.ReserveCheckout(ctx, activeSale.ID, userID, itemID, checkoutCode, checkout.ExpiresAt, event)
+		if err != nil {
+			log.Printf("Warning: Failed to reserve stock for checkout: %v", err)
+			// Continue without a reservation - purchase limits are still enforced
+		} else if status != interfaces.PurchaseSuccess {
+			return nil, &LimitError{Status: status, MaxPerUser: activeSale.MaxPerUser}
+		} else {
+			reserved, queued = true, event != nil
+		}
+	}
+
+	// 8. Persist checkout attempt in database (or queue it in write-behind mode),
+	// unless it was already queued with the reservation
+	if !queued {
+		if err := s.persistCheckout(ctx, checkout); err != nil {
+			if reserved {
+				if _, err := s.redis.ReleaseReservation(ctx, activeSale.ID, checkoutCode); err != nil {
+					log.Printf("Warning: Failed to release reservation for %s: %v", checkoutCode, err)
+				}
+			}
+			return nil, fmt.Errorf("failed to create checkout record: %w", err)
+		}
+	}
+
+	// 9. Cache checkout code in Redis for fast verification (expires with the code)
+	if err := s.redis.SetCheckoutCode(ctx, checkout); err != nil {
+		log.Printf("Warning: Failed to cache checkout code in Redis: %v", err)
+		// Continue anyway - database has the record
+	}
+
+	return &interfaces.IssuedCheckout{
+		Checkout: checkout,
+		Item:     item,
+		Reserved: reserved,
+	}, nil
+}
+
+// GetCheckoutAttempt returns the checkout issued with a code, or nil if there is none
+func (s *CheckoutServiceImpl) GetCheckoutAttempt(ctx context.Context, code string) (*models.CheckoutAttempt, error) {
+	return getCheckoutAttempt(ctx, s.db, s.redis, code)
+}
+
+// getCheckoutAttempt looks a checkout code up in Redis, then in the database
+func getCheckoutAttempt(ctx context.Context, db interfaces.DatabaseInterface, redis interfaces.RedisInterface, code string) (*models.CheckoutAttempt, error) {
+	// Redis caches the complete checkout record, including its expiry, until the code expires
+	if checkout, err := redis.GetCheckoutCode(ctx, code); err == nil {
+		return checkout, nil
+	}
+
+	// Fall back to the database for codes Redis did not cache or already dropped
+	checkout, err := db.GetCheckoutByCode(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkout from database: %w", err)
+	}
+
+	return checkout, nil
+}
+
+// persistCheckout records the checkout attempt, through the write-behind stream when
+// enabled and directly in the database otherwise or when the stream is unavailable
+func (s *CheckoutServiceImpl) persistCheckout(ctx context.Context, checkout *models.Checkout) error {
+	if s.writeBehind {
+		event := &interfaces.PersistenceEvent{Type: interfaces.PersistCheckout, Checkout: checkout}
+		err := s.redis.EnqueuePersistence(ctx, event)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Warning: Failed to queue checkout for write-behind, writing directly: %v", err)
+	}
+
+	return s.db.CreateCheckout(ctx, checkout)
+}
+
+// getSaleItemStock returns the remaining stock of an item in a sale,
+// falling back to the database if Redis fails
+func (s *CheckoutServiceImpl) getSaleItemStock(ctx context.Context, saleID int, itemID string) (*interfaces.SaleItemStock, error) {
+	stock, err := s.redis.GetSaleItemStock(ctx, saleID, itemID)
+	if err == nil {
+		return stock, nil
+	}
+	log.Printf("Warning: failed to get item stock from Redis: %v", err)
+
+	items, err := s.db.GetSaleItems(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return &interfaces.SaleItemStock{InSale: true}, nil // Unrestricted sale
+	}
+
+	for _, item := range items {
+		if item.ItemID == itemID {
+			return &interfaces.SaleItemStock{InSale: true, Restricted: true, Remaining: item.Stock - item.Sold}, nil
+		}
+	}
+
+	return &interfaces.SaleItemStock{Restricted: true}, nil
+}
+
+// generateCheckoutCode creates a unique checkout code, signed when a code signer is set
+func (s *CheckoutServiceImpl) generateCheckoutCode(saleID int, userID, itemID string, expiresAt time.Time) (string, error) {
+	if s.codes != nil {
+		return s.codes.Sign(&models.CheckoutClaims{
+			SaleID:    saleID,
+			UserID:    userID,
+			ItemID:    itemID,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	// Generate UUID-based code for uniqueness
+	uuid := uuid.New()
+
+	// Create a shorter, more user-friendly code
+	// Use first 8 characters of UUID + timestamp suffix for uniqueness
+	timestamp := time.Now().Unix() % 10000 // Last 4 digits of timestamp
+
+	return fmt.Sprintf("%s%s_%d", CheckoutCodePrefix, uuid.String()[:8], timestamp), nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+)
+
+// Counter recovery defaults
+const (
+	DefaultCounterReconcileInterval = 5 * time.Second
+	CounterRebuildTimeout           = 10 * time.Second // Purchases stay blocked at most this long if a rebuild dies
+)
+
+// CounterReconciler rebuilds the active sale's Redis counters from the purchases table
+// when they are missing or behind Postgres, e.g. after a Redis restart, key expiry or eviction.
+// Purchases are refused with sale_rebuilding from the moment a rebuild starts until it completes.
+// Replicas can run it concurrently; only one rebuilds a given sale at a time.
+// Purchases still queued for write-behind are not in Postgres yet, so a rebuild keeps
+// purchases blocked and waits until the sale has no events left in the stream.
+//
+// It also hands sales whose purchase limits fell back to Postgres back to Redis once Redis is
+// reachable, rebuilding their counters from the Postgres limits first.
+type CounterReconciler struct {
+	db         interfaces.DatabaseInterface
+	redis      interfaces.RedisInterface
+	clock      interfaces.Clock
+	instanceID string
+	interval   time.Duration
+	stopChan   chan struct{}
+}
+
+// NewCounterReconciler creates a new counter reconciler
+func NewCounterReconciler(
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+	clock interfaces.Clock,
+	instanceID string,
+	interval time.Duration,
+) *CounterReconciler {
+	return &CounterReconciler{
+		db:         db,
+		redis:      redis,
+		clock:      clock,
+		instanceID: instanceID,
+		interval:   interval,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Reconcile checks the active sale's counters and rebuilds them if needed.
+// It returns whether this call rebuilt them.
+func (c *CounterReconciler) Reconcile(ctx context.Context) (bool, error) {
+	sale, err := c.db.GetActiveSale(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get active sale: %w", err)
+	}
+
+	if sale == nil {
+		return false, nil
+	}
+
+	return c.ReconcileSale(ctx, sale)
+}
+
+// ReconcileSale rebuilds the sale's counters if Redis lost them or counts fewer
+// purchases than Postgres. Redis counting more is expected: purchases are counted
+// in Redis before they are recorded.
+func (c *CounterReconciler) ReconcileSale(ctx context.Context, sale *models.Sale) (bool, error) {
+	fallback, err := c.db.GetPurchaseFallback(ctx, sale.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if fallback {
+		return c.restore(ctx, sale)
+	}
+
+	sold, present, err := c.redis.GetSaleCounters(ctx, sale.ID)
+	if err != nil {
+		return false, err
+	}
+
+	counts, err := c.db.GetPurchaseCounts(ctx, sale.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if present && sold >= counts.Total {
+		return false, nil
+	}
+
+	if present {
+		log.Printf("Warning: Redis counts %d sold for sale %d but Postgres has %d purchases, rebuilding", sold, sale.ID, counts.Total)
+	} else {
+		log.Printf("Warning: Redis counters for sale %d are missing, rebuilding", sale.ID)
+	}
+
+	return c.rebuild(ctx, sale)
+}
+
+// rebuild blocks purchases, recounts from Postgres and writes the counters back
+func (c *CounterReconciler) rebuild(ctx context.Context, sale *models.Sale) (bool, error) {
+	// 1. Block purchases; another replica may already be rebuilding
+	started, err := c.redis.BeginCounterRebuild(ctx, sale.ID, c.instanceID, CounterRebuildTimeout)
+	if err != nil {
+		return false, err
+	}
+
+	if !started {
+		return false, nil
+	}
+
+	// 2. Wait for queued purchases to reach Postgres; the marker is renewed on each attempt
+	pending, err := c.redis.PendingPersistence(ctx, sale.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if pending > 0 {
+		log.Printf("Waiting for %d write-behind events of sale %d before rebuilding its counters", pending, sale.ID)
+		return false, nil
+	}
+
+	// 3. Count again now that no new purchases can be counted in Redis
+	counts, err := c.db.GetPurchaseCounts(ctx, sale.ID)
+	if err != nil {
+		return false, err
+	}
+
+	items, err := c.db.GetSaleItems(ctx, sale.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get sale items: %w", err)
+	}
+
+	// 4. Write the counters and unblock purchases
+	stock := make(map[string]int, len(items))
+	for _, item := range items {
+		stock[item.ItemID] = item.Stock - counts.ByItem[item.ItemID]
+	}
+
+	counters := &interfaces.SaleCounters{
+		ItemsAvailable: sale.ItemsAvailable,
+		MaxPerUser:     sale.MaxPerUser,
+		Sold:           counts.Total,
+		ItemStock:      stock,
+		UserCounts:     counts.ByUser,
+	}
+
+	rebuilt, err := c.redis.RebuildSaleCounters(ctx, sale.ID, c.instanceID, counters)
+	if err != nil {
+		return false, err
+	}
+
+	if !rebuilt {
+		return false, fmt.Errorf("counter rebuild for sale %d timed out after %v", sale.ID, CounterRebuildTimeout)
+	}
+
+	refreshSaleKeys(ctx, c.redis, sale)
+
+	log.Printf("Rebuilt Redis counters for sale %d from %d purchases by %d users", sale.ID, counts.Total, len(counts.ByUser))
+	return true, nil
+}
+
+// restore moves a sale whose purchases fell back to Postgres back to Redis. Postgres purchases
+// wait on the sale row while its counters are written, and Redis purchases stay blocked until
+// the flag is cleared, so neither store misses a purchase of the other.
+func (c *CounterReconciler) restore(ctx context.Context, sale *models.Sale) (bool, error) {
+	// 1. Block Redis purchases; this also checks that Redis is reachable again
+	started, err := c.redis.BeginCounterRebuild(ctx, sale.ID, c.instanceID, CounterRebuildTimeout)
+	if err != nil {
+		return false, err
+	}
+
+	if !started {
+		return false, nil
+	}
+
+	// 2. Copy the Postgres limits to Redis and clear the fallback flag
+	restored, err := c.db.EndPurchaseFallback(ctx, sale.ID, func(counters *interfaces.SaleCounters) error {
+		rebuilt, err := c.redis.RebuildSaleCounters(ctx, sale.ID, c.instanceID, counters)
+		if err != nil {
+			return err
+		}
+		if !rebuilt {
+			return fmt.Errorf("counter rebuild for sale %d timed out after %v", sale.ID, CounterRebuildTimeout)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if restored {
+		refreshSaleKeys(ctx, c.redis, sale)
+		log.Printf("Sale %d purchases moved back to Redis limits", sale.ID)
+	}
+	return restored, nil
+}
+
+// Start reconciles every interval until Stop is called or ctx is done
+func (c *CounterReconciler) Start(ctx context.Context) {
+	for {
+		if _, err := c.Reconcile(ctx); err != nil {
+			log.Printf("Warning: failed to reconcile sale counters: %v", err)
+		}
+
+		select {
+		case <-c.clock.After(c.interval):
+		case <-c.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the reconciler
+func (c *CounterReconciler) Stop() {
+	close(c.stopChan)
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flash-sale-backend/internal/models"
+)
+
+// Item cache defaults
+const (
+	DefaultItemCacheSize = 10000           // Items cached per replica
+	DefaultItemCacheTTL  = 5 * time.Minute // How long an item is served from the cache
+	itemCacheShards      = 16
+)
+
+// itemCache is a bounded cache of catalog items. Items are spread over shards, each
+// with its own lock and least-recently-used eviction, and expire after the TTL.
+type itemCache struct {
+	shards [itemCacheShards]*itemCacheShard
+	ttl    time.Duration
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64 // Dropped to make room for another item
+	expirations atomic.Uint64 // Dropped because their TTL passed
+}
+
+// itemCacheShard holds the items whose IDs hash to it, most recently used first
+type itemCacheShard struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+
+	// Bumped whenever items are removed, so a load that started before an
+	// invalidation cannot put the old item back
+	generation uint64
+}
+
+// itemCacheEntry is a cached item and when it expires
+type itemCacheEntry struct {
+	item      *models.Item
+	expiresAt time.Time
+}
+
+// newItemCache creates a cache holding about size items, split evenly across its shards
+func newItemCache(size int, ttl time.Duration) *itemCache {
+	capacity := (size + itemCacheShards - 1) / itemCacheShards
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	cache := &itemCache{ttl: ttl}
+	for idx := range cache.shards {
+		cache.shards[idx] = &itemCacheShard{
+			capacity: capacity,
+			entries:  make(map[string]*list.Element),
+			order:    list.New(),
+		}
+	}
+	return cache
+}
+
+// get returns a cached item that has not expired
+func (c *itemCache) get(itemID string) (*models.Item, bool) {
+	shard := c.shard(itemID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	element, exists := shard.entries[itemID]
+	if !exists {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := element.Value.(*itemCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		shard.order.Remove(element)
+		delete(shard.entries, itemID)
+		c.expirations.Add(1)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	shard.order.MoveToFront(element)
+	c.hits.Add(1)
+	return entry.item, true
+}
+
+// generation returns the generation of an item's shard, to pass to add once the item is loaded
+func (c *itemCache) generation(itemID string) uint64 {
+	shard := c.shard(itemID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	return shard.generation
+}
+
+// add caches an item loaded when its shard was at generation. The item is not cached
+// if items were removed from the shard since, as it may be one of them.
+func (c *itemCache) add(item *models.Item, generation uint64) {
+	shard := c.shard(item.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if shard.generation != generation {
+		return
+	}
+
+	entry := &itemCacheEntry{item: item, expiresAt: time.Now().Add(c.ttl)}
+	if element, exists := shard.entries[item.ID]; exists {
+		element.Value = entry
+		shard.order.MoveToFront(element)
+		return
+	}
+
+	shard.entries[item.ID] = shard.order.PushFront(entry)
+
+	for shard.order.Len() > shard.capacity {
+		oldest := shard.order.Back()
+		shard.order.Remove(oldest)
+		delete(shard.entries, oldest.Value.(*itemCacheEntry).item.ID)
+		c.evictions.Add(1)
+	}
+}
+
+// remove drops items from the cache
+func (c *itemCache) remove(itemIDs []string) {
+	for _, itemID := range itemIDs {
+		shard := c.shard(itemID)
+		shard.mu.Lock()
+		if element, exists := shard.entries[itemID]; exists {
+			shard.order.Remove(element)
+			delete(shard.entries, itemID)
+		}
+		shard.generation++
+		shard.mu.Unlock()
+	}
+}
+
+// clear drops every item from the cache
+func (c *itemCache) clear() {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.entries = make(map[string]*list.Element)
+		shard.order.Init()
+		shard.generation++
+		shard.mu.Unlock()
+	}
+}
+
+// stats returns the cache size and hit, miss and eviction counts
+func (c *itemCache) stats() map[string]interface{} {
+	size, capacity := 0, 0
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		size += shard.order.Len()
+		capacity += shard.capacity
+		shard.mu.Unlock()
+	}
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+
+	return map[string]interface{}{
+		"cached_items":    size,
+		"capacity":        capacity,
+		"ttl_seconds":     c.ttl.Seconds(),
+		"hits":            hits,
+		"misses":          misses,
+		"hit_rate":        hitRate,
+		"evictions":       c.evictions.Load(),
+		"expirations":     c.expirations.Load(),
+		"memory_estimate": size * 200, // Rough estimate: 200 bytes per item
+	}
+}
+
+// shard returns the shard an item ID hashes to
+func (c *itemCache) shard(itemID string) *itemCacheShard {
+	return c.shards[simpleHash(itemID)%itemCacheShards]
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"flash-sale-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// MaxSeedItems is the most items GenerateSeedItems creates at once
+const MaxSeedItems = 100000
+
+// CommonSeedItemIDs are the item IDs used by the examples, tests and load tests
+var CommonSeedItemIDs = []string{
+	"item1", "item2", "item3", "item4", "item5",
+	"test_item", "demo_item", "sample_item",
+	"product_a", "product_b", "product_c",
+}
+
+// seedTemplates are the item kinds seed items are generated from
+var seedTemplates = []struct {
+	namePrefix  string
+	description string
+	basePrice   int64 // Cents
+}{
+	{"Flash Electronics", "High-tech gadget at incredible price", 29999},
+	{"Designer Fashion", "Premium clothing item with limited availability", 14999},
+	{"Home Essential", "Must-have household item for modern living", 7999},
+	{"Sports Gear", "Professional quality sports equipment", 19999},
+	{"Beauty Product", "Premium skincare and cosmetic item", 8999},
+	{"Kitchen Tool", "Essential cooking equipment for every chef", 5999},
+	{"Gaming Accessory", "Professional gaming equipment", 12999},
+	{"Health Supplement", "Premium wellness and health product", 4999},
+	{"Book Collection", "Bestselling books and educational materials", 2999},
+	{"Art Supply", "Professional quality creative materials", 3999},
+}
+
+// SeedItem builds seed data for an item ID. The name, description and price are
+// derived from the ID, so seeding the same ID always yields the same item.
+func SeedItem(itemID string) models.Item {
+	// Extract number from item ID if it follows our pattern
+	var itemNumber int = 1
+	if strings.HasPrefix(itemID, "item_") {
+		// Use hash of ID to generate consistent properties
+		hash := simpleHash(itemID)
+		itemNumber = int(hash % 10000) // Keep within reasonable range
+	}
+
+	template := seedTemplates[itemNumber%len(seedTemplates)]
+
+	// Generate consistent price variation based on item ID
+	hash := simpleHash(itemID)
+	priceVariation := 80 + int64(hash%40) // Between 80% and 119%
+	finalPrice := models.NewMoney(template.basePrice, models.DefaultCurrency).MulRatio(priceVariation, 100)
+
+	return models.Item{
+		ID:          itemID,
+		Name:        fmt.Sprintf("%s #%d", template.namePrefix, itemNumber),
+		Description: template.description,
+		Price:       finalPrice,
+	}
+}
+
+// SeedItems builds seed data for each item ID
+func SeedItems(itemIDs []string) []models.Item {
+	items := make([]models.Item, len(itemIDs))
+	for idx, itemID := range itemIDs {
+		items[idx] = SeedItem(itemID)
+	}
+	return items
+}
+
+// GenerateSeedItems creates seed data for count items with new random IDs
+func GenerateSeedItems(count int) ([]models.Item, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive, got %d", count)
+	}
+
+	if count > MaxSeedItems {
+		return nil, fmt.Errorf("count too large, maximum %d, got %d", MaxSeedItems, count)
+	}
+
+	itemIDs := make([]string, count)
+	for idx := range itemIDs {
+		itemIDs[idx] = fmt.Sprintf("item_%s", uuid.New().String()[:8])
+	}
+
+	return SeedItems(itemIDs), nil
+}
+
+// simpleHash creates a simple hash of a string for consistent randomization
+func simpleHash(s string) uint32 {
+	var hash uint32 = 0
+	for _, char := range s {
+		hash = hash*31 + uint32(char)
+	}
+	return hash
+}
@@ -2,128 +2,119 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
-	"strings"
+	"log"
 	"time"
 
+	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
+)
+
+// Item catalog limits
+const (
+	MaxItemNameLength             = 200
+	MaxItemPriceAmount            = 9999999999 // Largest price in minor units, 99999999.99 in USD
+	MaxItemPriceUpdates           = 1000       // Prices changed by one bulk update
+	ItemInvalidationRetryInterval = 5 * time.Second
+)
 
-	"github.com/google/uuid"
+// Item catalog errors
+var (
+	ErrItemNotInCatalog = errors.New("item not in catalog")
+	ErrItemExists       = errors.New("item already exists")
+	ErrInvalidItem      = errors.New("invalid item")
+	ErrItemPriceLocked  = interfaces.ErrItemPriceLocked
+	ErrItemRetired      = errors.New("item is retired")
 )
 
-// ItemServiceImpl implements interfaces.ItemService
+// ItemServiceImpl implements interfaces.ItemService and interfaces.ItemCatalog on the
+// item catalog in PostgreSQL
 type ItemServiceImpl struct {
-	// In-memory cache of generated items for performance
-	itemCache map[string]*models.Item
+	db     interfaces.DatabaseInterface
+	redis  interfaces.RedisInterface // Publishes catalog changes to other replicas; local only when nil
+	strict bool                      // Reject item IDs that are not in the catalog instead of serving seed data for them
+
+	// In-memory cache of catalog items for performance
+	cache *itemCache
+
+	stopChan chan struct{}
 }
 
-// NewItemService creates a new item service
-func NewItemService() *ItemServiceImpl {
+// NewItemService creates a new item service backed by the catalog in db
+func NewItemService(db interfaces.DatabaseInterface) *ItemServiceImpl {
 	return &ItemServiceImpl{
-		itemCache: make(map[string]*models.Item),
-	}
-}
-
-// GenerateItems creates a specified number of items at runtime
-func (i *ItemServiceImpl) GenerateItems(ctx context.Context, count int) ([]models.Item, error) {
-	if count <= 0 {
-		return nil, fmt.Errorf("count must be positive, got %d", count)
-	}
-
-	if count > 100000 { // Reasonable upper limit
-		return nil, fmt.Errorf("count too large, maximum 100000, got %d", count)
-	}
-
-	items := make([]models.Item, count)
-	now := time.Now()
-
-	// Predefined item templates for variety
-	itemTemplates := []struct {
-		namePrefix  string
-		description string
-		basePrice   float64
-	}{
-		{"Flash Electronics", "High-tech gadget at incredible price", 299.99},
-		{"Designer Fashion", "Premium clothing item with limited availability", 149.99},
-		{"Home Essential", "Must-have household item for modern living", 79.99},
-		{"Sports Gear", "Professional quality sports equipment", 199.99},
-		{"Beauty Product", "Premium skincare and cosmetic item", 89.99},
-		{"Kitchen Tool", "Essential cooking equipment for every chef", 59.99},
-		{"Gaming Accessory", "Professional gaming equipment", 129.99},
-		{"Health Supplement", "Premium wellness and health product", 49.99},
-		{"Book Collection", "Bestselling books and educational materials", 29.99},
-		{"Art Supply", "Professional quality creative materials", 39.99},
-	}
-
-	for idx := 0; idx < count; idx++ {
-		// Generate unique item ID
-		itemID := fmt.Sprintf("item_%s", uuid.New().String()[:8])
-		
-		// Select random template
-		template := itemTemplates[rand.Intn(len(itemTemplates))]
-		
-		// Create unique name with variant number
-		itemName := fmt.Sprintf("%s #%d", template.namePrefix, idx+1)
-		
-		// Add some price variation (±20%)
-		priceVariation := 1.0 + (rand.Float64()-0.5)*0.4 // Random between 0.8 and 1.2
-		finalPrice := template.basePrice * priceVariation
-		
-		// Round to 2 decimal places
-		finalPrice = float64(int(finalPrice*100)) / 100
-
-		item := models.Item{
-			ID:          itemID,
-			Name:        itemName,
-			Description: template.description,
-			Price:       finalPrice,
-			CreatedAt:   now,
-		}
+		db:       db,
+		strict:   true,
+		cache:    newItemCache(DefaultItemCacheSize, DefaultItemCacheTTL),
+		stopChan: make(chan struct{}),
+	}
+}
 
-		items[idx] = item
-		
-		// Cache the item for quick lookup
-		i.itemCache[itemID] = &item
+// SetStrict enables or disables strict mode, which is on by default. In strict mode only
+// items in the catalog can be checked out; otherwise an unknown, well-formed item ID is
+// served with seed data derived from the ID, so every replica quotes the same price. The
+// seed item is never added to the catalog.
+func (i *ItemServiceImpl) SetStrict(strict bool) {
+	i.strict = strict
+}
+
+// SetCacheLimits bounds the item cache to about size items, each served from the cache
+// for at most ttl. Cached items are dropped.
+func (i *ItemServiceImpl) SetCacheLimits(size int, ttl time.Duration) error {
+	if size <= 0 {
+		return fmt.Errorf("item cache size must be positive, got %d", size)
 	}
 
-	return items, nil
+	if ttl <= 0 {
+		return fmt.Errorf("item cache TTL must be positive, got %v", ttl)
+	}
+
+	i.cache = newItemCache(size, ttl)
+	return nil
+}
+
+// SetCacheInvalidation publishes catalog changes through redis, so every replica running
+// Start drops changed items from its cache
+func (i *ItemServiceImpl) SetCacheInvalidation(redis interfaces.RedisInterface) {
+	i.redis = redis
 }
 
-// GetItemByID returns a specific item by its ID
+// GetItemByID returns a specific item by its ID, or ErrItemNotInCatalog in strict mode.
+// Retired items are returned with RetiredAt set.
 func (i *ItemServiceImpl) GetItemByID(ctx context.Context, itemID string) (*models.Item, error) {
 	if err := i.ValidateItemID(itemID); err != nil {
 		return nil, err
 	}
 
 	// Check cache first
-	if item, exists := i.itemCache[itemID]; exists {
+	if item, exists := i.cache.get(itemID); exists {
 		return item, nil
 	}
 
-	// If not in cache, it might be a valid format but not generated yet
-	// For flash sale, we generate items on-demand if they don't exist
-	return i.generateSingleItem(ctx, itemID)
-}
-
-// GetAvailableItems returns all available items (from cache)
-func (i *ItemServiceImpl) GetAvailableItems(ctx context.Context) ([]models.Item, error) {
-	items := make([]models.Item, 0, len(i.itemCache))
-	
-	for _, item := range i.itemCache {
-		items = append(items, *item)
+	generation := i.cache.generation(itemID)
+	item, err := i.db.GetItemByID(ctx, itemID)
+	if err != nil {
+		return nil, err
 	}
 
-	// If no items are cached, generate a default set
-	if len(items) == 0 {
-		generatedItems, err := i.GenerateItems(ctx, 1000) // Generate 1000 default items
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate default items: %w", err)
+	if item == nil {
+		if i.strict {
+			return nil, fmt.Errorf("%w: %s", ErrItemNotInCatalog, itemID)
 		}
-		return generatedItems, nil
+
+		seeded := SeedItem(itemID)
+		item = &seeded
 	}
 
-	return items, nil
+	i.cache.add(item, generation)
+
+	return item, nil
+}
+
+// GetAvailableItems returns all items in the catalog that are not retired
+func (i *ItemServiceImpl) GetAvailableItems(ctx context.Context) ([]models.Item, error) {
+	return i.ListItems(ctx, false)
 }
 
 // ValidateItemID checks if an item ID has a valid format
@@ -138,10 +129,10 @@ func (i *ItemServiceImpl) ValidateItemID(itemID string) error {
 
 	// Check for valid characters (alphanumeric, underscore, hyphen)
 	for _, char := range itemID {
-		if !((char >= 'a' && char <= 'z') || 
-			 (char >= 'A' && char <= 'Z') || 
-			 (char >= '0' && char <= '9') || 
-			 char == '_' || char == '-') {
+		if !((char >= 'a' && char <= 'z') ||
+			(char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9') ||
+			char == '_' || char == '-') {
 			return fmt.Errorf("item ID contains invalid characters: %s", itemID)
 		}
 	}
@@ -149,95 +140,291 @@ func (i *ItemServiceImpl) ValidateItemID(itemID string) error {
 	return nil
 }
 
-// generateSingleItem creates a single item with the given ID
-func (i *ItemServiceImpl) generateSingleItem(ctx context.Context, itemID string) (*models.Item, error) {
-	// Extract number from item ID if it follows our pattern
-	var itemNumber int = 1
-	if strings.HasPrefix(itemID, "item_") {
-		// Use hash of ID to generate consistent properties
-		hash := simpleHash(itemID)
-		itemNumber = int(hash % 10000) // Keep within reasonable range
-	}
-
-	// Use item number to select template consistently
-	itemTemplates := []struct {
-		namePrefix  string
-		description string
-		basePrice   float64
-	}{
-		{"Flash Electronics", "High-tech gadget at incredible price", 299.99},
-		{"Designer Fashion", "Premium clothing item with limited availability", 149.99},
-		{"Home Essential", "Must-have household item for modern living", 79.99},
-		{"Sports Gear", "Professional quality sports equipment", 199.99},
-		{"Beauty Product", "Premium skincare and cosmetic item", 89.99},
-		{"Kitchen Tool", "Essential cooking equipment for every chef", 59.99},
-		{"Gaming Accessory", "Professional gaming equipment", 129.99},
-		{"Health Supplement", "Premium wellness and health product", 49.99},
-		{"Book Collection", "Bestselling books and educational materials", 29.99},
-		{"Art Supply", "Professional quality creative materials", 39.99},
-	}
-
-	template := itemTemplates[itemNumber%len(itemTemplates)]
-	
-	// Generate consistent price variation based on item ID
-	hash := simpleHash(itemID)
-	priceVariation := 0.8 + (float64(hash%40)/100.0) // Between 0.8 and 1.2
-	finalPrice := template.basePrice * priceVariation
-	finalPrice = float64(int(finalPrice*100)) / 100
-
-	item := &models.Item{
-		ID:          itemID,
-		Name:        fmt.Sprintf("%s #%d", template.namePrefix, itemNumber),
-		Description: template.description,
-		Price:       finalPrice,
-		CreatedAt:   time.Now(),
-	}
-
-	// Cache the generated item
-	i.itemCache[itemID] = item
+// ValidateItem checks an item's ID, name and price before it is stored
+func (i *ItemServiceImpl) ValidateItem(item *models.Item) error {
+	if err := i.ValidateItemID(item.ID); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidItem, err)
+	}
+
+	if item.Name == "" || len(item.Name) > MaxItemNameLength {
+		return fmt.Errorf("%w: name must be between 1 and %d characters", ErrInvalidItem, MaxItemNameLength)
+	}
+
+	return validatePrice(item.Price)
+}
+
+// ListItems returns the items in the catalog, ordered by ID
+func (i *ItemServiceImpl) ListItems(ctx context.Context, includeRetired bool) ([]models.Item, error) {
+	items, err := i.db.ListItems(ctx, includeRetired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list catalog items: %w", err)
+	}
+
+	return items, nil
+}
+
+// LookupItem returns an item from the catalog, or ErrItemNotInCatalog. Unlike GetItemByID
+// it never uses the cache.
+func (i *ItemServiceImpl) LookupItem(ctx context.Context, itemID string) (*models.Item, error) {
+	item, err := i.db.GetItemByID(ctx, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item %s: %w", itemID, err)
+	}
+
+	if item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotInCatalog, itemID)
+	}
 
 	return item, nil
 }
 
-// simpleHash creates a simple hash of a string for consistent randomization
-func simpleHash(s string) uint32 {
-	var hash uint32 = 0
-	for _, char := range s {
-		hash = hash*31 + uint32(char)
+// CreateItem adds a new item to the catalog
+func (i *ItemServiceImpl) CreateItem(ctx context.Context, item *models.Item) error {
+	if err := i.ValidateItem(item); err != nil {
+		return err
 	}
-	return hash
+
+	created, err := i.db.CreateItems(ctx, []models.Item{*item})
+	if err != nil {
+		return fmt.Errorf("failed to create item %s: %w", item.ID, err)
+	}
+
+	if created == 0 {
+		return fmt.Errorf("%w: %s", ErrItemExists, item.ID)
+	}
+
+	// Replicas may have cached the ID while it was unknown
+	i.invalidate(ctx, []string{item.ID})
+	return nil
 }
 
-// PreloadCommonItems generates and caches commonly requested items
-func (i *ItemServiceImpl) PreloadCommonItems(ctx context.Context) error {
-	// Generate common item IDs that might be used in testing
-	commonItems := []string{
-		"item1", "item2", "item3", "item4", "item5",
-		"test_item", "demo_item", "sample_item",
-		"product_a", "product_b", "product_c",
+// UpdateItem changes the name, description and price of an item. The price of an
+// item on sale cannot change while the sale is active.
+func (i *ItemServiceImpl) UpdateItem(ctx context.Context, item *models.Item) error {
+	if err := i.ValidateItem(item); err != nil {
+		return err
+	}
+
+	current, err := i.LookupItem(ctx, item.ID)
+	if err != nil {
+		return err
 	}
 
-	for _, itemID := range commonItems {
-		if _, exists := i.itemCache[itemID]; !exists {
-			_, err := i.generateSingleItem(ctx, itemID)
-			if err != nil {
-				return fmt.Errorf("failed to preload item %s: %w", itemID, err)
-			}
+	// The database refuses a price change while the item is on sale, in the same statement
+	// that makes it, so a sale activated in between cannot be missed
+	found, err := i.db.UpdateItem(ctx, item)
+	if err != nil {
+		return fmt.Errorf("failed to update item %s: %w", item.ID, err)
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", ErrItemNotInCatalog, item.ID)
+	}
+
+	i.invalidate(ctx, []string{item.ID})
+
+	item.CreatedAt, item.RetiredAt = current.CreatedAt, current.RetiredAt
+	return nil
+}
+
+// UpdateItemPrices changes the prices of several items at once. Either every price
+// changes or, if any item is unknown or on sale, none does.
+func (i *ItemServiceImpl) UpdateItemPrices(ctx context.Context, prices []models.ItemPrice) error {
+	// 1. Validate the update as a whole
+	if len(prices) == 0 || len(prices) > MaxItemPriceUpdates {
+		return fmt.Errorf("%w: between 1 and %d prices must be given", ErrInvalidItem, MaxItemPriceUpdates)
+	}
+
+	itemIDs := make([]string, 0, len(prices))
+	seen := make(map[string]bool, len(prices))
+	for _, price := range prices {
+		if seen[price.ItemID] {
+			return fmt.Errorf("%w: duplicate price for item %s", ErrInvalidItem, price.ItemID)
+		}
+		seen[price.ItemID] = true
+
+		if err := i.ValidateItemID(price.ItemID); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidItem, err)
+		}
+		if err := validatePrice(price.Price); err != nil {
+			return fmt.Errorf("item %s: %w", price.ItemID, err)
 		}
+		itemIDs = append(itemIDs, price.ItemID)
 	}
 
+	// 2. Refuse the whole update if any item is unknown
+	for _, price := range prices {
+		if _, err := i.LookupItem(ctx, price.ItemID); err != nil {
+			return err
+		}
+	}
+
+	// 3. Change every price in one transaction, which fails if any price is locked by the active sale
+	if err := i.db.UpdateItemPrices(ctx, prices); err != nil {
+		return fmt.Errorf("failed to update item prices: %w", err)
+	}
+
+	i.invalidate(ctx, itemIDs)
 	return nil
 }
 
-// GetCacheStats returns statistics about the item cache
-func (i *ItemServiceImpl) GetCacheStats() map[string]interface{} {
-	return map[string]interface{}{
-		"cached_items":    len(i.itemCache),
-		"memory_estimate": len(i.itemCache) * 200, // Rough estimate: 200 bytes per item
+// RetireItem stops an item from being checked out. Purchases of checkout codes
+// already issued for it can still be completed.
+func (i *ItemServiceImpl) RetireItem(ctx context.Context, itemID string) (*models.Item, error) {
+	current, err := i.LookupItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.RetiredAt != nil {
+		return current, fmt.Errorf("%w: %s", ErrItemRetired, itemID)
+	}
+
+	found, err := i.db.RetireItem(ctx, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire item %s: %w", itemID, err)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotInCatalog, itemID)
 	}
+
+	i.invalidate(ctx, []string{itemID})
+	return i.LookupItem(ctx, itemID)
+}
+
+// SeedCatalog adds seed data for the given item IDs to the catalog, leaving items
+// already in the catalog unchanged. It returns how many items were added.
+func (i *ItemServiceImpl) SeedCatalog(ctx context.Context, itemIDs []string) (int, error) {
+	for _, itemID := range itemIDs {
+		if err := i.ValidateItemID(itemID); err != nil {
+			return 0, err
+		}
+	}
+
+	created, err := i.db.CreateItems(ctx, SeedItems(itemIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to seed catalog: %w", err)
+	}
+
+	return created, nil
+}
+
+// Start keeps the item cache consistent with changes made by other replicas until Stop
+// is called or ctx is done. While the subscription is down, the cache is cleared every
+// ItemInvalidationRetryInterval, so items are never stale for longer than that.
+func (i *ItemServiceImpl) Start(ctx context.Context) {
+	if i.redis == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-i.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		err := i.redis.ReceiveItemInvalidations(ctx, i.evict)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Warning: item cache invalidation unavailable, retrying in %v: %v", ItemInvalidationRetryInterval, err)
+		i.ClearCache()
+
+		select {
+		case <-time.After(ItemInvalidationRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops receiving cache invalidations
+func (i *ItemServiceImpl) Stop() {
+	close(i.stopChan)
+}
+
+// checkPriceUnlocked returns ErrItemPriceLocked if the item can be bought in the active
+// sale: it is allocated to the sale, or the sale has no per-item allocations. Updates are
+// refused by the database itself; this only reports a locked price ahead of time, as when
+// planning an import.
+func (i *ItemServiceImpl) checkPriceUnlocked(ctx context.Context, itemID string) error {
+	sale, err := i.db.GetActiveSale(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get active sale: %w", err)
+	}
+
+	if sale == nil {
+		return nil
+	}
+
+	saleItems, err := i.db.GetSaleItems(ctx, sale.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get items of sale %d: %w", sale.ID, err)
+	}
+
+	if len(saleItems) == 0 {
+		return fmt.Errorf("%w: %s (sale %d)", ErrItemPriceLocked, itemID, sale.ID)
+	}
+
+	for _, saleItem := range saleItems {
+		if saleItem.ItemID == itemID {
+			return fmt.Errorf("%w: %s (sale %d)", ErrItemPriceLocked, itemID, sale.ID)
+		}
+	}
+
+	return nil
+}
+
+// invalidate drops changed items from this replica's cache and tells the other replicas
+// to do the same. A failed publish is logged, as the change itself has been made.
+func (i *ItemServiceImpl) invalidate(ctx context.Context, itemIDs []string) {
+	i.evict(itemIDs)
+
+	if i.redis == nil {
+		return
+	}
+
+	if err := i.redis.PublishItemInvalidation(ctx, itemIDs); err != nil {
+		log.Printf("Warning: failed to publish item invalidation for %v: %v", itemIDs, err)
+	}
+}
+
+// evict drops items from the cache, or every item when itemIDs is empty
+func (i *ItemServiceImpl) evict(itemIDs []string) {
+	if len(itemIDs) == 0 {
+		i.ClearCache()
+		return
+	}
+
+	i.cache.remove(itemIDs)
+}
+
+// validatePrice checks that a price is in a supported currency and within the catalog's range
+func validatePrice(price models.Money) error {
+	if err := price.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidItem, err)
+	}
+
+	if price.Amount < 0 || price.Amount > MaxItemPriceAmount {
+		return fmt.Errorf("%w: price must be between 0 and %d minor units", ErrInvalidItem, MaxItemPriceAmount)
+	}
+
+	return nil
+}
+
+// GetCacheStats returns the item cache's size, hit and miss counts and evictions
+func (i *ItemServiceImpl) GetCacheStats() map[string]interface{} {
+	return i.cache.stats()
 }
 
 // ClearCache clears the item cache (useful for testing)
 func (i *ItemServiceImpl) ClearCache() {
-	i.itemCache = make(map[string]*models.Item)
-} 
\ No newline at end of file
+	i.cache.clear()
+}
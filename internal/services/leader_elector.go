@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+
+	"github.com/google/uuid"
+)
+
+// Leader election defaults
+const (
+	SaleManagerLeaderName = "sale_manager"
+	DefaultLeaderLeaseTTL = 15 * time.Second
+)
+
+// LeaderElector elects a single leader among app replicas using a Redis lease.
+// Each lease carries a fencing token that the leader records in Postgres before acting;
+// once a newer leader has recorded a higher token, the old leader's writes are refused.
+type LeaderElector struct {
+	redis      interfaces.RedisInterface
+	db         interfaces.DatabaseInterface
+	name       string
+	instanceID string
+	ttl        time.Duration
+
+	// Fencing token of the lease currently held, 0 when not leading
+	token int64
+}
+
+// NewLeaderElector creates a new leader elector for the named role
+func NewLeaderElector(
+	redis interfaces.RedisInterface,
+	db interfaces.DatabaseInterface,
+	name string,
+	instanceID string,
+	ttl time.Duration,
+) *LeaderElector {
+	return &LeaderElector{
+		redis:      redis,
+		db:         db,
+		name:       name,
+		instanceID: instanceID,
+		ttl:        ttl,
+	}
+}
+
+// NewInstanceID returns an identifier unique to this process
+func NewInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8])
+}
+
+// Campaign acquires or renews the lease and reports whether this instance leads.
+// It must be called more often than the lease TTL to keep leadership; see RenewInterval.
+// Any error is treated as lost leadership so that two instances never act at once.
+func (e *LeaderElector) Campaign(ctx context.Context) (bool, error) {
+	token, err := e.redis.AcquireLeadership(ctx, e.name, e.instanceID, e.ttl)
+	if err != nil {
+		e.stepDown()
+		return false, fmt.Errorf("failed to acquire %s leadership: %w", e.name, err)
+	}
+
+	if token == 0 {
+		e.stepDown()
+		return false, nil
+	}
+
+	// Record the token so that any previous leader is fenced off
+	current, err := e.db.AdvanceFencingToken(ctx, e.name, token)
+	if err != nil {
+		e.stepDown()
+		return false, fmt.Errorf("failed to record %s fencing token: %w", e.name, err)
+	}
+
+	if !current {
+		// A newer leader already recorded a higher token; our lease is stale
+		e.stepDown()
+		return false, nil
+	}
+
+	if e.token != token {
+		log.Printf("Instance %s became %s leader (fencing token %d)", e.instanceID, e.name, token)
+		e.token = token
+	}
+
+	return true, nil
+}
+
+// Resign releases the lease so another instance can take over immediately
+func (e *LeaderElector) Resign(ctx context.Context) {
+	if e.token == 0 {
+		return
+	}
+
+	if err := e.redis.ReleaseLeadership(ctx, e.name, e.instanceID); err != nil {
+		log.Printf("Warning: failed to release %s leadership: %v", e.name, err)
+	}
+	e.stepDown()
+}
+
+// Fence returns the fence of the held lease. Writes made under it through
+// interfaces.WithFence are rejected once a newer leader has recorded its token;
+// when not leading its token is 0, which no fenced write accepts.
+func (e *LeaderElector) Fence() interfaces.Fence {
+	return interfaces.Fence{Name: e.name, Token: e.token}
+}
+
+// RenewInterval is how often Campaign should run to keep or take over leadership
+func (e *LeaderElector) RenewInterval() time.Duration {
+	return e.ttl / 3
+}
+
+// stepDown forgets the held lease
+func (e *LeaderElector) stepDown() {
+	if e.token != 0 {
+		log.Printf("Instance %s is no longer %s leader", e.instanceID, e.name)
+		e.token = 0
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// Write-behind persistence defaults
+const (
+	DefaultPersistenceFlushInterval = 200 * time.Millisecond
+	DefaultPersistenceBatchSize     = 500
+	PersistenceClaimIdle            = 30 * time.Second // Unacknowledged events are retried by any writer after this long
+)
+
+// PersistenceWriter drains the write-behind stream into Postgres in batches.
+// Events are acknowledged only after they are committed, and events a writer failed
+// to persist or was holding when it died are claimed again after PersistenceClaimIdle,
+// so every event is persisted at least once. Replicas share the stream's consumer group.
+type PersistenceWriter struct {
+	db        interfaces.DatabaseInterface
+	redis     interfaces.RedisInterface
+	clock     interfaces.Clock
+	consumer  string
+	batchSize int
+	interval  time.Duration
+	stopChan  chan struct{}
+}
+
+// NewPersistenceWriter creates a new persistence writer reading as consumer
+func NewPersistenceWriter(
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+	clock interfaces.Clock,
+	consumer string,
+	batchSize int,
+	interval time.Duration,
+) *PersistenceWriter {
+	return &PersistenceWriter{
+		db:        db,
+		redis:     redis,
+		clock:     clock,
+		consumer:  consumer,
+		batchSize: batchSize,
+		interval:  interval,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Flush persists one batch of events and returns how many were persisted
+func (w *PersistenceWriter) Flush(ctx context.Context) (int, error) {
+	// 1. Retry events that were delivered but never acknowledged
+	events, err := w.redis.ClaimStalePersistence(ctx, w.consumer, PersistenceClaimIdle, w.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// 2. Fill the batch with new events
+	if len(events) < w.batchSize {
+		fresh, err := w.redis.ReadPersistence(ctx, w.consumer, w.batchSize-len(events))
+		if err != nil {
+			return 0, err // Claimed events stay pending and are retried later
+		}
+		events = append(events, fresh...)
+	}
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	// 3. Write the batch in one transaction; if that fails, write the events one by one
+	// so a single bad event does not hold back the rest
+	persisted := events
+	if err := w.db.PersistEvents(ctx, events); err != nil {
+		log.Printf("Warning: failed to persist batch of %d events, retrying one by one: %v", len(events), err)
+		persisted = w.persistEach(ctx, events)
+	}
+
+	// 4. Acknowledge; if this fails the events are persisted again, which is a no-op
+	ids := make([]string, len(persisted))
+	for i, event := range persisted {
+		ids[i] = event.ID
+	}
+
+	if err := w.redis.AckPersistence(ctx, ids); err != nil {
+		return 0, err
+	}
+
+	return len(persisted), nil
+}
+
+// persistEach persists events individually and returns those that were persisted.
+// The rest stay pending and are retried once they have been idle long enough. Events
+// after a failed one with the same checkout code are held back with it, so a purchase
+// is never applied before its checkout.
+func (w *PersistenceWriter) persistEach(ctx context.Context, events []interfaces.PersistenceEvent) []interfaces.PersistenceEvent {
+	var persisted []interfaces.PersistenceEvent
+	failed := make(map[string]bool)
+	for _, event := range events {
+		code := eventCode(event)
+		if code != "" && failed[code] {
+			log.Printf("Warning: holding back %s event %s until the earlier event for its code is persisted", event.Type, event.ID)
+			continue
+		}
+
+		if err := w.db.PersistEvents(ctx, []interfaces.PersistenceEvent{event}); err != nil {
+			log.Printf("Warning: failed to persist %s event %s, will retry: %v", event.Type, event.ID, err)
+			failed[code] = true
+			continue
+		}
+		persisted = append(persisted, event)
+	}
+
+	return persisted
+}
+
+// eventCode returns the checkout code an event is about, or "" for a malformed event
+func eventCode(event interfaces.PersistenceEvent) string {
+	switch {
+	case event.Checkout != nil:
+		return event.Checkout.Code
+	case event.Purchase != nil:
+		return event.Purchase.Code
+	default:
+		return ""
+	}
+}
+
+// Start drains the stream until Stop is called or ctx is done. Full batches are
+// followed immediately by the next one; otherwise the writer waits for the interval.
+func (w *PersistenceWriter) Start(ctx context.Context) {
+	ready := false
+	for {
+		persisted := 0
+		if !ready {
+			if err := w.redis.EnsurePersistenceGroup(ctx); err != nil {
+				log.Printf("Warning: failed to set up persistence stream: %v", err)
+			} else {
+				ready = true
+			}
+		}
+
+		if ready {
+			var err error
+			if persisted, err = w.Flush(ctx); err != nil {
+				log.Printf("Warning: failed to flush persistence events: %v", err)
+			}
+		}
+
+		if persisted >= w.batchSize {
+			select {
+			case <-w.stopChan:
+				return
+			case <-ctx.Done():
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-w.clock.After(w.interval):
+		case <-w.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the writer; unacknowledged events stay in the stream for the next writer
+func (w *PersistenceWriter) Stop() {
+	close(w.stopChan)
+}
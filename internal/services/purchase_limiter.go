@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// DefaultRedisHealthCheckInterval is how often the failover limiter pings Redis
+const DefaultRedisHealthCheckInterval = 2 * time.Second
+
+// DefaultPurchaseFallbackCacheTTL is how long a replica trusts the fallback flag it last read
+const DefaultPurchaseFallbackCacheTTL = time.Second
+
+// FailoverPurchaseLimiter enforces purchase limits in Redis and falls back to Postgres
+// while Redis health checks fail. Any Redis error during a purchase also triggers the
+// fallback, so the request that notices the outage is served from Postgres.
+//
+// The fallback is recorded on the sale row, so every replica sends the sale's purchases to
+// Postgres from then on, including replicas that can still reach Redis. The counter
+// reconciler rebuilds the sale's Redis counters from Postgres before handing it back.
+//
+// With write-behind persistence, Postgres lags behind Redis by the purchases still queued in
+// the stream, which cannot be read while Redis is down. The limiter then refuses to fall back
+// and purchases are rejected with sale_rebuilding until Redis recovers. As a sale can never
+// move to Postgres, the fallback flag is not read and purchases never touch Postgres.
+//
+// The flag is cached per sale for a short TTL, so purchases served by Redis do not read
+// Postgres. A stale flag is safe: Postgres refuses to record Redis purchases once the sale
+// moved, and refuses Postgres purchases once it moved back, which also drops the cache.
+type FailoverPurchaseLimiter struct {
+	redis       interfaces.RedisInterface
+	db          interfaces.DatabaseInterface
+	clock       interfaces.Clock
+	interval    time.Duration
+	writeBehind bool
+
+	healthy  bool
+	mu       sync.RWMutex
+	stopChan chan struct{}
+
+	fallbacks   map[int]cachedFallback
+	fallbackTTL time.Duration
+	fallbackMu  sync.RWMutex
+}
+
+// cachedFallback is a sale's fallback flag as read at loaded
+type cachedFallback struct {
+	fallback bool
+	loaded   time.Time
+}
+
+// NewFailoverPurchaseLimiter creates a new failover purchase limiter. Redis is assumed
+// healthy until a health check or purchase says otherwise.
+func NewFailoverPurchaseLimiter(
+	redis interfaces.RedisInterface,
+	db interfaces.DatabaseInterface,
+	clock interfaces.Clock,
+	interval time.Duration,
+) *FailoverPurchaseLimiter {
+	return &FailoverPurchaseLimiter{
+		redis:    redis,
+		db:       db,
+		clock:    clock,
+		interval: interval,
+		healthy:     true,
+		stopChan:    make(chan struct{}),
+		fallbacks:   make(map[int]cachedFallback),
+		fallbackTTL: DefaultPurchaseFallbackCacheTTL,
+	}
+}
+
+// SetWriteBehind tells the limiter that purchases are persisted through the write-behind
+// stream, so it never falls back to Postgres limits
+func (f *FailoverPurchaseLimiter) SetWriteBehind(enabled bool) {
+	f.writeBehind = enabled
+}
+
+// SetFallbackCacheTTL sets how long a sale's fallback flag is served from memory. Another
+// replica moving the sale is seen within ttl. 0 reads the flag on every purchase.
+func (f *FailoverPurchaseLimiter) SetFallbackCacheTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("purchase fallback cache TTL cannot be negative, got %v", ttl)
+	}
+
+	f.fallbackMu.Lock()
+	defer f.fallbackMu.Unlock()
+	f.fallbackTTL = ttl
+	f.fallbacks = make(map[int]cachedFallback)
+	return nil
+}
+
+// AttemptPurchase enforces the purchase limits in Redis, or in Postgres while Redis is down.
+// The write-behind event is only queued by Redis; a Postgres purchase is recorded directly.
+func (f *FailoverPurchaseLimiter) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, event *interfaces.PersistenceEvent) (*interfaces.PurchaseResult, error) {
+	// 1. Use Redis unless it is down or the sale already moved to Postgres
+	fallback, err := f.fallback(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fallback && f.Healthy() {
+		result, err := f.redis.AttemptPurchase(ctx, saleID, userID, itemID, code, event)
+		if err == nil {
+			return result, nil
+		}
+
+		// The script may have run before the error; if so Redis over-counts, which never oversells
+		f.setHealth(err)
+	}
+
+	// 2. Move the sale to Postgres for every replica
+	if !fallback {
+		if f.writeBehind {
+			// Postgres is missing the purchases still queued in the write-behind stream
+			return &interfaces.PurchaseResult{Status: interfaces.PurchaseSaleRebuilding, ItemID: itemID}, nil
+		}
+
+		moved, err := f.db.BeginPurchaseFallback(ctx, saleID)
+		if err != nil {
+			return nil, err
+		}
+		if moved {
+			log.Printf("Sale %d purchases now use PostgreSQL limits", saleID)
+		}
+		f.cacheFallback(saleID, true)
+	}
+
+	result, err := f.db.AttemptPurchase(ctx, saleID, userID, itemID, code)
+	if err == nil && result.Status == interfaces.PurchaseSaleRebuilding {
+		// The sale moved back to Redis; the retry reads the flag again
+		f.forgetFallback(saleID)
+	}
+	return result, err
+}
+
+// RevertPurchase gives back a unit to the store the sale's purchases go to. If the sale
+// moved to Postgres after a Redis attempt, the Postgres revert finds no claim and Redis
+// keeps counting the unit until its counters are rebuilt, which can only undersell.
+func (f *FailoverPurchaseLimiter) RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error {
+	fallback, err := f.fallback(ctx, saleID)
+	if err != nil {
+		return err
+	}
+
+	if fallback {
+		return f.db.RevertPurchase(ctx, saleID, userID, itemID, code)
+	}
+	return f.redis.RevertPurchase(ctx, saleID, userID, itemID, code)
+}
+
+// CheckHealth pings Redis and records the result. It returns whether Redis is healthy.
+func (f *FailoverPurchaseLimiter) CheckHealth(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, f.interval)
+	defer cancel()
+
+	err := f.redis.Ping(ctx)
+	f.setHealth(err)
+	return err == nil
+}
+
+// Healthy reports whether Redis passed its last health check
+func (f *FailoverPurchaseLimiter) Healthy() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.healthy
+}
+
+// Start runs health checks every interval until Stop is called or ctx is done
+func (f *FailoverPurchaseLimiter) Start(ctx context.Context) {
+	for {
+		f.CheckHealth(ctx)
+
+		select {
+		case <-f.clock.After(f.interval):
+		case <-f.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the health checks
+func (f *FailoverPurchaseLimiter) Stop() {
+	close(f.stopChan)
+}
+
+// fallback reports whether the sale's purchase limits moved to Postgres. In write-behind
+// mode they never do, so Postgres is not asked; otherwise a fresh cached flag is used.
+func (f *FailoverPurchaseLimiter) fallback(ctx context.Context, saleID int) (bool, error) {
+	if f.writeBehind {
+		return false, nil
+	}
+
+	if fallback, ok := f.cachedFallback(saleID); ok {
+		return fallback, nil
+	}
+
+	fallback, err := f.db.GetPurchaseFallback(ctx, saleID)
+	if err != nil {
+		return false, err
+	}
+	f.cacheFallback(saleID, fallback)
+	return fallback, nil
+}
+
+// cachedFallback returns the sale's cached fallback flag, if it is still fresh
+func (f *FailoverPurchaseLimiter) cachedFallback(saleID int) (bool, bool) {
+	f.fallbackMu.RLock()
+	defer f.fallbackMu.RUnlock()
+
+	cached, ok := f.fallbacks[saleID]
+	if !ok || f.clock.Now().Sub(cached.loaded) >= f.fallbackTTL {
+		return false, false
+	}
+	return cached.fallback, true
+}
+
+// cacheFallback keeps the sale's fallback flag for cachedFallback
+func (f *FailoverPurchaseLimiter) cacheFallback(saleID int, fallback bool) {
+	f.fallbackMu.Lock()
+	defer f.fallbackMu.Unlock()
+
+	if f.fallbackTTL == 0 {
+		return
+	}
+	f.fallbacks[saleID] = cachedFallback{fallback: fallback, loaded: f.clock.Now()}
+}
+
+// forgetFallback drops the sale's cached fallback flag
+func (f *FailoverPurchaseLimiter) forgetFallback(saleID int) {
+	f.fallbackMu.Lock()
+	defer f.fallbackMu.Unlock()
+	delete(f.fallbacks, saleID)
+}
+
+// setHealth records a health check or purchase result, logging state changes
+func (f *FailoverPurchaseLimiter) setHealth(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	healthy := err == nil
+	if healthy == f.healthy {
+		return
+	}
+
+	if healthy {
+		log.Println("Redis is healthy again, sales move back to Redis purchase limits once their counters are rebuilt")
+	} else {
+		log.Printf("Warning: Redis is unhealthy, falling back to PostgreSQL purchase limits: %v", err)
+	}
+	f.healthy = healthy
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+)
+
+// MaxCheckoutCodeLength is the longest checkout code accepted, matching the code columns in Postgres
+const MaxCheckoutCodeLength = 512
+
+// Purchase rejections. Forged and unknown codes are rejected with ErrInvalidCheckoutCode.
+var (
+	ErrCheckoutExpired      = errors.New("checkout code has expired")
+	ErrCheckoutUserMismatch = errors.New("checkout code belongs to another user")
+	ErrItemNotFound         = errors.New("item not found")
+	ErrPurchaseNotRecorded  = errors.New("purchase could not be recorded")
+)
+
+// Refund errors
+var (
+	ErrPurchaseNotFound     = errors.New("purchase not found")
+	ErrPurchaseNotCompleted = errors.New("purchase is already refunded or cancelled")
+)
+
+// LimitError is a checkout or purchase refused by the sale's limits or state.
+// Status is the outcome reported to clients, e.g. item_sold_out.
+type LimitError struct {
+	Status        interfaces.PurchaseStatus
+	UserPurchases int // The user's purchases in the sale, set for PurchaseUserLimitExceeded
+	MaxPerUser    int // The sale's per-user limit, when known
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("purchase refused: %s", e.Status)
+}
+
+// PurchaseServiceImpl implements interfaces.PurchaseService
+type PurchaseServiceImpl struct {
+	saleService interfaces.SaleService
+	itemService interfaces.ItemService
+	db          interfaces.DatabaseInterface
+	redis       interfaces.RedisInterface
+	limiter     interfaces.PurchaseLimiter
+	codes       interfaces.CheckoutCodeSigner // Verifies signed checkout codes; codes are only looked up when nil
+	writeBehind bool                          // Queue purchases counted in Redis for Postgres instead of writing them
+}
+
+// NewPurchaseService creates a new purchase service
+func NewPurchaseService(
+	saleService interfaces.SaleService,
+	itemService interfaces.ItemService,
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+) *PurchaseServiceImpl {
+	return &PurchaseServiceImpl{
+		saleService: saleService,
+		itemService: itemService,
+		db:          db,
+		redis:       redis,
+		limiter:     redis,
+	}
+}
+
+// SetWriteBehind enables or disables write-behind persistence. With write-behind, purchases
+// counted in Redis are queued on the Redis persistence stream instead of written before returning.
+func (s *PurchaseServiceImpl) SetWriteBehind(enabled bool) {
+	s.writeBehind = enabled
+}
+
+// SetCodeSigner sets the signer used to verify checkout codes. Forged, tampered and
+// expired codes are then rejected before any Redis or Postgres lookup.
+func (s *PurchaseServiceImpl) SetCodeSigner(signer interfaces.CheckoutCodeSigner) {
+	s.codes = signer
+}
+
+// SetPurchaseLimiter replaces the Redis purchase limiter, e.g. with one that fails over to Postgres
+func (s *PurchaseServiceImpl) SetPurchaseLimiter(limiter interfaces.PurchaseLimiter) {
+	s.limiter = limiter
+}
+
+// ValidatePurchaseRequest validates the purchase request parameters
+func (s *PurchaseServiceImpl) ValidatePurchaseRequest(code string) error {
+	if code == "" {
+		return fmt.Errorf("checkout_code is required")
+	}
+
+	// Basic format validation for checkout code
+	if len(code) < 5 || len(code) > MaxCheckoutCodeLength {
+		return fmt.Errorf("invalid checkout_code format")
+	}
+
+	return nil
+}
+
+// ProcessPurchase redeems a checkout code with atomic operations. callerID is the
+// authenticated user, or "" when authentication is disabled. Codes that cannot be redeemed
+// are rejected with ErrInvalidCheckoutCode, ErrCheckoutExpired, ErrCheckoutUserMismatch and
+// ErrItemNotFound, purchases the sale refuses with a *LimitError, and purchases that were
+// counted but could not be recorded with ErrPurchaseNotRecorded.
+func (s *PurchaseServiceImpl) ProcessPurchase(ctx context.Context, code string, callerID string) (*interfaces.CompletedPurchase, error) {
+	// 1. Reject forged and expired codes from their signature alone, then get checkout details
+	var claims *models.CheckoutClaims
+	if s.codes != nil {
+		verified, err := s.codes.Verify(code)
+		if err != nil {
+			log.Printf("Checkout code rejected: %v", err)
+			return nil, ErrInvalidCheckoutCode
+		}
+
+		if time.Now().After(verified.ExpiresAt) {
+			return nil, ErrCheckoutExpired
+		}
+		if callerID != "" && verified.UserID != callerID {
+			return nil, ErrCheckoutUserMismatch
+		}
+		claims = verified
+	}
+
+	checkout, err := getCheckoutAttempt(ctx, s.db, s.redis, code)
+	if err == nil && checkout == nil {
+		err = fmt.Errorf("checkout code not found")
+	}
+	if err == nil && claims != nil && !claimsMatch(claims, checkout) {
+		err = fmt.Errorf("checkout %s does not match its signed claims", checkout.Code)
+	}
+	if err != nil {
+		log.Printf("Checkout code verification failed: %v", err)
+		return nil, ErrInvalidCheckoutCode
+	}
+
+	// Only the user who created the checkout may complete it
+	if callerID != "" && checkout.UserID != callerID {
+		return nil, ErrCheckoutUserMismatch
+	}
+
+	// 2. Check if checkout has already been used (fast path; the atomic
+	// consumption in step 6 is what actually guarantees single use)
+	if checkout.Status != "pending" {
+		return nil, &LimitError{Status: interfaces.PurchaseCodeAlreadyUsed}
+	}
+
+	// 3. Check if checkout has expired
+	if time.Now().After(checkout.ExpiresAt) {
+		return nil, ErrCheckoutExpired
+	}
+
+	// 4. Get the associated sale and verify it's still active
+	sale, err := s.saleService.GetCurrentActiveSale(ctx)
+	if err != nil || sale == nil || sale.ID != checkout.SaleID {
+		return nil, &LimitError{Status: interfaces.PurchaseSaleNotActive}
+	}
+
+	// 5. Get item details
+	item, err := s.itemService.GetItemByID(ctx, checkout.ItemID)
+	if err != nil {
+		log.Printf("Error getting item %s: %v", checkout.ItemID, err)
+		return nil, ErrItemNotFound
+	}
+
+	// 6. Perform atomic purchase operation (Redis Lua script, or Postgres row locks
+	// while Redis is down). The checkout code is consumed in the same step, so
+	// concurrent or replayed requests with the same code cannot both succeed.
+	// In write-behind mode the purchase is queued for Postgres in that step too,
+	// so a crash can never leave a counted purchase unrecorded.
+	purchase := newPurchase(checkout, item, time.Now())
+	var event *interfaces.PersistenceEvent
+	if s.writeBehind {
+		event = &interfaces.PersistenceEvent{Type: interfaces.PersistPurchase, Purchase: purchase}
+	}
+
+	purchaseResult, err := s.limiter.AttemptPurchase(ctx, sale.ID, checkout.UserID, checkout.ItemID, checkout.Code, event)
+	if err != nil {
+		return nil, fmt.Errorf("purchase attempt failed: %w", err)
+	}
+
+	// 7. Check purchase result
+	if purchaseResult.Status != interfaces.PurchaseSuccess {
+		return nil, &LimitError{
+			Status:        purchaseResult.Status,
+			UserPurchases: purchaseResult.UserPurchases,
+			MaxPerUser:    sale.MaxPerUser,
+		}
+	}
+
+	// Purchase successful, create purchase record in database
+	return s.completePurchase(ctx, checkout, purchase, item, purchaseResult)
+}
+
+// GetUserPurchaseCount returns how many items a user has purchased in a sale
+func (s *PurchaseServiceImpl) GetUserPurchaseCount(ctx context.Context, userID string, saleID int) (int, error) {
+	return s.redis.GetUserPurchaseCount(ctx, userID, saleID)
+}
+
+// CanUserPurchase reports whether a user is still below a sale's per-user limit
+func (s *PurchaseServiceImpl) CanUserPurchase(ctx context.Context, userID string, saleID int) (bool, error) {
+	sale, err := s.db.GetSaleByID(ctx, saleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get sale %d: %w", saleID, err)
+	}
+
+	if sale == nil {
+		return false, nil
+	}
+
+	count, err := s.GetUserPurchaseCount(ctx, userID, saleID)
+	if err != nil {
+		return false, err
+	}
+
+	return count < sale.MaxPerUser, nil
+}
+
+// newPurchase builds the record of a purchase made with the checkout
+func newPurchase(checkout *models.Checkout, item *models.Item, now time.Time) *models.Purchase {
+	return &models.Purchase{
+		UserID:      checkout.UserID,
+		ItemID:      checkout.ItemID,
+		SaleID:      checkout.SaleID,
+		Code:        checkout.Code,
+		CheckoutID:  checkout.ID,
+		Price:       item.Price,
+		Status:      models.PurchaseStatusCompleted,
+		PurchasedAt: now,
+	}
+}
+
+// completePurchase finalizes the purchase by creating database records, unless the
+// limiter already queued it for write-behind. The limiter has already counted the
+// purchase at this point, so any database failure is compensated by reverting the
+// limiter's counters.
+func (s *PurchaseServiceImpl) completePurchase(ctx context.Context, checkout *models.Checkout, purchase *models.Purchase, item *models.Item, purchaseResult *interfaces.PurchaseResult) (*interfaces.CompletedPurchase, error) {
+	if purchaseResult.Queued {
+		return &interfaces.CompletedPurchase{
+			Purchase:      purchase,
+			Item:          item,
+			UserPurchases: purchaseResult.UserPurchases,
+		}, nil
+	}
+
+	if err := s.persistPurchase(ctx, checkout, purchase, purchase.PurchasedAt, !purchaseResult.DatabaseCounted); err != nil {
+		log.Printf("Failed to record purchase for checkout %s: %v", checkout.Code, err)
+
+		// Give the unit back so the limiter does not count a sale that was never recorded
+		if revertErr := s.limiter.RevertPurchase(ctx, checkout.SaleID, checkout.UserID, checkout.ItemID, checkout.Code); revertErr != nil {
+			log.Printf("Failed to revert purchase counters for checkout %s: %v", checkout.Code, revertErr)
+		}
+
+		return nil, ErrPurchaseNotRecorded
+	}
+
+	return &interfaces.CompletedPurchase{
+		Purchase:      purchase,
+		Item:          item,
+		UserPurchases: purchaseResult.UserPurchases,
+	}, nil
+}
+
+// persistPurchase writes the purchase row, the checkout status change and the
+// sale counters in a single transaction so they commit or roll back together.
+// countSale is false when the limiter already updated the sale counters in Postgres.
+func (s *PurchaseServiceImpl) persistPurchase(ctx context.Context, checkout *models.Checkout, purchase *models.Purchase, now time.Time, countSale bool) error {
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	if err := tx.CreatePurchase(ctx, purchase); err != nil {
+		return err
+	}
+
+	// Update checkout status to 'used'
+	checkout.Status = "used"
+	checkout.Purchased = true
+	checkout.UpdatedAt = now
+	if err := tx.UpdateCheckout(ctx, checkout); err != nil {
+		return err
+	}
+
+	if countSale {
+		// A purchase counted in Redis must not be recorded once the sale moved to Postgres
+		if err := tx.EnsureRedisLimits(ctx, checkout.SaleID); err != nil {
+			return err
+		}
+
+		if err := tx.IncrementSaleItemsSold(ctx, checkout.SaleID, 1); err != nil {
+			return err
+		}
+
+		if err := tx.IncrementSaleItemSold(ctx, checkout.SaleID, checkout.ItemID, 1); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// claimsMatch reports whether a stored checkout matches the details signed into its code
+func claimsMatch(claims *models.CheckoutClaims, checkout *models.Checkout) bool {
+	return checkout.SaleID == claims.SaleID &&
+		checkout.UserID == claims.UserID &&
+		checkout.ItemID == claims.ItemID
+}
+
+// RefundPurchase marks the purchase made with a checkout code refunded and returns its
+// item to the sale. The checkout code stays used, so it cannot buy the item again.
+func (s *PurchaseServiceImpl) RefundPurchase(ctx context.Context, code string) (*models.Purchase, error) {
+	return s.reversePurchase(ctx, code, models.PurchaseStatusRefunded)
+}
+
+// CancelPurchase marks the purchase made with a checkout code cancelled and returns its
+// item to the sale, like RefundPurchase
+func (s *PurchaseServiceImpl) CancelPurchase(ctx context.Context, code string) (*models.Purchase, error) {
+	return s.reversePurchase(ctx, code, models.PurchaseStatusCancelled)
+}
+
+// reversePurchase moves a completed purchase to status and takes it off the sale counters.
+// Postgres changes are committed first, in one transaction, so a reversal succeeds while
+// Redis is down. The Redis counters are decremented afterwards; if that fails, the sale's
+// purchase limits move to Postgres until the counter reconciler rebuilds Redis from it.
+func (s *PurchaseServiceImpl) reversePurchase(ctx context.Context, code string, status string) (*models.Purchase, error) {
+	tx, err := s.db.BeginTransaction(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	// 1. Lock the purchase; only completed purchases can be reversed, and only once
+	purchase, err := tx.GetPurchaseByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if purchase == nil {
+		return nil, ErrPurchaseNotFound
+	}
+	if purchase.Status != models.PurchaseStatusCompleted {
+		return purchase, ErrPurchaseNotCompleted
+	}
+
+	// 2. Record the new status and take the purchase off the sale counters
+	if err := tx.UpdatePurchaseStatus(ctx, purchase.ID, status); err != nil {
+		return nil, err
+	}
+
+	if err := tx.IncrementSaleItemsSold(ctx, purchase.SaleID, -1); err != nil {
+		return nil, err
+	}
+
+	if err := tx.IncrementSaleItemSold(ctx, purchase.SaleID, purchase.ItemID, -1); err != nil {
+		return nil, err
+	}
+
+	// 3. Commit
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// 4. Give the unit back in Redis: the sale and user counters and the item stock are
+	// decremented atomically. No code is passed, so the checkout code stays consumed.
+	if err := s.redis.RevertPurchase(ctx, purchase.SaleID, purchase.UserID, purchase.ItemID, ""); err != nil {
+		s.reconcileReversal(ctx, purchase, status, err)
+	}
+
+	purchase.Status = status
+	return purchase, nil
+}
+
+// reconcileReversal handles a reversal committed in Postgres whose Redis decrement failed.
+// The decrement is not retried, as it may have been applied. Instead the sale's purchase
+// limits move to Postgres, which has the reversal, and the counter reconciler rebuilds Redis
+// from Postgres once it is reachable. In write-behind mode Postgres lags behind Redis and
+// cannot take over, so Redis keeps counting the unit as sold.
+func (s *PurchaseServiceImpl) reconcileReversal(ctx context.Context, purchase *models.Purchase, status string, revertErr error) {
+	if s.writeBehind {
+		log.Printf("Warning: Failed to return %s purchase %d to sale %d in Redis; the unit stays sold there: %v",
+			status, purchase.ID, purchase.SaleID, revertErr)
+		return
+	}
+
+	log.Printf("Warning: Failed to return %s purchase %d to sale %d in Redis, moving its purchase limits to PostgreSQL: %v",
+		status, purchase.ID, purchase.SaleID, revertErr)
+	if _, err := s.db.BeginPurchaseFallback(ctx, purchase.SaleID); err != nil {
+		log.Printf("Warning: Failed to move sale %d purchase limits to PostgreSQL; Redis counts purchase %d as sold: %v",
+			purchase.SaleID, purchase.ID, err)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// localBucketPruneInterval is how often refilled in-process buckets are dropped
+const localBucketPruneInterval = time.Minute
+
+// ParseRateLimitRule parses a rule like "10/1m" (10 requests per minute); "off" or "0" disables it
+func ParseRateLimitRule(spec string) (interfaces.RateLimitRule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "off" || spec == "0" {
+		return interfaces.RateLimitRule{}, nil
+	}
+
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return interfaces.RateLimitRule{}, fmt.Errorf("invalid rate limit %q, expected requests/window like 10/1m", spec)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return interfaces.RateLimitRule{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", spec)
+	}
+
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || window <= 0 {
+		return interfaces.RateLimitRule{}, fmt.Errorf("invalid rate limit %q: window must be a positive duration", spec)
+	}
+
+	return interfaces.RateLimitRule{Limit: limit, Window: window}, nil
+}
+
+// localBucket is an in-process token bucket
+type localBucket struct {
+	tokens float64
+	ts     time.Time
+	fullAt time.Time // When the bucket has refilled and is no different from a new one
+}
+
+// RateLimiter enforces token bucket limits shared by all replicas through Redis. While
+// Redis fails, each replica falls back to its own in-process buckets, so limits are
+// enforced per replica until Redis recovers. Once a request sees Redis fail, requests
+// skip Redis until a health check run by Start finds it reachable again.
+type RateLimiter struct {
+	redis    interfaces.RedisInterface
+	clock    interfaces.Clock
+	interval time.Duration
+
+	mu        sync.Mutex
+	local     map[string]*localBucket
+	lastPrune time.Time
+	degraded  bool // Using in-process buckets because Redis failed
+	stopChan  chan struct{}
+}
+
+// NewRateLimiter creates a rate limiter that checks a failed Redis every interval;
+// a nil redis uses in-process buckets only
+func NewRateLimiter(redis interfaces.RedisInterface, clock interfaces.Clock, interval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		redis:     redis,
+		clock:     clock,
+		interval:  interval,
+		local:     make(map[string]*localBucket),
+		lastPrune: clock.Now(),
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Allow takes a token from the bucket for key and reports whether the request may
+// proceed; when it may not, it also returns how long until a token is available
+func (l *RateLimiter) Allow(ctx context.Context, key string, rule interfaces.RateLimitRule) (bool, time.Duration) {
+	if !rule.Enabled() {
+		return true, 0
+	}
+
+	now := l.clock.Now()
+	refill := rule.Window / time.Duration(rule.Limit)
+
+	// While degraded, skip Redis so requests do not wait through its timeouts
+	if l.redis != nil && !l.Degraded() {
+		allowed, retryAfter, err := l.redis.TakeRateLimitToken(ctx, key, rule.Limit, refill, now)
+		if err == nil {
+			return allowed, retryAfter
+		}
+		l.setDegraded(true, err)
+	}
+
+	return l.allowLocal(key, rule.Limit, refill, now)
+}
+
+// CheckHealth pings Redis and switches back to it if the ping succeeds. It returns
+// whether the limiter uses Redis.
+func (l *RateLimiter) CheckHealth(ctx context.Context) bool {
+	if l.redis == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.interval)
+	defer cancel()
+
+	err := l.redis.Ping(ctx)
+	l.setDegraded(err != nil, err)
+	return err == nil
+}
+
+// Degraded reports whether the limiter is using in-process buckets
+func (l *RateLimiter) Degraded() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.degraded
+}
+
+// Start checks Redis every interval while the limiter is degraded, until Stop is called or ctx is done
+func (l *RateLimiter) Start(ctx context.Context) {
+	for {
+		if l.Degraded() {
+			l.CheckHealth(ctx)
+		}
+
+		select {
+		case <-l.clock.After(l.interval):
+		case <-l.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the health checks
+func (l *RateLimiter) Stop() {
+	close(l.stopChan)
+}
+
+// setDegraded logs switches between Redis and in-process buckets
+func (l *RateLimiter) setDegraded(degraded bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if degraded == l.degraded {
+		return
+	}
+	l.degraded = degraded
+
+	if degraded {
+		log.Printf("Warning: Redis rate limiting failed, limiting per instance until it recovers: %v", err)
+	} else {
+		log.Println("Redis rate limiting recovered")
+	}
+}
+
+// allowLocal takes a token from an in-process bucket
+func (l *RateLimiter) allowLocal(key string, capacity int, refill time.Duration, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pruneLocked(now)
+
+	bucket, ok := l.local[key]
+	if !ok {
+		bucket = &localBucket{tokens: float64(capacity), ts: now}
+		l.local[key] = bucket
+	}
+	if now.After(bucket.ts) {
+		bucket.tokens += float64(now.Sub(bucket.ts)) / float64(refill)
+		if bucket.tokens > float64(capacity) {
+			bucket.tokens = float64(capacity)
+		}
+		bucket.ts = now
+	}
+
+	allowed, retryAfter := false, time.Duration((1-bucket.tokens)*float64(refill))
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		allowed, retryAfter = true, 0
+	}
+	bucket.fullAt = now.Add(time.Duration((float64(capacity) - bucket.tokens) * float64(refill)))
+
+	return allowed, retryAfter
+}
+
+// pruneLocked drops buckets that have refilled, as a missing bucket starts out full
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < localBucketPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, bucket := range l.local {
+		if !now.Before(bucket.fullAt) {
+			delete(l.local, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+)
+
+// Reservation sweeper defaults
+const (
+	DefaultReservationSweepInterval = 5 * time.Second
+	ReservationReleaseBatchSize     = 500 // Reservations released per Redis round trip
+)
+
+// ReservationSweeper returns units held by expired checkout reservations of the
+// active sale to available stock. Each batch is released atomically in Redis,
+// so replicas can sweep concurrently without releasing a reservation twice.
+type ReservationSweeper struct {
+	db       interfaces.DatabaseInterface
+	redis    interfaces.RedisInterface
+	clock    interfaces.Clock
+	interval time.Duration
+	stopChan chan struct{}
+}
+
+// NewReservationSweeper creates a new reservation sweeper
+func NewReservationSweeper(
+	db interfaces.DatabaseInterface,
+	redis interfaces.RedisInterface,
+	clock interfaces.Clock,
+	interval time.Duration,
+) *ReservationSweeper {
+	return &ReservationSweeper{
+		db:       db,
+		redis:    redis,
+		clock:    clock,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Sweep releases the active sale's expired reservations and returns how many were released
+func (s *ReservationSweeper) Sweep(ctx context.Context) (int, error) {
+	sale, err := s.db.GetActiveSale(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get active sale: %w", err)
+	}
+
+	if sale == nil {
+		return 0, nil
+	}
+
+	now := s.clock.Now()
+	total := 0
+	for {
+		released, err := s.redis.ReleaseExpiredReservations(ctx, sale.ID, now, ReservationReleaseBatchSize)
+		total += released
+		if err != nil {
+			return total, err
+		}
+
+		if released < ReservationReleaseBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Released %d expired reservations for sale %d", total, sale.ID)
+	}
+
+	return total, nil
+}
+
+// Start sweeps every interval until Stop is called or ctx is done
+func (s *ReservationSweeper) Start(ctx context.Context) {
+	for {
+		if _, err := s.Sweep(ctx); err != nil {
+			log.Printf("Warning: failed to release expired reservations: %v", err)
+		}
+
+		select {
+		case <-s.clock.After(s.interval):
+		case <-s.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the sweeper
+func (s *ReservationSweeper) Stop() {
+	close(s.stopChan)
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+)
+
+// Defaults for the recurring sale schedule
+const (
+	DefaultScheduleInterval     = time.Hour
+	DefaultScheduleHorizon      = 24 * time.Hour
+	DefaultSchedulePollInterval = 15 * time.Second // Upper bound on how long newly scheduled windows go unnoticed
+)
+
+// RealClock implements interfaces.Clock using the system clock
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                         { return time.Now() }
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ScheduleRule generates recurring sale windows. Windows start on multiples of Interval
+// counted from the zero time, so an hourly rule starts sales on the hour (UTC).
+type ScheduleRule struct {
+	Interval time.Duration // 0 disables the rule; only explicitly scheduled windows run
+	Duration time.Duration // Length of each window; 0 means Interval
+	Horizon  time.Duration // How far ahead windows are persisted
+}
+
+// DefaultScheduleRule returns the hourly rule used when nothing is configured
+func DefaultScheduleRule() ScheduleRule {
+	return ScheduleRule{
+		Interval: DefaultScheduleInterval,
+		Duration: DefaultScheduleInterval,
+		Horizon:  DefaultScheduleHorizon,
+	}
+}
+
+// Validate checks that the rule produces non-overlapping windows
+func (r ScheduleRule) Validate() error {
+	if r.Interval < 0 {
+		return fmt.Errorf("schedule interval cannot be negative, got %v", r.Interval)
+	}
+
+	if r.Interval == 0 {
+		return nil
+	}
+
+	if r.Duration < 0 || r.Duration > r.Interval {
+		return fmt.Errorf("schedule duration must be between 0 and the interval %v, got %v", r.Interval, r.Duration)
+	}
+
+	if r.Horizon < r.Interval {
+		return fmt.Errorf("schedule horizon must be at least the interval %v, got %v", r.Interval, r.Horizon)
+	}
+
+	return nil
+}
+
+// windowsBetween returns the rule's windows that are still running at from or start before until
+func (r ScheduleRule) windowsBetween(from, until time.Time) []models.SaleWindow {
+	duration := r.Duration
+	if duration == 0 {
+		duration = r.Interval
+	}
+
+	var windows []models.SaleWindow
+	for start := from.Add(-duration).Truncate(r.Interval); start.Before(until); start = start.Add(r.Interval) {
+		end := start.Add(duration)
+		if !end.After(from) {
+			continue
+		}
+
+		windows = append(windows, models.SaleWindow{
+			StartTime: start,
+			EndTime:   end,
+			Status:    models.SaleWindowPending,
+			Source:    models.SaleWindowSourceRule,
+		})
+	}
+
+	return windows
+}
+
+// SaleScheduler moves persisted sale windows through their lifecycle:
+// pending windows become active sales at their start time and are completed at their end time.
+// Windows that ended while nothing was running are marked missed.
+type SaleScheduler struct {
+	saleService  interfaces.SaleService
+	db           interfaces.DatabaseInterface
+	clock        interfaces.Clock
+	rule         ScheduleRule
+	pollInterval time.Duration
+
+	// Rule windows are persisted up to this time
+	materializedUntil time.Time
+	mu                sync.Mutex
+}
+
+// NewSaleScheduler creates a new sale scheduler
+func NewSaleScheduler(
+	saleService interfaces.SaleService,
+	db interfaces.DatabaseInterface,
+	clock interfaces.Clock,
+	rule ScheduleRule,
+) *SaleScheduler {
+	return &SaleScheduler{
+		saleService:  saleService,
+		db:           db,
+		clock:        clock,
+		rule:         rule,
+		pollInterval: DefaultSchedulePollInterval,
+	}
+}
+
+// Reconcile applies every transition that is due at the current clock time and returns
+// when the next known one is due, or the zero time if nothing is scheduled. Transitions
+// missed while no manager was running are applied on the first call, so it is safe to call
+// after a restart. When ctx carries a leader fence and a newer leader has taken over, it
+// stops at the first rejected write and returns interfaces.ErrLeadershipLost.
+func (s *SaleScheduler) Reconcile(ctx context.Context) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	var next time.Time
+
+	// 1. Persist upcoming windows generated by the rule
+	if err := s.materialize(ctx, now); err != nil {
+		return time.Time{}, err
+	}
+
+	// 2. Complete active windows that have ended
+	active, err := s.db.GetSaleWindowsByStatus(ctx, models.SaleWindowActive)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get active sale windows: %w", err)
+	}
+
+	var running []models.SaleWindow
+	for _, window := range active {
+		if window.EndTime.After(now) {
+			running = append(running, window)
+			continue
+		}
+
+		if err := s.completeWindow(ctx, &window); err != nil {
+			if leadershipLost(err) {
+				return time.Time{}, err
+			}
+			log.Printf("Warning: failed to complete sale window %d: %v", window.ID, err)
+		}
+	}
+
+	// 3. Find the pending window to start; windows that ended before starting were missed
+	pending, err := s.db.GetSaleWindowsByStatus(ctx, models.SaleWindowPending)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get pending sale windows: %w", err)
+	}
+
+	var due *models.SaleWindow
+	for i := range pending {
+		window := &pending[i]
+
+		if window.StartTime.After(now) {
+			// Windows are ordered by start time, so this is the next boundary
+			next = earliest(next, window.StartTime)
+			break
+		}
+
+		if !window.EndTime.After(now) {
+			if err := s.setWindowStatus(ctx, window, models.SaleWindowMissed); leadershipLost(err) {
+				return time.Time{}, err
+			}
+			continue
+		}
+
+		// Overlapping windows: the one that started last wins
+		if due != nil {
+			if err := s.setWindowStatus(ctx, due, models.SaleWindowMissed); leadershipLost(err) {
+				return time.Time{}, err
+			}
+		}
+		due = window
+	}
+
+	// 4. Start the due window; its sale replaces whatever was running
+	if due != nil {
+		sale, err := s.saleService.CreateScheduledSale(ctx, due)
+		if err == nil {
+			if err = s.db.UpdateSaleWindowStatus(ctx, due.ID, models.SaleWindowActive, sale.ID); err != nil {
+				err = fmt.Errorf("failed to mark it active: %w", err)
+			}
+		}
+
+		switch {
+		case leadershipLost(err):
+			return time.Time{}, err
+		case err != nil:
+			log.Printf("Warning: failed to start sale window %d: %v", due.ID, err)
+		default:
+			log.Printf("Started scheduled sale %d for window %d (%v to %v)", sale.ID, due.ID, due.StartTime, due.EndTime)
+
+			for _, window := range running {
+				if err := s.setWindowStatus(ctx, &window, models.SaleWindowCompleted); leadershipLost(err) {
+					return time.Time{}, err
+				}
+			}
+			running = []models.SaleWindow{*due}
+		}
+	}
+
+	// 5. Wake up again when the running window ends
+	for _, window := range running {
+		next = earliest(next, window.EndTime)
+	}
+
+	return next, nil
+}
+
+// ScheduleWindow persists an explicit sale window. It returns false if the same window is already scheduled.
+func (s *SaleScheduler) ScheduleWindow(ctx context.Context, window *models.SaleWindow) (bool, error) {
+	if !window.EndTime.After(window.StartTime) {
+		return false, fmt.Errorf("window end time %v must be after start time %v", window.EndTime, window.StartTime)
+	}
+
+	if !window.EndTime.After(s.clock.Now()) {
+		return false, fmt.Errorf("window ending at %v is already over", window.EndTime)
+	}
+
+	if window.ItemsAvailable < 0 || window.MaxPerUser < 0 {
+		return false, fmt.Errorf("window limits cannot be negative")
+	}
+
+	window.Status = models.SaleWindowPending
+	if window.Source == "" {
+		window.Source = models.SaleWindowSourceManual
+	}
+
+	created, err := s.db.CreateSaleWindow(ctx, window)
+	if err != nil {
+		return false, fmt.Errorf("failed to schedule sale window: %w", err)
+	}
+
+	return created, nil
+}
+
+// materialize persists the rule's windows up to the horizon. Failures are logged and
+// retried on the next reconcile; only lost leadership is returned.
+func (s *SaleScheduler) materialize(ctx context.Context, now time.Time) error {
+	if s.rule.Interval <= 0 {
+		return nil
+	}
+
+	from := now
+	if s.materializedUntil.After(from) {
+		from = s.materializedUntil
+	}
+
+	until := now.Add(s.rule.Horizon)
+	if !until.After(from) {
+		return nil
+	}
+
+	for _, window := range s.rule.windowsBetween(from, until) {
+		if _, err := s.db.CreateSaleWindow(ctx, &window); err != nil {
+			if leadershipLost(err) {
+				return err
+			}
+			// Retry from the same point on the next reconcile
+			log.Printf("Warning: failed to schedule sale window %v to %v: %v", window.StartTime, window.EndTime, err)
+			return nil
+		}
+	}
+
+	s.materializedUntil = until
+	return nil
+}
+
+// completeWindow deactivates the window's sale and marks the window completed
+func (s *SaleScheduler) completeWindow(ctx context.Context, window *models.SaleWindow) error {
+	if window.SaleID > 0 {
+		if err := s.saleService.DeactivateSale(ctx, window.SaleID); err != nil {
+			return fmt.Errorf("failed to deactivate sale %d: %w", window.SaleID, err)
+		}
+	}
+
+	if err := s.db.UpdateSaleWindowStatus(ctx, window.ID, models.SaleWindowCompleted, 0); err != nil {
+		return err
+	}
+
+	log.Printf("Completed scheduled sale %d for window %d", window.SaleID, window.ID)
+	return nil
+}
+
+// setWindowStatus updates a window's status, logging failures so the next reconcile can retry
+func (s *SaleScheduler) setWindowStatus(ctx context.Context, window *models.SaleWindow, status string) error {
+	if err := s.db.UpdateSaleWindowStatus(ctx, window.ID, status, 0); err != nil {
+		log.Printf("Warning: failed to mark sale window %d %s: %v", window.ID, status, err)
+		return err
+	}
+
+	if status == models.SaleWindowMissed {
+		log.Printf("Sale window %d (%v to %v) was missed", window.ID, window.StartTime, window.EndTime)
+	}
+	return nil
+}
+
+// NextWake returns when a manager should reconcile again: at the next transition, but
+// no later than the poll interval so windows scheduled by other processes are noticed
+func (s *SaleScheduler) NextWake(next time.Time) time.Time {
+	return earliest(next, s.clock.Now().Add(s.pollInterval))
+}
+
+// leadershipLost reports whether a write was rejected because a newer leader took over
+func leadershipLost(err error) bool {
+	return errors.Is(err, interfaces.ErrLeadershipLost)
+}
+
+// earliest returns the earlier of two times, ignoring zero times
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -2,26 +2,106 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
 )
 
+// Default limits for sales created by CreateHourlySale
+const (
+	DefaultItemsAvailable = 10000 // Contest requirement: exactly 10,000 items
+	DefaultMaxPerUser     = 10
+)
+
+// SaleKeyTTL is how long Redis keeps a sale's keys after the sale ends
+const SaleKeyTTL = 24 * time.Hour
+
+// DefaultActiveSaleCacheTTL is how long a replica serves the active sale from memory
+// before reloading it from Postgres
+const DefaultActiveSaleCacheTTL = time.Second
+
+// Sale extension errors
+var (
+	ErrSaleNotExtendable = errors.New("only an active sale that has not ended can be extended")
+	ErrSaleWindowOverlap = errors.New("sale would overlap a scheduled sale window")
+)
+
 // SaleServiceImpl implements interfaces.SaleService
 type SaleServiceImpl struct {
 	db    interfaces.DatabaseInterface
 	redis interfaces.RedisInterface
+
+	// Limits applied to newly created sales
+	itemsAvailable int
+	maxPerUser     int
+
+	// Per-item stock allocated to newly created sales (empty means unrestricted)
+	defaultItems []models.SaleItem
+
+	// The active sale as last loaded from Postgres, served while Redis still names it
+	activeSale       *models.Sale
+	activeSaleLoaded time.Time
+	activeSaleTTL    time.Duration
+	activeSaleMu     sync.RWMutex
 }
 
 // NewSaleService creates a new sale service
 func NewSaleService(db interfaces.DatabaseInterface, redis interfaces.RedisInterface) *SaleServiceImpl {
 	return &SaleServiceImpl{
-		db:    db,
-		redis: redis,
+		db:             db,
+		redis:          redis,
+		itemsAvailable: DefaultItemsAvailable,
+		maxPerUser:     DefaultMaxPerUser,
+		activeSaleTTL:  DefaultActiveSaleCacheTTL,
+	}
+}
+
+// SetDefaultLimits overrides the limits used for newly created sales
+func (s *SaleServiceImpl) SetDefaultLimits(itemsAvailable, maxPerUser int) error {
+	if itemsAvailable <= 0 {
+		return fmt.Errorf("items available must be positive, got %d", itemsAvailable)
+	}
+
+	if maxPerUser <= 0 {
+		return fmt.Errorf("max per user must be positive, got %d", maxPerUser)
+	}
+
+	s.itemsAvailable = itemsAvailable
+	s.maxPerUser = maxPerUser
+	return nil
+}
+
+// SetActiveSaleCacheTTL sets how long the active sale is served from memory. A sale ended
+// or replaced on any replica is dropped at once, as Redis no longer names it; other changes,
+// such as an extension made by another replica, are seen within ttl. 0 disables the cache.
+func (s *SaleServiceImpl) SetActiveSaleCacheTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("active sale cache TTL cannot be negative, got %v", ttl)
+	}
+
+	s.activeSaleMu.Lock()
+	defer s.activeSaleMu.Unlock()
+	s.activeSaleTTL = ttl
+	s.activeSale = nil
+	return nil
+}
+
+// SetDefaultItems sets the per-item stock allocated to newly created sales.
+// Purchases of items outside the allocation are rejected.
+func (s *SaleServiceImpl) SetDefaultItems(items []models.SaleItem) error {
+	if err := validateSaleItems(items); err != nil {
+		return err
 	}
+
+	s.defaultItems = items
+	return nil
 }
 
 // CreateHourlySale creates a new hourly flash sale
@@ -36,15 +116,47 @@ func (s *SaleServiceImpl) CreateHourlySale(ctx context.Context) (*models.Sale, e
 	sale := &models.Sale{
 		StartTime:      startTime,
 		EndTime:        endTime,
-		ItemsAvailable: 10000, // Contest requirement: exactly 10,000 items
+		ItemsAvailable: s.itemsAvailable,
 		ItemsSold:      0,
+		MaxPerUser:     s.maxPerUser,
 		Active:         true,
 	}
 
-	// Deactivate any existing active sales first
-	if err := s.deactivateAllSales(ctx); err != nil {
-		log.Printf("Warning: failed to deactivate existing sales: %v", err)
-		// Continue anyway - this is not critical
+	// Allocate per-item stock
+	items := make([]models.SaleItem, len(s.defaultItems))
+	copy(items, s.defaultItems)
+
+	return s.CreateSale(ctx, sale, items)
+}
+
+// CreateSale creates a sale with the given times, limits and per-item stock.
+// An active sale replaces the current one and is set up in Redis immediately;
+// an inactive sale is only persisted until ActivateSale is called.
+func (s *SaleServiceImpl) CreateSale(ctx context.Context, sale *models.Sale, items []models.SaleItem) (*models.Sale, error) {
+	if !sale.EndTime.After(sale.StartTime) {
+		return nil, fmt.Errorf("sale end time %v must be after start time %v", sale.EndTime, sale.StartTime)
+	}
+
+	if sale.ItemsAvailable <= 0 {
+		return nil, fmt.Errorf("items available must be positive, got %d", sale.ItemsAvailable)
+	}
+
+	if sale.MaxPerUser <= 0 {
+		return nil, fmt.Errorf("max per user must be positive, got %d", sale.MaxPerUser)
+	}
+
+	if err := validateSaleItems(items); err != nil {
+		return nil, err
+	}
+
+	if sale.Active {
+		s.forgetActiveSale()
+
+		// Deactivate any existing active sales first
+		if err := s.deactivateAllSales(ctx); err != nil {
+			log.Printf("Warning: failed to deactivate existing sales: %v", err)
+			// Continue anyway - this is not critical
+		}
 	}
 
 	// Create sale in database
@@ -52,17 +164,99 @@ func (s *SaleServiceImpl) CreateHourlySale(ctx context.Context) (*models.Sale, e
 		return nil, fmt.Errorf("failed to create sale in database: %w", err)
 	}
 
-	// Setup sale in Redis for atomic operations
-	if err := s.redis.SetupSale(ctx, sale.ID, sale.ItemsAvailable); err != nil {
-		// Rollback database sale if Redis setup fails
+	if err := s.db.CreateSaleItems(ctx, sale.ID, items); err != nil {
 		s.db.DeactivateSale(ctx, sale.ID)
-		return nil, fmt.Errorf("failed to setup sale in Redis: %w", err)
+		return nil, fmt.Errorf("failed to create sale items: %w", err)
+	}
+
+	if sale.Active {
+		// Setup sale in Redis for atomic operations
+		if err := s.redis.SetupSale(ctx, sale.ID, sale.ItemsAvailable, sale.MaxPerUser, remainingStock(items)); err != nil {
+			// Rollback database sale if Redis setup fails
+			s.db.DeactivateSale(ctx, sale.ID)
+			return nil, fmt.Errorf("failed to setup sale in Redis: %w", err)
+		}
+		refreshSaleKeys(ctx, s.redis, sale)
 	}
 
-	log.Printf("Created new flash sale %d: %v to %v", sale.ID, startTime, endTime)
+	log.Printf("Created new flash sale %d: %v to %v (active=%t)", sale.ID, sale.StartTime, sale.EndTime, sale.Active)
 	return sale, nil
 }
 
+// CreateScheduledSale creates and activates the sale for a schedule window, using the
+// default limits and item allocation for anything the window does not override
+func (s *SaleServiceImpl) CreateScheduledSale(ctx context.Context, window *models.SaleWindow) (*models.Sale, error) {
+	sale := &models.Sale{
+		StartTime:      window.StartTime,
+		EndTime:        window.EndTime,
+		ItemsAvailable: s.itemsAvailable,
+		MaxPerUser:     s.maxPerUser,
+		Active:         true,
+	}
+
+	if window.ItemsAvailable > 0 {
+		sale.ItemsAvailable = window.ItemsAvailable
+	}
+
+	if window.MaxPerUser > 0 {
+		sale.MaxPerUser = window.MaxPerUser
+	}
+
+	items := make([]models.SaleItem, len(s.defaultItems))
+	copy(items, s.defaultItems)
+
+	return s.CreateSale(ctx, sale, items)
+}
+
+// ParseSaleItemStock parses an allocation spec like "item1=500,item2=250"
+func ParseSaleItemStock(spec string) ([]models.SaleItem, error) {
+	var items []models.SaleItem
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sale item entry %q, expected item_id=stock", entry)
+		}
+
+		stock, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid stock for item %s: %w", parts[0], err)
+		}
+
+		items = append(items, models.SaleItem{ItemID: strings.TrimSpace(parts[0]), Stock: stock})
+	}
+
+	return items, nil
+}
+
+// AllocateEvenly splits total stock across the given items, giving any remainder to the first ones.
+// A sale item needs at least one unit, so when total is smaller than the number of items only
+// the first total items are allocated and the rest are left out.
+func AllocateEvenly(itemIDs []string, total int) []models.SaleItem {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+
+	items := make([]models.SaleItem, 0, len(itemIDs))
+	share, remainder := total/len(itemIDs), total%len(itemIDs)
+	for idx, itemID := range itemIDs {
+		stock := share
+		if idx < remainder {
+			stock++
+		}
+		if stock <= 0 {
+			break
+		}
+		items = append(items, models.SaleItem{ItemID: itemID, Stock: stock})
+	}
+
+	return items
+}
+
 // GetCurrentActiveSale returns the currently active sale
 func (s *SaleServiceImpl) GetCurrentActiveSale(ctx context.Context) (*models.Sale, error) {
 	// Try Redis first for performance
@@ -71,13 +265,18 @@ func (s *SaleServiceImpl) GetCurrentActiveSale(ctx context.Context) (*models.Sal
 		log.Printf("Warning: failed to get active sale from Redis: %v", err)
 		// Fall back to database
 	} else if activeSaleID > 0 {
+		// Serve the sale from memory so checkout and purchase stay off Postgres
+		if sale := s.cachedActiveSale(activeSaleID); sale != nil {
+			return sale, nil
+		}
+
 		// Get sale details from database
 		sale, err := s.db.GetSaleByID(ctx, activeSaleID)
 		if err != nil {
 			log.Printf("Warning: failed to get sale %d from database: %v", activeSaleID, err)
 		} else if sale != nil && sale.Active {
-			// Sync Redis counter with database if needed
-			s.syncSaleCounters(ctx, sale)
+			// items_sold is kept by the purchases themselves; Redis is never copied over it
+			s.cacheActiveSale(sale)
 			return sale, nil
 		}
 	}
@@ -102,11 +301,6 @@ func (s *SaleServiceImpl) GetCurrentActiveSale(ctx context.Context) (*models.Sal
 
 // ActivateSale activates a specific sale
 func (s *SaleServiceImpl) ActivateSale(ctx context.Context, saleID int) error {
-	// Deactivate all other sales first
-	if err := s.deactivateAllSales(ctx); err != nil {
-		return fmt.Errorf("failed to deactivate existing sales: %w", err)
-	}
-
 	// Get sale to activate
 	sale, err := s.db.GetSaleByID(ctx, saleID)
 	if err != nil {
@@ -117,13 +311,37 @@ func (s *SaleServiceImpl) ActivateSale(ctx context.Context, saleID int) error {
 		return fmt.Errorf("sale %d not found", saleID)
 	}
 
-	// Activate sale in database (this will be handled by database triggers for updated_at)
-	// We'll use the database interface method for activation
-	
+	// Re-running SetupSale would reset the live counters of a running sale
+	if sale.Active {
+		return fmt.Errorf("sale %d is already active", saleID)
+	}
+
+	if !sale.EndTime.After(time.Now()) {
+		return fmt.Errorf("sale %d already ended at %v", saleID, sale.EndTime)
+	}
+
+	// Deactivate all other sales first
+	s.forgetActiveSale()
+	if err := s.deactivateAllSales(ctx); err != nil {
+		return fmt.Errorf("failed to deactivate existing sales: %w", err)
+	}
+
+	// Activate sale in database (updated_at is handled by database triggers)
+	if err := s.db.ActivateSale(ctx, saleID); err != nil {
+		return fmt.Errorf("failed to activate sale in database: %w", err)
+	}
+	sale.Active = true
+
+	items, err := s.db.GetSaleItems(ctx, saleID)
+	if err != nil {
+		return fmt.Errorf("failed to get items for sale %d: %w", saleID, err)
+	}
+
 	// Setup sale in Redis
-	if err := s.redis.SetupSale(ctx, saleID, sale.ItemsAvailable); err != nil {
+	if err := s.redis.SetupSale(ctx, saleID, sale.ItemsAvailable, sale.MaxPerUser, remainingStock(items)); err != nil {
 		return fmt.Errorf("failed to setup sale in Redis: %w", err)
 	}
+	refreshSaleKeys(ctx, s.redis, sale)
 
 	log.Printf("Activated sale %d", saleID)
 	return nil
@@ -131,6 +349,8 @@ func (s *SaleServiceImpl) ActivateSale(ctx context.Context, saleID int) error {
 
 // DeactivateSale deactivates a specific sale
 func (s *SaleServiceImpl) DeactivateSale(ctx context.Context, saleID int) error {
+	s.forgetActiveSale()
+
 	// Deactivate in database
 	if err := s.db.DeactivateSale(ctx, saleID); err != nil {
 		return fmt.Errorf("failed to deactivate sale in database: %w", err)
@@ -149,6 +369,72 @@ func (s *SaleServiceImpl) DeactivateSale(ctx context.Context, saleID int) error
 	return nil
 }
 
+// ExtendSale moves the end time of an active sale later, as long as it does not run into
+// a scheduled sale window, and keeps the sale's Redis keys until after the new end time
+func (s *SaleServiceImpl) ExtendSale(ctx context.Context, saleID int, endTime time.Time) (*models.Sale, error) {
+	// 1. Only a running sale can be extended
+	sale, err := s.db.GetSaleByID(ctx, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sale %d: %w", saleID, err)
+	}
+
+	if sale == nil {
+		return nil, fmt.Errorf("sale %d not found", saleID)
+	}
+
+	if !sale.Active || !sale.EndTime.After(time.Now()) {
+		return nil, fmt.Errorf("%w: sale %d is inactive or ended at %v", ErrSaleNotExtendable, saleID, sale.EndTime)
+	}
+
+	if !endTime.After(sale.EndTime) {
+		return nil, fmt.Errorf("new end time %v must be after current end time %v", endTime, sale.EndTime)
+	}
+
+	// 2. The extended sale must end before the next scheduled window starts
+	windows, err := s.db.GetSaleWindowsByStatus(ctx, models.SaleWindowPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled sale windows: %w", err)
+	}
+
+	for _, window := range windows {
+		if window.StartTime.Before(endTime) && window.EndTime.After(sale.StartTime) {
+			return nil, fmt.Errorf("%w: window %d starts at %v", ErrSaleWindowOverlap, window.ID, window.StartTime)
+		}
+	}
+
+	// 3. Move the end time
+	if err := s.db.UpdateSaleEndTime(ctx, saleID, endTime); err != nil {
+		return nil, fmt.Errorf("failed to extend sale in database: %w", err)
+	}
+	sale.EndTime = endTime
+	s.forgetActiveSale()
+
+	// 4. Keep the sale's counters in Redis until after it ends
+	refreshSaleKeys(ctx, s.redis, sale)
+
+	log.Printf("Extended sale %d until %v", saleID, endTime)
+	return sale, nil
+}
+
+// refreshSaleKeys keeps the sale's Redis keys until SaleKeyTTL after it ends. Keys that
+// expire early are rebuilt from Postgres by the counter reconciler, so failures only warn.
+func refreshSaleKeys(ctx context.Context, redis interfaces.RedisInterface, sale *models.Sale) {
+	ttl := time.Until(sale.EndTime) + SaleKeyTTL
+	if err := redis.RefreshSaleTTL(ctx, sale.ID, ttl); err != nil {
+		log.Printf("Warning: failed to refresh Redis keys of sale %d: %v", sale.ID, err)
+	}
+}
+
+// ListSales returns the most recent sales, newest first
+func (s *SaleServiceImpl) ListSales(ctx context.Context, limit int) ([]models.Sale, error) {
+	sales, err := s.db.ListSales(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sales: %w", err)
+	}
+
+	return sales, nil
+}
+
 // GetSaleStatus returns detailed status of a specific sale
 func (s *SaleServiceImpl) GetSaleStatus(ctx context.Context, saleID int) (*models.Sale, error) {
 	// Get sale from database
@@ -199,6 +485,41 @@ func (s *SaleServiceImpl) GetSaleItemsSold(ctx context.Context, saleID int) (int
 
 // Helper methods
 
+// cachedActiveSale returns a copy of the cached active sale if it is still fresh and
+// Redis still names it as the active sale, or nil
+func (s *SaleServiceImpl) cachedActiveSale(saleID int) *models.Sale {
+	s.activeSaleMu.RLock()
+	defer s.activeSaleMu.RUnlock()
+
+	if s.activeSale == nil || s.activeSale.ID != saleID || time.Since(s.activeSaleLoaded) >= s.activeSaleTTL {
+		return nil
+	}
+
+	sale := *s.activeSale
+	return &sale
+}
+
+// cacheActiveSale keeps a copy of the active sale for cachedActiveSale
+func (s *SaleServiceImpl) cacheActiveSale(sale *models.Sale) {
+	s.activeSaleMu.Lock()
+	defer s.activeSaleMu.Unlock()
+
+	if s.activeSaleTTL == 0 {
+		return
+	}
+
+	cached := *sale
+	s.activeSale = &cached
+	s.activeSaleLoaded = time.Now()
+}
+
+// forgetActiveSale drops the cached active sale after this replica changes a sale
+func (s *SaleServiceImpl) forgetActiveSale() {
+	s.activeSaleMu.Lock()
+	defer s.activeSaleMu.Unlock()
+	s.activeSale = nil
+}
+
 // deactivateAllSales deactivates all currently active sales
 func (s *SaleServiceImpl) deactivateAllSales(ctx context.Context) error {
 	// For now, we'll get the active sale and deactivate it
@@ -217,65 +538,90 @@ func (s *SaleServiceImpl) deactivateAllSales(ctx context.Context) error {
 	return nil
 }
 
-// syncSaleCounters ensures Redis and database counters are in sync
-func (s *SaleServiceImpl) syncSaleCounters(ctx context.Context, sale *models.Sale) {
-	// Get real-time count from Redis
-	soldItems, err := s.redis.GetSoldItems(ctx, sale.ID)
-	if err != nil {
-		log.Printf("Warning: failed to get sold items from Redis for sync: %v", err)
-		return
-	}
+// validateSaleItems checks that every sale item has an ID, positive stock and appears once
+func validateSaleItems(items []models.SaleItem) error {
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.ItemID == "" {
+			return fmt.Errorf("sale item ID cannot be empty")
+		}
+
+		if item.Stock <= 0 {
+			return fmt.Errorf("stock for item %s must be positive, got %d", item.ItemID, item.Stock)
+		}
 
-	// If Redis count differs significantly from database, update database
-	if abs(soldItems-sale.ItemsSold) > 10 { // Allow small discrepancy
-		if err := s.db.UpdateSaleItemsSold(ctx, sale.ID, soldItems); err != nil {
-			log.Printf("Warning: failed to sync database with Redis count: %v", err)
-		} else {
-			log.Printf("Synced database count for sale %d: %d -> %d", sale.ID, sale.ItemsSold, soldItems)
+		if seen[item.ItemID] {
+			return fmt.Errorf("duplicate sale item %s", item.ItemID)
 		}
+		seen[item.ItemID] = true
 	}
+
+	return nil
 }
 
-// abs returns the absolute value of an integer
-func abs(x int) int {
-	if x < 0 {
-		return -x
+// remainingStock converts sale items into the item ID -> stock map stored in Redis
+func remainingStock(items []models.SaleItem) map[string]int {
+	stock := make(map[string]int, len(items))
+	for _, item := range items {
+		stock[item.ItemID] = item.Stock - item.Sold
 	}
-	return x
+	return stock
 }
 
-// BackgroundSaleManager handles automatic sale lifecycle management
+// BackgroundSaleManager handles automatic sale lifecycle management.
+// It wakes at each schedule boundary and lets the SaleScheduler apply due transitions.
+// With a LeaderElector, only the elected replica drives the schedule; the others keep
+// campaigning so one of them takes over if the leader stops renewing its lease.
 type BackgroundSaleManager struct {
-	saleService interfaces.SaleService
-	stopChan    chan struct{}
+	scheduler *SaleScheduler
+	elector   *LeaderElector
+	stopChan  chan struct{}
 }
 
-// NewBackgroundSaleManager creates a new background sale manager
-func NewBackgroundSaleManager(saleService interfaces.SaleService) *BackgroundSaleManager {
+// NewBackgroundSaleManager creates a new background sale manager.
+// A nil elector makes this instance always drive the schedule (single-replica deployments).
+func NewBackgroundSaleManager(scheduler *SaleScheduler, elector *LeaderElector) *BackgroundSaleManager {
 	return &BackgroundSaleManager{
-		saleService: saleService,
-		stopChan:    make(chan struct{}),
+		scheduler: scheduler,
+		elector:   elector,
+		stopChan:  make(chan struct{}),
 	}
 }
 
 // Start begins the background sale management process
 func (bsm *BackgroundSaleManager) Start(ctx context.Context) {
 	log.Println("Starting background sale manager")
-	
-	// Create initial sale if none exists
-	go bsm.ensureActiveSale(ctx)
-	
-	// Set up hourly ticker for new sales
-	ticker := time.NewTicker(time.Hour)
-	defer ticker.Stop()
+	defer bsm.resign()
 
+	clock := bsm.scheduler.clock
 	for {
+		var wake time.Time
+		if bsm.lead(ctx) {
+			// Apply every due transition, including ones missed while no leader was running
+			next, err := bsm.scheduler.Reconcile(bsm.fenced(ctx))
+			if leadershipLost(err) {
+				// Our lease expired while we were paused and a newer leader has taken over
+				log.Printf("Warning: stopped reconciling sale schedule: %v", err)
+				bsm.elector.stepDown()
+			} else if err != nil {
+				log.Printf("Error reconciling sale schedule: %v", err)
+			}
+			wake = bsm.scheduler.NextWake(next)
+		}
+
+		// Renew the lease, or retry the campaign, before it could expire
+		if bsm.elector != nil {
+			wake = earliest(wake, clock.Now().Add(bsm.elector.RenewInterval()))
+		}
+
 		select {
-		case <-ticker.C:
-			go bsm.createNewHourlySale(ctx)
+		case <-clock.After(wake.Sub(clock.Now())):
 		case <-bsm.stopChan:
 			log.Println("Stopping background sale manager")
 			return
+		case <-ctx.Done():
+			log.Println("Stopping background sale manager")
+			return
 		}
 	}
 }
@@ -285,34 +631,35 @@ func (bsm *BackgroundSaleManager) Stop() {
 	close(bsm.stopChan)
 }
 
-// ensureActiveSale creates a sale if none is currently active
-func (bsm *BackgroundSaleManager) ensureActiveSale(ctx context.Context) {
-	activeSale, err := bsm.saleService.GetCurrentActiveSale(ctx)
+// lead reports whether this instance should drive the schedule right now
+func (bsm *BackgroundSaleManager) lead(ctx context.Context) bool {
+	if bsm.elector == nil {
+		return true
+	}
+
+	leading, err := bsm.elector.Campaign(ctx)
 	if err != nil {
-		log.Printf("Error checking for active sale: %v", err)
-		return
+		log.Printf("Warning: leader election failed: %v", err)
 	}
+	return leading
+}
 
-	if activeSale == nil {
-		log.Println("No active sale found, creating initial sale")
-		_, err := bsm.saleService.CreateHourlySale(ctx)
-		if err != nil {
-			log.Printf("Error creating initial sale: %v", err)
-		}
-	} else {
-		log.Printf("Found active sale %d", activeSale.ID)
+// fenced makes the scheduler's writes conditional on this instance still holding the
+// lease it won, so a leader that was paused past its lease cannot act next to its successor
+func (bsm *BackgroundSaleManager) fenced(ctx context.Context) context.Context {
+	if bsm.elector == nil {
+		return ctx
 	}
+	return interfaces.WithFence(ctx, bsm.elector.Fence())
 }
 
-// createNewHourlySale creates a new hourly sale (deactivating the previous one)
-func (bsm *BackgroundSaleManager) createNewHourlySale(ctx context.Context) {
-	log.Println("Creating new hourly sale")
-	
-	sale, err := bsm.saleService.CreateHourlySale(ctx)
-	if err != nil {
-		log.Printf("Error creating hourly sale: %v", err)
+// resign hands leadership to another replica when the manager stops
+func (bsm *BackgroundSaleManager) resign() {
+	if bsm.elector == nil {
 		return
 	}
 
-	log.Printf("Successfully created new sale %d", sale.ID)
-} 
\ No newline at end of file
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bsm.elector.Resign(ctx)
+}
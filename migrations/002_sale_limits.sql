@@ -0,0 +1,6 @@
+-- Per-sale purchase limits
+-- items_available already exists; max_per_user caps how many items one user may buy in a sale
+
+ALTER TABLE sales ADD COLUMN max_per_user INTEGER NOT NULL DEFAULT 10;
+
+ALTER TABLE sales ADD CONSTRAINT chk_max_per_user CHECK (max_per_user > 0);
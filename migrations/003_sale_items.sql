@@ -0,0 +1,22 @@
+-- Per-item inventory within a sale
+-- A sale with no rows here is unrestricted: any valid item may be bought up to the sale-wide cap
+
+CREATE TABLE sale_items (
+    sale_id INTEGER NOT NULL REFERENCES sales(id),
+    item_id VARCHAR(50) NOT NULL,
+    stock INTEGER NOT NULL,
+    sold INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    PRIMARY KEY (sale_id, item_id),
+    
+    -- Constraints
+    CONSTRAINT chk_sale_item_stock CHECK (stock >= 0),
+    CONSTRAINT chk_sale_item_sold CHECK (sold >= 0),
+    CONSTRAINT chk_sale_item_sold_limit CHECK (sold <= stock)
+);
+
+CREATE TRIGGER update_sale_items_updated_at 
+    BEFORE UPDATE ON sale_items
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,18 @@
+-- Audit trail for admin actions on sales
+
+CREATE TABLE admin_audit_log (
+    id SERIAL PRIMARY KEY,
+    actor VARCHAR(100) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    sale_id INTEGER REFERENCES sales(id),
+    success BOOLEAN NOT NULL,
+    details JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    -- Constraints
+    CONSTRAINT chk_audit_actor CHECK (LENGTH(actor) > 0),
+    CONSTRAINT chk_audit_action CHECK (LENGTH(action) > 0)
+);
+
+CREATE INDEX idx_audit_sale_created ON admin_audit_log(sale_id, created_at DESC);
+CREATE INDEX idx_audit_created ON admin_audit_log(created_at DESC);
@@ -0,0 +1,35 @@
+-- Scheduled sale windows
+-- Rows are created ahead of time by the recurring schedule rule or by operators, and the
+-- background sale manager moves them pending -> active -> completed at their boundaries.
+-- NULL limits fall back to the server's default sale limits.
+
+CREATE TABLE sale_windows (
+    id SERIAL PRIMARY KEY,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    items_available INTEGER,
+    max_per_user INTEGER,
+    sale_id INTEGER REFERENCES sales(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    source VARCHAR(20) NOT NULL DEFAULT 'manual',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    -- Constraints
+    CONSTRAINT chk_window_times CHECK (end_time > start_time),
+    CONSTRAINT chk_window_items_available CHECK (items_available IS NULL OR items_available > 0),
+    CONSTRAINT chk_window_max_per_user CHECK (max_per_user IS NULL OR max_per_user > 0),
+    CONSTRAINT chk_window_status CHECK (status IN ('pending', 'active', 'completed', 'missed', 'cancelled')),
+    CONSTRAINT chk_window_source CHECK (source IN ('rule', 'manual'))
+);
+
+-- The same window can only be scheduled once; a cancelled window keeps its slot so the
+-- recurring rule does not recreate it
+CREATE UNIQUE INDEX idx_sale_windows_unique ON sale_windows(start_time, end_time);
+
+-- Index for the manager's pending/active lookups
+CREATE INDEX idx_sale_windows_status_start ON sale_windows(status, start_time);
+
+CREATE TRIGGER update_sale_windows_updated_at 
+    BEFORE UPDATE ON sale_windows
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
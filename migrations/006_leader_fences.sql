@@ -0,0 +1,13 @@
+-- Fencing tokens for leader election
+-- The leader of each named role records its Redis lease token here before acting.
+-- A lower token is rejected, so a leader whose lease expired cannot keep making changes
+-- after another instance has taken over.
+
+CREATE TABLE leader_fences (
+    name VARCHAR(50) PRIMARY KEY,
+    token BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    
+    -- Constraints
+    CONSTRAINT chk_fence_token CHECK (token > 0)
+);
@@ -0,0 +1,6 @@
+-- Index for expiring checkout attempts
+-- The checkout expiry sweeper marks pending attempts past expires_at as 'expired' in
+-- batches, oldest first; only pending rows are ever scanned.
+
+CREATE INDEX CONCURRENTLY idx_checkout_pending_expiry ON checkout_attempts(expires_at)
+    WHERE status = 'pending';
@@ -0,0 +1,31 @@
+-- One purchase per checkout code
+-- Write-behind persistence delivers purchases at least once; the unique code makes
+-- a redelivered purchase a no-op (INSERT ... ON CONFLICT (code) DO NOTHING).
+--
+-- Servers from before this migration could record a code twice. Those duplicates are
+-- not removed automatically, since each one was also counted in sales.items_sold and
+-- sale_items.sold. The check below stops the migration and lists them instead. To clean
+-- up, for each listed code keep the earliest purchase, delete the others, and subtract
+-- the deleted rows from the sale's items_sold and the item's sold count. Then run the
+-- migration again.
+
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(code || ' (' || copies || ' purchases)', ', ')
+    INTO duplicates
+    FROM (
+        SELECT code, COUNT(*) AS copies
+        FROM purchases
+        GROUP BY code
+        HAVING COUNT(*) > 1
+        ORDER BY code
+    ) duplicated;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'purchases has duplicate checkout codes, clean them up before adding idx_purchases_code: %', duplicates;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX CONCURRENTLY idx_purchases_code ON purchases(code);
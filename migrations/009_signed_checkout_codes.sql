@@ -0,0 +1,6 @@
+-- Room for signed checkout codes
+-- Checkout codes carry the sale, user and item IDs, expiry and a signature, so they can
+-- be longer than the old random codes. Widening a VARCHAR does not rewrite the table.
+
+ALTER TABLE checkout_attempts ALTER COLUMN code TYPE VARCHAR(512);
+ALTER TABLE purchases ALTER COLUMN code TYPE VARCHAR(512);
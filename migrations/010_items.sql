@@ -0,0 +1,21 @@
+-- Item catalog shared by every server instance
+-- Items used to be generated in memory by each instance, so replicas could quote different
+-- prices for the same item ID. Seed this table with `go run ./cmd/seeditems`.
+
+CREATE TABLE items (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    -- Constraints
+    CONSTRAINT chk_item_id_length CHECK (LENGTH(id) >= 3),
+    CONSTRAINT chk_item_name CHECK (LENGTH(name) > 0),
+    CONSTRAINT chk_item_price CHECK (price >= 0)
+);
+
+CREATE TRIGGER update_items_updated_at
+    BEFORE UPDATE ON items
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+-- Soft retirement of catalog items
+-- Retired items stay in the catalog so purchases of already issued checkout codes can
+-- still be completed, but new checkouts for them are refused.
+
+ALTER TABLE items ADD COLUMN retired_at TIMESTAMP WITH TIME ZONE;
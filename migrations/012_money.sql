@@ -0,0 +1,16 @@
+-- Prices as integer minor units with an ISO 4217 currency code
+-- Every price stored so far is in USD with 2 decimals, so it converts to cents exactly.
+-- The columns are renamed so nothing reads the new amounts as decimal dollars.
+
+ALTER TABLE items RENAME COLUMN price TO price_minor;
+ALTER TABLE items ALTER COLUMN price_minor TYPE BIGINT USING ROUND(price_minor * 100);
+ALTER TABLE items ADD COLUMN price_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE items ALTER COLUMN price_currency DROP DEFAULT;
+
+ALTER TABLE purchases RENAME COLUMN price TO price_minor;
+ALTER TABLE purchases ALTER COLUMN price_minor TYPE BIGINT USING ROUND(price_minor * 100);
+ALTER TABLE purchases ADD COLUMN price_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE purchases ALTER COLUMN price_currency DROP DEFAULT;
+
+ALTER TABLE items ADD CONSTRAINT chk_item_price_currency CHECK (price_currency ~ '^[A-Z]{3}$');
+ALTER TABLE purchases ADD CONSTRAINT chk_purchase_price_currency CHECK (price_currency ~ '^[A-Z]{3}$');
@@ -0,0 +1,6 @@
+-- Shared purchase-limit fallback flag
+-- Set when a replica starts enforcing a sale's purchase limits in Postgres because Redis is
+-- unavailable. Every replica checks it before using Redis, so all of them count the sale in
+-- the same store until its Redis counters are rebuilt from Postgres and the flag is cleared.
+
+ALTER TABLE sales ADD COLUMN purchase_fallback BOOLEAN NOT NULL DEFAULT false;
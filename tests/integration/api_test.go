@@ -40,11 +40,14 @@ func TestFullAPIFlow(t *testing.T) {
 
 	// Initialize services
 	saleService := services.NewSaleService(db, redisClient)
-	itemService := services.NewItemService()
+	itemService := services.NewItemService(db)
+	if _, err := itemService.SeedCatalog(context.Background(), []string{"item1"}); err != nil {
+		t.Fatalf("Failed to seed test items: %v", err)
+	}
 
 	// Initialize handlers
-	checkoutHandler := handlers.NewCheckoutHandler(saleService, itemService, db, redisClient)
-	purchaseHandler := handlers.NewPurchaseHandler(saleService, itemService, db, redisClient)
+	checkoutHandler := handlers.NewCheckoutHandler(services.NewCheckoutService(saleService, itemService, db, redisClient))
+	purchaseHandler := handlers.NewPurchaseHandler(services.NewPurchaseService(saleService, itemService, db, redisClient))
 
 	// Create a test sale
 	sale, err := saleService.CreateHourlySale(context.Background())
@@ -130,8 +133,11 @@ func TestConcurrentCheckouts(t *testing.T) {
 	defer redisClient.Close()
 
 	saleService := services.NewSaleService(db, redisClient)
-	itemService := services.NewItemService()
-	checkoutHandler := handlers.NewCheckoutHandler(saleService, itemService, db, redisClient)
+	itemService := services.NewItemService(db)
+	if _, err := itemService.SeedCatalog(context.Background(), []string{"item1"}); err != nil {
+		t.Fatalf("Failed to seed test items: %v", err)
+	}
+	checkoutHandler := handlers.NewCheckoutHandler(services.NewCheckoutService(saleService, itemService, db, redisClient))
 
 	// Create a test sale
 	sale, err := saleService.CreateHourlySale(context.Background())
@@ -193,9 +199,16 @@ func TestUserPurchaseLimit(t *testing.T) {
 	defer redisClient.Close()
 
 	saleService := services.NewSaleService(db, redisClient)
-	itemService := services.NewItemService()
-	checkoutHandler := handlers.NewCheckoutHandler(saleService, itemService, db, redisClient)
-	purchaseHandler := handlers.NewPurchaseHandler(saleService, itemService, db, redisClient)
+	itemService := services.NewItemService(db)
+	itemIDs := make([]string, 11)
+	for i := range itemIDs {
+		itemIDs[i] = fmt.Sprintf("item%d", i+1)
+	}
+	if _, err := itemService.SeedCatalog(context.Background(), itemIDs); err != nil {
+		t.Fatalf("Failed to seed test items: %v", err)
+	}
+	checkoutHandler := handlers.NewCheckoutHandler(services.NewCheckoutService(saleService, itemService, db, redisClient))
+	purchaseHandler := handlers.NewPurchaseHandler(services.NewPurchaseService(saleService, itemService, db, redisClient))
 
 	// Create a test sale
 	sale, err := saleService.CreateHourlySale(context.Background())
@@ -237,11 +237,14 @@ func setupLoadTest(tb testing.TB, config *LoadTestConfig) (*database.PostgresDB,
 
 	// Initialize services
 	saleService := services.NewSaleService(db, redisClient)
-	itemService := services.NewItemService()
+	itemService := services.NewItemService(db)
+	if _, err := itemService.SeedCatalog(context.Background(), []string{"item1"}); err != nil {
+		tb.Fatalf("Failed to seed test items: %v", err)
+	}
 
 	// Initialize handlers
-	checkoutHandler := handlers.NewCheckoutHandler(saleService, itemService, db, redisClient)
-	purchaseHandler := handlers.NewPurchaseHandler(saleService, itemService, db, redisClient)
+	checkoutHandler := handlers.NewCheckoutHandler(services.NewCheckoutService(saleService, itemService, db, redisClient))
+	purchaseHandler := handlers.NewPurchaseHandler(services.NewPurchaseService(saleService, itemService, db, redisClient))
 
 	// Create a test sale
 	sale, err := saleService.CreateHourlySale(context.Background())
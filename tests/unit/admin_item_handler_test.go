@@ -0,0 +1,85 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func adminItemRequest(t *testing.T, handler *handlers.AdminItemHandler, method, path string, body interface{}) (*httptest.ResponseRecorder, handlers.AdminItemResponse) {
+	var response handlers.AdminItemResponse
+	w := adminCall(t, handler.HandleItems, method, path, body, &response)
+	return w, response
+}
+
+func TestAdminItemHandler_ManagesItems(t *testing.T) {
+	mockDB := NewMockDatabase()
+	itemService := services.NewItemService(mockDB)
+	itemService.SetCacheInvalidation(NewMockRedis(t))
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	handler := handlers.NewAdminItemHandler(itemService, auth)
+
+	// Create
+	w, response := adminItemRequest(t, handler, "POST", "/admin/items", map[string]interface{}{"id": "item1", "name": "Widget", "price": 10})
+	if w.Code != http.StatusCreated || response.Item == nil || response.Item.Name != "Widget" {
+		t.Fatalf("Expected the item to be created, got %d %+v", w.Code, response)
+	}
+	if w, _ := adminItemRequest(t, handler, "POST", "/admin/items", map[string]interface{}{"id": "item1", "name": "Again", "price": 1}); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an existing item, got: %d", w.Code)
+	}
+	if w, _ := adminItemRequest(t, handler, "POST", "/admin/items", map[string]interface{}{"id": "item2", "name": "Cheap", "price": 0.001}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a fractional cent price, got: %d", w.Code)
+	}
+	unsupported := map[string]interface{}{"id": "item2", "name": "Gadget", "price": map[string]interface{}{"amount": 2000, "currency": "XYZ"}}
+	if w, _ := adminItemRequest(t, handler, "POST", "/admin/items", unsupported); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsupported currency, got: %d", w.Code)
+	}
+	adminItemRequest(t, handler, "POST", "/admin/items", map[string]interface{}{"id": "item2", "name": "Gadget", "price": 20})
+
+	// Update and bulk price change
+	w, response = adminItemRequest(t, handler, "PUT", "/admin/items/item1", map[string]interface{}{"name": "Widget Pro", "description": "Improved", "price": 12.5})
+	if w.Code != http.StatusOK || response.Item.Name != "Widget Pro" || response.Item.Price != models.NewMoney(1250, "USD") {
+		t.Errorf("Expected the item to be updated, got %d %+v", w.Code, response)
+	}
+	prices := map[string]interface{}{"prices": []models.ItemPrice{{ItemID: "item1", Price: models.NewMoney(1100, "USD")}, {ItemID: "item2", Price: models.NewMoney(1900, "USD")}}}
+	w, response = adminItemRequest(t, handler, "PATCH", "/admin/items", prices)
+	if w.Code != http.StatusOK || len(response.Items) != 2 || response.Items[1].Price != models.NewMoney(1900, "USD") {
+		t.Errorf("Expected both prices to change, got %d %+v", w.Code, response)
+	}
+	unknown := map[string]interface{}{"prices": []models.ItemPrice{{ItemID: "item1", Price: models.NewMoney(100, "USD")}, {ItemID: "missing", Price: models.NewMoney(100, "USD")}}}
+	if w, _ := adminItemRequest(t, handler, "PATCH", "/admin/items", unknown); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a bulk update with an unknown item, got: %d", w.Code)
+	}
+	if item, _ := mockDB.GetItemByID(context.Background(), "item1"); item.Price.Amount != 1100 {
+		t.Errorf("Expected a failed bulk update to change no price, got %v", item.Price)
+	}
+
+	// Retire
+	w, response = adminItemRequest(t, handler, "POST", "/admin/items/item2/retire", nil)
+	if w.Code != http.StatusOK || response.Item.RetiredAt == nil {
+		t.Errorf("Expected the item to be retired, got %d %+v", w.Code, response)
+	}
+	if w, _ := adminItemRequest(t, handler, "POST", "/admin/items/item2/retire", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a retired item, got: %d", w.Code)
+	}
+	if _, response := adminItemRequest(t, handler, "GET", "/admin/items", nil); len(response.Items) != 1 {
+		t.Errorf("Expected retired items to be hidden by default, got %+v", response.Items)
+	}
+	if _, response := adminItemRequest(t, handler, "GET", "/admin/items?include_retired=true", nil); len(response.Items) != 2 {
+		t.Errorf("Expected retired items to be listed on request, got %+v", response.Items)
+	}
+	if w, _ := adminItemRequest(t, handler, "GET", "/admin/items/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown item, got: %d", w.Code)
+	}
+
+	entries := mockDB.AuditEntries()
+	if len(entries) != 9 || entries[0].Action != handlers.AuditActionCreateItem || entries[7].Action != handlers.AuditActionRetireItem {
+		t.Errorf("Expected every item change to be audited, got %+v", entries)
+	}
+}
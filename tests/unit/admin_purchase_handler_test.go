@@ -0,0 +1,62 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func adminPurchaseRequest(t *testing.T, handler *handlers.AdminPurchaseHandler, method, path string, body interface{}) (*httptest.ResponseRecorder, handlers.AdminPurchaseResponse) {
+	var response handlers.AdminPurchaseResponse
+	w := adminCall(t, handler.HandlePurchases, method, path, body, &response)
+	return w, response
+}
+
+func TestAdminPurchaseHandler_RefundsPurchase(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 10, 2, 5)
+	saleID := mockSaleService.currentSale.ID
+	service := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	addCheckout(mockDB, "CODE1", "user1")
+	if _, err := service.ProcessPurchase(context.Background(), "CODE1", "user1"); err != nil {
+		t.Fatalf("Failed to purchase: %v", err)
+	}
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+
+	// Unavailable without a refunder
+	unavailable := handlers.NewAdminPurchaseHandler(nil, auth)
+	if w, _ := adminPurchaseRequest(t, unavailable, "POST", "/admin/purchases/CODE1/refund", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without a refunder, got: %d", w.Code)
+	}
+	handler := handlers.NewAdminPurchaseHandler(service, auth)
+
+	w, response := adminPurchaseRequest(t, handler, "POST", "/admin/purchases/CODE1/refund", map[string]string{"reason": "customer request"})
+	if w.Code != http.StatusOK || response.Purchase == nil || response.Purchase.Status != models.PurchaseStatusRefunded {
+		t.Fatalf("Expected the purchase to be refunded, got %d %+v", w.Code, response)
+	}
+
+	if w, _ := adminPurchaseRequest(t, handler, "POST", "/admin/purchases/CODE1/cancel", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a refunded purchase, got: %d", w.Code)
+	}
+	if w, _ := adminPurchaseRequest(t, handler, "POST", "/admin/purchases/MISSING/refund", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown code, got: %d", w.Code)
+	}
+	if w, _ := adminPurchaseRequest(t, handler, "GET", "/admin/purchases/CODE1/refund", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got: %d", w.Code)
+	}
+
+	entries := mockDB.AuditEntries()
+	refund := entries[0]
+	if refund.Action != handlers.AuditActionRefundPurchase || !refund.Success || refund.SaleID != saleID || !strings.Contains(refund.Details, "customer request") {
+		t.Errorf("Expected a successful refund audit entry with the reason, got %+v", refund)
+	}
+	if len(entries) != 3 || entries[1].Success || entries[2].Success {
+		t.Errorf("Expected failed reversals to be audited, got %+v", entries)
+	}
+}
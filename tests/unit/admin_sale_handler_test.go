@@ -0,0 +1,466 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+const (
+	testAdminToken    = "test-admin-token"
+	testOperatorToken = "test-operator-token"
+)
+
+func adminRequest(t *testing.T, handler *handlers.AdminSaleHandler, method, path string, body interface{}) (*httptest.ResponseRecorder, handlers.AdminSaleResponse) {
+	handle := handler.HandleSales
+	if strings.HasPrefix(path, "/admin/schedule") {
+		handle = handler.HandleSchedule
+	}
+
+	var response handlers.AdminSaleResponse
+	w := adminCall(t, handle, method, path, body, &response)
+	return w, response
+}
+
+// adminCall sends an operator request to an admin handler and decodes its JSON response
+func adminCall(t *testing.T, handle http.HandlerFunc, method, path string, body interface{}, response interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testOperatorToken)
+	w := httptest.NewRecorder()
+
+	handle(w, req)
+
+	if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return w
+}
+
+func TestAdminSaleHandler_RequiresToken(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, services.RealClock{}, services.ScheduleRule{})
+	handler := handlers.NewAdminSaleHandler(saleService, scheduler, mockDB, mockRedis, auth)
+
+	testCases := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", ""},
+		{"wrong token", "Bearer wrong"},
+		{"wrong scheme", "Basic " + testAdminToken},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/sales", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.HandleSales(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401, got %d", w.Code)
+			}
+		})
+	}
+
+	// An unconfigured token disables the admin API entirely
+	disabled := handlers.NewAdminSaleHandler(nil, nil, nil, nil, handlers.NewAdminAuth(nil, ""))
+	req := httptest.NewRequest(http.MethodGet, "/admin/sales", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	disabled.HandleSales(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with no admin token configured, got %d", w.Code)
+	}
+}
+
+func TestAdminSaleHandler_AuditsActorFromToken(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, services.RealClock{}, services.ScheduleRule{})
+	handler := handlers.NewAdminSaleHandler(saleService, scheduler, mockDB, mockRedis, auth)
+
+	// The shared token is audited as "admin"; X-Admin-User is only recorded as a claim
+	req := httptest.NewRequest(http.MethodPost, "/admin/schedule/99/cancel", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	req.Header.Set("X-Admin-User", "someone-else@example.com")
+	w := httptest.NewRecorder()
+	handler.HandleSchedule(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 for a missing window, got %d", w.Code)
+	}
+
+	// An operator token is audited under the operator's name, whatever the header claims
+	req = httptest.NewRequest(http.MethodPost, "/admin/schedule/99/cancel", nil)
+	req.Header.Set("Authorization", "Bearer "+testOperatorToken)
+	req.Header.Set("X-Admin-User", "someone-else@example.com")
+	handler.HandleSchedule(httptest.NewRecorder(), req)
+
+	entries := mockDB.AuditEntries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d: %+v", len(entries), entries)
+	}
+	if entries[0].Actor != "admin" || entries[1].Actor != "ops@example.com" {
+		t.Errorf("Expected actors admin and ops@example.com, got %s and %s", entries[0].Actor, entries[1].Actor)
+	}
+	for i, entry := range entries {
+		var details map[string]interface{}
+		if err := json.Unmarshal([]byte(entry.Details), &details); err != nil {
+			t.Fatalf("Audit entry %d: failed to decode details: %v", i, err)
+		}
+		if details["claimed_user"] != "someone-else@example.com" {
+			t.Errorf("Audit entry %d: expected the header as claimed_user, got %v", i, details["claimed_user"])
+		}
+	}
+}
+
+func TestAdminSaleHandler_ParseOperatorTokens(t *testing.T) {
+	tokens, err := handlers.ParseOperatorTokens(" alice=token1, bob=token2 ,")
+	if err != nil {
+		t.Fatalf("Failed to parse operator tokens: %v", err)
+	}
+	if len(tokens) != 2 || tokens["alice"] != "token1" || tokens["bob"] != "token2" {
+		t.Errorf("Unexpected operator tokens: %v", tokens)
+	}
+
+	for _, spec := range []string{"alice", "=token1", "alice=", "alice=token1,alice=token2", "alice=token1,bob=token1"} {
+		if _, err := handlers.ParseOperatorTokens(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestAdminSaleHandler_Lifecycle(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, services.RealClock{}, services.ScheduleRule{})
+	handler := handlers.NewAdminSaleHandler(saleService, scheduler, mockDB, mockRedis, auth)
+	ctx := context.Background()
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	end := start.Add(30 * time.Minute)
+
+	// Create an inactive sale with custom limits
+	w, resp := adminRequest(t, handler, http.MethodPost, "/admin/sales", handlers.AdminCreateSaleRequest{
+		StartTime:      start,
+		EndTime:        end,
+		ItemsAvailable: 50,
+		MaxPerUser:     2,
+		Items:          []models.SaleItem{{ItemID: "item1", Stock: 30}, {ItemID: "item2", Stock: 20}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, resp.Error)
+	}
+	saleID := resp.Sale.ID
+	if resp.Sale.Active || resp.Sale.MaxPerUser != 2 || resp.Sale.ItemsAvailable != 50 {
+		t.Errorf("Unexpected created sale: %+v", resp.Sale)
+	}
+
+	// Inactive sales are not set up in Redis
+	if result, _ := mockRedis.AttemptPurchase(ctx, saleID, "user1", "item1", "code0", nil); result.Status != "sale_not_active" {
+		t.Errorf("Expected sale_not_active before activation, got %s", result.Status)
+	}
+
+	// Activate
+	w, resp = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/activate", saleID), nil)
+	if w.Code != http.StatusOK || !resp.Sale.Active {
+		t.Fatalf("Expected activation to succeed, got %d: %s", w.Code, resp.Error)
+	}
+
+	// Activating twice would reset live counters, so it is rejected
+	w, _ = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/activate", saleID), nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for re-activation, got %d", w.Code)
+	}
+
+	// Sell one item and inspect live counters
+	if result, err := mockRedis.AttemptPurchase(ctx, saleID, "user1", "item1", "code1", nil); err != nil || result.Status != "success" {
+		t.Fatalf("Expected purchase to succeed, got %+v, %v", result, err)
+	}
+
+	w, resp = adminRequest(t, handler, http.MethodGet, fmt.Sprintf("/admin/sales/%d", saleID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, resp.Error)
+	}
+	if resp.Live == nil || resp.Live.ItemsSold != 1 || resp.Live.ActiveSaleID != saleID {
+		t.Errorf("Unexpected live counters: %+v", resp.Live)
+	}
+	if resp.Live != nil && (resp.Live.ItemStock["item1"] != 29 || resp.Live.ItemStock["item2"] != 20) {
+		t.Errorf("Unexpected live item stock: %v", resp.Live.ItemStock)
+	}
+	if len(resp.Items) != 2 {
+		t.Errorf("Expected 2 sale items, got %d", len(resp.Items))
+	}
+
+	// Extend by duration, then reject an end time that moves backwards
+	w, resp = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/extend", saleID),
+		handlers.AdminExtendSaleRequest{ExtendBy: "15m"})
+	if w.Code != http.StatusOK || !resp.Sale.EndTime.Equal(end.Add(15*time.Minute)) {
+		t.Fatalf("Expected sale extended to %v, got %d: %+v", end.Add(15*time.Minute), w.Code, resp)
+	}
+
+	earlier := end
+	w, _ = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/extend", saleID),
+		handlers.AdminExtendSaleRequest{EndTime: &earlier})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for earlier end time, got %d", w.Code)
+	}
+
+	// Deactivate
+	w, resp = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/deactivate", saleID), nil)
+	if w.Code != http.StatusOK || resp.Sale.Active {
+		t.Fatalf("Expected deactivation to succeed, got %d: %s", w.Code, resp.Error)
+	}
+
+	// List
+	w, resp = adminRequest(t, handler, http.MethodGet, "/admin/sales?limit=10", nil)
+	if w.Code != http.StatusOK || len(resp.Sales) != 1 {
+		t.Errorf("Expected 1 listed sale, got %d: %+v", w.Code, resp.Sales)
+	}
+
+	// Every mutating action is audited, including rejected ones
+	expected := []struct {
+		action  string
+		success bool
+	}{
+		{handlers.AuditActionCreateSale, true},
+		{handlers.AuditActionActivateSale, true},
+		{handlers.AuditActionActivateSale, false},
+		{handlers.AuditActionExtendSale, true},
+		{handlers.AuditActionExtendSale, false},
+		{handlers.AuditActionDeactivateSale, true},
+	}
+
+	entries := mockDB.AuditEntries()
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d audit entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+	for i, want := range expected {
+		entry := entries[i]
+		if entry.Action != want.action || entry.Success != want.success || entry.SaleID != saleID {
+			t.Errorf("Audit entry %d: expected %s success=%t sale=%d, got %+v", i, want.action, want.success, saleID, entry)
+		}
+		if entry.Actor != "ops@example.com" {
+			t.Errorf("Audit entry %d: expected actor ops@example.com, got %s", i, entry.Actor)
+		}
+	}
+}
+
+func TestAdminSaleHandler_ExtendChecksSaleAndSchedule(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, services.RealClock{}, services.ScheduleRule{})
+	handler := handlers.NewAdminSaleHandler(saleService, scheduler, mockDB, mockRedis, auth)
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	end := start.Add(30 * time.Minute)
+	w, resp := adminRequest(t, handler, http.MethodPost, "/admin/sales", handlers.AdminCreateSaleRequest{
+		StartTime: start, EndTime: end, ItemsAvailable: 10, MaxPerUser: 1, Activate: true,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, resp.Error)
+	}
+	saleID := resp.Sale.ID
+
+	// Activation keeps the sale's Redis keys until SaleKeyTTL after it ends
+	activatedTTL := mockRedis.SaleTTL(saleID)
+	if activatedTTL < services.SaleKeyTTL {
+		t.Errorf("Expected Redis keys kept for at least %v, got %v", services.SaleKeyTTL, activatedTTL)
+	}
+
+	// Extending pushes the Redis key TTLs out with the end time
+	w, resp = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/extend", saleID),
+		handlers.AdminExtendSaleRequest{ExtendBy: "15m"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, resp.Error)
+	}
+	if extendedTTL := mockRedis.SaleTTL(saleID); extendedTTL < activatedTTL+14*time.Minute {
+		t.Errorf("Expected Redis key TTL extended by about 15m from %v, got %v", activatedTTL, extendedTTL)
+	}
+
+	// The sale cannot run into a scheduled window
+	windowStart := end.Add(30 * time.Minute)
+	w, resp = adminRequest(t, handler, http.MethodPost, "/admin/schedule", handlers.AdminScheduleRequest{
+		StartTime: windowStart, EndTime: windowStart.Add(time.Hour),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for schedule, got %d: %s", w.Code, resp.Error)
+	}
+	w, _ = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/extend", saleID),
+		handlers.AdminExtendSaleRequest{ExtendBy: "30m"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an extension into a scheduled window, got %d", w.Code)
+	}
+
+	// An inactive sale cannot be extended
+	if w, resp = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/deactivate", saleID), nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected deactivation to succeed, got %d: %s", w.Code, resp.Error)
+	}
+	w, _ = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/sales/%d/extend", saleID),
+		handlers.AdminExtendSaleRequest{ExtendBy: "5m"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an inactive sale, got %d", w.Code)
+	}
+}
+
+func TestAdminSaleHandler_Validation(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, services.RealClock{}, services.ScheduleRule{})
+	handler := handlers.NewAdminSaleHandler(saleService, scheduler, mockDB, mockRedis, auth)
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		body     interface{}
+		expected int
+	}{
+		{
+			name:   "end before start",
+			method: http.MethodPost,
+			path:   "/admin/sales",
+			body: handlers.AdminCreateSaleRequest{
+				StartTime: now, EndTime: now.Add(-time.Hour), ItemsAvailable: 10, MaxPerUser: 1,
+			},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:   "zero max per user",
+			method: http.MethodPost,
+			path:   "/admin/sales",
+			body: handlers.AdminCreateSaleRequest{
+				StartTime: now, EndTime: now.Add(time.Hour), ItemsAvailable: 10,
+			},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:   "duplicate items",
+			method: http.MethodPost,
+			path:   "/admin/sales",
+			body: handlers.AdminCreateSaleRequest{
+				StartTime: now, EndTime: now.Add(time.Hour), ItemsAvailable: 10, MaxPerUser: 1,
+				Items: []models.SaleItem{{ItemID: "item1", Stock: 5}, {ItemID: "item1", Stock: 5}},
+			},
+			expected: http.StatusBadRequest,
+		},
+		{"unknown sale", http.MethodGet, "/admin/sales/999", nil, http.StatusNotFound},
+		{"unknown action", http.MethodPost, "/admin/sales/1/explode", nil, http.StatusNotFound},
+		{"wrong method", http.MethodGet, "/admin/sales/1/activate", nil, http.StatusMethodNotAllowed},
+		{"bad limit", http.MethodGet, "/admin/sales?limit=0", nil, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, resp := adminRequest(t, handler, tc.method, tc.path, tc.body)
+			if w.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d: %s", tc.expected, w.Code, resp.Error)
+			}
+			if resp.Success {
+				t.Error("Expected success to be false")
+			}
+		})
+	}
+
+	// Rejected creates are audited without a sale ID
+	for _, entry := range mockDB.AuditEntries() {
+		if entry.Action != handlers.AuditActionCreateSale || entry.Success || entry.SaleID != 0 || entry.Details == "" {
+			t.Errorf("Unexpected audit entry for rejected create: %+v", entry)
+		}
+	}
+}
+
+func TestAdminSaleHandler_Schedule(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	auth := handlers.NewAdminAuth(mockDB, testAdminToken)
+	auth.SetOperatorTokens(map[string]string{"ops@example.com": testOperatorToken})
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, services.RealClock{}, services.ScheduleRule{})
+	handler := handlers.NewAdminSaleHandler(saleService, scheduler, mockDB, mockRedis, auth)
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	request := handlers.AdminScheduleRequest{StartTime: start, EndTime: start.Add(20 * time.Minute), MaxPerUser: 3}
+
+	w, resp := adminRequest(t, handler, http.MethodPost, "/admin/schedule", request)
+	if w.Code != http.StatusCreated || resp.Window == nil {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, resp.Error)
+	}
+	windowID := resp.Window.ID
+	if resp.Window.Status != models.SaleWindowPending || resp.Window.Source != models.SaleWindowSourceManual {
+		t.Errorf("Unexpected scheduled window: %+v", resp.Window)
+	}
+
+	// The same window cannot be scheduled twice
+	if w, _ = adminRequest(t, handler, http.MethodPost, "/admin/schedule", request); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for duplicate window, got %d", w.Code)
+	}
+
+	w, resp = adminRequest(t, handler, http.MethodGet, "/admin/schedule", nil)
+	if w.Code != http.StatusOK || len(resp.Windows) != 1 || resp.Windows[0].MaxPerUser != 3 {
+		t.Errorf("Expected the scheduled window to be listed, got %d: %+v", w.Code, resp.Windows)
+	}
+
+	// Cancel once; a second cancel finds nothing pending
+	if w, resp = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/schedule/%d/cancel", windowID), nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for cancel, got %d: %s", w.Code, resp.Error)
+	}
+	if w, _ = adminRequest(t, handler, http.MethodPost, fmt.Sprintf("/admin/schedule/%d/cancel", windowID), nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for second cancel, got %d", w.Code)
+	}
+
+	if windows := mockDB.SaleWindows(); len(windows) != 1 || windows[0].Status != models.SaleWindowCancelled {
+		t.Errorf("Expected the window to be cancelled, got %+v", windows)
+	}
+
+	entries := mockDB.AuditEntries()
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d", len(entries))
+	}
+	if entries[0].Action != handlers.AuditActionScheduleSale || !entries[0].Success ||
+		entries[2].Action != handlers.AuditActionCancelSchedule || !entries[2].Success {
+		t.Errorf("Unexpected audit entries: %+v", entries)
+	}
+}
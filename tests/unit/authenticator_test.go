@@ -0,0 +1,240 @@
+package unit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/services"
+)
+
+var testTokenSecret = bytes.Repeat([]byte("s"), services.MinSigningKeyBytes)
+
+// signToken builds a JWT with the given header and claims, signed by key
+// ([]byte for HS256, *rsa.PrivateKey for RS256, *ecdsa.PrivateKey for ES256)
+func signToken(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signingInput := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		signature = sig
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// userToken returns an HS256 token for userID that expires in an hour
+func userToken(t *testing.T, userID string) string {
+	return signToken(t,
+		map[string]interface{}{"alg": "HS256", "typ": "JWT"},
+		map[string]interface{}{"sub": userID, "exp": time.Now().Add(time.Hour).Unix()},
+		testTokenSecret)
+}
+
+func TestHMACAuthenticator_VerifiesTokens(t *testing.T) {
+	now := time.Now()
+	auth, err := services.NewHMACAuthenticator(testTokenSecret, "shop", "flash-sale", NewMockClock(now))
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	hs256 := map[string]interface{}{"alg": "HS256"}
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "user1", "iss": "shop", "aud": "flash-sale", "exp": now.Add(time.Minute).Unix()}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	userID, err := auth.VerifyToken(signToken(t, hs256, claims(nil), testTokenSecret))
+	if err != nil || userID != "user1" {
+		t.Fatalf("Expected user1, got %q, %v", userID, err)
+	}
+
+	if _, err := auth.VerifyToken(signToken(t, hs256, claims(map[string]interface{}{"aud": []string{"other", "flash-sale"}}), testTokenSecret)); err != nil {
+		t.Errorf("Expected an audience list containing flash-sale to be accepted, got: %v", err)
+	}
+
+	rejected := map[string]string{
+		"wrong secret":    signToken(t, hs256, claims(nil), bytes.Repeat([]byte("x"), 32)),
+		"alg none":        signToken(t, map[string]interface{}{"alg": "none"}, claims(nil), testTokenSecret),
+		"expired":         signToken(t, hs256, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), testTokenSecret),
+		"no expiry":       signToken(t, hs256, claims(map[string]interface{}{"exp": nil}), testTokenSecret),
+		"not yet valid":   signToken(t, hs256, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), testTokenSecret),
+		"wrong issuer":    signToken(t, hs256, claims(map[string]interface{}{"iss": "other"}), testTokenSecret),
+		"wrong audience":  signToken(t, hs256, claims(map[string]interface{}{"aud": "other"}), testTokenSecret),
+		"missing subject": signToken(t, hs256, claims(map[string]interface{}{"sub": nil}), testTokenSecret),
+		"malformed":       "not.a.token",
+	}
+	for name, token := range rejected {
+		if _, err := auth.VerifyToken(token); err == nil {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+
+	if _, err := services.NewHMACAuthenticator([]byte("short"), "", "", NewMockClock(now)); err == nil {
+		t.Error("Expected a short secret to be rejected")
+	}
+}
+
+func TestJWKSAuthenticator_VerifiesTokens(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	jwks := map[string]interface{}{"keys": []map[string]interface{}{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "ignored", "e": "ignored"},
+	}}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, data, 0o600)
+
+	auth, err := services.NewJWKSAuthenticator(path, "", "", NewMockClock(time.Now()))
+	if err != nil {
+		t.Fatalf("Failed to load JWKS: %v", err)
+	}
+
+	claims := map[string]interface{}{"sub": "user1", "exp": time.Now().Add(time.Minute).Unix()}
+	for _, token := range []string{
+		signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}, claims, rsaKey),
+		signToken(t, map[string]interface{}{"alg": "ES256", "kid": "ec-1"}, claims, ecKey),
+	} {
+		if userID, err := auth.VerifyToken(token); err != nil || userID != "user1" {
+			t.Errorf("Expected user1, got %q, %v", userID, err)
+		}
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rejected := map[string]string{
+		"unknown kid":      signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-2"}, claims, rsaKey),
+		"wrong key":        signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}, claims, otherKey),
+		"algorithm switch": signToken(t, map[string]interface{}{"alg": "ES256", "kid": "rsa-1"}, claims, ecKey),
+		"no kid":           signToken(t, map[string]interface{}{"alg": "RS256"}, claims, rsaKey),
+	}
+	for name, token := range rejected {
+		if _, err := auth.VerifyToken(token); err == nil {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+}
+
+func TestHandlers_BindPurchaseToAuthenticatedUser(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutHandler, purchaseHandler := handlers.NewCheckoutHandler(checkoutService), handlers.NewPurchaseHandler(purchaseService)
+	auth, _ := services.NewHMACAuthenticator(testTokenSecret, "", "", NewMockClock(time.Now()))
+	checkoutHandler.SetAuthenticator(auth)
+	purchaseHandler.SetAuthenticator(auth)
+
+	request := func(handler http.HandlerFunc, target, token string, body string) (int, string) {
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	// Checkout requires a token and takes the user from it
+	if status, _ := request(checkoutHandler.HandleCheckout, "/checkout?item_id=item1", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got: %d", status)
+	}
+
+	if status, _ := request(checkoutHandler.HandleCheckout, "/checkout?user_id=user2&item_id=item1", userToken(t, "user1"), ""); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for another user's user_id, got: %d", status)
+	}
+
+	status, body := request(checkoutHandler.HandleCheckout, "/checkout?item_id=item1", userToken(t, "user1"), "")
+	var response handlers.CheckoutResponse
+	json.Unmarshal([]byte(body), &response)
+	if status != http.StatusOK {
+		t.Fatalf("Expected checkout for the token's user, got %d %s", status, body)
+	}
+
+	// Only the user who created the checkout can complete it
+	purchaseBody := `{"checkout_code":"` + response.CheckoutCode + `"}`
+	if status, _ := request(purchaseHandler.HandlePurchase, "/purchase", "", purchaseBody); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got: %d", status)
+	}
+
+	status, body = request(purchaseHandler.HandlePurchase, "/purchase", userToken(t, "user2"), purchaseBody)
+	if status != http.StatusForbidden || !strings.Contains(body, handlers.ErrorCodeForbidden) {
+		t.Errorf("Expected 403 for another user, got %d %s", status, body)
+	}
+
+	if status, body := request(purchaseHandler.HandlePurchase, "/purchase", userToken(t, "user1"), purchaseBody); status != http.StatusOK {
+		t.Errorf("Expected the checkout's owner to complete the purchase, got %d %s", status, body)
+	}
+}
+
+func TestHandlers_SignedCodeOwnerCheckedBeforeLookup(t *testing.T) {
+	signer := newTestSigner(t, "k1")
+	auth, _ := services.NewHMACAuthenticator(testTokenSecret, "", "", NewMockClock(time.Now()))
+
+	// No services, database or Redis: reaching one would panic
+	offlineService := services.NewPurchaseService(nil, nil, nil, nil)
+	offlineService.SetCodeSigner(signer)
+	offline := handlers.NewPurchaseHandler(offlineService)
+	offline.SetAuthenticator(auth)
+
+	code := mustSign(t, signer)
+	req := httptest.NewRequest("POST", "/purchase?code="+code, nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, "user2"))
+	w := httptest.NewRecorder()
+
+	offline.HandlePurchase(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected another user's signed code to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,127 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func TestCatalogImporter_AppliesOnlyChanges(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	mockDB.CreateItems(ctx, []models.Item{{ID: "item1", Name: "Widget", Price: models.NewMoney(1000, "USD")}})
+
+	sale := &models.Sale{StartTime: time.Now().Add(time.Hour), EndTime: time.Now().Add(2 * time.Hour), ItemsAvailable: 100, MaxPerUser: 2}
+	mockDB.CreateSale(ctx, sale)
+
+	importer := services.NewCatalogImporter(mockDB, services.NewItemService(mockDB))
+	csvFor := func(stock int) string {
+		return "id,name,description,price,sale_id,stock\n" +
+			fmt.Sprintf("item1,Widget,,12.50,%d,%d\n", sale.ID, stock) +
+			fmt.Sprintf("item6,Gadget,Limited edition,99.99,%d,10\n", sale.ID) +
+			"item7,Gizmo,,5,,\n"
+	}
+
+	// A dry run only plans the changes
+	changes := planCSV(t, importer, csvFor(40))
+	if kinds := changeKinds(changes); kinds != "update_item create_item create_item create_allocation create_allocation" {
+		t.Fatalf("Unexpected changes: %s", kinds)
+	}
+	if item, _ := mockDB.GetItemByID(ctx, "item6"); item != nil {
+		t.Fatal("Expected planning to leave the catalog alone")
+	}
+
+	if applied, err := importer.Apply(ctx, changes); err != nil || applied != len(changes) {
+		t.Fatalf("Expected every change to apply, got %d, %v", applied, err)
+	}
+
+	// Importing the same line-up again changes nothing
+	if changes := planCSV(t, importer, csvFor(40)); len(changes) != 0 {
+		t.Errorf("Expected no changes on re-import, got: %s", changeKinds(changes))
+	}
+
+	// Only the changed stock is applied
+	changes = planCSV(t, importer, csvFor(55))
+	if len(changes) != 1 || changes[0].String() != fmt.Sprintf("~ sale %d item item1: stock 40 -> 55", sale.ID) {
+		t.Fatalf("Expected one stock change, got: %v", changes)
+	}
+	importer.Apply(ctx, changes)
+
+	// An export of the catalog imports back without changes
+	var exported bytes.Buffer
+	if err := importer.Export(ctx, &exported, sale.ID, false); err != nil {
+		t.Fatalf("Failed to export catalog: %v", err)
+	}
+	if changes := planCSV(t, importer, exported.String()); len(changes) != 0 {
+		t.Errorf("Expected the export to match the catalog, got: %s\n%s", changeKinds(changes), exported.String())
+	}
+}
+
+func TestCatalogImporter_RejectsInvalidImports(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	mockDB.CreateItems(ctx, []models.Item{{ID: "item1", Name: "Widget", Price: models.NewMoney(1000, "USD")}})
+
+	active := &models.Sale{StartTime: time.Now(), EndTime: time.Now().Add(time.Hour), ItemsAvailable: 100, MaxPerUser: 2, Active: true}
+	mockDB.CreateSale(ctx, active)
+
+	importer := services.NewCatalogImporter(mockDB, services.NewItemService(mockDB))
+
+	// Every problem is reported, and nothing is planned
+	catalog := &services.CatalogImport{
+		Items: []models.Item{
+			{ID: "bad id!", Name: "Broken", Price: models.NewMoney(100, "USD")},
+			{ID: "item1", Name: "Widget", Price: models.NewMoney(800, "USD")},
+			{ID: "item2", Name: "", Price: models.NewMoney(100, "USD")},
+		},
+		Allocations: []models.SaleItem{{SaleID: active.ID, ItemID: "item1", Stock: 5}},
+	}
+	changes, err := importer.Plan(ctx, catalog)
+	if err == nil || changes != nil {
+		t.Fatalf("Expected the import to be rejected, got %v", changes)
+	}
+	for _, expected := range []error{services.ErrInvalidItem, services.ErrItemPriceLocked, services.ErrSaleAllocationLocked} {
+		if !errors.Is(err, expected) {
+			t.Errorf("Expected the rejection to include %v, got: %v", expected, err)
+		}
+	}
+
+	// Repeated rows for an item must agree
+	repeated := "id,name,price,sale_id,stock\nitem1,Widget,10,1,5\nitem1,Widget,11,2,5\n"
+	if _, err := services.ParseCatalogCSV(strings.NewReader(repeated)); err == nil || !strings.Contains(err.Error(), "row 3") {
+		t.Errorf("Expected row 3 to be rejected, got: %v", err)
+	}
+	if _, err := services.ParseCatalogCSV(strings.NewReader("id,name\nitem1,Widget\n")); err == nil {
+		t.Error("Expected a CSV without prices to be rejected")
+	}
+}
+
+// planCSV parses a catalog CSV and plans its import
+func planCSV(t *testing.T, importer *services.CatalogImporter, text string) []services.CatalogChange {
+	t.Helper()
+	catalog, err := services.ParseCatalogCSV(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Failed to parse catalog CSV: %v", err)
+	}
+	changes, err := importer.Plan(context.Background(), catalog)
+	if err != nil {
+		t.Fatalf("Failed to plan import: %v", err)
+	}
+	return changes
+}
+
+// changeKinds lists the kinds of the changes, in order
+func changeKinds(changes []services.CatalogChange) string {
+	kinds := make([]string, len(changes))
+	for idx, change := range changes {
+		kinds[idx] = string(change.Kind)
+	}
+	return strings.Join(kinds, " ")
+}
@@ -0,0 +1,197 @@
+package unit
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// newTestSigner creates a signer whose keys are the given IDs with deterministic secrets
+func newTestSigner(t *testing.T, keyIDs ...string) *services.CheckoutCodeSigner {
+	keys := make([]services.SigningKey, len(keyIDs))
+	for i, keyID := range keyIDs {
+		keys[i] = services.SigningKey{ID: keyID, Secret: bytes.Repeat([]byte(keyID[:1]), services.MinSigningKeyBytes)}
+	}
+
+	signer, err := services.NewCheckoutCodeSigner(keys)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func TestCheckoutCodeSigner_SignAndVerify(t *testing.T) {
+	signer := newTestSigner(t, "k1")
+	claims := &models.CheckoutClaims{SaleID: 42, UserID: "user1", ItemID: "item1", ExpiresAt: time.Now().Add(time.Minute).Truncate(time.Millisecond)}
+
+	code, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	if !strings.HasPrefix(code, "CHK_k1.") || len(code) > services.MaxCheckoutCodeLength {
+		t.Errorf("Expected a CHK_ code naming key k1, got: %s", code)
+	}
+
+	verified, err := signer.Verify(code)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	if verified.KeyID != "k1" || verified.SaleID != 42 || verified.UserID != "user1" || verified.ItemID != "item1" || !verified.ExpiresAt.Equal(claims.ExpiresAt) {
+		t.Errorf("Expected claims to round-trip, got %+v", verified)
+	}
+
+	// Codes for the same checkout details are still unique
+	if again, _ := signer.Sign(claims); again == code {
+		t.Error("Expected two codes for the same claims to differ")
+	}
+
+	// The longest accepted user and item IDs still fit
+	long := &models.CheckoutClaims{SaleID: 1 << 30, UserID: strings.Repeat("u", 100), ItemID: strings.Repeat("i", 50), ExpiresAt: claims.ExpiresAt}
+	if code, _ := signer.Sign(long); len(code) > services.MaxCheckoutCodeLength {
+		t.Errorf("Expected codes to fit in %d characters, got: %d", services.MaxCheckoutCodeLength, len(code))
+	}
+}
+
+func TestCheckoutCodeSigner_RejectsForgedCodes(t *testing.T) {
+	signer := newTestSigner(t, "k1")
+	code, _ := signer.Sign(&models.CheckoutClaims{SaleID: 1, UserID: "user1", ItemID: "item1", ExpiresAt: time.Now().Add(time.Minute)})
+
+	// A valid code for user2 whose payload is spliced into user1's code
+	other, _ := signer.Sign(&models.CheckoutClaims{SaleID: 1, UserID: "user2", ItemID: "item1", ExpiresAt: time.Now().Add(time.Minute)})
+	parts, otherParts := strings.Split(code, "."), strings.Split(other, ".")
+
+	// A signer that reuses the key ID with a different secret
+	impostor, _ := services.NewCheckoutCodeSigner([]services.SigningKey{{ID: "k1", Secret: bytes.Repeat([]byte("z"), services.MinSigningKeyBytes)}})
+
+	forged := map[string]string{
+		"legacy format":    "CHK_1a2b3c4d_1234",
+		"no prefix":        strings.TrimPrefix(code, "CHK_"),
+		"unknown key":      strings.Replace(code, "CHK_k1.", "CHK_k9.", 1),
+		"spliced payload":  parts[0] + "." + otherParts[1] + "." + parts[2],
+		"flipped byte":     code[:len(code)-1] + string(code[len(code)-1]^1),
+		"wrong secret":     mustSign(t, impostor),
+		"truncated":        code[:len(code)-4],
+		"extra separators": code + ".x",
+	}
+
+	for name, code := range forged {
+		if _, err := signer.Verify(code); !errors.Is(err, services.ErrInvalidCheckoutCode) {
+			t.Errorf("%s: expected ErrInvalidCheckoutCode, got: %v", name, err)
+		}
+	}
+}
+
+// mustSign signs a fixed checkout with the given signer
+func mustSign(t *testing.T, signer *services.CheckoutCodeSigner) string {
+	code, err := signer.Sign(&models.CheckoutClaims{SaleID: 1, UserID: "user1", ItemID: "item1", ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return code
+}
+
+func TestCheckoutCodeSigner_KeyRotation(t *testing.T) {
+	old := newTestSigner(t, "old")
+	oldCode := mustSign(t, old)
+
+	// The new key signs while the old one keeps verifying the codes it issued
+	rotated := newTestSigner(t, "new", "old")
+	if _, err := rotated.Verify(oldCode); err != nil {
+		t.Errorf("Expected codes signed with a retiring key to verify, got: %v", err)
+	}
+
+	newCode := mustSign(t, rotated)
+	if !strings.HasPrefix(newCode, "CHK_new.") {
+		t.Errorf("Expected new codes to be signed with the first key, got: %s", newCode)
+	}
+
+	// Once the old key is removed its codes no longer verify
+	retired := newTestSigner(t, "new")
+	if _, err := retired.Verify(oldCode); err == nil {
+		t.Error("Expected codes signed with a removed key to be rejected")
+	}
+	if _, err := retired.Verify(newCode); err != nil {
+		t.Errorf("Expected codes signed with the current key to verify, got: %v", err)
+	}
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	secret := "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=" // 32 bytes
+
+	keys, err := services.ParseSigningKeys("2025-10:" + secret + ", 2025-07:" + secret)
+	if err != nil || len(keys) != 2 || keys[0].ID != "2025-10" || len(keys[1].Secret) != 32 {
+		t.Fatalf("Expected 2 parsed keys, got %+v, %v", keys, err)
+	}
+
+	if _, err := services.NewCheckoutCodeSigner(keys); err != nil {
+		t.Errorf("Expected parsed keys to be accepted, got: %v", err)
+	}
+
+	invalid := map[string]string{
+		"missing secret": "k1",
+		"bad base64":     "k1:not base64!",
+	}
+	for name, spec := range invalid {
+		if _, err := services.ParseSigningKeys(spec); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	rejected := map[string][]services.SigningKey{
+		"no keys":       nil,
+		"short secret":  {{ID: "k1", Secret: []byte("short")}},
+		"bad key id":    {{ID: "k.1", Secret: bytes.Repeat([]byte("x"), 32)}},
+		"duplicate ids": {{ID: "k1", Secret: bytes.Repeat([]byte("x"), 32)}, {ID: "k1", Secret: bytes.Repeat([]byte("y"), 32)}},
+	}
+	for name, keys := range rejected {
+		if _, err := services.NewCheckoutCodeSigner(keys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPurchaseHandler_SignedCodes(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	signer := newTestSigner(t, "k1")
+	checkoutService.SetCodeSigner(signer)
+	purchaseService.SetCodeSigner(signer)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService)
+	purchaseHandler := handlers.NewPurchaseHandler(purchaseService)
+
+	status, response := checkout(checkoutHandler, "user1")
+	if status != http.StatusOK || !strings.HasPrefix(response.CheckoutCode, "CHK_k1.") {
+		t.Fatalf("Expected a signed checkout code, got %d %+v", status, response)
+	}
+
+	if status, errorCode := purchase(purchaseHandler, response.CheckoutCode); status != http.StatusOK {
+		t.Fatalf("Expected signed code to be accepted, got %d %q", status, errorCode)
+	}
+
+	// Forged and expired codes are rejected before any datastore lookup: this handler
+	// has no services, database or Redis and would panic if it reached one
+	offlineService := services.NewPurchaseService(nil, nil, nil, nil)
+	offlineService.SetCodeSigner(signer)
+	offline := handlers.NewPurchaseHandler(offlineService)
+
+	forged := strings.Replace(response.CheckoutCode, "CHK_k1.", "CHK_k1.A", 1)
+	if status, errorCode := purchase(offline, forged); status != http.StatusBadRequest || errorCode != handlers.ErrorCodeInvalidCode {
+		t.Errorf("Expected forged code to be rejected, got %d %q", status, errorCode)
+	}
+
+	expired, _ := signer.Sign(&models.CheckoutClaims{SaleID: 1, UserID: "user1", ItemID: "item1", ExpiresAt: time.Now().Add(-time.Second)})
+	if status, errorCode := purchase(offline, expired); status != http.StatusBadRequest || errorCode != handlers.ErrorCodeCheckoutExpired {
+		t.Errorf("Expected expired code to be rejected, got %d %q", status, errorCode)
+	}
+}
@@ -0,0 +1,121 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// addCachedCheckout stores a checkout attempt in the mock database and caches its code in Redis
+func addCachedCheckout(mockDB *MockDatabaseInterface, mockRedis *MockRedisInterface, code, status string, expiresAt time.Time) {
+	ctx := context.Background()
+	checkout := &models.CheckoutAttempt{
+		Code:      code,
+		SaleID:    1,
+		UserID:    "user1",
+		ItemID:    "item1",
+		Status:    status,
+		ExpiresAt: expiresAt,
+	}
+	mockDB.CreateCheckout(ctx, checkout)
+	mockRedis.CacheCheckoutCode(ctx, checkout)
+}
+
+func TestCheckoutExpirySweeper_ExpiresPendingAttempts(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	ctx := context.Background()
+	// Sweep after the codes expired, before Redis dropped their hashes
+	now := time.Now().Add(2 * time.Minute)
+
+	addCachedCheckout(mockDB, mockRedis, "CHK_expired_1", "pending", now.Add(-time.Minute))
+	addCachedCheckout(mockDB, mockRedis, "CHK_expired_2", "pending", now.Add(-time.Second))
+	addCachedCheckout(mockDB, mockRedis, "CHK_live", "pending", now.Add(time.Minute))
+	addCachedCheckout(mockDB, mockRedis, "CHK_used", "used", now.Add(-time.Minute))
+
+	// A code consumed in Redis whose purchase is still being recorded keeps its hash
+	addCachedCheckout(mockDB, mockRedis, "CHK_in_flight", "pending", now.Add(-time.Minute))
+	mockRedis.server.HSet("checkout:CHK_in_flight", "used", "true")
+
+	sweeper := services.NewCheckoutExpirySweeper(mockDB, mockRedis, NewMockClock(now), time.Second)
+	result, err := sweeper.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+
+	if result.Expired != 3 || result.CodesRemoved != 2 {
+		t.Errorf("Expected 3 expired and 2 codes removed, got %+v", result)
+	}
+
+	wantStatus := map[string]string{
+		"CHK_expired_1": "expired",
+		"CHK_expired_2": "expired",
+		"CHK_live":      "pending",
+		"CHK_used":      "used",
+		"CHK_in_flight": "expired",
+	}
+	for code, want := range wantStatus {
+		if checkout, _ := mockDB.GetCheckoutByCode(ctx, code); checkout.Status != want {
+			t.Errorf("Expected %s to be %s, got: %s", code, want, checkout.Status)
+		}
+	}
+
+	if _, err := mockRedis.GetCheckoutCode(ctx, "CHK_expired_1"); err == nil {
+		t.Error("Expected expired code to be removed from Redis")
+	}
+
+	for _, code := range []string{"CHK_live", "CHK_in_flight"} {
+		if _, err := mockRedis.GetCheckoutCode(ctx, code); err != nil {
+			t.Errorf("Expected %s to stay cached, got: %v", code, err)
+		}
+	}
+
+	// A second sweep finds nothing left to expire
+	if result, _ := sweeper.Sweep(ctx); result.Expired != 0 {
+		t.Errorf("Expected nothing to expire on the second sweep, got %+v", result)
+	}
+}
+
+func TestCheckoutExpirySweeper_ConcurrentSweepers(t *testing.T) {
+	const attempts, replicas = 2*services.CheckoutExpiryBatchSize + 50, 4
+
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	now := time.Now().Add(2 * time.Minute)
+	for i := 0; i < attempts; i++ {
+		addCachedCheckout(mockDB, mockRedis, fmt.Sprintf("CHK_sweep_%d", i), "pending", now.Add(-time.Minute))
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan *services.CheckoutSweepResult, replicas)
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sweeper := services.NewCheckoutExpirySweeper(mockDB, mockRedis, NewMockClock(now), time.Second)
+			result, err := sweeper.Sweep(context.Background())
+			if err != nil {
+				t.Errorf("Sweep failed: %v", err)
+				return
+			}
+			results <- result
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	expired, removed := 0, 0
+	for result := range results {
+		expired += result.Expired
+		removed += result.CodesRemoved
+	}
+
+	if expired != attempts || removed != attempts {
+		t.Errorf("Expected each of %d attempts expired and removed exactly once, got %d expired and %d removed", attempts, expired, removed)
+	}
+}
@@ -1,6 +1,7 @@
 package unit
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 
 	"flash-sale-backend/internal/handlers"
 	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
 )
 
 func TestCheckoutHandler_ValidRequest(t *testing.T) {
@@ -26,13 +28,13 @@ func TestCheckoutHandler_ValidRequest(t *testing.T) {
 	mockItemService.items["item1"] = &models.Item{
 		ID:    "item1", 
 		Name:  "Test Item", 
-		Price: 99.99,
+		Price: models.NewMoney(9999, "USD"),
 	}
 	
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 
-	handler := handlers.NewCheckoutHandler(mockSaleService, mockItemService, mockDB, mockRedis)
+	handler := handlers.NewCheckoutHandler(services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis))
 
 	// Test valid request with query parameters
 	req := httptest.NewRequest("POST", "/checkout?user_id=user123&item_id=item1", nil)
@@ -74,13 +76,13 @@ func TestCheckoutHandler_ConcurrentRequests(t *testing.T) {
 	
 	mockItemService := NewMockItemService()
 	mockItemService.items["item1"] = &models.Item{
-		ID: "item1", Name: "Test Item", Price: 99.99,
+		ID: "item1", Name: "Test Item", Price: models.NewMoney(9999, "USD"),
 	}
 	
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 
-	handler := handlers.NewCheckoutHandler(mockSaleService, mockItemService, mockDB, mockRedis)
+	handler := handlers.NewCheckoutHandler(services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis))
 
 	numRequests := 100
 	results := make(chan int, numRequests)
@@ -114,4 +116,147 @@ func TestCheckoutHandler_ConcurrentRequests(t *testing.T) {
 	if len(mockDB.checkouts) != numRequests {
 		t.Errorf("Expected %d checkout records, got: %d", numRequests, len(mockDB.checkouts))
 	}
-} 
\ No newline at end of file
+} 
+
+func TestCheckoutHandler_ItemNotInSale(t *testing.T) {
+	mockSaleService := NewMockSaleService()
+	mockSaleService.currentSale = &models.Sale{
+		ID:        1,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Hour),
+		Active:    true,
+	}
+
+	mockItemService := NewMockItemService()
+	mockItemService.items["item1"] = &models.Item{ID: "item1", Name: "Test Item", Price: models.NewMoney(9999, "USD")}
+	mockItemService.items["item2"] = &models.Item{ID: "item2", Name: "Other Item", Price: models.NewMoney(4999, "USD")}
+
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(context.Background(), 1, 10000, 10, map[string]int{"item1": 100})
+
+	handler := handlers.NewCheckoutHandler(services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis))
+
+	// item2 exists in the catalog but has no stock allocated to the sale
+	req := httptest.NewRequest("POST", "/checkout?user_id=user123&item_id=item2", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleCheckout(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got: %d", w.Code)
+	}
+
+	var response handlers.CheckoutResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.ErrorCode != "item_not_in_sale" {
+		t.Errorf("Expected error code item_not_in_sale, got: %q", response.ErrorCode)
+	}
+
+	if len(mockDB.checkouts) != 0 {
+		t.Errorf("Expected no checkout records, got: %d", len(mockDB.checkouts))
+	}
+
+	// item1 is allocated, so checkout goes through
+	req = httptest.NewRequest("POST", "/checkout?user_id=user123&item_id=item1", nil)
+	w = httptest.NewRecorder()
+
+	handler.HandleCheckout(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got: %d", w.Code)
+	}
+}
+
+func TestCheckoutHandler_OversoldItem(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 10, 2, 2)
+	handler := handlers.NewCheckoutHandler(services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis))
+
+	// Postgres records more units sold than allocated, and Redis is down
+	mockDB.saleItems[1][0].Sold = 3
+	mockRedis.SetError(true)
+
+	req := httptest.NewRequest("POST", "/checkout?user_id=user123&item_id=item1", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleCheckout(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an oversold item, got: %d", w.Code)
+	}
+
+	var response handlers.CheckoutResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.ErrorCode != "item_sold_out" {
+		t.Errorf("Expected error code item_sold_out, got: %q", response.ErrorCode)
+	}
+
+	if len(mockDB.checkouts) != 0 {
+		t.Errorf("Expected no checkout records, got: %d", len(mockDB.checkouts))
+	}
+}
+
+func TestCheckoutHandler_CheckoutTTL(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(false)
+	checkoutService.SetCheckoutTTL(2 * time.Minute)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService)
+	purchaseHandler := handlers.NewPurchaseHandler(purchaseService)
+	ctx := context.Background()
+
+	status, response := checkout(checkoutHandler, "user1")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d", status)
+	}
+
+	if ttl := time.Until(response.ExpiresAt); ttl <= time.Minute || ttl > 2*time.Minute {
+		t.Errorf("Expected the code to expire in 2 minutes, got: %v", ttl)
+	}
+
+	// Postgres and Redis agree on the expiry
+	stored, _ := mockDB.GetCheckoutByCode(ctx, response.CheckoutCode)
+	cached, err := mockRedis.GetCheckoutCode(ctx, response.CheckoutCode)
+	if err != nil || !cached.ExpiresAt.Equal(stored.ExpiresAt) || cached.ID != stored.ID {
+		t.Fatalf("Expected Redis to cache the checkout with its expiry, got %+v, %v", cached, err)
+	}
+
+	// Once the code expires Redis no longer accepts it
+	clock := NewMockClock(time.Now())
+	mockRedis.SetClock(clock)
+	clock.Advance(3 * time.Minute)
+	if _, err := mockRedis.GetCheckoutCode(ctx, response.CheckoutCode); err == nil {
+		t.Error("Expected Redis to drop the expired code")
+	}
+
+	// A live code is verified from Redis alone
+	mockRedis.SetClock(NewMockClock(time.Now()))
+	_, live := checkout(checkoutHandler, "user2")
+	mockDB.checkouts[live.CheckoutCode].ExpiresAt = time.Now().Add(-time.Minute)
+	if status, errorCode := purchase(purchaseHandler, live.CheckoutCode); status != http.StatusOK {
+		t.Errorf("Expected purchase verified from Redis to succeed, got %d %q", status, errorCode)
+	}
+}
+
+func TestCheckoutHandler_RetiredItem(t *testing.T) {
+	mockSaleService := NewMockSaleService()
+	mockSaleService.currentSale = &models.Sale{
+		ID:        1,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Hour),
+		Active:    true,
+	}
+
+	retiredAt := time.Now()
+	mockItemService := NewMockItemService()
+	mockItemService.items["item1"] = &models.Item{ID: "item1", Name: "Old Item", Price: models.NewMoney(999, "USD"), RetiredAt: &retiredAt}
+
+	handler := handlers.NewCheckoutHandler(services.NewCheckoutService(mockSaleService, mockItemService, NewMockDatabase(), NewMockRedis(t)))
+
+	status, response := checkout(handler, "user1")
+	if status != http.StatusBadRequest || response.Success || response.CheckoutCode != "" {
+		t.Errorf("Expected a retired item to be refused, got %d %+v", status, response)
+	}
+}
@@ -0,0 +1,172 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/services"
+)
+
+func TestCounterReconciler_RebuildsAfterRedisDataLoss(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 5, 2, 5)
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
+	reconciler := services.NewCounterReconciler(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", time.Second)
+	ctx := context.Background()
+
+	for i, userID := range []string{"user1", "user1", "user2"} {
+		code := fmt.Sprintf("CHK_before_%d", i)
+		addCheckout(mockDB, code, userID)
+		if status, errorCode := purchase(handler, code); status != http.StatusOK {
+			t.Fatalf("Expected purchase %s to succeed, got %d %q", code, status, errorCode)
+		}
+	}
+
+	// Consistent counters are left alone
+	if rebuilt, err := reconciler.Reconcile(ctx); err != nil || rebuilt {
+		t.Fatalf("Expected no rebuild for consistent counters, got %t, %v", rebuilt, err)
+	}
+
+	// Redis restarts mid-sale: purchases are refused instead of starting again from 0
+	mockRedis.FlushAll()
+	addCheckout(mockDB, "CHK_after_lost", "user3")
+	if status, _ := purchase(handler, "CHK_after_lost"); status == http.StatusOK {
+		t.Fatal("Expected purchases to be refused while Redis counters are missing")
+	}
+
+	if rebuilt, err := reconciler.Reconcile(ctx); err != nil || !rebuilt {
+		t.Fatalf("Expected counters to be rebuilt, got %t, %v", rebuilt, err)
+	}
+
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 3 {
+		t.Errorf("Expected 3 sold after rebuild, got: %d", sold)
+	}
+
+	if count, _ := mockRedis.GetUserPurchaseCount(ctx, "user1", 1); count != 2 {
+		t.Errorf("Expected user1 count of 2 after rebuild, got: %d", count)
+	}
+
+	if stock, _ := mockRedis.GetSaleItemStock(ctx, 1, "item1"); !stock.InSale || stock.Remaining != 2 {
+		t.Errorf("Expected 2 units of item1 left after rebuild, got %d (in sale: %t)", stock.Remaining, stock.InSale)
+	}
+
+	// The rebuilt counters enforce the original limits
+	addCheckout(mockDB, "CHK_user1_again", "user1")
+	addCheckout(mockDB, "CHK_user3_2", "user3")
+	addCheckout(mockDB, "CHK_user4_1", "user4")
+
+	tests := []struct {
+		code       string
+		wantStatus int
+		wantError  string
+	}{
+		{"CHK_user1_again", http.StatusConflict, string(interfaces.PurchaseUserLimitExceeded)},
+		{"CHK_after_lost", http.StatusOK, ""},
+		{"CHK_user3_2", http.StatusOK, ""},
+		{"CHK_user4_1", http.StatusConflict, string(interfaces.PurchaseItemSoldOut)},
+	}
+
+	for _, tt := range tests {
+		status, errorCode := purchase(handler, tt.code)
+		if status != tt.wantStatus || errorCode != tt.wantError {
+			t.Errorf("Purchase with %s: expected %d %q, got %d %q", tt.code, tt.wantStatus, tt.wantError, status, errorCode)
+		}
+	}
+}
+
+func TestCounterReconciler_BlocksPurchasesDuringRebuild(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 5, 2, 5)
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
+	reconciler := services.NewCounterReconciler(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", time.Second)
+	ctx := context.Background()
+
+	// Another replica is rebuilding the sale
+	mockRedis.FlushAll()
+	if started, _ := mockRedis.BeginCounterRebuild(ctx, 1, "replica-b", services.CounterRebuildTimeout); !started {
+		t.Fatal("Expected rebuild marker to be set")
+	}
+	mockRedis.SetupSale(ctx, 1, 5, 2, nil)
+
+	addCheckout(mockDB, "CHK_blocked_1", "user1")
+	jsonBody, _ := json.Marshal(map[string]string{"checkout_code": "CHK_blocked_1"})
+	req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandlePurchase(w, req)
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After during rebuild, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// This replica leaves the rebuild to its owner
+	mockRedis.FlushAll()
+	mockRedis.BeginCounterRebuild(ctx, 1, "replica-b", services.CounterRebuildTimeout)
+	if rebuilt, err := reconciler.Reconcile(ctx); err != nil || rebuilt {
+		t.Errorf("Expected no rebuild while another replica holds the marker, got %t, %v", rebuilt, err)
+	}
+
+	// A rebuild whose marker was taken over writes nothing
+	counters := &interfaces.SaleCounters{ItemsAvailable: 5, MaxPerUser: 2}
+	if rebuilt, _ := mockRedis.RebuildSaleCounters(ctx, 1, "replica-a", counters); rebuilt {
+		t.Error("Expected rebuild without the marker to be refused")
+	}
+}
+
+func TestCounterReconciler_WaitsForWriteBehindEvents(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 5, 2, 5)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	purchaseService.SetWriteBehind(true)
+	handler := handlers.NewPurchaseHandler(purchaseService)
+	reconciler := services.NewCounterReconciler(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", time.Second)
+	ctx := context.Background()
+	mockRedis.EnsurePersistenceGroup(ctx)
+
+	for i, userID := range []string{"user1", "user1", "user2"} {
+		code := fmt.Sprintf("CHK_queued_%d", i)
+		addCheckout(mockDB, code, userID)
+		if status, errorCode := purchase(handler, code); status != http.StatusOK {
+			t.Fatalf("Expected purchase %s to succeed, got %d %q", code, status, errorCode)
+		}
+	}
+
+	// The sold counter is evicted while the purchases are still queued for Postgres
+	mockRedis.server.Del("sale:1:sold")
+	if rebuilt, err := reconciler.Reconcile(ctx); err != nil || rebuilt {
+		t.Fatalf("Expected the rebuild to wait for queued purchases, got %t, %v", rebuilt, err)
+	}
+
+	addCheckout(mockDB, "CHK_while_queued", "user3")
+	if status, errorCode := purchase(handler, "CHK_while_queued"); status != http.StatusServiceUnavailable || errorCode != string(interfaces.PurchaseSaleRebuilding) {
+		t.Errorf("Expected purchases to be refused with sale_rebuilding, got %d %q", status, errorCode)
+	}
+
+	// Once the stream is drained the counters include every queued purchase
+	writer := services.NewPersistenceWriter(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", 100, time.Second)
+	if persisted, err := writer.Flush(ctx); err != nil || persisted != 3 {
+		t.Fatalf("Expected the queued purchases to be persisted, got %d, %v", persisted, err)
+	}
+
+	if rebuilt, err := reconciler.Reconcile(ctx); err != nil || !rebuilt {
+		t.Fatalf("Expected counters to be rebuilt, got %t, %v", rebuilt, err)
+	}
+
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 3 {
+		t.Errorf("Expected 3 sold after rebuild, got: %d", sold)
+	}
+
+	if count, _ := mockRedis.GetUserPurchaseCount(ctx, "user1", 1); count != 2 {
+		t.Errorf("Expected user1 count of 2 after rebuild, got: %d", count)
+	}
+
+	if stock, _ := mockRedis.GetSaleItemStock(ctx, 1, "item1"); stock.Remaining != 2 {
+		t.Errorf("Expected 2 units of item1 left after rebuild, got: %d", stock.Remaining)
+	}
+}
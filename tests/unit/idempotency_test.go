@@ -0,0 +1,153 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+)
+
+// sendWithKey posts body to handler with an Idempotency-Key
+func sendWithKey(handler http.HandlerFunc, key, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(handlers.IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestIdempotency_ReplaysResponse(t *testing.T) {
+	middleware := handlers.NewIdempotencyMiddleware(NewMockRedis(t), time.Hour)
+
+	var calls int32
+	handler := middleware.Wrap("checkout", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"code":"CHK_%d"}`, n)
+	})
+
+	body := `{"user_id":"user1","item_id":"item1"}`
+	first := sendWithKey(handler, "key-1", "/checkout", body)
+	second := sendWithKey(handler, "key-1", "/checkout", body)
+
+	if calls != 1 {
+		t.Fatalf("Expected the handler to run once, ran %d times", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("Expected the replay to match %d %s, got %d %s", first.Code, first.Body.String(), second.Code, second.Body.String())
+	}
+	if second.Header().Get("Content-Type") != "application/json" || second.Header().Get(handlers.IdempotencyReplayedHeader) != "true" {
+		t.Errorf("Expected the replay to keep its Content-Type and be marked replayed, got %v", second.Header())
+	}
+
+	// Keys are scoped per user, and requests without a key are never replayed
+	sendWithKey(handler, "key-1", "/checkout", `{"user_id":"user2","item_id":"item1"}`)
+	sendWithKey(handler, "", "/checkout", body)
+	sendWithKey(handler, "", "/checkout", body)
+	if calls != 4 {
+		t.Errorf("Expected other users and unkeyed requests to reach the handler, ran %d times", calls)
+	}
+}
+
+func TestIdempotency_RejectsReusedAndPendingKeys(t *testing.T) {
+	mockRedis := NewMockRedis(t)
+	middleware := handlers.NewIdempotencyMiddleware(mockRedis, time.Hour)
+
+	var handler http.HandlerFunc
+	var inner *httptest.ResponseRecorder
+	handler = middleware.Wrap("purchase", func(w http.ResponseWriter, r *http.Request) {
+		// A retry arriving while the first request is still running
+		if inner == nil {
+			inner = sendWithKey(handler, "key-1", "/purchase", `{"user_id":"user1","checkout_code":"A"}`)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	sendWithKey(handler, "key-1", "/purchase", `{"user_id":"user1","checkout_code":"A"}`)
+	if inner.Code != http.StatusConflict || inner.Header().Get("Retry-After") == "" ||
+		!strings.Contains(inner.Body.String(), handlers.ErrorCodeIdempotencyKeyInProgress) {
+		t.Errorf("Expected a concurrent retry to get 409, got %d %s", inner.Code, inner.Body.String())
+	}
+
+	w := sendWithKey(handler, "key-1", "/purchase", `{"user_id":"user1","checkout_code":"B"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), handlers.ErrorCodeIdempotencyKeyReused) {
+		t.Errorf("Expected a different payload to get 422, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := sendWithKey(handler, strings.Repeat("k", handlers.MaxIdempotencyKeyLength+1), "/purchase", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an overlong key to get 400, got %d", w.Code)
+	}
+}
+
+func TestIdempotency_ServerErrorsAndRedisFailures(t *testing.T) {
+	mockRedis := NewMockRedis(t)
+	middleware := handlers.NewIdempotencyMiddleware(mockRedis, time.Hour)
+
+	status := http.StatusInternalServerError
+	var calls int
+	handler := middleware.Wrap("purchase", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	})
+
+	// Server errors are not stored, so a retry runs again
+	body := `{"user_id":"user1","checkout_code":"A"}`
+	sendWithKey(handler, "key-1", "/purchase", body)
+	status = http.StatusOK
+	if w := sendWithKey(handler, "key-1", "/purchase", body); w.Code != http.StatusOK || calls != 2 {
+		t.Errorf("Expected the retry after a server error to run, got %d after %d calls", w.Code, calls)
+	}
+
+	// While Redis fails, requests are processed without idempotency
+	mockRedis.SetError(true)
+	if w := sendWithKey(handler, "key-2", "/purchase", body); w.Code != http.StatusOK || calls != 3 {
+		t.Errorf("Expected the request to be processed while Redis fails, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestIdempotency_ScopesRequestsWithoutUser(t *testing.T) {
+	middleware := handlers.NewIdempotencyMiddleware(NewMockRedis(t), time.Hour)
+
+	var calls int
+	handler := middleware.Wrap("purchase", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Purchases without authentication name no user, so keys are scoped to the checkout code
+	sendWithKey(handler, "retry-1", "/purchase", `{"checkout_code":"A"}`)
+	if w := sendWithKey(handler, "retry-1", "/purchase", `{"checkout_code":"B"}`); w.Code != http.StatusOK || calls != 2 {
+		t.Errorf("Expected another client's purchase with the same key to run, got %d after %d calls", w.Code, calls)
+	}
+	if w := sendWithKey(handler, "retry-1", "/purchase", `{"checkout_code":"A"}`); w.Header().Get(handlers.IdempotencyReplayedHeader) != "true" || calls != 2 {
+		t.Errorf("Expected the repeated purchase to be replayed, got %d after %d calls", w.Code, calls)
+	}
+
+	// Requests with neither a user nor a code are scoped to the client IP
+	requests := []struct {
+		addr  string
+		calls int
+	}{
+		{"192.0.2.1:1234", 3},
+		{"192.0.2.2:1234", 4},
+		{"192.0.2.1:5678", 4}, // Same client IP, replayed
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest("POST", "/purchase", nil)
+		req.RemoteAddr = r.addr
+		req.Header.Set(handlers.IdempotencyKeyHeader, "retry-2")
+		handler(httptest.NewRecorder(), req)
+		if calls != r.calls {
+			t.Errorf("Expected %d calls after the request from %s, got %d", r.calls, r.addr, calls)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func TestItemService_StrictModeRejectsUnknownItems(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	mockDB.CreateItems(ctx, []models.Item{{ID: "item1", Name: "Catalog Item", Price: models.NewMoney(1250, "USD")}})
+
+	itemService := services.NewItemService(mockDB)
+
+	item, err := itemService.GetItemByID(ctx, "item1")
+	if err != nil || item.Name != "Catalog Item" || item.Price != models.NewMoney(1250, "USD") {
+		t.Fatalf("Expected the catalog item, got %+v, %v", item, err)
+	}
+
+	if _, err := itemService.GetItemByID(ctx, "item_unknown"); !errors.Is(err, services.ErrItemNotInCatalog) {
+		t.Errorf("Expected ErrItemNotInCatalog, got: %v", err)
+	}
+	if items, _ := mockDB.ListItems(ctx, true); len(items) != 1 {
+		t.Errorf("Expected unknown items to stay out of the catalog, got %d items", len(items))
+	}
+}
+
+func TestItemService_NonStrictModeServesSeedData(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+
+	itemService := services.NewItemService(mockDB)
+	itemService.SetStrict(false)
+
+	// An unknown item is sold with the seed data every replica derives from its ID
+	item, err := itemService.GetItemByID(ctx, "item_unknown")
+	if err != nil {
+		t.Fatalf("Expected seed data outside strict mode, got: %v", err)
+	}
+	if *item != services.SeedItem("item_unknown") {
+		t.Errorf("Expected the seed item, got %+v", item)
+	}
+	if items, _ := mockDB.ListItems(ctx, true); len(items) != 0 {
+		t.Errorf("Expected the seed item to stay out of the catalog, got %d items", len(items))
+	}
+
+	// Malformed IDs are still rejected
+	if _, err := itemService.GetItemByID(ctx, "x"); err == nil {
+		t.Error("Expected a malformed item ID to be rejected")
+	}
+}
+
+func TestItemService_ReplicasShareCatalogPrices(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+
+	// Two instances sharing one catalog agree on an item one of them seeded
+	first := services.NewItemService(mockDB)
+	second := services.NewItemService(mockDB)
+
+	if created, err := first.SeedCatalog(ctx, []string{"item_abc123"}); err != nil || created != 1 {
+		t.Fatalf("Expected the item to be seeded, got %d, %v", created, err)
+	}
+	added := mustGetItem(t, first, "item_abc123")
+	if *added != *mustGetItem(t, second, "item_abc123") {
+		t.Errorf("Expected both instances to return the same item")
+	}
+	if seed := services.SeedItem("item_abc123"); added.Price != seed.Price || added.Name != seed.Name {
+		t.Errorf("Expected the seed data for the item, got %+v", added)
+	}
+
+	// Seeding never changes an item already in the catalog
+	mockDB.CreateItems(ctx, []models.Item{{ID: "product_a", Name: "Priced By Admin", Price: models.NewMoney(500, "USD")}})
+	created, err := first.SeedCatalog(ctx, services.CommonSeedItemIDs)
+	if err != nil || created != len(services.CommonSeedItemIDs)-1 {
+		t.Fatalf("Expected to seed all but one common item, got %d, %v", created, err)
+	}
+	if item := mustGetItem(t, second, "product_a"); item.Price.Amount != 500 {
+		t.Errorf("Expected the existing price to be kept, got %v", item.Price)
+	}
+
+	if _, err := first.GetItemByID(ctx, "bad id!"); err == nil {
+		t.Error("Expected a malformed item ID to be rejected")
+	}
+}
+
+// seedNumberedItems adds item1 and item_0 to item_{count-1} to the catalog
+func seedNumberedItems(t *testing.T, itemService *services.ItemServiceImpl, count int) {
+	t.Helper()
+	itemIDs := []string{"item1"}
+	for n := 0; n < count; n++ {
+		itemIDs = append(itemIDs, fmt.Sprintf("item_%d", n))
+	}
+	if _, err := itemService.SeedCatalog(context.Background(), itemIDs); err != nil {
+		t.Fatalf("Failed to seed items: %v", err)
+	}
+}
+
+// mustGetItem looks an item up and fails the test if it cannot be found
+func mustGetItem(t *testing.T, itemService *services.ItemServiceImpl, itemID string) *models.Item {
+	t.Helper()
+	item, err := itemService.GetItemByID(context.Background(), itemID)
+	if err != nil {
+		t.Fatalf("Failed to get item %s: %v", itemID, err)
+	}
+	return item
+}
+
+func TestItemService_PriceLockedDuringActiveSale(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	mockDB.CreateItems(ctx, []models.Item{{ID: "item1", Name: "On Sale", Price: models.NewMoney(1000, "USD")}, {ID: "item2", Name: "Not On Sale", Price: models.NewMoney(2000, "USD")}})
+
+	sale := &models.Sale{StartTime: time.Now(), EndTime: time.Now().Add(time.Hour), ItemsAvailable: 10, MaxPerUser: 2, Active: true}
+	mockDB.CreateSale(ctx, sale)
+	mockDB.CreateSaleItems(ctx, sale.ID, []models.SaleItem{{ItemID: "item1", Stock: 10}})
+
+	itemService := services.NewItemService(mockDB)
+
+	if err := itemService.UpdateItem(ctx, &models.Item{ID: "item1", Name: "On Sale", Price: models.NewMoney(500, "USD")}); !errors.Is(err, services.ErrItemPriceLocked) {
+		t.Errorf("Expected ErrItemPriceLocked, got: %v", err)
+	}
+	if err := itemService.UpdateItem(ctx, &models.Item{ID: "item1", Name: "Renamed", Price: models.NewMoney(1000, "USD")}); err != nil {
+		t.Errorf("Expected other changes to an item on sale to succeed, got: %v", err)
+	}
+
+	// A bulk update touching an item on sale changes nothing
+	prices := []models.ItemPrice{{ItemID: "item2", Price: models.NewMoney(1500, "USD")}, {ItemID: "item1", Price: models.NewMoney(500, "USD")}}
+	if err := itemService.UpdateItemPrices(ctx, prices); !errors.Is(err, services.ErrItemPriceLocked) {
+		t.Errorf("Expected ErrItemPriceLocked, got: %v", err)
+	}
+	if item, _ := mockDB.GetItemByID(ctx, "item2"); item.Price.Amount != 2000 {
+		t.Errorf("Expected item2's price to be unchanged, got %v", item.Price)
+	}
+
+	// Prices are free to change once the sale ends
+	mockDB.DeactivateSale(ctx, sale.ID)
+	if err := itemService.UpdateItemPrices(ctx, prices); err != nil {
+		t.Errorf("Expected the price update to succeed after the sale, got: %v", err)
+	}
+}
+
+func TestItemService_PriceLockCheckedWhenApplied(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	mockDB.CreateItems(ctx, []models.Item{{ID: "item1", Name: "Widget", Price: models.NewMoney(1000, "USD")}})
+
+	itemService := services.NewItemService(mockDB)
+	importer := services.NewCatalogImporter(mockDB, itemService)
+
+	// The price change is planned before the sale starts
+	changes, err := importer.Plan(ctx, &services.CatalogImport{Items: []models.Item{{ID: "item1", Name: "Widget", Price: models.NewMoney(800, "USD")}}})
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Expected one planned change, got %v, %v", changes, err)
+	}
+
+	// A sale selling every item starts before the change is applied
+	sale := &models.Sale{StartTime: time.Now(), EndTime: time.Now().Add(time.Hour), ItemsAvailable: 10, MaxPerUser: 2, Active: true}
+	mockDB.CreateSale(ctx, sale)
+
+	if _, err := importer.Apply(ctx, changes); !errors.Is(err, services.ErrItemPriceLocked) {
+		t.Errorf("Expected ErrItemPriceLocked, got: %v", err)
+	}
+	if item, _ := mockDB.GetItemByID(ctx, "item1"); item.Price.Amount != 1000 {
+		t.Errorf("Expected item1's price to be unchanged, got %v", item.Price)
+	}
+}
+
+func TestItemService_InvalidatesOtherReplicaCaches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	mockDB.CreateItems(ctx, []models.Item{{ID: "item1", Name: "Widget", Price: models.NewMoney(1000, "USD")}})
+
+	writer := services.NewItemService(mockDB)
+	writer.SetCacheInvalidation(mockRedis)
+	reader := services.NewItemService(mockDB)
+	reader.SetCacheInvalidation(mockRedis)
+	go reader.Start(ctx)
+	defer reader.Stop()
+
+	waitFor(t, "the reader to subscribe", func() bool { return mockRedis.ItemSubscribers() == 1 })
+
+	// The reader caches the item, then sees the writer's change
+	if item := mustGetItem(t, reader, "item1"); item.Price.Amount != 1000 {
+		t.Fatalf("Expected price 10, got %v", item.Price)
+	}
+	if err := writer.UpdateItem(ctx, &models.Item{ID: "item1", Name: "Widget", Price: models.NewMoney(800, "USD")}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	waitFor(t, "the new price", func() bool { return mustGetItem(t, reader, "item1").Price.Amount == 800 })
+
+	if _, err := writer.RetireItem(ctx, "item1"); err != nil {
+		t.Fatalf("Failed to retire item: %v", err)
+	}
+	waitFor(t, "the retirement", func() bool { return mustGetItem(t, reader, "item1").RetiredAt != nil })
+}
+
+func TestItemService_CacheIsBoundedAndExpires(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	itemService := services.NewItemService(mockDB)
+	if err := itemService.SetCacheLimits(32, time.Hour); err != nil {
+		t.Fatalf("Failed to set cache limits: %v", err)
+	}
+	seedNumberedItems(t, itemService, 200)
+
+	// Novel item IDs never grow the cache past its capacity
+	for n := 0; n < 200; n++ {
+		mustGetItem(t, itemService, fmt.Sprintf("item_%d", n))
+	}
+	stats := itemService.GetCacheStats()
+	if stats["cached_items"].(int) > stats["capacity"].(int) || stats["evictions"].(uint64) == 0 {
+		t.Errorf("Expected the cache to stay within its capacity by evicting items, got %v", stats)
+	}
+
+	// The most recently used item is still cached
+	mustGetItem(t, itemService, "item_199")
+	if hits := itemService.GetCacheStats()["hits"].(uint64); hits != 1 {
+		t.Errorf("Expected 1 cache hit, got %d", hits)
+	}
+
+	// Items are reloaded once their TTL passes
+	itemService.SetCacheLimits(32, 20*time.Millisecond)
+	mustGetItem(t, itemService, "item1")
+	mockDB.UpdateItem(ctx, &models.Item{ID: "item1", Name: "Changed Elsewhere", Price: models.NewMoney(100, "USD")})
+	time.Sleep(30 * time.Millisecond)
+	if item := mustGetItem(t, itemService, "item1"); item.Name != "Changed Elsewhere" {
+		t.Errorf("Expected the expired item to be reloaded, got %+v", item)
+	}
+	if expirations := itemService.GetCacheStats()["expirations"].(uint64); expirations != 1 {
+		t.Errorf("Expected 1 expiration, got %d", expirations)
+	}
+
+	if err := itemService.SetCacheLimits(0, time.Minute); err == nil {
+		t.Error("Expected a zero cache size to be rejected")
+	}
+}
+
+func TestItemService_CacheConcurrentStress(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	itemService := services.NewItemService(mockDB)
+	itemService.SetCacheLimits(64, time.Minute)
+	seedNumberedItems(t, itemService, 300)
+
+	const goroutines = 50
+	const lookups = 400
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < lookups; n++ {
+				itemID := fmt.Sprintf("item_%d", (g*7+n)%300)
+				if _, err := itemService.GetItemByID(ctx, itemID); err != nil {
+					t.Errorf("Failed to get item %s: %v", itemID, err)
+					return
+				}
+
+				// Mix in catalog changes, cache clears and metric reads
+				switch {
+				case n%50 == 0:
+					itemService.UpdateItem(ctx, &models.Item{ID: itemID, Name: "Updated", Price: models.NewMoney(int64(g), "USD")})
+				case n%97 == 0:
+					itemService.ClearCache()
+				case n%31 == 0:
+					itemService.GetCacheStats()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	stats := itemService.GetCacheStats()
+	if stats["cached_items"].(int) > stats["capacity"].(int) {
+		t.Errorf("Expected the cache to stay within its capacity, got %v", stats)
+	}
+	if total := stats["hits"].(uint64) + stats["misses"].(uint64); total != goroutines*lookups {
+		t.Errorf("Expected %d lookups to be counted, got %d", goroutines*lookups, total)
+	}
+
+	// A change is visible right after it is made
+	if err := itemService.UpdateItem(ctx, &models.Item{ID: "item_7", Name: "Final", Price: models.NewMoney(300, "USD")}); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	if item := mustGetItem(t, itemService, "item_7"); item.Name != "Final" {
+		t.Errorf("Expected the updated item, got %+v", item)
+	}
+}
@@ -0,0 +1,231 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// partitionedRedis simulates a replica that has lost its connection to Redis
+type partitionedRedis struct {
+	*MockRedisInterface
+	down int32
+}
+
+func (p *partitionedRedis) AcquireLeadership(ctx context.Context, name string, instanceID string, ttl time.Duration) (int64, error) {
+	if atomic.LoadInt32(&p.down) == 1 {
+		return 0, errors.New("connection refused")
+	}
+	return p.MockRedisInterface.AcquireLeadership(ctx, name, instanceID, ttl)
+}
+
+func (p *partitionedRedis) ReleaseLeadership(ctx context.Context, name string, instanceID string) error {
+	if atomic.LoadInt32(&p.down) == 1 {
+		return errors.New("connection refused")
+	}
+	return p.MockRedisInterface.ReleaseLeadership(ctx, name, instanceID)
+}
+
+func TestLeaderElector_FencingAndHandoff(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	clock := NewMockClock(time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC))
+	mockRedis.SetClock(clock)
+	ctx := context.Background()
+
+	ttl := 15 * time.Second
+	first := services.NewLeaderElector(mockRedis, mockDB, services.SaleManagerLeaderName, "replica-a", ttl)
+	second := services.NewLeaderElector(mockRedis, mockDB, services.SaleManagerLeaderName, "replica-b", ttl)
+
+	if leading, err := first.Campaign(ctx); err != nil || !leading {
+		t.Fatalf("Expected first replica to lead, got %t, %v", leading, err)
+	}
+	if leading, _ := second.Campaign(ctx); leading {
+		t.Fatal("Expected second replica to follow while the lease is held")
+	}
+
+	// Renewing keeps the same fencing token
+	clock.Advance(first.RenewInterval())
+	if leading, _ := first.Campaign(ctx); !leading || first.Fence().Token != 1 {
+		t.Errorf("Expected renewal to keep token 1, got %t, %d", leading, first.Fence().Token)
+	}
+
+	// The leader stops renewing; once the lease expires the follower takes over with a higher token
+	clock.Advance(ttl)
+	if leading, _ := second.Campaign(ctx); !leading || second.Fence().Token != 2 {
+		t.Fatalf("Expected second replica to take over with token 2, got %t, %d", leading, second.Fence().Token)
+	}
+
+	// The old leader cannot come back while the new lease is held
+	if leading, _ := first.Campaign(ctx); leading || first.Fence().Token != 0 {
+		t.Errorf("Expected old leader to step down, got %t, %d", leading, first.Fence().Token)
+	}
+
+	// A stale token is fenced off even if it reaches Postgres late
+	if current, _ := mockDB.AdvanceFencingToken(ctx, services.SaleManagerLeaderName, 1); current {
+		t.Error("Expected stale fencing token to be rejected")
+	}
+
+	// Resigning hands over immediately
+	second.Resign(ctx)
+	if leading, _ := first.Campaign(ctx); !leading || first.Fence().Token != 3 {
+		t.Errorf("Expected first replica to lead again with token 3, got %t, %d", leading, first.Fence().Token)
+	}
+}
+
+func TestSaleScheduler_RejectsStaleLeaderWrites(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	clock := NewMockClock(time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC))
+	mockRedis.SetClock(clock)
+	ctx := context.Background()
+
+	ttl := 15 * time.Second
+	stale := services.NewLeaderElector(mockRedis, mockDB, services.SaleManagerLeaderName, "replica-a", ttl)
+	successor := services.NewLeaderElector(mockRedis, mockDB, services.SaleManagerLeaderName, "replica-b", ttl)
+	if leading, _ := stale.Campaign(ctx); !leading {
+		t.Fatal("Expected first replica to lead")
+	}
+	staleCtx := interfaces.WithFence(ctx, stale.Fence())
+
+	// The leader is paused past its lease and another replica takes over
+	clock.Advance(ttl)
+	if leading, _ := successor.Campaign(ctx); !leading {
+		t.Fatal("Expected second replica to take over")
+	}
+
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, clock, services.ScheduleRule{})
+	window := &models.SaleWindow{StartTime: clock.Now(), EndTime: clock.Now().Add(time.Hour)}
+	if _, err := scheduler.ScheduleWindow(ctx, window); err != nil {
+		t.Fatalf("Failed to schedule window: %v", err)
+	}
+
+	// Waking up, the old leader still believes it leads; its writes are rejected
+	if _, err := scheduler.Reconcile(staleCtx); !errors.Is(err, interfaces.ErrLeadershipLost) {
+		t.Fatalf("Expected the stale leader to lose leadership, got %v", err)
+	}
+	if sales, _ := mockDB.ListSales(ctx, 10); len(sales) != 0 {
+		t.Fatalf("Expected no sale from the stale leader, got %+v", sales)
+	}
+
+	// The current leader starts the window
+	if _, err := scheduler.Reconcile(interfaces.WithFence(ctx, successor.Fence())); err != nil {
+		t.Fatalf("Failed to reconcile as the current leader: %v", err)
+	}
+	active, _ := mockDB.GetActiveSale(ctx)
+	if active == nil {
+		t.Fatal("Expected the current leader to start the sale")
+	}
+
+	// Nor can the old leader end the successor's sale
+	if err := saleService.DeactivateSale(staleCtx, active.ID); !errors.Is(err, interfaces.ErrLeadershipLost) {
+		t.Errorf("Expected deactivation by the stale leader to be rejected, got %v", err)
+	}
+	if sale, _ := mockDB.GetSaleByID(ctx, active.ID); sale == nil || !sale.Active {
+		t.Errorf("Expected the sale to stay active, got %+v", sale)
+	}
+}
+
+func TestBackgroundSaleManager_SingleLeaderAcrossReplicas(t *testing.T) {
+	const replicas = 3
+
+	// Shared stand-ins for Postgres and Redis
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	clock := NewMockClock(time.Date(2025, 1, 1, 10, 59, 50, 0, time.UTC))
+	mockRedis.SetClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rule := services.ScheduleRule{Interval: time.Hour, Horizon: 2 * time.Hour}
+	connections := make(map[string]*partitionedRedis, replicas)
+	for i := 0; i < replicas; i++ {
+		instanceID := fmt.Sprintf("replica-%d", i)
+		connections[instanceID] = &partitionedRedis{MockRedisInterface: mockRedis}
+
+		saleService := services.NewSaleService(mockDB, mockRedis)
+		scheduler := services.NewSaleScheduler(saleService, mockDB, clock, rule)
+		elector := services.NewLeaderElector(connections[instanceID], mockDB, services.SaleManagerLeaderName, instanceID, 15*time.Second)
+		manager := services.NewBackgroundSaleManager(scheduler, elector)
+
+		go manager.Start(ctx)
+		defer manager.Stop()
+	}
+
+	// settle waits until every manager is asleep on the clock
+	settle := func(description string) {
+		t.Helper()
+		waitFor(t, description, func() bool { return clock.Waiters() == replicas })
+	}
+
+	// step advances the clock in renew-sized steps so leases behave as in real time
+	step := func(until time.Time) {
+		t.Helper()
+		for clock.Now().Before(until) {
+			next := clock.Now().Add(5 * time.Second)
+			if next.After(until) {
+				next = until
+			}
+			clock.Set(next)
+			settle(fmt.Sprintf("managers to settle at %v", next))
+		}
+	}
+
+	saleCount := func() int {
+		sales, _ := mockDB.ListSales(ctx, 100)
+		return len(sales)
+	}
+
+	settle("managers to start")
+	if count := saleCount(); count != 1 {
+		t.Fatalf("Expected exactly one sale for the current window, got %d", count)
+	}
+
+	// Roll over at 11:00: still exactly one new sale
+	step(time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC))
+	if count := saleCount(); count != 2 {
+		t.Fatalf("Expected exactly two sales after the 11:00 boundary, got %d", count)
+	}
+
+	leader := mockRedis.LeaseOwner(services.SaleManagerLeaderName)
+	if leader == "" {
+		t.Fatal("Expected a leader to hold the lease")
+	}
+
+	// The leader loses Redis; another replica takes over once the lease expires
+	atomic.StoreInt32(&connections[leader].down, 1)
+	step(time.Date(2025, 1, 1, 11, 1, 0, 0, time.UTC))
+
+	successor := mockRedis.LeaseOwner(services.SaleManagerLeaderName)
+	if successor == "" || successor == leader {
+		t.Fatalf("Expected another replica to take over from %s, got %q", leader, successor)
+	}
+
+	// The successor drives the 12:00 boundary alone
+	step(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	if count := saleCount(); count != 3 {
+		t.Errorf("Expected exactly three sales after the 12:00 boundary, got %d", count)
+	}
+
+	active, _ := mockDB.GetActiveSale(ctx)
+	if active == nil || !active.StartTime.Equal(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the 12:00 sale to be active, got %+v", active)
+	}
+
+	windows := mockDB.SaleWindows()
+	if running := windowsByStatus(windows, models.SaleWindowActive); len(running) != 1 {
+		t.Errorf("Expected exactly one active window, got %+v", running)
+	}
+	if completed := windowsByStatus(windows, models.SaleWindowCompleted); len(completed) != 2 {
+		t.Errorf("Expected two completed windows, got %+v", completed)
+	}
+}
@@ -4,9 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+
+	"flash-sale-backend/internal/database"
 	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
 )
@@ -37,6 +43,7 @@ func (m *MockSaleService) CreateHourlySale(ctx context.Context) (*models.Sale, e
 		EndTime:        time.Now().Add(time.Hour),
 		ItemsAvailable: 10000,
 		ItemsSold:      0,
+		MaxPerUser:     10,
 		Active:         true,
 		CreatedAt:      time.Now(),
 	}
@@ -45,6 +52,27 @@ func (m *MockSaleService) CreateHourlySale(ctx context.Context) (*models.Sale, e
 	return sale, nil
 }
 
+func (m *MockSaleService) CreateSale(ctx context.Context, sale *models.Sale, items []models.SaleItem) (*models.Sale, error) {
+	if m.shouldError {
+		return nil, errors.New("mock sale service error")
+	}
+	sale.ID = m.nextSaleID
+	sale.CreatedAt = time.Now()
+	m.sales[sale.ID] = sale
+	m.nextSaleID++
+	return sale, nil
+}
+
+func (m *MockSaleService) CreateScheduledSale(ctx context.Context, window *models.SaleWindow) (*models.Sale, error) {
+	return m.CreateSale(ctx, &models.Sale{
+		StartTime:      window.StartTime,
+		EndTime:        window.EndTime,
+		ItemsAvailable: window.ItemsAvailable,
+		MaxPerUser:     window.MaxPerUser,
+		Active:         true,
+	}, nil)
+}
+
 func (m *MockSaleService) GetCurrentActiveSale(ctx context.Context) (*models.Sale, error) {
 	if m.shouldError {
 		return nil, errors.New("mock sale service error")
@@ -72,6 +100,31 @@ func (m *MockSaleService) DeactivateSale(ctx context.Context, saleID int) error
 	return nil
 }
 
+func (m *MockSaleService) ExtendSale(ctx context.Context, saleID int, endTime time.Time) (*models.Sale, error) {
+	if m.shouldError {
+		return nil, errors.New("mock sale service error")
+	}
+	sale, exists := m.sales[saleID]
+	if !exists {
+		return nil, errors.New("sale not found")
+	}
+	sale.EndTime = endTime
+	return sale, nil
+}
+
+func (m *MockSaleService) ListSales(ctx context.Context, limit int) ([]models.Sale, error) {
+	if m.shouldError {
+		return nil, errors.New("mock sale service error")
+	}
+	sales := make([]models.Sale, 0, len(m.sales))
+	for id := m.nextSaleID - 1; id > 0 && len(sales) < limit; id-- {
+		if sale, exists := m.sales[id]; exists {
+			sales = append(sales, *sale)
+		}
+	}
+	return sales, nil
+}
+
 func (m *MockSaleService) GetSaleStatus(ctx context.Context, saleID int) (*models.Sale, error) {
 	if m.shouldError {
 		return nil, errors.New("mock sale service error")
@@ -112,23 +165,6 @@ func NewMockItemService() *MockItemService {
 	}
 }
 
-func (m *MockItemService) GenerateItems(ctx context.Context, count int) ([]models.Item, error) {
-	if m.shouldError {
-		return nil, errors.New("mock item service error")
-	}
-	items := make([]models.Item, count)
-	for i := 0; i < count; i++ {
-		items[i] = models.Item{
-			ID:          "item" + string(rune('1'+i)),
-			Name:        "Test Item " + string(rune('1'+i)),
-			Description: "Test Description",
-			Price:       99.99,
-			CreatedAt:   time.Now(),
-		}
-	}
-	return items, nil
-}
-
 func (m *MockItemService) GetItemByID(ctx context.Context, itemID string) (*models.Item, error) {
 	if m.shouldError {
 		return nil, errors.New("mock item service error")
@@ -168,7 +204,15 @@ type MockDatabaseInterface struct {
 	sales        map[int]*models.Sale
 	checkouts    map[string]*models.CheckoutAttempt
 	purchases    map[int]*models.Purchase
+	saleItems    map[int][]models.SaleItem
+	items        map[string]*models.Item
+	auditLog     []models.AuditEntry
+	saleWindows  []*models.SaleWindow
+	fences       map[string]int64
+	fallback     map[int]bool // Sales whose purchase limits moved to Postgres
 	shouldError  bool
+	failCommit   bool
+	failPersist  string // Checkout code whose write-behind checkout event fails to persist
 	nextSaleID   int
 	nextPurchaseID int
 	mu           sync.RWMutex
@@ -179,6 +223,8 @@ func NewMockDatabase() *MockDatabaseInterface {
 		sales:      make(map[int]*models.Sale),
 		checkouts:  make(map[string]*models.CheckoutAttempt),
 		purchases:  make(map[int]*models.Purchase),
+		saleItems:  make(map[int][]models.SaleItem),
+		items:      make(map[string]*models.Item),
 		nextSaleID: 1,
 		nextPurchaseID: 1,
 	}
@@ -196,9 +242,14 @@ func (m *MockDatabaseInterface) CreateSale(ctx context.Context, sale *models.Sal
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if err := m.checkFence(ctx); err != nil {
+		return err
+	}
 	sale.ID = m.nextSaleID
 	sale.CreatedAt = time.Now()
-	m.sales[sale.ID] = sale
+	// Store a copy so later updates don't race with the caller's sale
+	stored := *sale
+	m.sales[sale.ID] = &stored
 	m.nextSaleID++
 	return nil
 }
@@ -211,7 +262,8 @@ func (m *MockDatabaseInterface) GetActiveSale(ctx context.Context) (*models.Sale
 	defer m.mu.RUnlock()
 	for _, sale := range m.sales {
 		if sale.Active {
-			return sale, nil
+			copied := *sale
+			return &copied, nil
 		}
 	}
 	return nil, nil
@@ -221,33 +273,135 @@ func (m *MockDatabaseInterface) GetSaleByID(ctx context.Context, id int) (*model
 	if m.shouldError {
 		return nil, errors.New("mock database error")
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	sale, exists := m.sales[id]
 	if !exists {
 		return nil, nil
 	}
-	return sale, nil
+	copied := *sale
+	return &copied, nil
+}
+
+func (m *MockDatabaseInterface) ListSales(ctx context.Context, limit int) ([]models.Sale, error) {
+	if m.shouldError {
+		return nil, errors.New("mock database error")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sales := make([]models.Sale, 0, len(m.sales))
+	for id := m.nextSaleID - 1; id > 0 && len(sales) < limit; id-- {
+		if sale, exists := m.sales[id]; exists {
+			sales = append(sales, *sale)
+		}
+	}
+	return sales, nil
 }
 
 func (m *MockDatabaseInterface) UpdateSaleItemsSold(ctx context.Context, saleID int, itemsSold int) error {
 	if m.shouldError {
 		return errors.New("mock database error")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if sale, exists := m.sales[saleID]; exists {
 		sale.ItemsSold = itemsSold
 	}
 	return nil
 }
 
+func (m *MockDatabaseInterface) UpdateSaleEndTime(ctx context.Context, saleID int, endTime time.Time) error {
+	if m.shouldError {
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sale, exists := m.sales[saleID]
+	if !exists {
+		return errors.New("sale not found")
+	}
+	sale.EndTime = endTime
+	return nil
+}
+
+func (m *MockDatabaseInterface) ActivateSale(ctx context.Context, saleID int) error {
+	if m.shouldError {
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkFence(ctx); err != nil {
+		return err
+	}
+	sale, exists := m.sales[saleID]
+	if !exists {
+		return errors.New("sale not found")
+	}
+	sale.Active = true
+	return nil
+}
+
 func (m *MockDatabaseInterface) DeactivateSale(ctx context.Context, saleID int) error {
 	if m.shouldError {
 		return errors.New("mock database error")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkFence(ctx); err != nil {
+		return err
+	}
 	if sale, exists := m.sales[saleID]; exists {
 		sale.Active = false
 	}
 	return nil
 }
 
+// Sale item operations
+func (m *MockDatabaseInterface) CreateSaleItems(ctx context.Context, saleID int, items []models.SaleItem) error {
+	if m.shouldError {
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkFence(ctx); err != nil {
+		return err
+	}
+	for _, item := range items {
+		item.SaleID = saleID
+		m.saleItems[saleID] = append(m.saleItems[saleID], item)
+	}
+	return nil
+}
+
+func (m *MockDatabaseInterface) GetSaleItems(ctx context.Context, saleID int) ([]models.SaleItem, error) {
+	if m.shouldError {
+		return nil, errors.New("mock database error")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := make([]models.SaleItem, len(m.saleItems[saleID]))
+	copy(items, m.saleItems[saleID])
+	return items, nil
+}
+
+func (m *MockDatabaseInterface) UpdateSaleItemStock(ctx context.Context, saleID int, itemID string, stock int) (bool, error) {
+	if m.shouldError {
+		return false, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.saleItems[saleID] {
+		if m.saleItems[saleID][i].ItemID == itemID {
+			if stock < m.saleItems[saleID][i].Sold {
+				return false, fmt.Errorf("stock %d is below the %d units sold", stock, m.saleItems[saleID][i].Sold)
+			}
+			m.saleItems[saleID][i].Stock = stock
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Checkout operations
 func (m *MockDatabaseInterface) CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error {
 	if m.shouldError {
@@ -265,11 +419,15 @@ func (m *MockDatabaseInterface) GetCheckoutAttemptByCode(ctx context.Context, co
 	if m.shouldError {
 		return nil, errors.New("mock database error")
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	checkout, exists := m.checkouts[code]
 	if !exists {
 		return nil, nil
 	}
-	return checkout, nil
+	// Return a copy so concurrent callers don't share the stored record
+	copied := *checkout
+	return &copied, nil
 }
 
 func (m *MockDatabaseInterface) UpdateCheckoutAttemptPurchased(ctx context.Context, code string) error {
@@ -282,6 +440,25 @@ func (m *MockDatabaseInterface) UpdateCheckoutAttemptPurchased(ctx context.Conte
 	return nil
 }
 
+func (m *MockDatabaseInterface) ExpireCheckoutAttempts(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	if m.shouldError {
+		return nil, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var codes []string
+	for code, checkout := range m.checkouts {
+		if len(codes) >= limit {
+			break
+		}
+		if checkout.Status == "pending" && !checkout.Purchased && !checkout.ExpiresAt.After(now) {
+			checkout.Status = "expired"
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
 // Compatibility aliases
 func (m *MockDatabaseInterface) CreateCheckout(ctx context.Context, attempt *models.CheckoutAttempt) error {
 	return m.CreateCheckoutAttempt(ctx, attempt)
@@ -296,6 +473,8 @@ func (m *MockDatabaseInterface) CreatePurchase(ctx context.Context, purchase *mo
 	if m.shouldError {
 		return errors.New("mock database error")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	purchase.ID = m.nextPurchaseID
 	purchase.CreatedAt = time.Now()
 	m.purchases[purchase.ID] = purchase
@@ -307,6 +486,8 @@ func (m *MockDatabaseInterface) UpdateCheckout(ctx context.Context, checkout *mo
 	if m.shouldError {
 		return errors.New("mock database error")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if existing, exists := m.checkouts[checkout.Code]; exists {
 		existing.Status = checkout.Status
 		existing.Purchased = checkout.Purchased
@@ -315,199 +496,820 @@ func (m *MockDatabaseInterface) UpdateCheckout(ctx context.Context, checkout *mo
 	return nil
 }
 
-// Transaction support
-func (m *MockDatabaseInterface) BeginTx(ctx context.Context) (interfaces.TxInterface, error) {
+func (m *MockDatabaseInterface) GetPurchaseCounts(ctx context.Context, saleID int) (*interfaces.PurchaseCounts, error) {
 	if m.shouldError {
 		return nil, errors.New("mock database error")
 	}
-	return &MockTx{db: m}, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := &interfaces.PurchaseCounts{
+		ByItem: make(map[string]int),
+		ByUser: make(map[string]int),
+	}
+	for _, purchase := range m.purchases {
+		if purchase.SaleID != saleID {
+			continue
+		}
+		if purchase.Status != "completed" {
+			if _, seen := counts.ByUser[purchase.UserID]; !seen {
+				counts.ByUser[purchase.UserID] = 0
+			}
+			continue
+		}
+		counts.Total++
+		counts.ByItem[purchase.ItemID]++
+		counts.ByUser[purchase.UserID]++
+	}
+	return counts, nil
 }
 
-func (m *MockDatabaseInterface) BeginTransaction(ctx context.Context) (interfaces.TxInterface, error) {
-	return m.BeginTx(ctx)
-}
+// Write-behind persistence, applying a batch all-or-nothing like PostgresDB.PersistEvents
+func (m *MockDatabaseInterface) PersistEvents(ctx context.Context, events []interfaces.PersistenceEvent) error {
+	if m.shouldError || m.failCommit {
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, event := range events {
+		if (event.Type != interfaces.PersistCheckout || event.Checkout == nil) && (event.Type != interfaces.PersistPurchase || event.Purchase == nil) {
+			return fmt.Errorf("unknown persistence event type %q", event.Type)
+		}
+		if event.Checkout != nil && event.Checkout.Code == m.failPersist {
+			return errors.New("mock database error")
+		}
+	}
+	for _, event := range events {
+		if event.Type == interfaces.PersistCheckout {
+			if _, exists := m.checkouts[event.Checkout.Code]; !exists {
+				attempt := *event.Checkout
+				attempt.ID = len(m.checkouts) + 1
+				m.checkouts[attempt.Code] = &attempt
+				for _, existing := range m.purchases {
+					if existing.Code == attempt.Code {
+						attempt.Status = "used"
+						attempt.Purchased = true
+						existing.CheckoutID = attempt.ID
+					}
+				}
+			}
+			continue
+		}
 
-// MockTx implements interfaces.TxInterface
-type MockTx struct {
-	db *MockDatabaseInterface
+		purchase := *event.Purchase
+		duplicate := false
+		for _, existing := range m.purchases {
+			duplicate = duplicate || existing.Code == purchase.Code
+		}
+		if duplicate {
+			continue
+		}
+		if checkout, exists := m.checkouts[purchase.Code]; exists {
+			purchase.CheckoutID = checkout.ID
+			checkout.Status = "used"
+			checkout.Purchased = true
+		}
+		purchase.ID = m.nextPurchaseID
+		m.purchases[purchase.ID] = &purchase
+		m.nextPurchaseID++
+		if sale, exists := m.sales[purchase.SaleID]; exists {
+			sale.ItemsSold++
+		}
+		for i := range m.saleItems[purchase.SaleID] {
+			if m.saleItems[purchase.SaleID][i].ItemID == purchase.ItemID {
+				m.saleItems[purchase.SaleID][i].Sold++
+			}
+		}
+	}
+	return nil
 }
 
-func (t *MockTx) Commit() error { return nil }
-func (t *MockTx) Rollback() error { return nil }
+// Purchase limits, mirroring the row-locked checks in PostgresDB.AttemptPurchase
+func (m *MockDatabaseInterface) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) (*interfaces.PurchaseResult, error) {
+	if m.shouldError {
+		return nil, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (t *MockTx) CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error {
-	return t.db.CreateCheckoutAttempt(ctx, attempt)
-}
+	result := &interfaces.PurchaseResult{ItemID: itemID}
+	sale, exists := m.sales[saleID]
+	if !exists || !sale.Active {
+		result.Status = interfaces.PurchaseSaleNotActive
+		return result, nil
+	}
+	if !m.fallback[saleID] {
+		result.Status = interfaces.PurchaseSaleRebuilding
+		return result, nil
+	}
+	result.TotalSold = sale.ItemsSold
 
-func (t *MockTx) GetCheckoutAttemptByCode(ctx context.Context, code string) (*models.CheckoutAttempt, error) {
-	return t.db.GetCheckoutAttemptByCode(ctx, code)
+	for _, checkout := range m.checkouts {
+		if checkout.SaleID == saleID && checkout.UserID == userID && checkout.Status == "used" {
+			result.UserPurchases++
+		}
+	}
+
+	checkout, exists := m.checkouts[code]
+	if !exists || checkout.SaleID != saleID {
+		return nil, fmt.Errorf("checkout code %s not found for sale %d", code, saleID)
+	}
+
+	var item *models.SaleItem
+	for i := range m.saleItems[saleID] {
+		if m.saleItems[saleID][i].ItemID == itemID {
+			item = &m.saleItems[saleID][i]
+		}
+	}
+	restricted := len(m.saleItems[saleID]) > 0
+
+	switch {
+	case checkout.Status != "pending":
+		result.Status = interfaces.PurchaseCodeAlreadyUsed
+	case restricted && item == nil:
+		result.Status = interfaces.PurchaseItemNotInSale
+	case restricted && item.Sold >= item.Stock:
+		result.Status = interfaces.PurchaseItemSoldOut
+	case sale.ItemsSold >= sale.ItemsAvailable:
+		result.Status = interfaces.PurchaseSaleSoldOut
+	case result.UserPurchases >= sale.MaxPerUser:
+		result.Status = interfaces.PurchaseUserLimitExceeded
+	default:
+		sale.ItemsSold++
+		if item != nil {
+			item.Sold++
+		}
+		checkout.Status = "used"
+		result.Status = interfaces.PurchaseSuccess
+		result.TotalSold = sale.ItemsSold
+		result.UserPurchases++
+		result.DatabaseCounted = true
+	}
+	return result, nil
 }
 
-func (t *MockTx) UpdateCheckoutAttemptPurchased(ctx context.Context, code string) error {
-	return t.db.UpdateCheckoutAttemptPurchased(ctx, code)
+func (m *MockDatabaseInterface) RevertPurchase(ctx context.Context, saleID int, userID string, itemID string, code string) error {
+	if m.shouldError {
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	checkout, exists := m.checkouts[code]
+	if !exists || checkout.SaleID != saleID || checkout.Status != "used" || checkout.Purchased {
+		return nil
+	}
+	checkout.Status = "pending"
+
+	if sale, exists := m.sales[saleID]; exists && sale.ItemsSold > 0 {
+		sale.ItemsSold--
+	}
+	for i := range m.saleItems[saleID] {
+		if m.saleItems[saleID][i].ItemID == itemID && m.saleItems[saleID][i].Sold > 0 {
+			m.saleItems[saleID][i].Sold--
+		}
+	}
+	return nil
 }
 
-// MockRedisInterface implements interfaces.RedisInterface
-type MockRedisInterface struct {
-	checkoutCodes map[string]bool
-	userCounts    map[string]int
-	soldItems     map[int]int
-	shouldError   bool
-	mu            sync.RWMutex
+// Sale schedule operations
+func (m *MockDatabaseInterface) CreateSaleWindow(ctx context.Context, window *models.SaleWindow) (bool, error) {
+	if m.shouldError {
+		return false, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkFence(ctx); err != nil {
+		return false, err
+	}
+	for _, existing := range m.saleWindows {
+		if existing.StartTime.Equal(window.StartTime) && existing.EndTime.Equal(window.EndTime) {
+			return false, nil
+		}
+	}
+	window.ID = len(m.saleWindows) + 1
+	window.CreatedAt = time.Now()
+	stored := *window
+	m.saleWindows = append(m.saleWindows, &stored)
+	return true, nil
 }
 
-func NewMockRedis() *MockRedisInterface {
-	return &MockRedisInterface{
-		checkoutCodes: make(map[string]bool),
-		userCounts:    make(map[string]int),
-		soldItems:     make(map[int]int),
+func (m *MockDatabaseInterface) GetSaleWindowsByStatus(ctx context.Context, status string) ([]models.SaleWindow, error) {
+	if m.shouldError {
+		return nil, errors.New("mock database error")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var windows []models.SaleWindow
+	for _, window := range m.saleWindows {
+		if window.Status == status {
+			windows = append(windows, *window)
+		}
 	}
+	sort.SliceStable(windows, func(i, j int) bool {
+		return windows[i].StartTime.Before(windows[j].StartTime)
+	})
+	return windows, nil
 }
 
-// Connection management
-func (m *MockRedisInterface) Close() error { return nil }
-func (m *MockRedisInterface) Ping(ctx context.Context) error { return nil }
+func (m *MockDatabaseInterface) UpdateSaleWindowStatus(ctx context.Context, windowID int, status string, saleID int) error {
+	if m.shouldError {
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkFence(ctx); err != nil {
+		return err
+	}
+	if windowID <= 0 || windowID > len(m.saleWindows) {
+		return errors.New("sale window not found")
+	}
+	window := m.saleWindows[windowID-1]
+	window.Status = status
+	if saleID > 0 {
+		window.SaleID = saleID
+	}
+	window.UpdatedAt = time.Now()
+	return nil
+}
 
-// Atomic sale operations
-func (m *MockRedisInterface) AtomicPurchase(ctx context.Context, saleID int, userID string, maxItems, maxUserItems int) (bool, string, int, int, error) {
+func (m *MockDatabaseInterface) CancelSaleWindow(ctx context.Context, windowID int) (bool, error) {
 	if m.shouldError {
-		return false, "error", 0, 0, errors.New("mock redis error")
+		return false, errors.New("mock database error")
 	}
-	
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
-	userKey := userID + "_" + string(rune(saleID))
-	userCount := m.userCounts[userKey]
-	
-	if userCount >= maxUserItems {
-		return false, "user_limit_exceeded", m.soldItems[saleID], userCount, nil
+	if windowID <= 0 || windowID > len(m.saleWindows) || m.saleWindows[windowID-1].Status != models.SaleWindowPending {
+		return false, nil
 	}
-	
-	if m.soldItems[saleID] >= maxItems {
-		return false, "sold_out", m.soldItems[saleID], userCount, nil
+	m.saleWindows[windowID-1].Status = models.SaleWindowCancelled
+	return true, nil
+}
+
+// Helper method for tests
+func (m *MockDatabaseInterface) SaleWindows() []models.SaleWindow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	windows := make([]models.SaleWindow, 0, len(m.saleWindows))
+	for _, window := range m.saleWindows {
+		windows = append(windows, *window)
 	}
-	
-	m.soldItems[saleID]++
-	m.userCounts[userKey]++
-	
-	return true, "success", m.soldItems[saleID], m.userCounts[userKey], nil
+	return windows
 }
 
-func (m *MockRedisInterface) GetSoldItems(ctx context.Context, saleID int) (int, error) {
+// Item catalog operations
+func (m *MockDatabaseInterface) GetItemByID(ctx context.Context, itemID string) (*models.Item, error) {
 	if m.shouldError {
-		return 0, errors.New("mock redis error")
+		return nil, errors.New("mock database error")
 	}
-	return m.soldItems[saleID], nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	item, exists := m.items[itemID]
+	if !exists {
+		return nil, nil
+	}
+	itemCopy := *item
+	return &itemCopy, nil
 }
 
-func (m *MockRedisInterface) GetUserPurchaseCount(ctx context.Context, userID string, saleID int) (int, error) {
+func (m *MockDatabaseInterface) ListItems(ctx context.Context, includeRetired bool) ([]models.Item, error) {
 	if m.shouldError {
-		return 0, errors.New("mock redis error")
+		return nil, errors.New("mock database error")
 	}
-	userKey := userID + "_" + string(rune(saleID))
-	return m.userCounts[userKey], nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := make([]models.Item, 0, len(m.items))
+	for _, item := range m.items {
+		if item.RetiredAt != nil && !includeRetired {
+			continue
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(a, b int) bool { return items[a].ID < items[b].ID })
+	return items, nil
 }
 
-// Sale management
-func (m *MockRedisInterface) SetupSale(ctx context.Context, saleID int, itemsAvailable int) error {
+func (m *MockDatabaseInterface) CreateItems(ctx context.Context, items []models.Item) (int, error) {
 	if m.shouldError {
-		return errors.New("mock redis error")
+		return 0, errors.New("mock database error")
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.soldItems[saleID] = 0
-	return nil
+	created := 0
+	for idx := range items {
+		if _, exists := m.items[items[idx].ID]; exists {
+			continue
+		}
+		item := items[idx]
+		item.CreatedAt = time.Now()
+		m.items[item.ID] = &item
+		created++
+	}
+	return created, nil
 }
 
-func (m *MockRedisInterface) GetActiveSaleID(ctx context.Context) (int, error) {
+func (m *MockDatabaseInterface) UpdateItem(ctx context.Context, item *models.Item) (bool, error) {
 	if m.shouldError {
-		return 0, errors.New("mock redis error")
+		return false, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, exists := m.items[item.ID]
+	if !exists {
+		return false, nil
+	}
+	if stored.Price != item.Price && m.priceLockedLocked(item.ID) {
+		return true, fmt.Errorf("%w: %s", interfaces.ErrItemPriceLocked, item.ID)
+	}
+	stored.Name, stored.Description, stored.Price = item.Name, item.Description, item.Price
+	return true, nil
+}
+
+// priceLockedLocked mirrors the item price lock of PostgresDB; callers hold m.mu
+func (m *MockDatabaseInterface) priceLockedLocked(itemID string) bool {
+	for _, sale := range m.sales {
+		if !sale.Active {
+			continue
+		}
+		if len(m.saleItems[sale.ID]) == 0 {
+			return true
+		}
+		for _, saleItem := range m.saleItems[sale.ID] {
+			if saleItem.ItemID == itemID {
+				return true
+			}
+		}
 	}
-	return 1, nil
+	return false
 }
 
-func (m *MockRedisInterface) SetActiveSaleID(ctx context.Context, saleID int) error {
+func (m *MockDatabaseInterface) UpdateItemPrices(ctx context.Context, prices []models.ItemPrice) error {
 	if m.shouldError {
-		return errors.New("mock redis error")
+		return errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, price := range prices {
+		stored, exists := m.items[price.ItemID]
+		if !exists {
+			return fmt.Errorf("item %s not found", price.ItemID)
+		}
+		if stored.Price != price.Price && m.priceLockedLocked(price.ItemID) {
+			return fmt.Errorf("%w: %s", interfaces.ErrItemPriceLocked, price.ItemID)
+		}
+	}
+	for _, price := range prices {
+		m.items[price.ItemID].Price = price.Price
 	}
 	return nil
 }
 
-// Checkout code management
-func (m *MockRedisInterface) CacheCheckoutCode(ctx context.Context, code string, saleID int, userID string, itemID string) error {
+func (m *MockDatabaseInterface) RetireItem(ctx context.Context, itemID string) (bool, error) {
 	if m.shouldError {
-		return errors.New("mock redis error")
+		return false, errors.New("mock database error")
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.checkoutCodes[code] = true
-	return nil
+	item, exists := m.items[itemID]
+	if !exists {
+		return false, nil
+	}
+	if item.RetiredAt == nil {
+		now := time.Now()
+		item.RetiredAt = &now
+	}
+	return true, nil
 }
 
-func (m *MockRedisInterface) GetCheckoutData(ctx context.Context, code string) (saleID int, userID string, itemID string, err error) {
+// Leader fencing
+func (m *MockDatabaseInterface) AdvanceFencingToken(ctx context.Context, name string, token int64) (bool, error) {
 	if m.shouldError {
-		return 0, "", "", errors.New("mock redis error")
+		return false, errors.New("mock database error")
 	}
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if !m.checkoutCodes[code] {
-		return 0, "", "", errors.New("checkout code not found")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fences == nil {
+		m.fences = make(map[string]int64)
+	}
+	if token < m.fences[name] {
+		return false, nil
+	}
+	m.fences[name] = token
+	return true, nil
+}
+
+// checkFence rejects a write made under a fence whose token is no longer the latest; callers hold m.mu
+func (m *MockDatabaseInterface) checkFence(ctx context.Context) error {
+	fence, ok := interfaces.FenceFromContext(ctx)
+	if !ok || (fence.Token > 0 && m.fences[fence.Name] == fence.Token) {
+		return nil
 	}
-	return 1, "user1", "item1", nil
+	return fmt.Errorf("%s fencing token %d is no longer current: %w", fence.Name, fence.Token, interfaces.ErrLeadershipLost)
 }
 
-func (m *MockRedisInterface) InvalidateCheckoutCode(ctx context.Context, code string) error {
+// Audit operations
+func (m *MockDatabaseInterface) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
 	if m.shouldError {
-		return errors.New("mock redis error")
+		return errors.New("mock database error")
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.checkoutCodes, code)
+	entry.ID = len(m.auditLog) + 1
+	entry.CreatedAt = time.Now()
+	m.auditLog = append(m.auditLog, *entry)
 	return nil
 }
 
-// Compatibility aliases
-func (m *MockRedisInterface) SetCheckoutCode(ctx context.Context, code string, saleID int, userID string, itemID string) error {
-	return m.CacheCheckoutCode(ctx, code, saleID, userID, itemID)
+// Helper method for tests
+func (m *MockDatabaseInterface) AuditEntries() []models.AuditEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]models.AuditEntry, len(m.auditLog))
+	copy(entries, m.auditLog)
+	return entries
 }
 
-func (m *MockRedisInterface) GetCheckoutCode(ctx context.Context, code string) (*models.Checkout, error) {
+// Purchase limit fallback
+func (m *MockDatabaseInterface) GetPurchaseFallback(ctx context.Context, saleID int) (bool, error) {
 	if m.shouldError {
-		return nil, errors.New("mock redis error")
+		return false, errors.New("mock database error")
 	}
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	if !m.checkoutCodes[code] {
-		return nil, errors.New("checkout code not found")
+	return m.fallback[saleID], nil
+}
+
+func (m *MockDatabaseInterface) BeginPurchaseFallback(ctx context.Context, saleID int) (bool, error) {
+	if m.shouldError {
+		return false, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fallback == nil {
+		m.fallback = make(map[int]bool)
+	}
+	if _, exists := m.sales[saleID]; !exists || m.fallback[saleID] {
+		return false, nil
+	}
+	m.fallback[saleID] = true
+	return true, nil
+}
+
+// EndPurchaseFallback holds the lock while restore runs, like the sale row lock in PostgresDB
+func (m *MockDatabaseInterface) EndPurchaseFallback(ctx context.Context, saleID int, restore func(*interfaces.SaleCounters) error) (bool, error) {
+	if m.shouldError {
+		return false, errors.New("mock database error")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sale, exists := m.sales[saleID]
+	if !exists || !m.fallback[saleID] {
+		return false, nil
 	}
-	return &models.Checkout{
-		Code:   code,
-		SaleID: 1,
-		UserID: "user1",
-		ItemID: "item1",
-		Status: "pending",
-	}, nil
+
+	counters := &interfaces.SaleCounters{
+		ItemsAvailable: sale.ItemsAvailable,
+		MaxPerUser:     sale.MaxPerUser,
+		Sold:           sale.ItemsSold,
+		ItemStock:      make(map[string]int),
+		UserCounts:     make(map[string]int),
+	}
+	for _, item := range m.saleItems[saleID] {
+		counters.ItemStock[item.ItemID] = item.Stock - item.Sold
+	}
+	reversed := make(map[string]bool)
+	for _, purchase := range m.purchases {
+		if purchase.Status != models.PurchaseStatusCompleted {
+			reversed[purchase.Code] = true
+		}
+	}
+	for _, checkout := range m.checkouts {
+		if checkout.SaleID != saleID || checkout.Status != "used" {
+			continue
+		}
+		if reversed[checkout.Code] {
+			if _, seen := counters.UserCounts[checkout.UserID]; !seen {
+				counters.UserCounts[checkout.UserID] = 0
+			}
+			continue
+		}
+		counters.UserCounts[checkout.UserID]++
+	}
+
+	if err := restore(counters); err != nil {
+		return false, err
+	}
+	m.fallback[saleID] = false
+	return true, nil
 }
 
-func (m *MockRedisInterface) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string) (*interfaces.PurchaseResult, error) {
+// Transaction support
+func (m *MockDatabaseInterface) BeginTx(ctx context.Context) (interfaces.TxInterface, error) {
 	if m.shouldError {
-		return nil, errors.New("mock redis error")
+		return nil, errors.New("mock database error")
 	}
-	_, status, totalSold, userPurchases, err := m.AtomicPurchase(ctx, saleID, userID, 10000, 10)
-	if err != nil {
-		return nil, err
+	return &MockTx{db: m}, nil
+}
+
+func (m *MockDatabaseInterface) BeginTransaction(ctx context.Context) (interfaces.TxInterface, error) {
+	return m.BeginTx(ctx)
+}
+
+// MockTx implements interfaces.TxInterface.
+// Purchase writes are staged and only applied to the mock database on Commit.
+type MockTx struct {
+	db      *MockDatabaseInterface
+	pending []func() error
+}
+
+func (t *MockTx) Commit() error {
+	if t.db.failCommit {
+		t.pending = nil
+		return errors.New("mock commit error")
 	}
-	
-	return &interfaces.PurchaseResult{
-		Status:        status,
-		UserPurchases: userPurchases,
-		TotalSold:     totalSold,
-		ItemID:        itemID,
-	}, nil
+	for _, apply := range t.pending {
+		if err := apply(); err != nil {
+			return err
+		}
+	}
+	t.pending = nil
+	return nil
 }
 
-// Performance metrics
-func (m *MockRedisInterface) GetConnectionStats() interface{} {
-	return map[string]interface{}{"mock": "stats"}
-} 
\ No newline at end of file
+func (t *MockTx) Rollback() error {
+	t.pending = nil
+	return nil
+}
+
+func (t *MockTx) CreateCheckoutAttempt(ctx context.Context, attempt *models.CheckoutAttempt) error {
+	return t.db.CreateCheckoutAttempt(ctx, attempt)
+}
+
+func (t *MockTx) GetCheckoutAttemptByCode(ctx context.Context, code string) (*models.CheckoutAttempt, error) {
+	return t.db.GetCheckoutAttemptByCode(ctx, code)
+}
+
+func (t *MockTx) UpdateCheckoutAttemptPurchased(ctx context.Context, code string) error {
+	return t.db.UpdateCheckoutAttemptPurchased(ctx, code)
+}
+
+func (t *MockTx) CreatePurchase(ctx context.Context, purchase *models.Purchase) error {
+	t.pending = append(t.pending, func() error { return t.db.CreatePurchase(ctx, purchase) })
+	return nil
+}
+
+func (t *MockTx) UpdateCheckout(ctx context.Context, checkout *models.CheckoutAttempt) error {
+	t.pending = append(t.pending, func() error { return t.db.UpdateCheckout(ctx, checkout) })
+	return nil
+}
+
+func (t *MockTx) IncrementSaleItemsSold(ctx context.Context, saleID int, delta int) error {
+	t.pending = append(t.pending, func() error {
+		t.db.mu.Lock()
+		defer t.db.mu.Unlock()
+		if sale, exists := t.db.sales[saleID]; exists {
+			sale.ItemsSold += delta
+		}
+		return nil
+	})
+	return nil
+}
+
+func (t *MockTx) IncrementSaleItemSold(ctx context.Context, saleID int, itemID string, delta int) error {
+	t.pending = append(t.pending, func() error {
+		t.db.mu.Lock()
+		defer t.db.mu.Unlock()
+		for i := range t.db.saleItems[saleID] {
+			if t.db.saleItems[saleID][i].ItemID == itemID {
+				t.db.saleItems[saleID][i].Sold += delta
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+func (t *MockTx) EnsureRedisLimits(ctx context.Context, saleID int) error {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+	if t.db.fallback[saleID] {
+		return fmt.Errorf("sale %d: %w", saleID, interfaces.ErrPurchaseFallback)
+	}
+	return nil
+}
+
+func (t *MockTx) GetPurchaseByCode(ctx context.Context, code string) (*models.Purchase, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+	for _, purchase := range t.db.purchases {
+		if purchase.Code == code {
+			found := *purchase
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (t *MockTx) UpdatePurchaseStatus(ctx context.Context, purchaseID int, status string) error {
+	t.pending = append(t.pending, func() error {
+		t.db.mu.Lock()
+		defer t.db.mu.Unlock()
+		purchase, exists := t.db.purchases[purchaseID]
+		if !exists {
+			return fmt.Errorf("purchase with ID %d not found", purchaseID)
+		}
+		purchase.Status = status
+		return nil
+	})
+	return nil
+}
+
+// MockRedisInterface runs the real database.RedisClient, Lua scripts included, against an
+// in-process miniredis server, so the tests exercise the same scripts as production.
+type MockRedisInterface struct {
+	*database.RedisClient
+	server       *miniredis.Miniredis
+	forcedStatus interfaces.PurchaseStatus // When set, AttemptPurchase returns this outcome
+}
+
+// NewMockRedis starts a miniredis server that is shut down when the test ends
+func NewMockRedis(t testing.TB) *MockRedisInterface {
+	server := miniredis.RunT(t)
+	client := database.OpenRedisClient(server.Addr(), "", 0)
+	t.Cleanup(func() { client.Close() })
+	return &MockRedisInterface{RedisClient: client, server: server}
+}
+
+// SetError makes every Redis command fail until it is called with false
+func (m *MockRedisInterface) SetError(fail bool) {
+	if fail {
+		m.server.SetError("mock redis error")
+		return
+	}
+	m.server.SetError("")
+}
+
+// SetClock keeps the server's clock and key expiry in step with clock
+func (m *MockRedisInterface) SetClock(clock *MockClock) {
+	m.server.SetTime(clock.Now())
+	clock.OnSet(func(from, to time.Time) {
+		m.server.SetTime(to)
+		if to.After(from) {
+			m.server.FastForward(to.Sub(from))
+		}
+	})
+}
+
+// FlushAll simulates a Redis restart without persistence
+func (m *MockRedisInterface) FlushAll() {
+	m.server.FlushAll()
+}
+
+// LeaseOwner returns the instance holding the named leadership lease
+func (m *MockRedisInterface) LeaseOwner(name string) string {
+	return m.server.HGet("leader:"+name, "owner")
+}
+
+// SaleTTL returns the TTL of the sale's counters
+func (m *MockRedisInterface) SaleTTL(saleID int) time.Duration {
+	return m.server.TTL(fmt.Sprintf("sale:%d:sold", saleID))
+}
+
+// StreamLength returns how many write-behind events are not yet acknowledged
+func (m *MockRedisInterface) StreamLength() int {
+	entries, _ := m.server.Stream("persist:events")
+	return len(entries)
+}
+
+// ItemSubscribers returns how many readers listen for item invalidations
+func (m *MockRedisInterface) ItemSubscribers() int {
+	return m.server.PubSubNumSub("items:invalidate")["items:invalidate"]
+}
+
+func (m *MockRedisInterface) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, event *interfaces.PersistenceEvent) (*interfaces.PurchaseResult, error) {
+	if m.forcedStatus != "" {
+		return &interfaces.PurchaseResult{Status: m.forcedStatus, ItemID: itemID}, nil
+	}
+	return m.RedisClient.AttemptPurchase(ctx, saleID, userID, itemID, code, event)
+}
+
+// newMockSale sets up sale 1 in the mock stores: an active sale of itemsAvailable units,
+// at most maxPerUser per user, selling item1. A stock above 0 limits item1 to that many units.
+func newMockSale(t testing.TB, itemsAvailable, maxPerUser, stock int) (*MockSaleService, *MockItemService, *MockDatabaseInterface, *MockRedisInterface) {
+	ctx := context.Background()
+
+	mockDB := NewMockDatabase()
+	sale := &models.Sale{
+		StartTime:      time.Now().Add(-time.Minute),
+		EndTime:        time.Now().Add(time.Hour),
+		ItemsAvailable: itemsAvailable,
+		MaxPerUser:     maxPerUser,
+		Active:         true,
+	}
+	mockDB.CreateSale(ctx, sale)
+
+	mockSaleService := NewMockSaleService()
+	mockSaleService.currentSale = sale
+
+	mockItemService := NewMockItemService()
+	mockItemService.items["item1"] = &models.Item{ID: "item1", Name: "Test Item", Price: models.NewMoney(9999, "USD")}
+
+	var itemStock map[string]int
+	if stock > 0 {
+		mockDB.CreateSaleItems(ctx, sale.ID, []models.SaleItem{{ItemID: "item1", Stock: stock}})
+		itemStock = map[string]int{"item1": stock}
+	}
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(ctx, sale.ID, itemsAvailable, maxPerUser, itemStock)
+
+	return mockSaleService, mockItemService, mockDB, mockRedis
+}
+
+// MockClock implements interfaces.Clock with manually advanced time
+type MockClock struct {
+	now     time.Time
+	waiters []mockClockWaiter
+	onSet   []func(from, to time.Time)
+	mu      sync.Mutex
+}
+
+type mockClockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *MockClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	deadline := c.now.Add(d)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, mockClockWaiter{deadline: deadline, ch: ch})
+	return ch
+}
+
+// OnSet registers fn to be called whenever the clock is moved
+func (c *MockClock) OnSet(fn func(from, to time.Time)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onSet = append(c.onSet, fn)
+}
+
+// Set moves the clock to t, firing every timer whose deadline has passed
+func (c *MockClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, fn := range c.onSet {
+		fn(c.now, t)
+	}
+	c.now = t
+	remaining := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(t) {
+			remaining = append(remaining, waiter)
+			continue
+		}
+		waiter.ch <- t
+	}
+	c.waiters = remaining
+}
+
+// Advance moves the clock forward by d
+func (c *MockClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Waiters returns the number of pending timers
+func (c *MockClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// NextDeadline returns the earliest pending timer deadline
+func (c *MockClock) NextDeadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return time.Time{}, false
+	}
+	next := c.waiters[0].deadline
+	for _, waiter := range c.waiters[1:] {
+		if waiter.deadline.Before(next) {
+			next = waiter.deadline
+		}
+	}
+	return next, true
+}
@@ -0,0 +1,78 @@
+package unit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"flash-sale-backend/internal/models"
+)
+
+func TestMoney_ParsesAndFormatsExactly(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		minor    int64
+		decimal  string
+	}{
+		{"19.99", "USD", 1999, "19.99"},
+		{"0.1", "USD", 10, "0.10"},
+		{"5.000", "EUR", 500, "5.00"},
+		{"1500", "JPY", 1500, "1500"},
+		{"1.234", "KWD", 1234, "1.234"},
+		{"-0.05", "USD", -5, "-0.05"},
+		{"99999999.99", "USD", 9999999999, "99999999.99"},
+	}
+
+	for _, test := range tests {
+		money, err := models.ParseMoney(test.amount, test.currency)
+		if err != nil || money.Amount != test.minor || money.Decimal() != test.decimal {
+			t.Errorf("ParseMoney(%q, %s) = %+v (%s), %v; expected %d minor units", test.amount, test.currency, money, money.Decimal(), err, test.minor)
+		}
+	}
+
+	for _, invalid := range [][2]string{{"0.001", "USD"}, {"1.5", "JPY"}, {"1e3", "USD"}, {"12.", "USD"}, {"", "USD"}, {"1", "XYZ"}, {"99999999999999999999", "USD"}} {
+		if money, err := models.ParseMoney(invalid[0], invalid[1]); err == nil {
+			t.Errorf("Expected ParseMoney(%q, %s) to fail, got %+v", invalid[0], invalid[1], money)
+		}
+	}
+}
+
+func TestMoney_MulRatioRoundsHalfToEven(t *testing.T) {
+	tests := []struct {
+		amount, num, den, expected int64
+	}{
+		{29999, 80, 100, 23999}, // 239.992 rounds down
+		{1001, 1, 2, 500},       // 500.5 rounds to the even 500
+		{1003, 1, 2, 502},       // 501.5 rounds to the even 502
+		{1, 2, 3, 1},            // 0.667 rounds up
+		{-1003, 1, 2, -502},
+		{-1, 2, 3, -1},
+	}
+
+	for _, test := range tests {
+		if result := models.NewMoney(test.amount, "USD").MulRatio(test.num, test.den); result.Amount != test.expected {
+			t.Errorf("%d * %d/%d = %d, expected %d", test.amount, test.num, test.den, result.Amount, test.expected)
+		}
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	encoded, _ := json.Marshal(models.NewMoney(1999, "EUR"))
+	if string(encoded) != `{"amount":1999,"currency":"EUR"}` {
+		t.Errorf("Unexpected encoding: %s", encoded)
+	}
+
+	// Prices written as decimal numbers, such as purchases queued before the upgrade, are read exactly
+	var purchase models.Purchase
+	if err := json.Unmarshal([]byte(`{"code":"CHK_1","price":0.29}`), &purchase); err != nil || purchase.Price != models.NewMoney(29, models.DefaultCurrency) {
+		t.Errorf("Expected 0.29 to decode to 29 cents, got %+v, %v", purchase.Price, err)
+	}
+
+	var money models.Money
+	if err := json.Unmarshal([]byte(`{"amount":500}`), &money); err != nil || money != models.NewMoney(500, models.DefaultCurrency) {
+		t.Errorf("Expected the default currency, got %+v, %v", money, err)
+	}
+	if err := json.Unmarshal([]byte(`19.999`), &money); err == nil {
+		t.Error("Expected a fractional cent to be rejected")
+	}
+}
@@ -0,0 +1,233 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func TestWriteBehind_ServesCheckoutAndPurchaseFromRedis(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(false)
+	checkoutService.SetWriteBehind(true)
+	purchaseService.SetWriteBehind(true)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService)
+	purchaseHandler := handlers.NewPurchaseHandler(purchaseService)
+	ctx := context.Background()
+
+	// Postgres is not touched while serving requests
+	mockDB.shouldError = true
+	status, response := checkout(checkoutHandler, "user1")
+	if status != http.StatusOK {
+		t.Fatalf("Expected checkout to succeed without Postgres, got status: %d", status)
+	}
+
+	if status, errorCode := purchase(purchaseHandler, response.CheckoutCode); status != http.StatusOK {
+		t.Fatalf("Expected purchase to succeed without Postgres, got %d %q", status, errorCode)
+	}
+	mockDB.shouldError = false
+
+	writer := services.NewPersistenceWriter(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", 100, time.Second)
+	mockRedis.EnsurePersistenceGroup(ctx)
+	if persisted, err := writer.Flush(ctx); err != nil || persisted != 2 {
+		t.Fatalf("Expected checkout and purchase to be persisted, got %d, %v", persisted, err)
+	}
+
+	checkout, _ := mockDB.GetCheckoutByCode(ctx, response.CheckoutCode)
+	if checkout == nil || checkout.Status != "used" || !checkout.Purchased {
+		t.Errorf("Expected checkout to be recorded as used, got %+v", checkout)
+	}
+
+	if len(mockDB.purchases) != 1 || mockDB.purchases[1].CheckoutID != checkout.ID {
+		t.Errorf("Expected 1 purchase linked to the checkout, got %+v", mockDB.purchases)
+	}
+
+	if sale, _ := mockDB.GetSaleByID(ctx, 1); sale.ItemsSold != 1 {
+		t.Errorf("Expected 1 item sold in Postgres, got: %d", sale.ItemsSold)
+	}
+
+	if mockRedis.StreamLength() != 0 {
+		t.Errorf("Expected the stream to be drained, got %d events", mockRedis.StreamLength())
+	}
+}
+
+func TestWriteBehind_QueuesEventsWithTheReservationAndPurchase(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetWriteBehind(true)
+	purchaseService.SetWriteBehind(true)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService)
+	purchaseHandler := handlers.NewPurchaseHandler(purchaseService)
+	ctx := context.Background()
+
+	// The reservation and its checkout event are written in one step
+	status, response := checkout(checkoutHandler, "user1")
+	if status != http.StatusOK {
+		t.Fatalf("Expected checkout to succeed, got status: %d", status)
+	}
+
+	if mockRedis.StreamLength() != 1 {
+		t.Fatalf("Expected the checkout to be queued with its reservation, got %d events", mockRedis.StreamLength())
+	}
+
+	// So are the purchase counters and the purchase event
+	if status, errorCode := purchase(purchaseHandler, response.CheckoutCode); status != http.StatusOK {
+		t.Fatalf("Expected purchase to succeed, got %d %q", status, errorCode)
+	}
+
+	if mockRedis.StreamLength() != 2 {
+		t.Fatalf("Expected the purchase to be queued once by the purchase script, got %d events", mockRedis.StreamLength())
+	}
+
+	writer := services.NewPersistenceWriter(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", 100, time.Second)
+	mockRedis.EnsurePersistenceGroup(ctx)
+	if persisted, err := writer.Flush(ctx); err != nil || persisted != 2 {
+		t.Fatalf("Expected checkout and purchase to be persisted, got %d, %v", persisted, err)
+	}
+
+	if len(mockDB.purchases) != 1 {
+		t.Errorf("Expected 1 purchase, got: %d", len(mockDB.purchases))
+	}
+}
+
+func TestPersistenceWriter_RetriesUntilPersisted(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockDB.CreateSale(context.Background(), &models.Sale{ItemsAvailable: 10, MaxPerUser: 2, Active: true})
+	mockRedis := NewMockRedis(t)
+	clock := NewMockClock(time.Now())
+	mockRedis.SetClock(clock)
+	ctx := context.Background()
+
+	checkout := &models.CheckoutAttempt{Code: "CHK_retry_1", SaleID: 1, UserID: "user1", ItemID: "item1", Status: "pending", ExpiresAt: time.Now().Add(time.Minute)}
+	purchase := &models.Purchase{Code: "CHK_retry_1", SaleID: 1, UserID: "user1", ItemID: "item1", Price: models.NewMoney(9999, "USD"), Status: "completed", PurchasedAt: time.Now()}
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistCheckout, Checkout: checkout})
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistPurchase, Purchase: purchase})
+
+	writer := services.NewPersistenceWriter(mockDB, mockRedis, clock, "replica-a", 100, time.Second)
+	mockRedis.EnsurePersistenceGroup(ctx)
+
+	// Postgres is down: nothing is acknowledged
+	mockDB.failCommit = true
+	if persisted, _ := writer.Flush(ctx); persisted != 0 {
+		t.Fatalf("Expected nothing persisted while Postgres fails, got: %d", persisted)
+	}
+	mockDB.failCommit = false
+
+	// The failed events are retried, by any writer, once they have been idle long enough
+	other := services.NewPersistenceWriter(mockDB, mockRedis, clock, "replica-b", 100, time.Second)
+	if persisted, _ := other.Flush(ctx); persisted != 0 {
+		t.Errorf("Expected pending events to wait before being retried, got: %d", persisted)
+	}
+
+	clock.Advance(services.PersistenceClaimIdle)
+	if persisted, err := other.Flush(ctx); err != nil || persisted != 2 {
+		t.Fatalf("Expected pending events to be persisted on retry, got %d, %v", persisted, err)
+	}
+
+	// A redelivered purchase is a no-op
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistPurchase, Purchase: purchase})
+	writer.Flush(ctx)
+
+	if len(mockDB.purchases) != 1 {
+		t.Errorf("Expected 1 purchase after redelivery, got: %d", len(mockDB.purchases))
+	}
+
+	if sale, _ := mockDB.GetSaleByID(ctx, 1); sale.ItemsSold != 1 {
+		t.Errorf("Expected the purchase to be counted once, got: %d", sale.ItemsSold)
+	}
+
+	// An event that can never be persisted does not hold back the rest of its batch
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: "bogus"})
+	next := *checkout
+	next.Code = "CHK_retry_2"
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistCheckout, Checkout: &next})
+
+	if persisted, _ := writer.Flush(ctx); persisted != 1 {
+		t.Errorf("Expected the valid event to be persisted, got: %d", persisted)
+	}
+
+	if stored, _ := mockDB.GetCheckoutByCode(ctx, "CHK_retry_2"); stored == nil {
+		t.Error("Expected CHK_retry_2 to be persisted")
+	}
+
+	if mockRedis.StreamLength() != 1 {
+		t.Errorf("Expected only the bad event to stay pending, got %d", mockRedis.StreamLength())
+	}
+}
+
+func TestPersistenceWriter_KeepsPurchaseBehindItsCheckout(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockDB.CreateSale(context.Background(), &models.Sale{ItemsAvailable: 10, MaxPerUser: 2, Active: true})
+	mockRedis := NewMockRedis(t)
+	clock := NewMockClock(time.Now())
+	mockRedis.SetClock(clock)
+	ctx := context.Background()
+
+	checkout := &models.CheckoutAttempt{Code: "CHK_order_1", SaleID: 1, UserID: "user1", ItemID: "item1", Status: "pending", ExpiresAt: time.Now().Add(time.Minute)}
+	purchase := &models.Purchase{Code: "CHK_order_1", SaleID: 1, UserID: "user1", ItemID: "item1", Price: models.NewMoney(9999, "USD"), Status: "completed", PurchasedAt: time.Now()}
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistCheckout, Checkout: checkout})
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistPurchase, Purchase: purchase})
+
+	writer := services.NewPersistenceWriter(mockDB, mockRedis, clock, "replica-a", 100, time.Second)
+	mockRedis.EnsurePersistenceGroup(ctx)
+
+	// The checkout fails, so its purchase is held back rather than applied first
+	mockDB.failPersist = checkout.Code
+	if persisted, _ := writer.Flush(ctx); persisted != 0 {
+		t.Fatalf("Expected the purchase to wait for its checkout, got %d persisted", persisted)
+	}
+
+	if len(mockDB.purchases) != 0 {
+		t.Fatalf("Expected no purchase before its checkout, got: %d", len(mockDB.purchases))
+	}
+	mockDB.failPersist = ""
+
+	clock.Advance(services.PersistenceClaimIdle)
+	if persisted, err := writer.Flush(ctx); err != nil || persisted != 2 {
+		t.Fatalf("Expected checkout and purchase to be persisted on retry, got %d, %v", persisted, err)
+	}
+
+	stored, _ := mockDB.GetCheckoutByCode(ctx, checkout.Code)
+	if stored == nil || stored.Status != "used" || mockDB.purchases[1].CheckoutID != stored.ID {
+		t.Errorf("Expected the checkout to be used and linked to its purchase, got %+v", stored)
+	}
+}
+
+func TestPersistenceWriter_CheckoutAfterItsPurchaseIsUsed(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockDB.CreateSale(context.Background(), &models.Sale{ItemsAvailable: 10, MaxPerUser: 2, Active: true})
+	mockRedis := NewMockRedis(t)
+	ctx := context.Background()
+
+	// A redelivered checkout can reach Postgres after its purchase
+	checkout := &models.CheckoutAttempt{Code: "CHK_late_1", SaleID: 1, UserID: "user1", ItemID: "item1", Status: "pending", ExpiresAt: time.Now().Add(time.Minute)}
+	purchase := &models.Purchase{Code: "CHK_late_1", SaleID: 1, UserID: "user1", ItemID: "item1", Price: models.NewMoney(9999, "USD"), Status: "completed", PurchasedAt: time.Now()}
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistPurchase, Purchase: purchase})
+	mockRedis.EnqueuePersistence(ctx, &interfaces.PersistenceEvent{Type: interfaces.PersistCheckout, Checkout: checkout})
+
+	writer := services.NewPersistenceWriter(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", 100, time.Second)
+	mockRedis.EnsurePersistenceGroup(ctx)
+	if persisted, err := writer.Flush(ctx); err != nil || persisted != 2 {
+		t.Fatalf("Expected both events to be persisted, got %d, %v", persisted, err)
+	}
+
+	stored, _ := mockDB.GetCheckoutByCode(ctx, checkout.Code)
+	if stored == nil || stored.Status != "used" || !stored.Purchased {
+		t.Fatalf("Expected the late checkout to be recorded as used, got %+v", stored)
+	}
+
+	if mockDB.purchases[1].CheckoutID != stored.ID {
+		t.Errorf("Expected the purchase to be linked to the late checkout, got: %d", mockDB.purchases[1].CheckoutID)
+	}
+}
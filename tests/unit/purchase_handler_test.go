@@ -2,14 +2,18 @@ package unit
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"flash-sale-backend/internal/database"
 	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
 )
 
 func TestPurchaseHandler_ValidPurchase(t *testing.T) {
@@ -26,11 +30,12 @@ func TestPurchaseHandler_ValidPurchase(t *testing.T) {
 	mockItemService.items["item1"] = &models.Item{
 		ID:    "item1", 
 		Name:  "Test Item", 
-		Price: 99.99,
+		Price: models.NewMoney(9999, "USD"),
 	}
 	
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(context.Background(), 1, 10000, 10, nil)
 
 	// Create a valid checkout first
 	checkout := &models.CheckoutAttempt{
@@ -44,7 +49,7 @@ func TestPurchaseHandler_ValidPurchase(t *testing.T) {
 	}
 	mockDB.checkouts[checkout.Code] = checkout
 
-	handler := handlers.NewPurchaseHandler(mockSaleService, mockItemService, mockDB, mockRedis)
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
 
 	// Test valid purchase request
 	requestBody := map[string]string{
@@ -79,7 +84,7 @@ func TestPurchaseHandler_ValidPurchase(t *testing.T) {
 }
 
 func TestPurchaseHandler_InvalidMethod(t *testing.T) {
-	handler := handlers.NewPurchaseHandler(nil, nil, nil, nil)
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(nil, nil, nil, nil))
 
 	req := httptest.NewRequest("GET", "/purchase", nil)
 	w := httptest.NewRecorder()
@@ -92,7 +97,7 @@ func TestPurchaseHandler_InvalidMethod(t *testing.T) {
 }
 
 func TestPurchaseHandler_MissingCheckoutCode(t *testing.T) {
-	handler := handlers.NewPurchaseHandler(nil, nil, nil, nil)
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(nil, nil, nil, nil))
 
 	// Test empty request body
 	req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer([]byte("{}")))
@@ -117,7 +122,8 @@ func TestPurchaseHandler_ExpiredCheckout(t *testing.T) {
 	
 	mockItemService := NewMockItemService()
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(context.Background(), 1, 10000, 10, nil)
 
 	// Create an expired checkout
 	checkout := &models.CheckoutAttempt{
@@ -131,7 +137,7 @@ func TestPurchaseHandler_ExpiredCheckout(t *testing.T) {
 	}
 	mockDB.checkouts[checkout.Code] = checkout
 
-	handler := handlers.NewPurchaseHandler(mockSaleService, mockItemService, mockDB, mockRedis)
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
 
 	requestBody := map[string]string{
 		"checkout_code": "CHK_expired_123",
@@ -154,4 +160,307 @@ func TestPurchaseHandler_ExpiredCheckout(t *testing.T) {
 	if message, ok := response["message"].(string); !ok || message != "Checkout code has expired" {
 		t.Error("Expected 'Checkout code has expired' message")
 	}
-} 
\ No newline at end of file
+} 
+
+// The mock Redis runs atomicPurchaseLua, so this checks that the script lets exactly
+// one request consume the code and that the service and handler report the rest as conflicts.
+func TestPurchaseHandler_ConcurrentSameCode(t *testing.T) {
+	mockSaleService := NewMockSaleService()
+	mockSaleService.currentSale = &models.Sale{
+		ID:        1,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Hour),
+		Active:    true,
+	}
+
+	mockItemService := NewMockItemService()
+	mockItemService.items["item1"] = &models.Item{
+		ID:    "item1",
+		Name:  "Test Item",
+		Price: models.NewMoney(9999, "USD"),
+	}
+
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(context.Background(), 1, 10000, 10, nil)
+
+	checkout := &models.CheckoutAttempt{
+		Code:      "CHK_race_123",
+		SaleID:    1,
+		UserID:    "user123",
+		ItemID:    "item1",
+		Status:    "pending",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+		CreatedAt: time.Now(),
+	}
+	mockDB.checkouts[checkout.Code] = checkout
+
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
+
+	numRequests := 50
+	results := make(chan int, numRequests)
+
+	// Fire the same checkout code from many goroutines at once
+	for i := 0; i < numRequests; i++ {
+		go func() {
+			jsonBody, _ := json.Marshal(map[string]string{"checkout_code": checkout.Code})
+			req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.HandlePurchase(w, req)
+			results <- w.Code
+		}()
+	}
+
+	successCount, conflictCount := 0, 0
+	for i := 0; i < numRequests; i++ {
+		switch <-results {
+		case http.StatusOK:
+			successCount++
+		case http.StatusConflict:
+			conflictCount++
+		}
+	}
+
+	if successCount != 1 {
+		t.Errorf("Expected exactly 1 successful purchase, got: %d", successCount)
+	}
+
+	if conflictCount != numRequests-1 {
+		t.Errorf("Expected %d 'already used' responses, got: %d", numRequests-1, conflictCount)
+	}
+
+	if len(mockDB.purchases) != 1 {
+		t.Errorf("Expected 1 purchase record, got: %d", len(mockDB.purchases))
+	}
+
+	if sold, _ := mockRedis.GetSoldItems(context.Background(), 1); sold != 1 {
+		t.Errorf("Expected 1 item sold, got: %d", sold)
+	}
+}
+
+func TestPurchaseHandler_CommitFailureRevertsRedis(t *testing.T) {
+	mockSaleService := NewMockSaleService()
+	mockSaleService.currentSale = &models.Sale{
+		ID:        1,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Hour),
+		Active:    true,
+	}
+
+	mockItemService := NewMockItemService()
+	mockItemService.items["item1"] = &models.Item{
+		ID:    "item1",
+		Name:  "Test Item",
+		Price: models.NewMoney(9999, "USD"),
+	}
+
+	mockDB := NewMockDatabase()
+	mockDB.failCommit = true
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(context.Background(), 1, 10000, 10, nil)
+
+	checkout := &models.CheckoutAttempt{
+		Code:      "CHK_commit_123",
+		SaleID:    1,
+		UserID:    "user123",
+		ItemID:    "item1",
+		Status:    "pending",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+		CreatedAt: time.Now(),
+	}
+	mockDB.checkouts[checkout.Code] = checkout
+
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
+
+	jsonBody, _ := json.Marshal(map[string]string{"checkout_code": checkout.Code})
+	req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandlePurchase(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got: %d", w.Code)
+	}
+
+	// Nothing from the rolled back transaction should be visible
+	if len(mockDB.purchases) != 0 {
+		t.Errorf("Expected no purchase records, got: %d", len(mockDB.purchases))
+	}
+
+	if mockDB.checkouts[checkout.Code].Status != "pending" {
+		t.Errorf("Expected checkout to stay pending, got: %s", mockDB.checkouts[checkout.Code].Status)
+	}
+
+	// Redis counters should have been compensated
+	ctx := context.Background()
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 0 {
+		t.Errorf("Expected sold count reverted to 0, got: %d", sold)
+	}
+
+	if count, _ := mockRedis.GetUserPurchaseCount(ctx, "user123", 1); count != 0 {
+		t.Errorf("Expected user count reverted to 0, got: %d", count)
+	}
+
+	// The code is released, so a retry after the database recovers succeeds
+	mockDB.failCommit = false
+	req = httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+
+	handler.HandlePurchase(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected retry to succeed with status 200, got: %d", w.Code)
+	}
+}
+
+func TestPurchaseHandler_ItemSoldOut(t *testing.T) {
+	mockSaleService := NewMockSaleService()
+	mockSaleService.currentSale = &models.Sale{
+		ID:        1,
+		StartTime: time.Now().Add(-time.Minute),
+		EndTime:   time.Now().Add(time.Hour),
+		Active:    true,
+	}
+
+	mockItemService := NewMockItemService()
+	mockItemService.items["item1"] = &models.Item{
+		ID:    "item1",
+		Name:  "Test Item",
+		Price: models.NewMoney(9999, "USD"),
+	}
+
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	// Only one unit of item1 even though the sale-wide cap is much higher
+	mockRedis.SetupSale(context.Background(), 1, 10000, 10, map[string]int{"item1": 1})
+
+	for _, code := range []string{"CHK_stock_1", "CHK_stock_2"} {
+		mockDB.checkouts[code] = &models.CheckoutAttempt{
+			Code:      code,
+			SaleID:    1,
+			UserID:    "user_" + code,
+			ItemID:    "item1",
+			Status:    "pending",
+			ExpiresAt: time.Now().Add(10 * time.Minute),
+			CreatedAt: time.Now(),
+		}
+	}
+
+	handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
+
+	purchase := func(code string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(map[string]string{"checkout_code": code})
+		req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.HandlePurchase(w, req)
+		return w
+	}
+
+	if w := purchase("CHK_stock_1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected first purchase to succeed, got: %d", w.Code)
+	}
+
+	w := purchase("CHK_stock_2")
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got: %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if soldOut, ok := response["sold_out"].(bool); !ok || !soldOut {
+		t.Error("Expected sold_out: true")
+	}
+}
+
+func TestPurchaseHandler_OutcomeMapping(t *testing.T) {
+	expected := map[interfaces.PurchaseStatus]int{
+		interfaces.PurchaseSuccess:           http.StatusOK,
+		interfaces.PurchaseSaleSoldOut:       http.StatusConflict,
+		interfaces.PurchaseItemSoldOut:       http.StatusConflict,
+		interfaces.PurchaseUserLimitExceeded: http.StatusConflict,
+		interfaces.PurchaseCodeAlreadyUsed:   http.StatusConflict,
+		interfaces.PurchaseItemNotInSale:     http.StatusBadRequest,
+		interfaces.PurchaseSaleNotActive:     http.StatusBadRequest,
+		interfaces.PurchaseSaleRebuilding:    http.StatusServiceUnavailable,
+	}
+
+	// Every outcome must have a documented mapping
+	for _, status := range interfaces.PurchaseStatuses {
+		if _, ok := expected[status]; !ok {
+			t.Errorf("No expected HTTP status for purchase outcome %q", status)
+		}
+	}
+
+	// Every outcome the Lua scripts return must reach the client
+	for _, status := range database.ScriptPurchaseStatuses {
+		if _, ok := expected[status]; !ok || !status.Valid() {
+			t.Errorf("Lua script outcome %q is not a mapped interfaces.PurchaseStatus", status)
+		}
+	}
+
+	for status, wantCode := range expected {
+		t.Run(string(status), func(t *testing.T) {
+			mockSaleService := NewMockSaleService()
+			mockSaleService.currentSale = &models.Sale{
+				ID:         1,
+				StartTime:  time.Now().Add(-time.Minute),
+				EndTime:    time.Now().Add(time.Hour),
+				MaxPerUser: 10,
+				Active:     true,
+			}
+
+			mockItemService := NewMockItemService()
+			mockItemService.items["item1"] = &models.Item{ID: "item1", Name: "Test Item", Price: models.NewMoney(9999, "USD")}
+
+			mockDB := NewMockDatabase()
+			mockRedis := NewMockRedis(t)
+			if status != interfaces.PurchaseSuccess {
+				mockRedis.forcedStatus = status
+			} else {
+				mockRedis.SetupSale(context.Background(), 1, 10000, 10, nil)
+			}
+
+			mockDB.checkouts["CHK_outcome_1"] = &models.CheckoutAttempt{
+				Code:      "CHK_outcome_1",
+				SaleID:    1,
+				UserID:    "user123",
+				ItemID:    "item1",
+				Status:    "pending",
+				ExpiresAt: time.Now().Add(10 * time.Minute),
+				CreatedAt: time.Now(),
+			}
+
+			handler := handlers.NewPurchaseHandler(services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis))
+
+			jsonBody, _ := json.Marshal(map[string]string{"checkout_code": "CHK_outcome_1"})
+			req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.HandlePurchase(w, req)
+
+			if w.Code != wantCode {
+				t.Errorf("Expected status %d, got: %d", wantCode, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response JSON: %v", err)
+			}
+
+			errorCode, _ := response["error_code"].(string)
+			if status == interfaces.PurchaseSuccess {
+				if errorCode != "" {
+					t.Errorf("Expected no error_code on success, got: %s", errorCode)
+				}
+			} else if errorCode != string(status) {
+				t.Errorf("Expected error_code %q, got: %q", status, errorCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+// unreachableRedis is a replica's view of Redis during a network partition: other
+// replicas still reach the shared instance
+type unreachableRedis struct {
+	*MockRedisInterface
+}
+
+func (u *unreachableRedis) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func (u *unreachableRedis) AttemptPurchase(ctx context.Context, saleID int, userID string, itemID string, code string, event *interfaces.PersistenceEvent) (*interfaces.PurchaseResult, error) {
+	return nil, errors.New("connection refused")
+}
+
+// addCheckout stores a pending checkout code for user in the mock database
+func addCheckout(mockDB *MockDatabaseInterface, code, userID string) {
+	mockDB.CreateCheckout(context.Background(), &models.CheckoutAttempt{
+		Code:      code,
+		SaleID:    1,
+		UserID:    userID,
+		ItemID:    "item1",
+		Status:    "pending",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	})
+}
+
+// purchase posts a checkout code and returns the status code and error_code
+func purchase(handler *handlers.PurchaseHandler, code string) (int, string) {
+	jsonBody, _ := json.Marshal(map[string]string{"checkout_code": code})
+	req := httptest.NewRequest("POST", "/purchase", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.HandlePurchase(w, req)
+
+	var response handlers.PurchaseResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.ErrorCode
+}
+
+func TestFailoverPurchaseLimiter_EnforcesLimitsInPostgres(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 0)
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	purchaseService.SetPurchaseLimiter(limiter)
+	handler := handlers.NewPurchaseHandler(purchaseService)
+	mockRedis.SetError(true)
+
+	for i := 1; i <= 3; i++ {
+		addCheckout(mockDB, fmt.Sprintf("CHK_user1_%d", i), "user1")
+	}
+	addCheckout(mockDB, "CHK_user2_1", "user2")
+	addCheckout(mockDB, "CHK_user2_2", "user2")
+
+	tests := []struct {
+		code       string
+		wantStatus int
+		wantError  string
+	}{
+		{"CHK_user1_1", http.StatusOK, ""},
+		{"CHK_user1_1", http.StatusConflict, string(interfaces.PurchaseCodeAlreadyUsed)},
+		{"CHK_user1_2", http.StatusOK, ""},
+		{"CHK_user1_3", http.StatusConflict, string(interfaces.PurchaseUserLimitExceeded)},
+		{"CHK_user2_1", http.StatusOK, ""},
+		{"CHK_user2_2", http.StatusConflict, string(interfaces.PurchaseSaleSoldOut)},
+	}
+
+	for _, tt := range tests {
+		status, errorCode := purchase(handler, tt.code)
+		if status != tt.wantStatus || errorCode != tt.wantError {
+			t.Errorf("Purchase with %s: expected %d %q, got %d %q", tt.code, tt.wantStatus, tt.wantError, status, errorCode)
+		}
+	}
+
+	// The limiter counted each purchase once; recording it must not count it again
+	sale, _ := mockDB.GetSaleByID(context.Background(), 1)
+	if sale.ItemsSold != 3 {
+		t.Errorf("Expected 3 items sold in Postgres, got: %d", sale.ItemsSold)
+	}
+
+	if len(mockDB.purchases) != 3 {
+		t.Errorf("Expected 3 purchase records, got: %d", len(mockDB.purchases))
+	}
+}
+
+func TestFailoverPurchaseLimiter_ConcurrentFallbackDoesNotOversell(t *testing.T) {
+	const itemsAvailable, buyers = 10, 50
+
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, itemsAvailable, 1, 0)
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	purchaseService.SetPurchaseLimiter(limiter)
+	handler := handlers.NewPurchaseHandler(purchaseService)
+	mockRedis.SetError(true)
+
+	for i := 0; i < buyers; i++ {
+		addCheckout(mockDB, fmt.Sprintf("CHK_buyer_%d", i), fmt.Sprintf("buyer%d", i))
+	}
+
+	results := make(chan int, buyers)
+	for i := 0; i < buyers; i++ {
+		go func(i int) {
+			status, _ := purchase(handler, fmt.Sprintf("CHK_buyer_%d", i))
+			results <- status
+		}(i)
+	}
+
+	successCount, soldOutCount := 0, 0
+	for i := 0; i < buyers; i++ {
+		switch <-results {
+		case http.StatusOK:
+			successCount++
+		case http.StatusConflict:
+			soldOutCount++
+		}
+	}
+
+	if successCount != itemsAvailable || soldOutCount != buyers-itemsAvailable {
+		t.Errorf("Expected %d purchases and %d sold out, got %d and %d", itemsAvailable, buyers-itemsAvailable, successCount, soldOutCount)
+	}
+
+	if sale, _ := mockDB.GetSaleByID(context.Background(), 1); sale.ItemsSold != itemsAvailable {
+		t.Errorf("Expected %d items sold in Postgres, got: %d", itemsAvailable, sale.ItemsSold)
+	}
+}
+
+func TestFailoverPurchaseLimiter_CommitFailureRevertsPostgres(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 10, 2, 0)
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	purchaseService.SetPurchaseLimiter(limiter)
+	handler := handlers.NewPurchaseHandler(purchaseService)
+	mockRedis.SetError(true)
+	mockDB.failCommit = true
+	addCheckout(mockDB, "CHK_commit_123", "user1")
+
+	if status, _ := purchase(handler, "CHK_commit_123"); status != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got: %d", status)
+	}
+
+	checkout, _ := mockDB.GetCheckoutByCode(context.Background(), "CHK_commit_123")
+	if checkout.Status != "pending" {
+		t.Errorf("Expected checkout to be released, got status: %s", checkout.Status)
+	}
+
+	if sale, _ := mockDB.GetSaleByID(context.Background(), 1); sale.ItemsSold != 0 {
+		t.Errorf("Expected sold count reverted to 0, got: %d", sale.ItemsSold)
+	}
+
+	// The retry succeeds once the database recovers
+	mockDB.failCommit = false
+	if status, _ := purchase(handler, "CHK_commit_123"); status != http.StatusOK {
+		t.Errorf("Expected retry to succeed with status 200, got: %d", status)
+	}
+}
+
+func TestFailoverPurchaseLimiter_SwitchesOnHealthChecks(t *testing.T) {
+	_, _, mockDB, mockRedis := newMockSale(t, 10, 5, 0)
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		addCheckout(mockDB, fmt.Sprintf("CHK_health_%d", i), "user1")
+	}
+
+	// Healthy: Redis enforces the limits and Postgres counters are left to the purchase record
+	result, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_health_1", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || result.DatabaseCounted {
+		t.Fatalf("Expected a Redis purchase, got %+v, %v", result, err)
+	}
+
+	// Redis goes down: the next health check switches to Postgres
+	mockRedis.SetError(true)
+	if limiter.CheckHealth(ctx) {
+		t.Fatal("Expected health check to fail")
+	}
+
+	result, err = limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_health_2", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || !result.DatabaseCounted {
+		t.Fatalf("Expected a Postgres purchase, got %+v, %v", result, err)
+	}
+
+	// Redis recovers, but its counters for sale 1 miss the Postgres purchase, so the sale stays
+	// on Postgres until the counter reconciler rebuilds them
+	mockRedis.SetError(false)
+	if !limiter.CheckHealth(ctx) || !limiter.Healthy() {
+		t.Fatal("Expected health check to pass")
+	}
+
+	result, err = limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_health_3", nil)
+	if err != nil || !result.DatabaseCounted {
+		t.Errorf("Expected sale 1 to stay on Postgres, got %+v, %v", result, err)
+	}
+
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 1 {
+		t.Errorf("Expected Redis to count only the first purchase, got: %d", sold)
+	}
+
+	// A sale that never fell back uses Redis again
+	mockRedis.SetupSale(ctx, 2, 10, 5, nil)
+	result, err = limiter.AttemptPurchase(ctx, 2, "user1", "item1", "CHK_other_sale", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || result.DatabaseCounted {
+		t.Errorf("Expected sale 2 to use Redis, got %+v, %v", result, err)
+	}
+}
+
+func TestFailoverPurchaseLimiter_FallbackIsSharedAcrossReplicas(t *testing.T) {
+	_, _, mockDB, mockRedis := newMockSale(t, 3, 2, 0)
+	healthy := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	partitioned := services.NewFailoverPurchaseLimiter(&unreachableRedis{mockRedis}, mockDB, NewMockClock(time.Now()), time.Second)
+	ctx := context.Background()
+	for i := 1; i <= 4; i++ {
+		addCheckout(mockDB, fmt.Sprintf("CHK_shared_%d", i), fmt.Sprintf("user%d", i))
+	}
+
+	// The partitioned replica moves the sale to Postgres
+	result, err := partitioned.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_shared_1", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || !result.DatabaseCounted {
+		t.Fatalf("Expected a Postgres purchase, got %+v, %v", result, err)
+	}
+
+	// A replica that still reaches Redis follows it instead of checking its own counters
+	result, err = healthy.AttemptPurchase(ctx, 1, "user2", "item1", "CHK_shared_2", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || !result.DatabaseCounted {
+		t.Fatalf("Expected the healthy replica to use Postgres too, got %+v, %v", result, err)
+	}
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 0 {
+		t.Errorf("Expected no purchases counted in Redis, got %d", sold)
+	}
+
+	// Once Redis is reachable, its counters are rebuilt from Postgres before the sale moves back
+	reconciler := services.NewCounterReconciler(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", time.Second)
+	if restored, err := reconciler.Reconcile(ctx); err != nil || !restored {
+		t.Fatalf("Expected the sale to move back to Redis, got %t, %v", restored, err)
+	}
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 2 {
+		t.Errorf("Expected Redis to count the 2 Postgres purchases, got %d", sold)
+	}
+
+	// The healthy replica's cached flag is stale: Postgres refuses the purchase and the retry uses Redis
+	result, err = healthy.AttemptPurchase(ctx, 1, "user3", "item1", "CHK_shared_3", nil)
+	if err != nil || result.Status != interfaces.PurchaseSaleRebuilding {
+		t.Fatalf("Expected a stale fallback flag to get sale_rebuilding, got %+v, %v", result, err)
+	}
+	result, err = healthy.AttemptPurchase(ctx, 1, "user3", "item1", "CHK_shared_3", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || result.DatabaseCounted {
+		t.Fatalf("Expected a Redis purchase, got %+v, %v", result, err)
+	}
+
+	// The sale-wide cap of 3 holds across both stores
+	result, err = healthy.AttemptPurchase(ctx, 1, "user4", "item1", "CHK_shared_4", nil)
+	if err != nil || result.Status != interfaces.PurchaseSaleSoldOut {
+		t.Errorf("Expected the sale to be sold out, got %+v, %v", result, err)
+	}
+
+	// A purchase counted in Redis cannot be recorded after the sale moves to Postgres again
+	mockDB.BeginPurchaseFallback(ctx, 1)
+	tx, _ := mockDB.BeginTransaction(ctx)
+	if err := tx.EnsureRedisLimits(ctx, 1); !errors.Is(err, interfaces.ErrPurchaseFallback) {
+		t.Errorf("Expected the Redis purchase to be refused, got %v", err)
+	}
+}
+
+func TestFailoverPurchaseLimiter_RefusesFallbackWithWriteBehind(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 10, 2, 0)
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	purchaseService.SetPurchaseLimiter(limiter)
+	handler := handlers.NewPurchaseHandler(purchaseService)
+	limiter.SetWriteBehind(true)
+	mockRedis.SetError(true)
+	addCheckout(mockDB, "CHK_queued_1", "user1")
+
+	// Postgres may be missing purchases still queued in the stream, so it cannot take over
+	if status, errorCode := purchase(handler, "CHK_queued_1"); status != http.StatusServiceUnavailable || errorCode != string(interfaces.PurchaseSaleRebuilding) {
+		t.Errorf("Expected 503 sale_rebuilding, got %d %q", status, errorCode)
+	}
+
+	if fallback, _ := mockDB.GetPurchaseFallback(context.Background(), 1); fallback {
+		t.Error("Expected the sale to stay on Redis")
+	}
+	if checkout, _ := mockDB.GetCheckoutByCode(context.Background(), "CHK_queued_1"); checkout.Status != "pending" {
+		t.Errorf("Expected the checkout code to stay unused, got %s", checkout.Status)
+	}
+}
+
+func TestFailoverPurchaseLimiter_WriteBehindStaysOffPostgres(t *testing.T) {
+	ctx := context.Background()
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	mockRedis.SetupSale(ctx, 1, 10, 2, nil)
+
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, NewMockClock(time.Now()), time.Second)
+	limiter.SetWriteBehind(true)
+
+	// The fallback can never be used, so an unreachable Postgres does not fail the purchase
+	mockDB.shouldError = true
+	result, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_wb_1", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess {
+		t.Fatalf("Expected a Redis purchase without Postgres, got %+v, %v", result, err)
+	}
+
+	if err := limiter.RevertPurchase(ctx, 1, "user1", "item1", "CHK_wb_1"); err != nil {
+		t.Errorf("Expected the revert to stay on Redis, got %v", err)
+	}
+}
+
+func TestFailoverPurchaseLimiter_CachesFallbackFlag(t *testing.T) {
+	_, _, mockDB, mockRedis := newMockSale(t, 10, 5, 0)
+	clock := NewMockClock(time.Now())
+	limiter := services.NewFailoverPurchaseLimiter(mockRedis, mockDB, clock, time.Second)
+	ctx := context.Background()
+	for i := 1; i <= 4; i++ {
+		addCheckout(mockDB, fmt.Sprintf("CHK_cached_%d", i), "user1")
+	}
+
+	if result, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_cached_1", nil); err != nil || result.Status != interfaces.PurchaseSuccess {
+		t.Fatalf("Expected a Redis purchase, got %+v, %v", result, err)
+	}
+
+	// Within the TTL, Redis purchases do not read the flag from Postgres
+	mockDB.shouldError = true
+	if result, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_cached_2", nil); err != nil || result.Status != interfaces.PurchaseSuccess {
+		t.Fatalf("Expected the cached flag to be used, got %+v, %v", result, err)
+	}
+
+	// Once it expires, the flag is read again
+	clock.Advance(services.DefaultPurchaseFallbackCacheTTL)
+	if _, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_cached_3", nil); err == nil {
+		t.Error("Expected the expired flag to be read from Postgres")
+	}
+
+	// A Redis error moves the sale to Postgres even while the cache says it is on Redis
+	mockDB.shouldError = false
+	if result, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_cached_3", nil); err != nil || result.Status != interfaces.PurchaseSuccess {
+		t.Fatalf("Expected a Redis purchase, got %+v, %v", result, err)
+	}
+	mockRedis.SetError(true)
+	result, err := limiter.AttemptPurchase(ctx, 1, "user1", "item1", "CHK_cached_4", nil)
+	if err != nil || result.Status != interfaces.PurchaseSuccess || !result.DatabaseCounted {
+		t.Fatalf("Expected a Postgres purchase after the Redis error, got %+v, %v", result, err)
+	}
+	if fallback, _ := mockDB.GetPurchaseFallback(ctx, 1); !fallback {
+		t.Error("Expected the sale to move to Postgres")
+	}
+}
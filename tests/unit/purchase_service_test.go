@@ -0,0 +1,141 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func TestPurchaseService_RefundReturnsItemToSale(t *testing.T) {
+	ctx := context.Background()
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 10, 2, 5)
+	saleID := mockSaleService.currentSale.ID
+	service := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	addCheckout(mockDB, "CODE1", "user1")
+	if _, err := service.ProcessPurchase(ctx, "CODE1", "user1"); err != nil {
+		t.Fatalf("Failed to purchase: %v", err)
+	}
+
+	purchase, err := service.RefundPurchase(ctx, "CODE1")
+	if err != nil {
+		t.Fatalf("Expected refund to succeed, got: %v", err)
+	}
+	if purchase.Status != models.PurchaseStatusRefunded {
+		t.Errorf("Expected refunded purchase, got status %q", purchase.Status)
+	}
+
+	// Redis gives the unit back to the sale, the item and the user
+	sold, _ := mockRedis.GetSoldItems(ctx, saleID)
+	stock, _ := mockRedis.GetSaleItemStock(ctx, saleID, "item1")
+	userCount, _ := mockRedis.GetUserPurchaseCount(ctx, "user1", saleID)
+	if sold != 0 || stock.Remaining != 5 || userCount != 0 {
+		t.Errorf("Expected Redis counters to be restored, got sold %d, stock %d, user count %d", sold, stock.Remaining, userCount)
+	}
+
+	// Postgres records the refund with the counters
+	sale, _ := mockDB.GetSaleByID(ctx, saleID)
+	items, _ := mockDB.GetSaleItems(ctx, saleID)
+	counts, _ := mockDB.GetPurchaseCounts(ctx, saleID)
+	if sale.ItemsSold != 0 || items[0].Sold != 0 || counts.Total != 0 {
+		t.Errorf("Expected Postgres counters to be restored, got sold %d, item sold %d, completed %d", sale.ItemsSold, items[0].Sold, counts.Total)
+	}
+
+	// A purchase is reversed only once
+	if _, err := service.CancelPurchase(ctx, "CODE1"); !errors.Is(err, services.ErrPurchaseNotCompleted) {
+		t.Errorf("Expected a second reversal to fail with ErrPurchaseNotCompleted, got: %v", err)
+	}
+	if sold, _ := mockRedis.GetSoldItems(ctx, saleID); sold != 0 {
+		t.Errorf("Expected a second reversal to leave counters alone, got sold %d", sold)
+	}
+
+	if _, err := service.RefundPurchase(ctx, "MISSING"); !errors.Is(err, services.ErrPurchaseNotFound) {
+		t.Errorf("Expected ErrPurchaseNotFound, got: %v", err)
+	}
+}
+
+func TestPurchaseService_RefundSucceedsWhenRedisFails(t *testing.T) {
+	ctx := context.Background()
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 10, 2, 5)
+	saleID := mockSaleService.currentSale.ID
+	service := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	addCheckout(mockDB, "CODE1", "user1")
+	if _, err := service.ProcessPurchase(ctx, "CODE1", "user1"); err != nil {
+		t.Fatalf("Failed to purchase: %v", err)
+	}
+
+	mockRedis.SetError(true)
+	if _, err := service.RefundPurchase(ctx, "CODE1"); err != nil {
+		t.Fatalf("Expected refund to succeed while Redis fails, got: %v", err)
+	}
+
+	sale, _ := mockDB.GetSaleByID(ctx, saleID)
+	counts, _ := mockDB.GetPurchaseCounts(ctx, saleID)
+	if sale.ItemsSold != 0 || counts.Total != 0 {
+		t.Errorf("Expected the refund to be committed, got sold %d, completed %d", sale.ItemsSold, counts.Total)
+	}
+
+	// The sale's limits move to Postgres, which has the refund
+	if fallback, _ := mockDB.GetPurchaseFallback(ctx, saleID); !fallback {
+		t.Fatal("Expected the sale's purchase limits to move to Postgres")
+	}
+
+	// Redis is rebuilt from Postgres once it recovers
+	mockRedis.SetError(false)
+	reconciler := services.NewCounterReconciler(mockDB, mockRedis, NewMockClock(time.Now()), "replica-a", time.Second)
+	if restored, err := reconciler.ReconcileSale(ctx, sale); err != nil || !restored {
+		t.Fatalf("Expected the sale to be restored to Redis, got %v, %v", restored, err)
+	}
+
+	sold, _ := mockRedis.GetSoldItems(ctx, saleID)
+	stock, _ := mockRedis.GetSaleItemStock(ctx, saleID, "item1")
+	userCount, _ := mockRedis.GetUserPurchaseCount(ctx, "user1", saleID)
+	if sold != 0 || stock.Remaining != 5 || userCount != 0 {
+		t.Errorf("Expected Redis counters to include the refund, got sold %d, stock %d, user count %d", sold, stock.Remaining, userCount)
+	}
+}
+
+func TestPurchaseService_ProcessesCheckoutCodes(t *testing.T) {
+	ctx := context.Background()
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+
+	issued, err := checkoutService.ProcessCheckout(ctx, "user1", "item1")
+	if err != nil {
+		t.Fatalf("Expected checkout to succeed, got: %v", err)
+	}
+
+	// Only the user who checked out may redeem the code
+	if _, err := purchaseService.ProcessPurchase(ctx, issued.Checkout.Code, "user2"); !errors.Is(err, services.ErrCheckoutUserMismatch) {
+		t.Errorf("Expected ErrCheckoutUserMismatch, got: %v", err)
+	}
+
+	completed, err := purchaseService.ProcessPurchase(ctx, issued.Checkout.Code, "user1")
+	if err != nil {
+		t.Fatalf("Expected purchase to succeed, got: %v", err)
+	}
+	if completed.Purchase.UserID != "user1" || completed.UserPurchases != 1 {
+		t.Errorf("Expected user1's first purchase, got %+v", completed)
+	}
+
+	// A used code is rejected with its purchase status
+	var limitErr *services.LimitError
+	if _, err := purchaseService.ProcessPurchase(ctx, issued.Checkout.Code, "user1"); !errors.As(err, &limitErr) || limitErr.Status != interfaces.PurchaseCodeAlreadyUsed {
+		t.Errorf("Expected a code_already_used LimitError, got: %v", err)
+	}
+
+	if ok, err := purchaseService.CanUserPurchase(ctx, "user1", issued.Checkout.SaleID); err != nil || !ok {
+		t.Errorf("Expected user1 to have one purchase left, got %v, %v", ok, err)
+	}
+
+	// Items outside the sale are rejected at checkout
+	if _, err := checkoutService.ProcessCheckout(ctx, "user1", "item2"); !errors.Is(err, services.ErrUnknownItem) {
+		t.Errorf("Expected ErrUnknownItem, got: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package unit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/interfaces"
+	"flash-sale-backend/internal/services"
+)
+
+func TestParseRateLimitRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    interfaces.RateLimitRule
+		wantErr bool
+	}{
+		{"10/1m", interfaces.RateLimitRule{Limit: 10, Window: time.Minute}, false},
+		{" 5 / 1s ", interfaces.RateLimitRule{Limit: 5, Window: time.Second}, false},
+		{"off", interfaces.RateLimitRule{}, false},
+		{"0", interfaces.RateLimitRule{}, false},
+		{"10", interfaces.RateLimitRule{}, true},
+		{"-1/1m", interfaces.RateLimitRule{}, true},
+		{"10/0s", interfaces.RateLimitRule{}, true},
+		{"ten/1m", interfaces.RateLimitRule{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := services.ParseRateLimitRule(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRateLimitRule(%q) = %+v, %v; want %+v, error %t", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	rule := interfaces.RateLimitRule{Limit: 3, Window: 3 * time.Second}
+
+	for _, redisDown := range []bool{false, true} {
+		mockRedis := NewMockRedis(t)
+		mockRedis.SetError(redisDown)
+		clock := NewMockClock(time.Now())
+		limiter := services.NewRateLimiter(mockRedis, clock, time.Second)
+		ctx := context.Background()
+
+		// A full bucket allows a burst of Limit requests
+		for i := 0; i < 3; i++ {
+			if allowed, _ := limiter.Allow(ctx, "checkout:user:user1", rule); !allowed {
+				t.Fatalf("redis down %t: expected request %d to be allowed", redisDown, i+1)
+			}
+		}
+
+		allowed, retryAfter := limiter.Allow(ctx, "checkout:user:user1", rule)
+		if allowed || retryAfter <= 0 || retryAfter > time.Second {
+			t.Errorf("redis down %t: expected to be limited for up to 1s, got %t %v", redisDown, allowed, retryAfter)
+		}
+
+		// Other keys have their own bucket
+		if allowed, _ := limiter.Allow(ctx, "checkout:user:user2", rule); !allowed {
+			t.Errorf("redis down %t: expected another user to be allowed", redisDown)
+		}
+
+		// One token comes back per Window/Limit
+		clock.Advance(time.Second)
+		if allowed, _ := limiter.Allow(ctx, "checkout:user:user1", rule); !allowed {
+			t.Errorf("redis down %t: expected a refilled token to be allowed", redisDown)
+		}
+		if allowed, _ := limiter.Allow(ctx, "checkout:user:user1", rule); allowed {
+			t.Errorf("redis down %t: expected only one token to be refilled", redisDown)
+		}
+
+		// Disabled rules never limit
+		for i := 0; i < 10; i++ {
+			if allowed, _ := limiter.Allow(ctx, "checkout:user:user1", interfaces.RateLimitRule{}); !allowed {
+				t.Fatalf("redis down %t: expected a disabled rule to allow every request", redisDown)
+			}
+		}
+	}
+}
+
+func TestRateLimiter_FallsBackWhileRedisFails(t *testing.T) {
+	mockRedis := NewMockRedis(t)
+	limiter := services.NewRateLimiter(mockRedis, NewMockClock(time.Now()), time.Second)
+	rule := interfaces.RateLimitRule{Limit: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "purchase:ip:10.0.0.1", rule)
+	limiter.Allow(ctx, "purchase:ip:10.0.0.1", rule)
+
+	// The in-process bucket starts full, so the limit applies per instance while Redis is down
+	mockRedis.SetError(true)
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow(ctx, "purchase:ip:10.0.0.1", rule); !allowed {
+			t.Fatalf("Expected request %d to be allowed by the in-process bucket", i+1)
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "purchase:ip:10.0.0.1", rule); allowed {
+		t.Error("Expected the in-process bucket to enforce the limit")
+	}
+
+	// Redis is skipped until a health check finds it back
+	mockRedis.SetError(false)
+	if allowed, _ := limiter.Allow(ctx, "purchase:ip:10.0.0.2", rule); !allowed || !limiter.Degraded() {
+		t.Error("Expected the in-process bucket to be used until the next health check")
+	}
+	if mockRedis.server.Exists("purchase:ip:10.0.0.2") {
+		t.Error("Expected Redis to be skipped after it failed")
+	}
+
+	// Once Redis is back its bucket applies again
+	if !limiter.CheckHealth(ctx) {
+		t.Fatal("Expected the health check to find Redis back")
+	}
+	if allowed, _ := limiter.Allow(ctx, "purchase:ip:10.0.0.1", rule); allowed {
+		t.Error("Expected the Redis bucket to still be empty")
+	}
+}
+
+func TestRateLimitMiddleware_LimitsPerIPAndUser(t *testing.T) {
+	limiter := services.NewRateLimiter(NewMockRedis(t), NewMockClock(time.Now()), time.Second)
+	middleware := handlers.NewRateLimitMiddleware(limiter)
+
+	var seenBody string
+	next := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seenBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}
+	handler := middleware.Limit("checkout", handlers.RateLimits{
+		PerIP:   interfaces.RateLimitRule{Limit: 3, Window: time.Minute},
+		PerUser: interfaces.RateLimitRule{Limit: 1, Window: time.Minute},
+	}, next)
+
+	send := func(ip, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.RemoteAddr = ip + ":12345"
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	// Per user, from the query string or the JSON body, which still reaches the handler
+	if w := send("10.0.0.1", "/checkout?user_id=user1&item_id=item1", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first request to pass, got: %d", w.Code)
+	}
+
+	body := `{"user_id":"user1","item_id":"item1"}`
+	w := send("10.0.0.2", "/checkout", body)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected user1 to be limited, got: %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" || !strings.Contains(w.Body.String(), handlers.ErrorCodeRateLimited) {
+		t.Errorf("Expected Retry-After and a rate_limited error, got %v %s", w.Header(), w.Body.String())
+	}
+
+	if w := send("10.0.0.2", "/checkout", `{"user_id":"user2","item_id":"item1"}`); w.Code != http.StatusOK || seenBody != `{"user_id":"user2","item_id":"item1"}` {
+		t.Errorf("Expected user2 to pass with its body intact, got %d %q", w.Code, seenBody)
+	}
+
+	// Per IP, across users
+	send("10.0.0.3", "/checkout?user_id=user3", "")
+	send("10.0.0.3", "/checkout?user_id=user4", "")
+	send("10.0.0.3", "/checkout?user_id=user5", "")
+	if w := send("10.0.0.3", "/checkout?user_id=user6", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP to be limited, got: %d", w.Code)
+	}
+}
+
+func TestRateLimitMiddleware_TrustedProxyAndTokens(t *testing.T) {
+	limiter := services.NewRateLimiter(NewMockRedis(t), NewMockClock(time.Now()), time.Second)
+	auth, _ := services.NewHMACAuthenticator(testTokenSecret, "", "", NewMockClock(time.Now()))
+	middleware := handlers.NewRateLimitMiddleware(limiter)
+	middleware.SetAuthenticator(auth)
+	middleware.SetTrustProxy(true)
+
+	handler := middleware.Limit("purchase", handlers.RateLimits{
+		PerIP:   interfaces.RateLimitRule{Limit: 1, Window: time.Minute},
+		PerUser: interfaces.RateLimitRule{Limit: 1, Window: time.Minute},
+	}, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	send := func(forwardedFor, userID string) int {
+		req := httptest.NewRequest("POST", "/purchase?user_id=ignored", nil)
+		req.RemoteAddr = "192.168.1.1:443"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("Authorization", "Bearer "+userToken(t, userID))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// Clients behind the proxy are limited separately, by the address the proxy saw
+	if send("spoofed, 203.0.113.1", "user1") != http.StatusOK || send("203.0.113.2", "user2") != http.StatusOK {
+		t.Fatal("Expected different clients behind the proxy to pass")
+	}
+	if code := send("spoofed, 203.0.113.1", "user3"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the forwarded IP to be limited, got: %d", code)
+	}
+
+	// The per-user limit follows the token, not the user_id parameter
+	if code := send("203.0.113.3", "user1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the token's user to be limited, got: %d", code)
+	}
+}
@@ -3,10 +3,12 @@ package unit
 import (
 	"context"
 	"testing"
+
+	"flash-sale-backend/internal/interfaces"
 )
 
 func TestRedis_AtomicPurchase_Success(t *testing.T) {
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	ctx := context.Background()
 
 	// Test successful purchase
@@ -19,7 +21,7 @@ func TestRedis_AtomicPurchase_Success(t *testing.T) {
 		t.Error("Expected successful purchase")
 	}
 
-	if status != "success" {
+	if status != interfaces.PurchaseSuccess {
 		t.Errorf("Expected status 'success', got: %s", status)
 	}
 
@@ -33,7 +35,7 @@ func TestRedis_AtomicPurchase_Success(t *testing.T) {
 }
 
 func TestRedis_AtomicPurchase_UserLimit(t *testing.T) {
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	ctx := context.Background()
 
 	// Purchase 10 items (user limit)
@@ -57,7 +59,7 @@ func TestRedis_AtomicPurchase_UserLimit(t *testing.T) {
 		t.Error("Expected purchase to fail due to user limit")
 	}
 
-	if status != "user_limit_exceeded" {
+	if status != interfaces.PurchaseUserLimitExceeded {
 		t.Errorf("Expected status 'user_limit_exceeded', got: %s", status)
 	}
 
@@ -67,7 +69,7 @@ func TestRedis_AtomicPurchase_UserLimit(t *testing.T) {
 }
 
 func TestRedis_AtomicPurchase_SoldOut(t *testing.T) {
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	ctx := context.Background()
 
 	// Purchase all available items (limit = 5 for this test)
@@ -92,8 +94,8 @@ func TestRedis_AtomicPurchase_SoldOut(t *testing.T) {
 		t.Error("Expected purchase to fail due to sold out")
 	}
 
-	if status != "sold_out" {
-		t.Errorf("Expected status 'sold_out', got: %s", status)
+	if status != interfaces.PurchaseSaleSoldOut {
+		t.Errorf("Expected status 'sale_sold_out', got: %s", status)
 	}
 
 	if totalSold != 5 {
@@ -102,7 +104,7 @@ func TestRedis_AtomicPurchase_SoldOut(t *testing.T) {
 }
 
 func TestRedis_ConcurrentPurchases(t *testing.T) {
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	ctx := context.Background()
 
 	numGoroutines := 100
@@ -0,0 +1,138 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/handlers"
+	"flash-sale-backend/internal/services"
+)
+
+// checkout requests a checkout code for item1 and returns the status code and response
+func checkout(handler *handlers.CheckoutHandler, userID string) (int, handlers.CheckoutResponse) {
+	req := httptest.NewRequest("POST", "/checkout?user_id="+userID+"&item_id=item1", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleCheckout(w, req)
+
+	var response handlers.CheckoutResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestCheckoutReservations_HoldStockUntilPurchase(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutHandler, purchaseHandler := handlers.NewCheckoutHandler(checkoutService), handlers.NewPurchaseHandler(purchaseService)
+	ctx := context.Background()
+
+	status, first := checkout(checkoutHandler, "user1")
+	if status != http.StatusOK || !first.Reserved {
+		t.Fatalf("Expected a reserved checkout, got %d %+v", status, first)
+	}
+	checkout(checkoutHandler, "user1")
+
+	// Reservations count against the user limit and the sale's stock
+	if status, response := checkout(checkoutHandler, "user1"); status != http.StatusConflict || response.ErrorCode != "user_limit_exceeded" {
+		t.Errorf("Expected user limit to include reservations, got %d %+v", status, response)
+	}
+
+	if status, _ := checkout(checkoutHandler, "user2"); status != http.StatusOK {
+		t.Errorf("Expected last unit to be reserved, got status: %d", status)
+	}
+
+	if status, _ := checkout(checkoutHandler, "user3"); status != http.StatusConflict {
+		t.Errorf("Expected sold out once every unit is reserved, got status: %d", status)
+	}
+
+	// Purchasing converts the reservation without taking another unit
+	if status, errorCode := purchase(purchaseHandler, first.CheckoutCode); status != http.StatusOK {
+		t.Fatalf("Expected reserved purchase to succeed, got %d %q", status, errorCode)
+	}
+
+	if reserved, _ := mockRedis.GetReservedItems(ctx, 1); reserved != 2 {
+		t.Errorf("Expected 2 units still reserved, got: %d", reserved)
+	}
+
+	if sold, _ := mockRedis.GetSoldItems(ctx, 1); sold != 1 {
+		t.Errorf("Expected 1 sold, got: %d", sold)
+	}
+
+	if stock, _ := mockRedis.GetSaleItemStock(ctx, 1, "item1"); stock.Remaining != 0 {
+		t.Errorf("Expected no unreserved stock of item1, got: %d", stock.Remaining)
+	}
+}
+
+func TestReservationSweeper_ReleasesExpiredReservations(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	purchaseService := services.NewPurchaseService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutHandler, purchaseHandler := handlers.NewCheckoutHandler(checkoutService), handlers.NewPurchaseHandler(purchaseService)
+	ctx := context.Background()
+
+	codes := make([]string, 0, 3)
+	for _, userID := range []string{"user1", "user2", "user3"} {
+		_, response := checkout(checkoutHandler, userID)
+		codes = append(codes, response.CheckoutCode)
+	}
+
+	// Unreserved purchases cannot take held units
+	addCheckout(mockDB, "CHK_unreserved", "user4")
+	if status, _ := purchase(purchaseHandler, "CHK_unreserved"); status != http.StatusConflict {
+		t.Errorf("Expected unreserved purchase to be refused, got status: %d", status)
+	}
+
+	// Nothing is released before the codes expire
+	clock := NewMockClock(time.Now())
+	sweeper := services.NewReservationSweeper(mockDB, mockRedis, clock, time.Second)
+	if released, err := sweeper.Sweep(ctx); err != nil || released != 0 {
+		t.Fatalf("Expected no reservations released yet, got %d, %v", released, err)
+	}
+
+	purchase(purchaseHandler, codes[0])
+
+	clock.Advance(11 * time.Minute)
+	if released, err := sweeper.Sweep(ctx); err != nil || released != 2 {
+		t.Fatalf("Expected 2 expired reservations released, got %d, %v", released, err)
+	}
+
+	if reserved, _ := mockRedis.GetReservedItems(ctx, 1); reserved != 0 {
+		t.Errorf("Expected no units reserved after sweep, got: %d", reserved)
+	}
+
+	if stock, _ := mockRedis.GetSaleItemStock(ctx, 1, "item1"); stock.Remaining != 2 {
+		t.Errorf("Expected 2 units of item1 back in stock, got: %d", stock.Remaining)
+	}
+
+	// Released units can be bought again
+	if status, errorCode := purchase(purchaseHandler, "CHK_unreserved"); status != http.StatusOK {
+		t.Errorf("Expected purchase of a released unit to succeed, got %d %q", status, errorCode)
+	}
+}
+
+func TestCheckoutReservations_InactiveAndRebuildingSale(t *testing.T) {
+	mockSaleService, mockItemService, mockDB, mockRedis := newMockSale(t, 3, 2, 3)
+	checkoutService := services.NewCheckoutService(mockSaleService, mockItemService, mockDB, mockRedis)
+	checkoutService.SetReservations(true)
+	checkoutHandler := handlers.NewCheckoutHandler(checkoutService)
+
+	// A sale that was never set up in Redis is not active
+	mockRedis.server.Del("sale:1:available")
+	if status, response := checkout(checkoutHandler, "user1"); status != http.StatusBadRequest || response.ErrorCode != "sale_not_active" {
+		t.Errorf("Expected 400 for an inactive sale, got %d %+v", status, response)
+	}
+
+	// Lost counters are restored, so the client should retry
+	mockRedis.server.Set("sale:1:available", "3")
+	mockRedis.server.Del("sale:1:sold")
+	if status, response := checkout(checkoutHandler, "user1"); status != http.StatusServiceUnavailable || response.ErrorCode != "sale_rebuilding" {
+		t.Errorf("Expected 503 while the counters are rebuilt, got %d %+v", status, response)
+	}
+}
@@ -0,0 +1,231 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"flash-sale-backend/internal/models"
+	"flash-sale-backend/internal/services"
+)
+
+func windowsByStatus(windows []models.SaleWindow, status string) []models.SaleWindow {
+	var matched []models.SaleWindow
+	for _, window := range windows {
+		if window.Status == status {
+			matched = append(matched, window)
+		}
+	}
+	return matched
+}
+
+func TestSaleScheduler_TransitionsExactlyAtBoundaries(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	saleService := services.NewSaleService(mockDB, mockRedis)
+
+	// Start mid-hour: the current hour's window is picked up late
+	clock := NewMockClock(time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC))
+	rule := services.ScheduleRule{Interval: time.Hour, Horizon: 3 * time.Hour}
+	scheduler := services.NewSaleScheduler(saleService, mockDB, clock, rule)
+	ctx := context.Background()
+
+	next, err := scheduler.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	boundary := time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)
+	if !next.Equal(boundary) {
+		t.Errorf("Expected next transition at %v, got %v", boundary, next)
+	}
+
+	active, _ := mockDB.GetActiveSale(ctx)
+	if active == nil || !active.StartTime.Equal(boundary.Add(-time.Hour)) || !active.EndTime.Equal(boundary) {
+		t.Fatalf("Expected the 10:00-11:00 sale to be active, got %+v", active)
+	}
+	firstSaleID := active.ID
+
+	windows := mockDB.SaleWindows()
+	if len(windows) != 4 {
+		t.Errorf("Expected windows through the 3h horizon (4), got %d", len(windows))
+	}
+
+	// Just before the boundary nothing changes
+	clock.Set(boundary.Add(-time.Millisecond))
+	if next, _ = scheduler.Reconcile(ctx); !next.Equal(boundary) {
+		t.Errorf("Expected next transition at %v, got %v", boundary, next)
+	}
+	if active, _ = mockDB.GetActiveSale(ctx); active == nil || active.ID != firstSaleID {
+		t.Errorf("Expected sale %d to still be active before the boundary", firstSaleID)
+	}
+
+	// At the boundary the sales roll over
+	clock.Set(boundary)
+	if next, _ = scheduler.Reconcile(ctx); !next.Equal(boundary.Add(time.Hour)) {
+		t.Errorf("Expected next transition at %v, got %v", boundary.Add(time.Hour), next)
+	}
+
+	active, _ = mockDB.GetActiveSale(ctx)
+	if active == nil || active.ID == firstSaleID || !active.StartTime.Equal(boundary) {
+		t.Fatalf("Expected the 11:00-12:00 sale to be active, got %+v", active)
+	}
+
+	if first, _ := mockDB.GetSaleByID(ctx, firstSaleID); first.Active {
+		t.Error("Expected the previous sale to be deactivated")
+	}
+
+	windows = mockDB.SaleWindows()
+	if completed := windowsByStatus(windows, models.SaleWindowCompleted); len(completed) != 1 || completed[0].SaleID != firstSaleID {
+		t.Errorf("Expected the first window to be completed, got %+v", completed)
+	}
+	if running := windowsByStatus(windows, models.SaleWindowActive); len(running) != 1 || running[0].SaleID != active.ID {
+		t.Errorf("Expected exactly one active window for sale %d, got %+v", active.ID, running)
+	}
+
+	// Re-materializing the horizon does not duplicate windows
+	if len(windows) != 4 {
+		t.Errorf("Expected 4 windows within the horizon, got %d", len(windows))
+	}
+}
+
+func TestSaleScheduler_RecoversMissedTransitionsAfterRestart(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	ctx := context.Background()
+
+	// Explicit windows only
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewMockClock(base)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, clock, services.ScheduleRule{})
+
+	for _, window := range []*models.SaleWindow{
+		{StartTime: base, EndTime: base.Add(30 * time.Minute)},                        // runs, then ends while down
+		{StartTime: base.Add(45 * time.Minute), EndTime: base.Add(time.Hour)},         // never started
+		{StartTime: base.Add(90 * time.Minute), EndTime: base.Add(150 * time.Minute)}, // in progress at restart
+		{StartTime: base.Add(3 * time.Hour), EndTime: base.Add(4 * time.Hour)},        // future
+	} {
+		if _, err := scheduler.ScheduleWindow(ctx, window); err != nil {
+			t.Fatalf("Failed to schedule window: %v", err)
+		}
+	}
+
+	if _, err := scheduler.Reconcile(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	first, _ := mockDB.GetActiveSale(ctx)
+	if first == nil {
+		t.Fatal("Expected the first window's sale to be active")
+	}
+
+	// The process is down until 09:40; a fresh scheduler picks up where it left off
+	clock.Set(base.Add(100 * time.Minute))
+	restarted := services.NewSaleScheduler(saleService, mockDB, clock, services.ScheduleRule{})
+	next, err := restarted.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !next.Equal(base.Add(150 * time.Minute)) {
+		t.Errorf("Expected next transition at the running window's end, got %v", next)
+	}
+
+	windows := mockDB.SaleWindows()
+	expected := []string{
+		models.SaleWindowCompleted,
+		models.SaleWindowMissed,
+		models.SaleWindowActive,
+		models.SaleWindowPending,
+	}
+	for i, status := range expected {
+		if windows[i].Status != status {
+			t.Errorf("Window %d: expected status %s, got %s", i+1, status, windows[i].Status)
+		}
+	}
+
+	if sale, _ := mockDB.GetSaleByID(ctx, first.ID); sale.Active {
+		t.Error("Expected the ended sale to be deactivated after restart")
+	}
+
+	active, _ := mockDB.GetActiveSale(ctx)
+	if active == nil || active.ID != windows[2].SaleID || !active.StartTime.Equal(windows[2].StartTime) {
+		t.Errorf("Expected the in-progress window's sale to be active, got %+v", active)
+	}
+}
+
+func TestSaleScheduler_WindowLimitsOverrideDefaults(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	ctx := context.Background()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewMockClock(now)
+	scheduler := services.NewSaleScheduler(saleService, mockDB, clock, services.ScheduleRule{})
+
+	window := &models.SaleWindow{StartTime: now, EndTime: now.Add(10 * time.Minute), ItemsAvailable: 5, MaxPerUser: 1}
+	if created, err := scheduler.ScheduleWindow(ctx, window); err != nil || !created {
+		t.Fatalf("Expected window to be scheduled, got %t, %v", created, err)
+	}
+
+	// Scheduling the same window twice is a no-op
+	duplicate := &models.SaleWindow{StartTime: now, EndTime: now.Add(10 * time.Minute)}
+	if created, err := scheduler.ScheduleWindow(ctx, duplicate); err != nil || created {
+		t.Errorf("Expected duplicate window to be ignored, got %t, %v", created, err)
+	}
+
+	// Windows that are already over are rejected
+	past := &models.SaleWindow{StartTime: now.Add(-time.Hour), EndTime: now.Add(-time.Minute)}
+	if _, err := scheduler.ScheduleWindow(ctx, past); err == nil {
+		t.Error("Expected error for a window that already ended")
+	}
+
+	if _, err := scheduler.Reconcile(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	active, _ := mockDB.GetActiveSale(ctx)
+	if active == nil || active.ItemsAvailable != 5 || active.MaxPerUser != 1 {
+		t.Errorf("Expected sale with window limits 5/1, got %+v", active)
+	}
+}
+
+func TestBackgroundSaleManager_WakesAtBoundary(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := NewMockClock(time.Date(2025, 1, 1, 10, 59, 59, 0, time.UTC))
+	rule := services.ScheduleRule{Interval: time.Hour, Horizon: 2 * time.Hour}
+	manager := services.NewBackgroundSaleManager(services.NewSaleScheduler(saleService, mockDB, clock, rule), nil)
+	go manager.Start(ctx)
+	defer manager.Stop()
+
+	boundary := time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)
+	waitFor(t, "manager to sleep until the boundary", func() bool {
+		deadline, ok := clock.NextDeadline()
+		return ok && deadline.Equal(boundary)
+	})
+
+	clock.Set(boundary)
+	waitFor(t, "11:00 sale to become active", func() bool {
+		active, _ := mockDB.GetActiveSale(ctx)
+		return active != nil && active.StartTime.Equal(boundary)
+	})
+}
+
+// waitFor polls condition until it holds or the test times out
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", description)
+}
@@ -2,16 +2,18 @@ package unit
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"flash-sale-backend/internal/interfaces"
 	"flash-sale-backend/internal/models"
 	"flash-sale-backend/internal/services"
 )
 
 func TestSaleService_CreateHourlySale(t *testing.T) {
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	saleService := services.NewSaleService(mockDB, mockRedis)
 
 	ctx := context.Background()
@@ -48,7 +50,7 @@ func TestSaleService_CreateHourlySale(t *testing.T) {
 
 func TestSaleService_GetCurrentActiveSale(t *testing.T) {
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	saleService := services.NewSaleService(mockDB, mockRedis)
 
 	ctx := context.Background()
@@ -84,12 +86,21 @@ func TestSaleService_GetCurrentActiveSale(t *testing.T) {
 	if sale.ID != 1 {
 		t.Errorf("Expected sale ID 1, got: %d", sale.ID)
 	}
+
+	// A Redis count ahead of Postgres must not overwrite items_sold, which the purchases keep
+	mockRedis.server.Set("sale:1:sold", "500")
+	if _, err := saleService.GetCurrentActiveSale(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if mockDB.sales[1].ItemsSold != 100 {
+		t.Errorf("Expected items_sold to stay 100, got: %d", mockDB.sales[1].ItemsSold)
+	}
 }
 
 func TestSaleService_ErrorHandling(t *testing.T) {
 	mockDB := NewMockDatabase()
 	mockDB.shouldError = true
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	saleService := services.NewSaleService(mockDB, mockRedis)
 
 	ctx := context.Background()
@@ -108,7 +119,7 @@ func TestSaleService_ErrorHandling(t *testing.T) {
 
 func TestSaleService_ConcurrentSaleCreation(t *testing.T) {
 	mockDB := NewMockDatabase()
-	mockRedis := NewMockRedis()
+	mockRedis := NewMockRedis(t)
 	saleService := services.NewSaleService(mockDB, mockRedis)
 
 	ctx := context.Background()
@@ -135,4 +146,116 @@ func TestSaleService_ConcurrentSaleCreation(t *testing.T) {
 	if len(mockDB.sales) != numGoroutines {
 		t.Errorf("Expected %d sales created, got: %d", numGoroutines, len(mockDB.sales))
 	}
-} 
\ No newline at end of file
+} 
+
+func TestSaleService_CustomLimits(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	saleService := services.NewSaleService(mockDB, mockRedis)
+
+	if err := saleService.SetDefaultLimits(0, 5); err == nil {
+		t.Error("Expected error for non-positive items available, got nil")
+	}
+
+	if err := saleService.SetDefaultLimits(500, 3); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	ctx := context.Background()
+	sale, err := saleService.CreateHourlySale(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if sale.ItemsAvailable != 500 {
+		t.Errorf("Expected 500 items available, got: %d", sale.ItemsAvailable)
+	}
+
+	if sale.MaxPerUser != 3 {
+		t.Errorf("Expected max 3 per user, got: %d", sale.MaxPerUser)
+	}
+
+	// The limits must reach Redis so the purchase script enforces them
+	for i := 0; i < 3; i++ {
+		result, err := mockRedis.AttemptPurchase(ctx, sale.ID, "user1", "item1", fmt.Sprintf("code%d", i), nil)
+		if err != nil || result.Status != interfaces.PurchaseSuccess {
+			t.Fatalf("Expected purchase %d to succeed, got: %v, %v", i+1, result, err)
+		}
+	}
+
+	result, err := mockRedis.AttemptPurchase(ctx, sale.ID, "user1", "item1", "code3", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if result.Status != interfaces.PurchaseUserLimitExceeded {
+		t.Errorf("Expected status 'user_limit_exceeded', got: %s", result.Status)
+	}
+}
+
+func TestSaleService_AllocateEvenly(t *testing.T) {
+	items := services.AllocateEvenly([]string{"item1", "item2", "item3"}, 10)
+	if len(items) != 3 || items[0].Stock != 4 || items[1].Stock != 3 || items[2].Stock != 3 {
+		t.Errorf("Expected stock 4/3/3, got %+v", items)
+	}
+
+	// Items that would get no stock are left out rather than allocated zero units
+	items = services.AllocateEvenly([]string{"item1", "item2", "item3"}, 2)
+	if len(items) != 2 || items[0].ItemID != "item1" || items[1].ItemID != "item2" {
+		t.Errorf("Expected only item1 and item2 allocated, got %+v", items)
+	}
+	for _, item := range items {
+		if item.Stock != 1 {
+			t.Errorf("Expected one unit for %s, got %d", item.ItemID, item.Stock)
+		}
+	}
+
+	if items = services.AllocateEvenly([]string{"item1"}, 0); len(items) != 0 {
+		t.Errorf("Expected no allocations without stock, got %+v", items)
+	}
+}
+
+func TestSaleService_ServesActiveSaleFromMemory(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockRedis := NewMockRedis(t)
+	saleService := services.NewSaleService(mockDB, mockRedis)
+	saleService.SetActiveSaleCacheTTL(time.Minute)
+
+	ctx := context.Background()
+	mockDB.sales[1] = &models.Sale{
+		ID:             1,
+		StartTime:      time.Now().Add(-time.Minute),
+		EndTime:        time.Now().Add(time.Hour),
+		ItemsAvailable: 10000,
+		MaxPerUser:     10,
+		Active:         true,
+	}
+	mockRedis.SetActiveSaleID(ctx, 1)
+
+	if sale, err := saleService.GetCurrentActiveSale(ctx); err != nil || sale == nil || sale.ID != 1 {
+		t.Fatalf("Expected sale 1, got %+v, %v", sale, err)
+	}
+
+	// Later requests do not need Postgres while Redis still names the sale
+	mockDB.shouldError = true
+	sale, err := saleService.GetCurrentActiveSale(ctx)
+	if err != nil || sale == nil || sale.ID != 1 {
+		t.Fatalf("Expected sale 1 from memory, got %+v, %v", sale, err)
+	}
+
+	// Callers get their own copy
+	sale.MaxPerUser = 1
+	if cached, _ := saleService.GetCurrentActiveSale(ctx); cached.MaxPerUser != 10 {
+		t.Errorf("Expected the cached sale to be unchanged, got max per user %d", cached.MaxPerUser)
+	}
+
+	// A sale changed by this replica is reloaded
+	mockDB.shouldError = false
+	if err := saleService.DeactivateSale(ctx, 1); err != nil {
+		t.Fatalf("Failed to deactivate sale: %v", err)
+	}
+	mockDB.shouldError = true
+	if _, err := saleService.GetCurrentActiveSale(ctx); err == nil {
+		t.Error("Expected the deactivated sale to be reloaded from Postgres")
+	}
+}